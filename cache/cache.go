@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/wptide/pkg/message"
+	"github.com/wptide/pkg/tide"
+)
+
+// Provider stores the results of completed audits by project checksum and audit configuration,
+// so that code that was already audited doesn't get audited again. The results are stored as
+// encoded by EncodeResults.
+type Provider interface {
+	// GetResults returns the stored results, or false if there are none.
+	GetResults(checksum, config string) ([]byte, bool, error)
+	// SetResults stores the results of a completed audit.
+	SetResults(checksum, config string, results []byte) error
+}
+
+// Results are the results of the audits of a project. They don't include anything of the message
+// that asked for them, e.g. its visibility or client, so that they can be replayed for any message.
+type Results struct {
+	Info   *tide.CodeInfo              `json:"info,omitempty"`
+	Audits map[string]tide.AuditResult `json:"audits"`
+}
+
+// EncodeResults encodes the results for a Provider.
+func EncodeResults(r Results) ([]byte, error) {
+	return json.Marshal(r)
+}
+
+// DecodeResults decodes the results stored by a Provider.
+func DecodeResults(data []byte) (Results, error) {
+	var r Results
+	err := json.Unmarshal(data, &r)
+	return r, err
+}
+
+// Entry describes stored results, the Results are encoded by EncodeResults.
+type Entry struct {
+	Checksum string `json:"checksum" firestore:"checksum"`
+	Config   string `json:"config" firestore:"config"`
+	Results  string `json:"results" firestore:"results"`
+	Created  int64  `json:"created" firestore:"created"`
+}
+
+// Pipeline describes how a pipeline runs the audits, e.g. the versions of the audit tools.
+// Results of another configuration aren't replayed, so that upgrading a tool audits the code again.
+type Pipeline struct {
+	Tools         map[string]string            `json:"tools,omitempty"`          // Versions of the audit tools, e.g. "phpcs": "3.3.0".
+	PhpcsVersions map[string]map[string]string `json:"phpcs_versions,omitempty"` // PHPCS versions for every standard.
+}
+
+// ConfigKey returns a key for the audit configuration of a message and the pipeline that runs the audits.
+//
+// Messages requesting the same audits with the same options and the same payload type
+// have the same key, as long as the pipeline doesn't change.
+func ConfigKey(msg message.Message, pipeline Pipeline) string {
+
+	// Response falls back to the "tide" payload.
+	payloadType := msg.PayloadType
+	if payloadType == "" {
+		payloadType = "tide"
+	}
+
+	config, _ := json.Marshal(struct {
+		PayloadType string           `json:"payload_type"`
+		Audits      []*message.Audit `json:"audits"`
+		Standards   []string         `json:"standards"`
+		Pipeline    Pipeline         `json:"pipeline"`
+	}{
+		payloadType,
+		msg.Audits,
+		msg.Standards,
+		pipeline,
+	})
+
+	return fmt.Sprintf("%x", sha256.Sum256(config))
+}
@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/wptide/pkg/message"
+)
+
+func TestConfigKey(t *testing.T) {
+
+	audits := []*message.Audit{
+		{
+			Type: "phpcs",
+			Options: &message.AuditOption{
+				Standard: "wordpress",
+			},
+		},
+	}
+
+	pipeline := Pipeline{
+		Tools: map[string]string{"phpcs": "3.3.0"},
+		PhpcsVersions: map[string]map[string]string{
+			"phpcompatibility": {"7.0": "7.0"},
+		},
+	}
+
+	base := ConfigKey(message.Message{
+		Title:       "Plugin One",
+		PayloadType: "tide",
+		Audits:      audits,
+	}, pipeline)
+
+	tests := []struct {
+		name     string
+		msg      message.Message
+		pipeline Pipeline
+		wantSame bool
+	}{
+		{
+			"Different Project",
+			message.Message{
+				Title:       "Plugin Two",
+				SourceURL:   "http://test.local/plugin-two.zip",
+				PayloadType: "tide",
+				Audits:      audits,
+			},
+			pipeline,
+			true,
+		},
+		{
+			"Default Payload Type",
+			message.Message{
+				Audits: audits,
+			},
+			pipeline,
+			true,
+		},
+		{
+			"Different Payload Type",
+			message.Message{
+				PayloadType: "local",
+				Audits:      audits,
+			},
+			pipeline,
+			false,
+		},
+		{
+			"Different Audit Options",
+			message.Message{
+				PayloadType: "tide",
+				Audits: []*message.Audit{
+					{
+						Type: "phpcs",
+						Options: &message.AuditOption{
+							Standard: "phpcompatibility",
+						},
+					},
+				},
+			},
+			pipeline,
+			false,
+		},
+		{
+			"Different Audits",
+			message.Message{
+				PayloadType: "tide",
+				Audits: append(audits, &message.Audit{
+					Type: "lighthouse",
+				}),
+			},
+			pipeline,
+			false,
+		},
+		{
+			"Different Tool Versions",
+			message.Message{
+				PayloadType: "tide",
+				Audits:      audits,
+			},
+			Pipeline{
+				Tools:         map[string]string{"phpcs": "3.4.0"},
+				PhpcsVersions: pipeline.PhpcsVersions,
+			},
+			false,
+		},
+		{
+			"Different PHPCS Versions",
+			message.Message{
+				PayloadType: "tide",
+				Audits:      audits,
+			},
+			Pipeline{
+				Tools: pipeline.Tools,
+				PhpcsVersions: map[string]map[string]string{
+					"phpcompatibility": {"7.0": "7.0", "7.2": "7.2"},
+				},
+			},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ConfigKey(tt.msg, tt.pipeline); (got == base) != tt.wantSame {
+				t.Errorf("ConfigKey() = %v, base %v, wantSame %v", got, base, tt.wantSame)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package firestore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/wptide/pkg/cache"
+	fsClient "github.com/wptide/pkg/wrapper/firestore"
+)
+
+// Provider stores audit results as Firestore documents.
+type Provider struct {
+	ctx      context.Context
+	client   fsClient.ClientInterface
+	rootPath string
+}
+
+// GetResults returns the stored results, or false if there are none.
+func (fs Provider) GetResults(checksum, config string) ([]byte, bool, error) {
+	data := fs.client.GetDoc(fs.key(checksum, config))
+	if data == nil {
+		return nil, false, nil
+	}
+
+	entry, err := itoe(data)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return []byte(entry.Results), true, nil
+}
+
+// SetResults stores the results of a completed audit.
+func (fs Provider) SetResults(checksum, config string, results []byte) error {
+	data, err := etoi(cache.Entry{
+		Checksum: checksum,
+		Config:   config,
+		Results:  string(results),
+		Created:  time.Now().UnixNano(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return fs.client.SetDoc(fs.key(checksum, config), data)
+}
+
+func (fs Provider) key(checksum, config string) string {
+	return fmt.Sprintf("%s/%s-%s", fs.rootPath, checksum, config)
+}
+
+// itoe converts a Firestore Document into a cache.Entry.
+func itoe(data map[string]interface{}) (cache.Entry, error) {
+	var entry cache.Entry
+	var cErr error
+	if temp, err := json.Marshal(data); err == nil {
+		cErr = json.Unmarshal(temp, &entry)
+	}
+	return entry, cErr
+}
+
+// etoi converts a cache.Entry into an interface map for Firestore.
+func etoi(entry cache.Entry) (map[string]interface{}, error) {
+	var data map[string]interface{}
+	var cErr error
+	if temp, err := json.Marshal(entry); err == nil {
+		cErr = json.Unmarshal(temp, &data)
+	}
+
+	// Keep the timestamp an integer.
+	if data != nil {
+		data["created"] = entry.Created
+	}
+	return data, cErr
+}
+
+// New creates a new Provider with a default client using Firestore.
+func New(ctx context.Context, projectID string, rootDocPath string) (*Provider, error) {
+
+	fireClient, _ := firestore.NewClient(ctx, projectID)
+	client := fsClient.Client{
+		Firestore: fireClient,
+		Ctx:       ctx,
+	}
+
+	return NewWithClient(ctx, projectID, rootDocPath, client)
+}
+
+// NewWithClient creates a new Provider with a provided ClientInterface client.
+// Note: Use this one for the tests with a mock ClientInterface.
+func NewWithClient(ctx context.Context, projectID string, rootDocPath string, client fsClient.ClientInterface) (*Provider, error) {
+	if client == nil || !client.Authenticated() {
+		return nil, errors.New("firestore: could not authenticate cache client")
+	}
+
+	return &Provider{
+		ctx:      ctx,
+		client:   client,
+		rootPath: rootDocPath,
+	}, nil
+}
@@ -0,0 +1,161 @@
+package firestore
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	fsClient "github.com/wptide/pkg/wrapper/firestore"
+)
+
+type mockClient struct {
+	authenticated bool
+	docs          map[string]map[string]interface{}
+}
+
+func (m mockClient) GetDoc(path string) map[string]interface{} {
+	return m.docs[path]
+}
+
+func (m mockClient) SetDoc(path string, data map[string]interface{}) error {
+	if path == "test/set-error-config" {
+		return errors.New("something went wrong")
+	}
+	m.docs[path] = data
+	return nil
+}
+
+func (m mockClient) AddDoc(collection string, data interface{}) error {
+	return nil
+}
+
+func (m mockClient) DeleteDoc(path string) error {
+	return nil
+}
+
+func (m mockClient) Close() error {
+	return nil
+}
+
+func (m mockClient) Authenticated() bool {
+	return m.authenticated
+}
+
+func (m mockClient) QueryItems(collection string, conditions []fsClient.Condition, ordering []fsClient.Order, limit int, updateFunc fsClient.UpdateFunc) ([]interface{}, error) {
+	return nil, nil
+}
+
+func TestProvider(t *testing.T) {
+	tests := []struct {
+		name      string
+		docs      map[string]map[string]interface{}
+		checksum  string
+		results   []byte
+		want      []byte
+		wantFound bool
+		wantErr   bool
+	}{
+		{
+			"Stored Results",
+			map[string]map[string]interface{}{},
+			"abc123",
+			[]byte(`{"title":"Plugin One"}`),
+			[]byte(`{"title":"Plugin One"}`),
+			true,
+			false,
+		},
+		{
+			"Missing Results",
+			map[string]map[string]interface{}{},
+			"",
+			nil,
+			nil,
+			false,
+			false,
+		},
+		{
+			"Set Error",
+			map[string]map[string]interface{}{},
+			"set-error",
+			[]byte(`{"title":"Plugin One"}`),
+			nil,
+			false,
+			true,
+		},
+		{
+			"Invalid Document",
+			map[string]map[string]interface{}{
+				"test/invalid-config": {
+					"results": 12345,
+				},
+			},
+			"",
+			nil,
+			nil,
+			false,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs, _ := NewWithClient(context.Background(), "test-project", "test", &mockClient{true, tt.docs})
+
+			checksum := tt.checksum
+			if checksum != "" {
+				err := fs.SetResults(checksum, "config", tt.results)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("Provider.SetResults() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			} else if tt.wantErr {
+				checksum = "invalid"
+			} else {
+				checksum = "missing"
+			}
+
+			got, found, err := fs.GetResults(checksum, "config")
+			if err != nil && tt.checksum != "" {
+				t.Errorf("Provider.GetResults() error = %v", err)
+				return
+			}
+			if found != tt.wantFound {
+				t.Errorf("Provider.GetResults() found = %v, want %v", found, tt.wantFound)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Provider.GetResults() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewWithClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		client  fsClient.ClientInterface
+		wantErr bool
+	}{
+		{
+			"Valid Client",
+			&mockClient{authenticated: true},
+			false,
+		},
+		{
+			"Unauthenticated Client",
+			&mockClient{},
+			true,
+		},
+		{
+			"No Client",
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewWithClient(context.Background(), "test-project", "test", tt.client)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewWithClient() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
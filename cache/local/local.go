@@ -0,0 +1,65 @@
+package local
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/wptide/pkg/cache"
+)
+
+var (
+	readFile  = ioutil.ReadFile
+	writeFile = ioutil.WriteFile
+)
+
+// Provider stores audit results as files in a local folder.
+type Provider struct {
+	path string
+}
+
+// GetResults returns the stored results, or false if there are none.
+func (p Provider) GetResults(checksum, config string) ([]byte, bool, error) {
+	data, err := readFile(p.filename(checksum, config))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var entry cache.Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false, err
+	}
+
+	return []byte(entry.Results), true, nil
+}
+
+// SetResults stores the results of a completed audit.
+func (p Provider) SetResults(checksum, config string, results []byte) error {
+	data, _ := json.Marshal(cache.Entry{
+		Checksum: checksum,
+		Config:   config,
+		Results:  string(results),
+		Created:  time.Now().UnixNano(),
+	})
+
+	if err := os.MkdirAll(p.path, os.ModePerm); err != nil {
+		return err
+	}
+
+	return writeFile(p.filename(checksum, config), data, 0644)
+}
+
+func (p Provider) filename(checksum, config string) string {
+	return p.path + "/" + checksum + "-" + config + ".json"
+}
+
+// NewLocalCache returns a local cache provider that stores audit results in the given folder.
+func NewLocalCache(path string) *Provider {
+	return &Provider{
+		path: path,
+	}
+}
@@ -0,0 +1,134 @@
+package local
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestProvider(t *testing.T) {
+
+	path := "./testdata/cache"
+
+	// Clean up after.
+	defer os.RemoveAll("./testdata")
+
+	errorWrite := func(filename string, data []byte, perm os.FileMode) error {
+		return errors.New("something went wrong")
+	}
+
+	tests := []struct {
+		name      string
+		setPath   string
+		checksum  string
+		results   []byte
+		writeFile func(string, []byte, os.FileMode) error
+		want      []byte
+		wantFound bool
+		wantErr   bool
+	}{
+		{
+			"Stored Results",
+			path,
+			"abc123",
+			[]byte(`{"title":"Plugin One"}`),
+			nil,
+			[]byte(`{"title":"Plugin One"}`),
+			true,
+			false,
+		},
+		{
+			"Missing Results",
+			path,
+			"",
+			nil,
+			nil,
+			nil,
+			false,
+			false,
+		},
+		{
+			"Write Error",
+			path,
+			"def456",
+			[]byte(`{"title":"Plugin One"}`),
+			errorWrite,
+			nil,
+			false,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			if tt.writeFile != nil {
+				oldWriteFile := writeFile
+				writeFile = tt.writeFile
+				defer func() {
+					writeFile = oldWriteFile
+				}()
+			}
+
+			p := NewLocalCache(tt.setPath)
+			checksum := tt.checksum
+
+			if checksum != "" {
+				err := p.SetResults(checksum, "config", tt.results)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("Provider.SetResults() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			} else {
+				checksum = "missing"
+			}
+
+			got, found, err := p.GetResults(checksum, "config")
+			if err != nil {
+				t.Errorf("Provider.GetResults() error = %v", err)
+				return
+			}
+			if found != tt.wantFound {
+				t.Errorf("Provider.GetResults() found = %v, want %v", found, tt.wantFound)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Provider.GetResults() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProvider_GetResults_Invalid(t *testing.T) {
+
+	oldReadFile := readFile
+	defer func() {
+		readFile = oldReadFile
+	}()
+
+	tests := []struct {
+		name     string
+		readFile func(string) ([]byte, error)
+	}{
+		{
+			"Read Error",
+			func(string) ([]byte, error) {
+				return nil, errors.New("something went wrong")
+			},
+		},
+		{
+			"Invalid Entry",
+			func(string) ([]byte, error) {
+				return []byte("not json"), nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readFile = tt.readFile
+
+			_, found, err := NewLocalCache("./testdata/cache").GetResults("abc123", "config")
+			if err == nil || found {
+				t.Errorf("Provider.GetResults() found = %v, error = %v, want error", found, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package mongo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/wptide/pkg/cache"
+	wrapper "github.com/wptide/pkg/wrapper/mongo"
+)
+
+// Provider stores audit results as MongoDB documents.
+type Provider struct {
+	ctx        context.Context
+	client     wrapper.Client
+	database   string
+	collection string
+}
+
+// GetResults returns the stored results, or false if there are none.
+func (m Provider) GetResults(checksum, config string) ([]byte, bool, error) {
+	collection := m.client.Database(m.database).Collection(m.collection)
+
+	filter := map[string]interface{}{
+		"checksum": checksum,
+		"config":   config,
+	}
+
+	// Newest results first.
+	sort, _ := mongo.Opt.Sort(bson.NewDocument(bson.EC.Int32("created", -1)))
+
+	entry, err := resultToEntry(collection.FindOne(m.ctx, filter, sort))
+	if err != nil {
+		return nil, false, err
+	}
+	if entry == nil {
+		return nil, false, nil
+	}
+
+	return []byte(entry.Results), true, nil
+}
+
+// SetResults stores the results of a completed audit.
+func (m Provider) SetResults(checksum, config string, results []byte) error {
+	collection := m.client.Database(m.database).Collection(m.collection)
+
+	_, err := collection.InsertOne(m.ctx, map[string]interface{}{
+		"checksum": checksum,
+		"config":   config,
+		"results":  string(results),
+		"created":  time.Now().UnixNano(),
+	})
+
+	return err
+}
+
+// resultToEntry converts a MongoDB result to a cache.Entry. A missing document is not an error.
+func resultToEntry(layer wrapper.DocumentResultLayer) (*cache.Entry, error) {
+	if layer == nil {
+		return nil, nil
+	}
+
+	elem, _ := layer.Decode()
+	if elem == nil {
+		return nil, nil
+	}
+
+	raw, _ := elem.MarshalBSON()
+	js, err := bson.ToExtJSON(false, raw)
+	if err != nil {
+		return nil, errors.New("mongodb: could not decode cache entry")
+	}
+	if js == "{}" {
+		return nil, nil
+	}
+
+	var entry *cache.Entry
+	if err := json.Unmarshal([]byte(js), &entry); err != nil {
+		return nil, errors.New("mongodb: could not decode cache entry")
+	}
+
+	return entry, nil
+}
+
+// New creates a new Provider with a default client.
+func New(ctx context.Context, user string, pass string, host string, db string, collection string, opts *mongo.ClientOptions) (*Provider, error) {
+	client, err := wrapper.NewMongoClient(ctx, user, pass, host, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWithClient(ctx, db, collection, client)
+}
+
+// NewWithClient creates a new Provider with a provided client.
+func NewWithClient(ctx context.Context, db string, collection string, client wrapper.Client) (*Provider, error) {
+	return &Provider{
+		ctx:        ctx,
+		client:     client,
+		database:   db,
+		collection: collection,
+	}, nil
+}
@@ -0,0 +1,152 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/core/option"
+	wrapper "github.com/wptide/pkg/wrapper/mongo"
+)
+
+type mockClient struct {
+	collection string
+}
+
+func (m mockClient) Database(string) wrapper.DataLayer {
+	return &mockDatabase{
+		collection: m.collection,
+	}
+}
+
+func (m mockClient) Close() error {
+	return nil
+}
+
+type mockDatabase struct {
+	collection string
+}
+
+func (m mockDatabase) Collection(name string) wrapper.CollectionLayer {
+	return &mockCollection{
+		collection: m.collection,
+	}
+}
+
+type mockCollection struct {
+	collection string
+}
+
+func (m mockCollection) InsertOne(ctx context.Context, document interface{}, opts ...option.InsertOneOptioner) (wrapper.InsertOneResultLayer, error) {
+	if m.collection == "test-insert-error" {
+		return nil, errors.New("something went wrong")
+	}
+	return nil, nil
+}
+
+func (m mockCollection) FindOne(ctx context.Context, filter interface{}, opts ...option.FindOneOptioner) wrapper.DocumentResultLayer {
+	return &mockDocumentResult{
+		collection: m.collection,
+	}
+}
+
+func (m mockCollection) FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, opts ...option.FindOneAndUpdateOptioner) wrapper.DocumentResultLayer {
+	return nil
+}
+
+func (m mockCollection) FindOneAndDelete(ctx context.Context, filter interface{}, opts ...option.FindOneAndDeleteOptioner) wrapper.DocumentResultLayer {
+	return nil
+}
+
+type mockDocumentResult struct {
+	collection string
+}
+
+func (d mockDocumentResult) Decode() (*bson.Document, error) {
+	switch d.collection {
+	case "test-cached":
+		return bson.ParseExtJSONObject(`{"checksum": "abc123", "config": "config", "results": "{\"title\":\"Plugin One\"}", "created": 1526956796534182580}`)
+	case "test-invalid":
+		return bson.ParseExtJSONObject(`{"checksum": "abc123", "config": "config", "results": 12345}`)
+	}
+	return nil, errors.New("mongo: no documents in result")
+}
+
+func TestProvider_GetResults(t *testing.T) {
+	tests := []struct {
+		name       string
+		collection string
+		want       []byte
+		wantFound  bool
+		wantErr    bool
+	}{
+		{
+			"Stored Results",
+			"test-cached",
+			[]byte(`{"title":"Plugin One"}`),
+			true,
+			false,
+		},
+		{
+			"Missing Results",
+			"test-no-records",
+			nil,
+			false,
+			false,
+		},
+		{
+			"Invalid Document",
+			"test-invalid",
+			nil,
+			false,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := NewWithClient(context.Background(), "test-db", tt.collection, &mockClient{tt.collection})
+
+			got, found, err := m.GetResults("abc123", "config")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Provider.GetResults() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if found != tt.wantFound {
+				t.Errorf("Provider.GetResults() found = %v, want %v", found, tt.wantFound)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Provider.GetResults() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProvider_SetResults(t *testing.T) {
+	tests := []struct {
+		name       string
+		collection string
+		wantErr    bool
+	}{
+		{
+			"Store Results",
+			"test-collection",
+			false,
+		},
+		{
+			"Insert Error",
+			"test-insert-error",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := NewWithClient(context.Background(), "test-db", tt.collection, &mockClient{tt.collection})
+
+			if err := m.SetResults("abc123", "config", []byte(`{"title":"Plugin One"}`)); (err != nil) != tt.wantErr {
+				t.Errorf("Provider.SetResults() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
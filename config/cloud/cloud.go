@@ -0,0 +1,129 @@
+// Package cloud registers the cloud providers with the config package. Import it to use them in configs:
+//
+//	import _ "github.com/wptide/pkg/config/cloud"
+//
+// The firestore and mongo message providers keep finished messages, unless the `retention` option is set,
+// e.g. "720h". Firestore removes them when the pipeline purges, MongoDB with a TTL index.
+// Both are also result caches.
+package cloud
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/wptide/pkg/cache"
+	firestoreCache "github.com/wptide/pkg/cache/firestore"
+	mongoCache "github.com/wptide/pkg/cache/mongo"
+	"github.com/wptide/pkg/config"
+	"github.com/wptide/pkg/message"
+	"github.com/wptide/pkg/message/firestore"
+	"github.com/wptide/pkg/message/mongo"
+	"github.com/wptide/pkg/message/sqs"
+	"github.com/wptide/pkg/storage"
+	"github.com/wptide/pkg/storage/gcs"
+	"github.com/wptide/pkg/storage/s3"
+)
+
+func init() {
+	config.Register(config.Registration{
+		Kind:     "s3",
+		Required: []string{"region", "bucket"},
+		Storage: func(ctx context.Context, options map[string]string) (storage.Provider, error) {
+			return s3.NewS3Provider(options["region"], options["key"], options["secret"], options["bucket"]), nil
+		},
+	})
+
+	config.Register(config.Registration{
+		Kind:     "gcs",
+		Required: []string{"project", "bucket"},
+		Storage: func(ctx context.Context, options map[string]string) (storage.Provider, error) {
+			return gcs.NewCloudStorageProvider(ctx, options["project"], options["bucket"]), nil
+		},
+	})
+
+	config.Register(config.Registration{
+		Kind:     "sqs",
+		Required: []string{"region", "queue"},
+		Messages: func(ctx context.Context, options map[string]string) (message.Provider, error) {
+			return sqs.NewSqsProvider(options["region"], options["key"], options["secret"], options["queue"]), nil
+		},
+	})
+
+	config.Register(config.Registration{
+		Kind:     "firestore",
+		Required: []string{"project", "root"},
+		Messages: func(ctx context.Context, options map[string]string) (message.Provider, error) {
+			provider, err := firestore.New(ctx, options["project"], options["root"])
+			if err != nil {
+				return nil, err
+			}
+			retention, err := parseRetention(options)
+			if err != nil {
+				return nil, err
+			}
+			provider.SetRetention(retention)
+			return provider, nil
+		},
+	})
+
+	config.Register(config.Registration{
+		Kind:     "mongo",
+		Required: []string{"host", "database", "collection"},
+		Messages: func(ctx context.Context, options map[string]string) (message.Provider, error) {
+			provider, err := mongo.New(ctx, options["user"], options["pass"], options["host"], options["database"], options["collection"], nil)
+			if err != nil {
+				return nil, err
+			}
+			retention, err := parseRetention(options)
+			if err != nil {
+				provider.Close()
+				return nil, err
+			}
+			if retention > 0 {
+				if err := provider.SetRetention(retention); err != nil {
+					provider.Close()
+					return nil, err
+				}
+			}
+			return provider, nil
+		},
+	})
+
+	config.Register(config.Registration{
+		Kind:     "firestore",
+		Required: []string{"project", "root"},
+		Cache: func(ctx context.Context, options map[string]string) (cache.Provider, error) {
+			provider, err := firestoreCache.New(ctx, options["project"], options["root"])
+			if err != nil {
+				return nil, err
+			}
+			return provider, nil
+		},
+	})
+
+	config.Register(config.Registration{
+		Kind:     "mongo",
+		Required: []string{"host", "database", "collection"},
+		Cache: func(ctx context.Context, options map[string]string) (cache.Provider, error) {
+			provider, err := mongoCache.New(ctx, options["user"], options["pass"], options["host"], options["database"], options["collection"], nil)
+			if err != nil {
+				return nil, err
+			}
+			return provider, nil
+		},
+	})
+}
+
+// parseRetention parses the `retention` option of document stores, e.g. "720h". Without it, finished
+// messages are kept.
+func parseRetention(options map[string]string) (time.Duration, error) {
+	if options["retention"] == "" {
+		return 0, nil
+	}
+	retention, err := time.ParseDuration(options["retention"])
+	if err != nil || retention <= 0 {
+		return 0, errors.New("option `retention` must be a positive duration, e.g. 720h")
+	}
+	return retention, nil
+}
@@ -0,0 +1,800 @@
+// Package config builds pipelines from YAML or JSON files, so that services don't have to wire
+// processes, channels and providers by hand.
+//
+// A config lists the stages of the pipeline in order, e.g.:
+//
+//	temp_folder: /tmp/tide
+//	workers: 2
+//	message_provider:
+//	  kind: sqs
+//	  options:
+//	    region: us-west-2
+//	    queue: tide-phpcs
+//	    key: ${AWS_KEY}
+//	    secret: ${AWS_SECRET}
+//	storage:
+//	  kind: local
+//	  options:
+//	    path: /srv/reports
+//	result_cache:
+//	  kind: local
+//	  options:
+//	    path: /srv/cache
+//	phpcs_versions:
+//	  phpcompatibility:
+//	    "7.0": "7.0"
+//	tool_versions:
+//	  phpcs: 3.3.0
+//	  lighthouse: 3.0.0
+//	payloaders:
+//	  tide:
+//	    kind: tide
+//	    options:
+//	      client_id: ${TIDE_CLIENT_ID}
+//	      client_secret: ${TIDE_CLIENT_SECRET}
+//	      auth_endpoint: https://tide.local/api/tide/v1/auth
+//	stages:
+//	  - type: ingest
+//	    extract_policy:
+//	      max_total_size: 536870912
+//	      symlinks: reject
+//	  - type: info
+//	  - type: fork
+//	    merge: error
+//	    branches:
+//	      - - type: phpcs
+//	          workers: 4
+//	          timeout: 10m
+//	      - - type: lighthouse
+//	  - type: response
+//
+// A fork sends every job to all of its branches at the same time, and joins the results of the branches
+// for the next stage.
+//
+// Environment variables in option values, e.g. "${AWS_KEY}", are expanded, so that secrets don't have to be in it.
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wptide/pkg/cache"
+	"github.com/wptide/pkg/health"
+	"github.com/wptide/pkg/log"
+	"github.com/wptide/pkg/message"
+	"github.com/wptide/pkg/payload"
+	"github.com/wptide/pkg/pipe"
+	"github.com/wptide/pkg/process"
+	"github.com/wptide/pkg/source"
+	"github.com/wptide/pkg/storage"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// A variable so that we can mock it in tests.
+	readFile = ioutil.ReadFile
+
+	// Using os.LookupEnv as a variable so that we can mock it in tests.
+	lookupEnv = os.LookupEnv
+
+	// Placeholders for environment variables in option values.
+	envPlaceholder = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+)
+
+// Config describes a pipeline.
+type Config struct {
+	TempFolder      string                       `json:"temp_folder" yaml:"temp_folder"`           // Folder for the files of the jobs, stages can override it.
+	Workers         int                          `json:"workers" yaml:"workers"`                   // (Optional) Number of jobs every stage processes at the same time. Defaults to 1.
+	Timeout         Duration                     `json:"timeout" yaml:"timeout"`                   // (Optional) Time before an audit is stopped, stages can override it.
+	RetryBackoff    Duration                     `json:"retry_backoff" yaml:"retry_backoff"`       // (Optional) Delay before failed messages are retried.
+	MessageProvider *ProviderConfig              `json:"message_provider" yaml:"message_provider"` // (Optional) Provider the messages come from, and are acknowledged to.
+	Storage         *ProviderConfig              `json:"storage" yaml:"storage"`                   // Storage provider to upload reports to.
+	StorageCheck    string                       `json:"storage_check" yaml:"storage_check"`       // (Optional) Reference the readiness check uploads a small file to, for storage providers that can't be pinged. Without it they aren't checked, so nothing is written to the storage.
+	ResultCache     *ProviderConfig              `json:"result_cache" yaml:"result_cache"`         // (Optional) Cache to replay the results of code that was already audited.
+	PhpcsVersions   map[string]map[string]string `json:"phpcs_versions" yaml:"phpcs_versions"`     // PHPCS versions for every standard.
+	ToolVersions    map[string]string            `json:"tool_versions" yaml:"tool_versions"`       // (Optional) Versions of the audit tools, e.g. "phpcs": "3.3.0". Cached results of other versions aren't replayed.
+	Payloaders      map[string]ProviderConfig    `json:"payloaders" yaml:"payloaders"`             // Payloaders by payload type, e.g. "tide".
+	Stages          []StageConfig                `json:"stages" yaml:"stages"`                     // Stages of the pipeline in order.
+}
+
+// ProviderConfig describes a provider by its registered kind.
+type ProviderConfig struct {
+	Kind    string            `json:"kind" yaml:"kind"`       // Kind of the provider, e.g. "s3".
+	Options map[string]string `json:"options" yaml:"options"` // Options for the factory of the kind.
+}
+
+// StageConfig describes a stage of the pipeline.
+type StageConfig struct {
+	Type          string               `json:"type" yaml:"type"`                     // One of "ingest", "info", "phpcs", "lighthouse", "fork" or "response".
+	Workers       int                  `json:"workers" yaml:"workers"`               // (Optional) Overrides Config.Workers.
+	TempFolder    string               `json:"temp_folder" yaml:"temp_folder"`       // (Optional) Overrides Config.TempFolder.
+	Timeout       Duration             `json:"timeout" yaml:"timeout"`               // (Optional) Overrides Config.Timeout.
+	CacheSize     int64                `json:"cache_size" yaml:"cache_size"`         // (Optional) Size in bytes of the download cache of ingest.
+	ExtractPolicy *ExtractPolicyConfig `json:"extract_policy" yaml:"extract_policy"` // (Optional) Limits for extracting archives in ingest.
+	Branches      [][]StageConfig      `json:"branches" yaml:"branches"`             // Stages of every branch of a fork.
+	Merge         string               `json:"merge" yaml:"merge"`                   // (Optional) How a fork merges a result key that more than one branch changed: "first" (default), "last" or "error".
+	JoinTimeout   Duration             `json:"join_timeout" yaml:"join_timeout"`     // (Optional) Time a fork waits for the other branches of a job. Defaults to process.DefaultJoinTimeout.
+}
+
+// ExtractPolicyConfig describes the limits for extracting archives, see source.ExtractPolicy.
+// Limits that aren't set keep the value of source.DefaultExtractPolicy.
+type ExtractPolicyConfig struct {
+	MaxTotalSize        int64   `json:"max_total_size" yaml:"max_total_size"`               // (Optional) Maximum uncompressed size of all files, in bytes.
+	MaxFiles            int     `json:"max_files" yaml:"max_files"`                         // (Optional) Maximum number of files.
+	MaxCompressionRatio float64 `json:"max_compression_ratio" yaml:"max_compression_ratio"` // (Optional) Maximum uncompressed to compressed size ratio of a single file.
+	Symlinks            string  `json:"symlinks" yaml:"symlinks"`                           // (Optional) "skip" or "reject" symlink entries.
+}
+
+// Policy returns the extract policy of the config.
+func (e ExtractPolicyConfig) Policy() source.ExtractPolicy {
+	policy := source.DefaultExtractPolicy
+	if e.MaxTotalSize > 0 {
+		policy.MaxTotalSize = e.MaxTotalSize
+	}
+	if e.MaxFiles > 0 {
+		policy.MaxFiles = e.MaxFiles
+	}
+	if e.MaxCompressionRatio > 0 {
+		policy.MaxCompressionRatio = e.MaxCompressionRatio
+	}
+	if symlinks, ok := symlinkPolicies[e.Symlinks]; ok {
+		policy.Symlinks = symlinks
+	}
+	return policy
+}
+
+var symlinkPolicies = map[string]int{
+	"skip":   source.SymlinkSkip,
+	"reject": source.SymlinkReject,
+}
+
+var mergePolicies = map[string]int{
+	"":      process.MergeFirst,
+	"first": process.MergeFirst,
+	"last":  process.MergeLast,
+	"error": process.MergeError,
+}
+
+// DefaultPollInterval is the time Pipeline.Run waits before it asks an empty or failing provider again.
+const DefaultPollInterval = 5 * time.Second
+
+// DefaultPurgeInterval is the time between purges of finished messages, see message.Purger.
+const DefaultPurgeInterval = time.Hour
+
+// Pipeline is a pipe built from a config.
+type Pipeline struct {
+	Pipe          *pipe.Pipe           // The pipe, ready to start.
+	Messages      chan message.Message // Messages sent to this channel go through the pipe.
+	Provider      message.Provider     // (Optional) Provider to get the messages from. Jobs are acknowledged to it.
+	PollInterval  time.Duration        // (Optional) Time to wait for new messages of the provider. Defaults to DefaultPollInterval.
+	PurgeInterval time.Duration        // (Optional) Time between purges of providers that implement message.Purger. Defaults to DefaultPurgeInterval.
+	Health        *health.Registry     // Health of the processes and checks of the dependencies, e.g. "storage".
+}
+
+// Run takes the messages of the provider and sends them through the pipe, until ctx is done.
+// While the queue is empty, it purges finished messages of providers that implement message.Purger.
+// Start the pipe first, and shut it down once Run returned.
+func (p *Pipeline) Run(ctx context.Context) error {
+	if p.Provider == nil {
+		return errors.New("config: the pipeline has no message provider")
+	}
+
+	interval := p.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	purgeInterval := p.PurgeInterval
+	if purgeInterval <= 0 {
+		purgeInterval = DefaultPurgeInterval
+	}
+	var purged time.Time
+
+	for {
+		msg, err := p.Provider.GetNextMessage()
+		if err != nil {
+			log.Log("Pipeline", "Could not get next message: "+err.Error())
+		}
+
+		// Wait for new messages, or for the provider to recover.
+		if msg == nil {
+			if purger, ok := p.Provider.(message.Purger); ok && err == nil && time.Since(purged) >= purgeInterval {
+				purged = time.Now()
+				if _, err := purger.Purge(); err != nil {
+					log.Log("Pipeline", "Could not purge finished messages: "+err.Error())
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(interval):
+			}
+			continue
+		}
+
+		select {
+		case p.Messages <- *msg:
+		case <-ctx.Done():
+			// Let another worker take the message.
+			if releaser, ok := p.Provider.(message.Releaser); ok && msg.ExternalRef != nil {
+				releaser.ReleaseMessage(msg.ExternalRef, 0)
+			}
+			return ctx.Err()
+		}
+	}
+}
+
+// ValidationError lists everything that is wrong with a config.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e ValidationError) Error() string {
+	return "invalid pipeline config: " + strings.Join(e.Problems, "; ")
+}
+
+// stageKind describes what a type of stage needs.
+type stageKind struct {
+	first      bool // Takes messages, so it has to be the first stage.
+	last       bool // Doesn't need a next stage, so it has to be the last stage.
+	tempFolder bool // Needs a temp folder.
+	storage    bool // Needs a storage provider.
+	phpcs      bool // Needs PHPCS versions.
+	payloaders bool // Needs payloaders.
+	fork       bool // Sends the jobs to branches of stages.
+}
+
+var stageKinds = map[string]stageKind{
+	"ingest":     {first: true, tempFolder: true},
+	"info":       {},
+	"phpcs":      {tempFolder: true, storage: true, phpcs: true},
+	"lighthouse": {tempFolder: true, storage: true},
+	"response":   {last: true, payloaders: true},
+	"fork":       {fork: true},
+}
+
+// Load reads and validates a config file. The format is taken from the extension of the file.
+func Load(path string) (*Config, error) {
+	var format string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		format = "yaml"
+	case ".json":
+		format = "json"
+	default:
+		return nil, errors.New("config: unknown format of " + path + ", expected .yaml, .yml or .json")
+	}
+
+	data, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data, format)
+}
+
+// Parse reads and validates a "yaml" or "json" config. Unknown fields are errors, so that typos don't go unnoticed.
+func Parse(data []byte, format string) (*Config, error) {
+	c := &Config{}
+	switch format {
+	case "yaml":
+		if err := yaml.UnmarshalStrict(data, c); err != nil {
+			return nil, errors.New("config: " + err.Error())
+		}
+	case "json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(c); err != nil {
+			return nil, errors.New("config: " + err.Error())
+		}
+	default:
+		return nil, errors.New("config: unknown format " + format)
+	}
+
+	problems := c.expandEnv()
+	if err := c.Validate(); err != nil {
+		vErr, ok := err.(ValidationError)
+		if !ok {
+			return nil, err
+		}
+		problems = append(problems, vErr.Problems...)
+	}
+	if len(problems) > 0 {
+		return nil, ValidationError{problems}
+	}
+
+	return c, nil
+}
+
+// expandEnv replaces the "${VAR}" placeholders in the option values of the providers with the environment
+// variables. It returns a problem for every variable that is not set.
+func (c *Config) expandEnv() []string {
+	var problems []string
+	expand := func(name string, p *ProviderConfig) {
+		keys := make([]string, 0, len(p.Options))
+		for key := range p.Options {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			p.Options[key] = envPlaceholder.ReplaceAllStringFunc(p.Options[key], func(placeholder string) string {
+				variable := envPlaceholder.FindStringSubmatch(placeholder)[1]
+				value, ok := lookupEnv(variable)
+				if !ok {
+					problems = append(problems, fmt.Sprintf("%s: option `%s` uses `%s`, which is not set", name, key, variable))
+				}
+				return value
+			})
+		}
+	}
+
+	if c.MessageProvider != nil {
+		expand("message_provider", c.MessageProvider)
+	}
+	if c.Storage != nil {
+		expand("storage", c.Storage)
+	}
+	if c.ResultCache != nil {
+		expand("result_cache", c.ResultCache)
+	}
+	names := make([]string, 0, len(c.Payloaders))
+	for name := range c.Payloaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := c.Payloaders[name]
+		expand("payloader `"+name+"`", &p)
+		c.Payloaders[name] = p
+	}
+
+	return problems
+}
+
+// Validate returns a ValidationError with every wiring mistake of the config.
+func (c *Config) Validate() error {
+	var problems []string
+	problem := func(format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+
+	if c.Workers < 0 {
+		problem("workers can't be negative")
+	}
+	if c.Timeout < 0 {
+		problem("timeout can't be negative")
+	}
+	if c.RetryBackoff < 0 {
+		problem("retry_backoff can't be negative")
+	}
+
+	if c.MessageProvider != nil {
+		problems = append(problems, validateProvider("message_provider", messages, *c.MessageProvider)...)
+	}
+	if c.Storage != nil {
+		problems = append(problems, validateProvider("storage", storages, *c.Storage)...)
+	}
+	if c.ResultCache != nil {
+		problems = append(problems, validateProvider("result_cache", caches, *c.ResultCache)...)
+	}
+	names := make([]string, 0, len(c.Payloaders))
+	for name := range c.Payloaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		problems = append(problems, validateProvider("payloader `"+name+"`", payloaders, c.Payloaders[name])...)
+	}
+
+	if len(c.Stages) == 0 {
+		problem("requires at least one stage")
+	}
+
+	seen := make(map[string]bool)
+	for i, s := range c.Stages {
+		kind, ok, kindProblems := lookupStage(fmt.Sprintf("stage %d", i+1), s.Type, seen)
+		problems = append(problems, kindProblems...)
+		if !ok {
+			continue
+		}
+
+		if i == 0 && !kind.first {
+			problem("stage %d: the first stage has to be `ingest`, not `%s`", i+1, s.Type)
+		}
+		if i > 0 && kind.first {
+			problem("stage %d: `%s` has to be the first stage", i+1, s.Type)
+		}
+		if i == len(c.Stages)-1 && !kind.last {
+			problem("stage %d: the last stage has to be `response`, not `%s`", i+1, s.Type)
+		}
+		if i < len(c.Stages)-1 && kind.last {
+			problem("stage %d: `%s` has to be the last stage", i+1, s.Type)
+		}
+
+		problems = append(problems, c.validateStage(fmt.Sprintf("stage %d", i+1), s, kind, seen)...)
+	}
+
+	if len(problems) > 0 {
+		return ValidationError{problems}
+	}
+	return nil
+}
+
+// lookupStage returns the kind of a stage type, or false with a problem if the type is unknown.
+// Every type can only be used once, so a problem is also returned if the type was already seen.
+func lookupStage(name, stageType string, seen map[string]bool) (stageKind, bool, []string) {
+	kind, ok := stageKinds[stageType]
+	if !ok {
+		return kind, false, []string{fmt.Sprintf("%s: unknown type `%s`", name, stageType)}
+	}
+
+	var problems []string
+	if seen[stageType] {
+		problems = append(problems, fmt.Sprintf("%s: `%s` is already a stage", name, stageType))
+	}
+	seen[stageType] = true
+
+	return kind, true, problems
+}
+
+// validateStage returns the problems of the options of a stage, and of the stages in its branches.
+func (c *Config) validateStage(name string, s StageConfig, kind stageKind, seen map[string]bool) []string {
+	var problems []string
+	problem := func(format string, a ...interface{}) {
+		problems = append(problems, name+": "+fmt.Sprintf(format, a...))
+	}
+
+	if s.Workers < 0 {
+		problem("workers can't be negative")
+	}
+	if s.Timeout < 0 {
+		problem("timeout can't be negative")
+	}
+	if s.CacheSize < 0 {
+		problem("cache_size can't be negative")
+	}
+	if kind.tempFolder && s.TempFolder == "" && c.TempFolder == "" {
+		problem("`%s` requires a temp_folder", s.Type)
+	}
+	if kind.storage && c.Storage == nil {
+		problem("`%s` requires storage", s.Type)
+	}
+	if kind.phpcs && len(c.PhpcsVersions) == 0 {
+		problem("`%s` requires phpcs_versions", s.Type)
+	}
+	if kind.payloaders && len(c.Payloaders) == 0 {
+		problem("`%s` requires payloaders", s.Type)
+	}
+
+	if e := s.ExtractPolicy; e != nil {
+		if s.Type != "ingest" {
+			problem("only `ingest` takes an extract_policy")
+		}
+		if e.MaxTotalSize < 0 || e.MaxFiles < 0 || e.MaxCompressionRatio < 0 {
+			problem("extract_policy limits can't be negative")
+		}
+		if _, ok := symlinkPolicies[e.Symlinks]; !ok && e.Symlinks != "" {
+			problem("extract_policy: unknown symlinks `%s`, expected skip or reject", e.Symlinks)
+		}
+	}
+
+	if !kind.fork {
+		if len(s.Branches) > 0 || s.Merge != "" || s.JoinTimeout != 0 {
+			problem("only `fork` takes branches, merge and join_timeout")
+		}
+		return problems
+	}
+
+	if _, ok := mergePolicies[s.Merge]; !ok {
+		problem("unknown merge `%s`, expected first, last or error", s.Merge)
+	}
+	if s.JoinTimeout < 0 {
+		problem("join_timeout can't be negative")
+	}
+	if len(s.Branches) == 0 {
+		problem("`fork` requires at least one branch")
+	}
+
+	for j, branch := range s.Branches {
+		if len(branch) == 0 {
+			problem("branch %d requires at least one stage", j+1)
+		}
+
+		for k, b := range branch {
+			branchName := fmt.Sprintf("%s, branch %d, stage %d", name, j+1, k+1)
+			branchKind, ok, kindProblems := lookupStage(branchName, b.Type, seen)
+			problems = append(problems, kindProblems...)
+			if !ok {
+				continue
+			}
+
+			if branchKind.first || branchKind.last || branchKind.fork {
+				problems = append(problems, fmt.Sprintf("%s: `%s` can't be in a branch", branchName, b.Type))
+				continue
+			}
+			problems = append(problems, c.validateStage(branchName, b, branchKind, seen)...)
+		}
+	}
+
+	return problems
+}
+
+// Build validates the config and builds the pipeline. The providers are created, but nothing is started.
+// The processes and the message provider report into the health registry of the pipeline, and its
+// dependencies, i.e. the storage provider and the binaries of the audits, are added to it as checks.
+func (c *Config) Build(ctx context.Context) (*Pipeline, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	// The providers that were already created are closed if a later one fails.
+	var closers []io.Closer
+	fail := func(err error) (*Pipeline, error) {
+		for _, closer := range closers {
+			closer.Close()
+		}
+		return nil, err
+	}
+
+	registry := health.NewRegistry()
+
+	var store storage.Provider
+	if c.Storage != nil {
+		reg, _ := lookup(storages, c.Storage.Kind)
+
+		var err error
+		if store, err = reg.Storage(ctx, c.Storage.Options); err != nil {
+			return fail(errors.New("config: storage: " + err.Error()))
+		}
+		if closer, ok := store.(io.Closer); ok {
+			closers = append(closers, closer)
+		}
+		registry.AddCheck("storage", health.Storage(store, c.StorageCheck))
+	}
+
+	var provider message.Provider
+	if c.MessageProvider != nil {
+		reg, _ := lookup(messages, c.MessageProvider.Kind)
+
+		var err error
+		if provider, err = reg.Messages(ctx, c.MessageProvider.Options); err != nil {
+			return fail(errors.New("config: message_provider: " + err.Error()))
+		}
+		closers = append(closers, provider)
+
+		if r, ok := provider.(health.Reporter); ok {
+			r.SetHealth(registry)
+		}
+	}
+
+	payloads := make(map[string]payload.Payloader, len(c.Payloaders))
+	for name, p := range c.Payloaders {
+		reg, _ := lookup(payloaders, p.Kind)
+
+		payloader, err := reg.Payloader(ctx, p.Options)
+		if err != nil {
+			return fail(errors.New("config: payloader `" + name + "`: " + err.Error()))
+		}
+		if closer, ok := payloader.(io.Closer); ok {
+			closers = append(closers, closer)
+		}
+		payloads[name] = payloader
+	}
+
+	// Results are only replayed for the same audit tools and configuration.
+	cachePipeline := cache.Pipeline{
+		Tools:         c.ToolVersions,
+		PhpcsVersions: c.PhpcsVersions,
+	}
+
+	var results cache.Provider
+	if c.ResultCache != nil {
+		reg, _ := lookup(caches, c.ResultCache.Kind)
+
+		var err error
+		if results, err = reg.Cache(ctx, c.ResultCache.Options); err != nil {
+			return fail(errors.New("config: result_cache: " + err.Error()))
+		}
+		if closer, ok := results.(io.Closer); ok {
+			closers = append(closers, closer)
+		}
+	}
+
+	pipeline := &Pipeline{
+		Pipe:     pipe.New(),
+		Messages: make(chan message.Message),
+		Provider: provider,
+		Health:   registry,
+	}
+	pipeline.Pipe.SetHealth(registry)
+
+	if provider != nil {
+		pipeline.Pipe.SetCompleter(process.Acknowledger{
+			Provider: provider,
+			Backoff:  time.Duration(c.RetryBackoff),
+		})
+	}
+
+	// build creates the process of a stage that isn't a fork.
+	build := func(s StageConfig, in <-chan process.Processor, out chan process.Processor) process.Processor {
+		workers := s.Workers
+		if workers == 0 {
+			workers = c.Workers
+		}
+		tempFolder := s.TempFolder
+		if tempFolder == "" {
+			tempFolder = c.TempFolder
+		}
+		timeout := s.Timeout
+		if timeout == 0 {
+			timeout = c.Timeout
+		}
+
+		switch s.Type {
+		case "ingest":
+			ingest := &process.Ingest{
+				In:              pipeline.Messages,
+				Out:             out,
+				TempFolder:      tempFolder,
+				CacheSize:       s.CacheSize,
+				StorageProvider: store,
+				ResultCache:     results,
+				Pipeline:        cachePipeline,
+				Workers:         workers,
+			}
+			if s.ExtractPolicy != nil {
+				policy := s.ExtractPolicy.Policy()
+				ingest.ExtractPolicy = &policy
+			}
+			return ingest
+		case "info":
+			return &process.Info{
+				In:      in,
+				Out:     out,
+				Workers: workers,
+			}
+		case "phpcs":
+			registry.AddCheck("phpcs", health.Binary("phpcs"))
+			return &process.Phpcs{
+				In:              in,
+				Out:             out,
+				TempFolder:      tempFolder,
+				StorageProvider: store,
+				PhpcsVersions:   c.PhpcsVersions,
+				Workers:         workers,
+				Timeout:         time.Duration(timeout),
+			}
+		case "lighthouse":
+			registry.AddCheck("lighthouse", health.Binary("lh"))
+			return &process.Lighthouse{
+				In:              in,
+				Out:             out,
+				TempFolder:      tempFolder,
+				StorageProvider: store,
+				Workers:         workers,
+				Timeout:         time.Duration(timeout),
+			}
+		case "response":
+			return &process.Response{
+				In:          in,
+				Out:         out,
+				Payloaders:  payloads,
+				ResultCache: results,
+				Pipeline:    cachePipeline,
+				Workers:     workers,
+			}
+		}
+		return nil
+	}
+
+	// Every stage takes the jobs of the previous one.
+	var in chan process.Processor
+	for i, s := range c.Stages {
+		var out chan process.Processor
+		if i < len(c.Stages)-1 {
+			out = make(chan process.Processor)
+		}
+
+		if s.Type != "fork" {
+			pipeline.Pipe.AddProcess(build(s, in, out))
+			in = out
+			continue
+		}
+
+		// Every branch takes a copy of the jobs, the join merges their results for the next stage.
+		fork := &process.Fork{
+			In: in,
+		}
+		join := &process.Join{
+			Out:     out,
+			Policy:  mergePolicies[s.Merge],
+			Timeout: time.Duration(s.JoinTimeout),
+		}
+
+		pipeline.Pipe.AddProcess(fork)
+		for _, branch := range s.Branches {
+			branchIn := make(chan process.Processor)
+			fork.Outs = append(fork.Outs, branchIn)
+
+			for _, b := range branch {
+				branchOut := make(chan process.Processor)
+				pipeline.Pipe.AddProcess(build(b, branchIn, branchOut))
+				branchIn = branchOut
+			}
+			join.Ins = append(join.Ins, branchIn)
+		}
+		pipeline.Pipe.AddProcess(join)
+
+		in = out
+	}
+
+	return pipeline, nil
+}
+
+// validateProvider returns the problems of a provider config.
+func validateProvider(name string, kinds map[string]Registration, p ProviderConfig) []string {
+	reg, ok := lookup(kinds, p.Kind)
+	if !ok {
+		return []string{fmt.Sprintf("%s: unknown kind `%s`, expected one of %s", name, p.Kind, strings.Join(kindsOf(kinds), ", "))}
+	}
+
+	var problems []string
+	for _, option := range reg.Required {
+		if p.Options[option] == "" {
+			problems = append(problems, fmt.Sprintf("%s: `%s` requires option `%s`", name, p.Kind, option))
+		}
+	}
+	return problems
+}
+
+// Duration is a time.Duration that configs set as a string, e.g. "1m30s", or as a number of seconds.
+type Duration time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	return d.set(value)
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value interface{}
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+	return d.set(value)
+}
+
+func (d *Duration) set(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		duration, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*d = Duration(duration)
+	case float64:
+		*d = Duration(v * float64(time.Second))
+	case int:
+		*d = Duration(time.Duration(v) * time.Second)
+	default:
+		return fmt.Errorf("invalid duration %v", value)
+	}
+	return nil
+}
@@ -0,0 +1,833 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wptide/pkg/cache"
+	"github.com/wptide/pkg/message"
+	"github.com/wptide/pkg/source"
+	"github.com/wptide/pkg/storage"
+)
+
+const validYAML = `
+temp_folder: /tmp/tide
+workers: 2
+timeout: 5m
+retry_backoff: 30
+message_provider:
+  kind: mock
+storage:
+  kind: local
+  options:
+    path: ${TEST_STORAGE_PATH}
+phpcs_versions:
+  phpcompatibility:
+    "7.0": "7.0"
+payloaders:
+  tide:
+    kind: file
+stages:
+  - type: ingest
+    cache_size: 1024
+  - type: info
+  - type: phpcs
+    workers: 4
+    timeout: 1m
+  - type: response
+`
+
+const validJSON = `{
+	"temp_folder": "/tmp/tide",
+	"storage": {"kind": "local", "options": {"path": "/srv/reports"}},
+	"payloaders": {"tide": {"kind": "file"}},
+	"stages": [
+		{"type": "ingest"},
+		{"type": "lighthouse", "timeout": "2m"},
+		{"type": "response"}
+	]
+}`
+
+const forkYAML = `
+temp_folder: /tmp/tide
+storage:
+  kind: local
+  options:
+    path: /srv/reports
+result_cache:
+  kind: local
+  options:
+    path: /srv/cache
+phpcs_versions:
+  phpcompatibility:
+    "7.0": "7.0"
+tool_versions:
+  phpcs: 3.3.0
+payloaders:
+  tide:
+    kind: file
+stages:
+  - type: ingest
+    extract_policy:
+      max_files: 100
+      symlinks: reject
+  - type: info
+  - type: fork
+    merge: error
+    join_timeout: 30m
+    branches:
+      - - type: phpcs
+          workers: 4
+      - - type: lighthouse
+  - type: response
+`
+
+type mockProvider struct{}
+
+func (m mockProvider) SendMessage(msg *message.Message) error    { return nil }
+func (m mockProvider) GetNextMessage() (*message.Message, error) { return nil, nil }
+func (m mockProvider) DeleteMessage(ref *string) error           { return nil }
+func (m mockProvider) Close() error                              { return nil }
+
+// mockQueue hands out its messages and records whether it was closed and how often it was purged.
+type mockQueue struct {
+	mockProvider
+	mutex    sync.Mutex
+	messages []*message.Message
+	closed   bool
+	purges   int
+}
+
+func (m *mockQueue) GetNextMessage() (*message.Message, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if len(m.messages) == 0 {
+		return nil, nil
+	}
+	msg := m.messages[0]
+	m.messages = m.messages[1:]
+	return msg, nil
+}
+
+func (m *mockQueue) Purge() (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.purges++
+	return 0, nil
+}
+
+func (m *mockQueue) Close() error {
+	m.closed = true
+	return nil
+}
+
+// Message provider of the "mock" kind.
+var queue = &mockQueue{}
+
+func init() {
+	Register(Registration{
+		Kind: "mock",
+		Messages: func(ctx context.Context, options map[string]string) (message.Provider, error) {
+			return queue, nil
+		},
+	})
+	Register(Registration{
+		Kind: "failing",
+		Storage: func(ctx context.Context, options map[string]string) (storage.Provider, error) {
+			return nil, errors.New("could not connect")
+		},
+	})
+	Register(Registration{
+		Kind: "failing",
+		Cache: func(ctx context.Context, options map[string]string) (cache.Provider, error) {
+			return nil, errors.New("could not connect")
+		},
+	})
+}
+
+func TestParse(t *testing.T) {
+	os.Setenv("TEST_STORAGE_PATH", "/srv/reports")
+	defer os.Unsetenv("TEST_STORAGE_PATH")
+
+	tests := []struct {
+		name     string
+		data     string
+		format   string
+		want     *Config
+		wantErr  bool
+		problems []string
+	}{
+		{
+			"Valid YAML",
+			validYAML,
+			"yaml",
+			&Config{
+				TempFolder:      "/tmp/tide",
+				Workers:         2,
+				Timeout:         Duration(5 * time.Minute),
+				RetryBackoff:    Duration(30 * time.Second),
+				MessageProvider: &ProviderConfig{Kind: "mock"},
+				Storage: &ProviderConfig{
+					Kind:    "local",
+					Options: map[string]string{"path": "/srv/reports"},
+				},
+				PhpcsVersions: map[string]map[string]string{
+					"phpcompatibility": {"7.0": "7.0"},
+				},
+				Payloaders: map[string]ProviderConfig{
+					"tide": {Kind: "file"},
+				},
+				Stages: []StageConfig{
+					{Type: "ingest", CacheSize: 1024},
+					{Type: "info"},
+					{Type: "phpcs", Workers: 4, Timeout: Duration(time.Minute)},
+					{Type: "response"},
+				},
+			},
+			false,
+			nil,
+		},
+		{
+			"Valid JSON",
+			validJSON,
+			"json",
+			&Config{
+				TempFolder: "/tmp/tide",
+				Storage: &ProviderConfig{
+					Kind:    "local",
+					Options: map[string]string{"path": "/srv/reports"},
+				},
+				Payloaders: map[string]ProviderConfig{
+					"tide": {Kind: "file"},
+				},
+				Stages: []StageConfig{
+					{Type: "ingest"},
+					{Type: "lighthouse", Timeout: Duration(2 * time.Minute)},
+					{Type: "response"},
+				},
+			},
+			false,
+			nil,
+		},
+		{
+			"Fork",
+			forkYAML,
+			"yaml",
+			&Config{
+				TempFolder: "/tmp/tide",
+				Storage: &ProviderConfig{
+					Kind:    "local",
+					Options: map[string]string{"path": "/srv/reports"},
+				},
+				ResultCache: &ProviderConfig{
+					Kind:    "local",
+					Options: map[string]string{"path": "/srv/cache"},
+				},
+				PhpcsVersions: map[string]map[string]string{
+					"phpcompatibility": {"7.0": "7.0"},
+				},
+				ToolVersions: map[string]string{"phpcs": "3.3.0"},
+				Payloaders: map[string]ProviderConfig{
+					"tide": {Kind: "file"},
+				},
+				Stages: []StageConfig{
+					{Type: "ingest", ExtractPolicy: &ExtractPolicyConfig{MaxFiles: 100, Symlinks: "reject"}},
+					{Type: "info"},
+					{
+						Type:        "fork",
+						Merge:       "error",
+						JoinTimeout: Duration(30 * time.Minute),
+						Branches: [][]StageConfig{
+							{{Type: "phpcs", Workers: 4}},
+							{{Type: "lighthouse"}},
+						},
+					},
+					{Type: "response"},
+				},
+			},
+			false,
+			nil,
+		},
+		{
+			"Unknown Format",
+			validJSON,
+			"toml",
+			nil,
+			true,
+			nil,
+		},
+		{
+			"Unknown YAML Field",
+			validYAML + "tmp_folder: /tmp\n",
+			"yaml",
+			nil,
+			true,
+			nil,
+		},
+		{
+			"Unknown JSON Field",
+			`{"stages": [{"type": "ingest", "worker": 2}]}`,
+			"json",
+			nil,
+			true,
+			nil,
+		},
+		{
+			"Invalid Duration",
+			`{"timeout": "soon"}`,
+			"json",
+			nil,
+			true,
+			nil,
+		},
+		{
+			"Wiring Mistakes",
+			`
+workers: -1
+message_provider:
+  kind: rabbitmq
+storage:
+  kind: local
+payloaders:
+  tide:
+    kind: tide
+stages:
+  - type: info
+  - type: ingest
+  - type: phpcs
+  - type: phpcs
+  - type: sniff
+  - type: response
+  - type: lighthouse
+`,
+			"yaml",
+			nil,
+			true,
+			[]string{
+				"workers can't be negative",
+				"message_provider: unknown kind `rabbitmq`, expected one of mock",
+				"storage: `local` requires option `path`",
+				"payloader `tide`: `tide` requires option `client_id`",
+				"payloader `tide`: `tide` requires option `client_secret`",
+				"payloader `tide`: `tide` requires option `auth_endpoint`",
+				"stage 1: the first stage has to be `ingest`, not `info`",
+				"stage 2: `ingest` has to be the first stage",
+				"stage 2: `ingest` requires a temp_folder",
+				"stage 3: `phpcs` requires a temp_folder",
+				"stage 3: `phpcs` requires phpcs_versions",
+				"stage 4: `phpcs` is already a stage",
+				"stage 4: `phpcs` requires a temp_folder",
+				"stage 4: `phpcs` requires phpcs_versions",
+				"stage 5: unknown type `sniff`",
+				"stage 6: `response` has to be the last stage",
+				"stage 7: the last stage has to be `response`, not `lighthouse`",
+				"stage 7: `lighthouse` requires a temp_folder",
+			},
+		},
+		{
+			"Fork Wiring Mistakes",
+			`
+temp_folder: /tmp/tide
+storage:
+  kind: local
+  options:
+    path: /srv/reports
+result_cache:
+  kind: redis
+payloaders:
+  tide:
+    kind: file
+stages:
+  - type: ingest
+    extract_policy:
+      max_files: -1
+      symlinks: follow
+  - type: info
+    merge: last
+    extract_policy: {}
+  - type: fork
+    merge: any
+    branches:
+      - []
+      - - type: info
+        - type: response
+        - type: sniff
+        - type: lighthouse
+  - type: fork
+  - type: response
+`,
+			"yaml",
+			nil,
+			true,
+			[]string{
+				"result_cache: unknown kind `redis`, expected one of failing, local",
+				"stage 1: extract_policy limits can't be negative",
+				"stage 1: extract_policy: unknown symlinks `follow`, expected skip or reject",
+				"stage 2: only `ingest` takes an extract_policy",
+				"stage 2: only `fork` takes branches, merge and join_timeout",
+				"stage 3: unknown merge `any`, expected first, last or error",
+				"stage 3: branch 1 requires at least one stage",
+				"stage 3, branch 2, stage 1: `info` is already a stage",
+				"stage 3, branch 2, stage 2: `response` can't be in a branch",
+				"stage 3, branch 2, stage 3: unknown type `sniff`",
+				"stage 4: `fork` is already a stage",
+				"stage 4: `fork` requires at least one branch",
+				"stage 5: `response` is already a stage",
+			},
+		},
+		{
+			"Environment Variables Only In Options",
+			`{
+	"temp_folder": "/tmp/${TEST_STORAGE_PATH}",
+	"storage": {"kind": "local", "options": {"path": "${TEST_STORAGE_PATH}/$HOME"}},
+	"payloaders": {"tide": {"kind": "file"}},
+	"stages": [{"type": "ingest"}, {"type": "response"}]
+}`,
+			"json",
+			&Config{
+				TempFolder: "/tmp/${TEST_STORAGE_PATH}",
+				Storage: &ProviderConfig{
+					Kind:    "local",
+					Options: map[string]string{"path": "/srv/reports/$HOME"},
+				},
+				Payloaders: map[string]ProviderConfig{
+					"tide": {Kind: "file"},
+				},
+				Stages: []StageConfig{
+					{Type: "ingest"},
+					{Type: "response"},
+				},
+			},
+			false,
+			nil,
+		},
+		{
+			"Unset Environment Variables",
+			`
+temp_folder: /tmp/$TEST_STORAGE_PATH
+storage:
+  kind: local
+  options:
+    path: ${TEST_UNSET_PATH}/reports
+payloaders:
+  tide:
+    kind: file
+stages:
+  - type: ingest
+  - type: response
+`,
+			"yaml",
+			nil,
+			true,
+			[]string{
+				"storage: option `path` uses `TEST_UNSET_PATH`, which is not set",
+			},
+		},
+		{
+			"No Stages",
+			`{"temp_folder": "/tmp/tide"}`,
+			"json",
+			nil,
+			true,
+			[]string{"requires at least one stage"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.data), tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+
+			if tt.problems != nil {
+				vErr, ok := err.(ValidationError)
+				if !ok {
+					t.Errorf("Parse() error = %T, want ValidationError", err)
+					return
+				}
+				if !reflect.DeepEqual(vErr.Problems, tt.problems) {
+					t.Errorf("ValidationError.Problems = %q, want %q", vErr.Problems, tt.problems)
+				}
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	os.Setenv("TEST_STORAGE_PATH", "/srv/reports")
+	defer os.Unsetenv("TEST_STORAGE_PATH")
+
+	readFile = func(path string) ([]byte, error) {
+		switch path {
+		case "pipeline.yml":
+			return []byte(validYAML), nil
+		case "pipeline.json":
+			return []byte(validJSON), nil
+		}
+		return ioutil.ReadFile(path)
+	}
+	defer func() {
+		readFile = ioutil.ReadFile
+	}()
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{
+			"YAML",
+			"pipeline.yml",
+			false,
+		},
+		{
+			"JSON",
+			"pipeline.json",
+			false,
+		},
+		{
+			"Unknown Extension",
+			"pipeline.toml",
+			true,
+		},
+		{
+			"Missing File",
+			"./testdata/missing.yaml",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(tt.path); (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfig_Build(t *testing.T) {
+	valid, err := Parse([]byte(validJSON), "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failing := *valid
+	failing.Storage = &ProviderConfig{Kind: "failing"}
+
+	withProvider := *valid
+	withProvider.MessageProvider = &ProviderConfig{Kind: "mock"}
+
+	fork, err := Parse([]byte(forkYAML), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failingCache := *fork
+	failingCache.ResultCache = &ProviderConfig{Kind: "failing"}
+
+	tests := []struct {
+		name         string
+		c            *Config
+		wantProvider bool
+		wantErr      string
+	}{
+		{
+			"Valid Config",
+			valid,
+			false,
+			"",
+		},
+		{
+			"Message Provider",
+			&withProvider,
+			true,
+			"",
+		},
+		{
+			"Invalid Config",
+			&Config{},
+			false,
+			"invalid pipeline config: requires at least one stage",
+		},
+		{
+			"Failing Storage",
+			&failing,
+			false,
+			"config: storage: could not connect",
+		},
+		{
+			"Fork",
+			fork,
+			false,
+			"",
+		},
+		{
+			"Failing Result Cache",
+			&failingCache,
+			false,
+			"config: result_cache: could not connect",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.c.Build(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Config.Build() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Config.Build() error = %v", err)
+				return
+			}
+
+			if got.Pipe == nil || got.Messages == nil {
+				t.Errorf("Config.Build() = %+v, want a pipe and a message channel", got)
+			}
+			if (got.Provider != nil) != tt.wantProvider {
+				t.Errorf("Config.Build() provider = %v, wantProvider %v", got.Provider, tt.wantProvider)
+			}
+
+			// The dependencies of the pipeline are checked for readiness.
+			checks := got.Health.Readiness(context.Background()).Checks
+			for _, name := range []string{"storage", "lighthouse"} {
+				if _, ok := checks[name]; !ok {
+					t.Errorf("Config.Build() health checks = %v, want %v", checks, name)
+				}
+			}
+		})
+	}
+}
+
+func TestConfig_Build_Run(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		format string
+	}{
+		{
+			"Stages",
+			validJSON,
+			"json",
+		},
+		{
+			"Fork",
+			forkYAML,
+			"yaml",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Parse([]byte(tt.data), tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pipeline, err := c.Build(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Every stage has what it needs to start.
+			errc := make(chan error)
+			if err := pipeline.Pipe.Start(&errc); err != nil {
+				t.Errorf("Pipe.Start() error = %v", err)
+			}
+			close(pipeline.Messages)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+			if err := pipeline.Pipe.Shutdown(ctx); err != nil {
+				t.Errorf("Pipe.Shutdown() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestConfig_Build_Close(t *testing.T) {
+	c, err := Parse([]byte(validJSON), "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.MessageProvider = &ProviderConfig{Kind: "mock"}
+
+	// The payloader can't authenticate.
+	c.Payloaders = map[string]ProviderConfig{
+		"tide": {
+			Kind: "tide",
+			Options: map[string]string{
+				"client_id":     "id",
+				"client_secret": "secret",
+				"auth_endpoint": "http://127.0.0.1:0/auth",
+			},
+		},
+	}
+
+	queue.closed = false
+	if _, err := c.Build(context.Background()); err == nil {
+		t.Errorf("Config.Build() error = nil, want error")
+	}
+	if !queue.closed {
+		t.Errorf("Config.Build() did not close the message provider")
+	}
+}
+
+func TestPipeline_Run(t *testing.T) {
+	if err := (&Pipeline{}).Run(context.Background()); err == nil {
+		t.Errorf("Pipeline.Run() error = nil, want error without a provider")
+	}
+
+	provider := &mockQueue{
+		messages: []*message.Message{
+			{Title: "One"},
+			{Title: "Two"},
+		},
+	}
+	pipeline := &Pipeline{
+		Messages:     make(chan message.Message),
+		Provider:     provider,
+		PollInterval: time.Millisecond * 10,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- pipeline.Run(ctx)
+	}()
+
+	for _, want := range []string{"One", "Two"} {
+		select {
+		case msg := <-pipeline.Messages:
+			if msg.Title != want {
+				t.Errorf("Pipeline.Run() sent %v, want %v", msg.Title, want)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("Pipeline.Run() did not send %v", want)
+		}
+	}
+
+	// The queue is empty, Run polls until it is cancelled and purges once per purge interval.
+	time.Sleep(time.Millisecond * 30)
+	cancel()
+
+	select {
+	case err := <-errc:
+		if err != context.Canceled {
+			t.Errorf("Pipeline.Run() error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Pipeline.Run() did not return after cancel")
+	}
+
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+	if provider.purges != 1 {
+		t.Errorf("Pipeline.Run() purged %v times, want 1", provider.purges)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	storageFactory := func(ctx context.Context, options map[string]string) (storage.Provider, error) {
+		return nil, nil
+	}
+	messageFactory := func(ctx context.Context, options map[string]string) (message.Provider, error) {
+		return nil, nil
+	}
+
+	tests := []struct {
+		name    string
+		reg     Registration
+		wantErr bool
+	}{
+		{
+			"Storage",
+			Registration{Kind: "test-storage", Storage: storageFactory},
+			false,
+		},
+		{
+			"Missing Kind",
+			Registration{Storage: storageFactory},
+			true,
+		},
+		{
+			"Missing Factory",
+			Registration{Kind: "test"},
+			true,
+		},
+		{
+			"Two Factories",
+			Registration{Kind: "test", Storage: storageFactory, Messages: messageFactory},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Register(tt.reg); (err != nil) != tt.wantErr {
+				t.Errorf("Register() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if !strings.Contains(strings.Join(StorageKinds(), ","), "test-storage") {
+		t.Errorf("StorageKinds() = %v, want test-storage", StorageKinds())
+	}
+	if got := PayloaderKinds(); !reflect.DeepEqual(got, []string{"file", "tide"}) {
+		t.Errorf("PayloaderKinds() = %v, want %v", got, []string{"file", "tide"})
+	}
+	if got := MessageKinds(); !reflect.DeepEqual(got, []string{"mock"}) {
+		t.Errorf("MessageKinds() = %v, want %v", got, []string{"mock"})
+	}
+	if got := CacheKinds(); !reflect.DeepEqual(got, []string{"failing", "local"}) {
+		t.Errorf("CacheKinds() = %v, want %v", got, []string{"failing", "local"})
+	}
+}
+
+func TestExtractPolicyConfig_Policy(t *testing.T) {
+	tests := []struct {
+		name string
+		e    ExtractPolicyConfig
+		want source.ExtractPolicy
+	}{
+		{
+			"Defaults",
+			ExtractPolicyConfig{},
+			source.DefaultExtractPolicy,
+		},
+		{
+			"Limits",
+			ExtractPolicyConfig{
+				MaxTotalSize:        1024,
+				MaxFiles:            10,
+				MaxCompressionRatio: 50,
+				Symlinks:            "reject",
+			},
+			source.ExtractPolicy{
+				MaxTotalSize:        1024,
+				MaxFiles:            10,
+				MaxCompressionRatio: 50,
+				Symlinks:            source.SymlinkReject,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.e.Policy(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExtractPolicyConfig.Policy() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
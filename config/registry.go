@@ -0,0 +1,165 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/wptide/pkg/cache"
+	localCache "github.com/wptide/pkg/cache/local"
+	"github.com/wptide/pkg/message"
+	"github.com/wptide/pkg/payload"
+	"github.com/wptide/pkg/storage"
+	"github.com/wptide/pkg/storage/local"
+	"github.com/wptide/pkg/tide/api"
+)
+
+// StorageFactory creates a storage provider from the options in a config.
+type StorageFactory func(ctx context.Context, options map[string]string) (storage.Provider, error)
+
+// MessageFactory creates a message provider from the options in a config.
+type MessageFactory func(ctx context.Context, options map[string]string) (message.Provider, error)
+
+// PayloaderFactory creates a payloader from the options in a config.
+type PayloaderFactory func(ctx context.Context, options map[string]string) (payload.Payloader, error)
+
+// CacheFactory creates a result cache from the options in a config.
+type CacheFactory func(ctx context.Context, options map[string]string) (cache.Provider, error)
+
+// Registration describes a kind of provider that configs can use. Exactly one of the factories is set.
+type Registration struct {
+	Kind      string           // Name of the kind in configs, e.g. "s3".
+	Required  []string         // (Optional) Options that configs have to set.
+	Storage   StorageFactory   // Creates storage providers.
+	Messages  MessageFactory   // Creates message providers.
+	Payloader PayloaderFactory // Creates payloaders.
+	Cache     CacheFactory     // Creates result caches.
+}
+
+var (
+	registryMutex sync.RWMutex
+	storages      = make(map[string]Registration)
+	messages      = make(map[string]Registration)
+	payloaders    = make(map[string]Registration)
+	caches        = make(map[string]Registration)
+)
+
+func init() {
+	Register(Registration{
+		Kind:     "local",
+		Required: []string{"path"},
+		Storage: func(ctx context.Context, options map[string]string) (storage.Provider, error) {
+			ref := options["collection"]
+			if ref == "" {
+				ref = options["path"]
+			}
+			return local.NewLocalStorage(options["path"], ref), nil
+		},
+	})
+
+	Register(Registration{
+		Kind:     "local",
+		Required: []string{"path"},
+		Cache: func(ctx context.Context, options map[string]string) (cache.Provider, error) {
+			return localCache.NewLocalCache(options["path"]), nil
+		},
+	})
+
+	Register(Registration{
+		Kind: "file",
+		Payloader: func(ctx context.Context, options map[string]string) (payload.Payloader, error) {
+			return payload.FilePayload{}, nil
+		},
+	})
+
+	Register(Registration{
+		Kind:     "tide",
+		Required: []string{"client_id", "client_secret", "auth_endpoint"},
+		Payloader: func(ctx context.Context, options map[string]string) (payload.Payloader, error) {
+			client := &api.Client{}
+			if err := client.Authenticate(options["client_id"], options["client_secret"], options["auth_endpoint"]); err != nil {
+				return nil, err
+			}
+			return payload.TidePayload{Client: client}, nil
+		},
+	})
+}
+
+// Register makes a kind of provider available for configs. Packages with more providers register them
+// in `init()`, so importing them is enough, e.g. "github.com/wptide/pkg/config/cloud".
+// Registering a kind again replaces the previous registration.
+func Register(reg Registration) error {
+	if reg.Kind == "" {
+		return errors.New("config: registration requires a kind")
+	}
+
+	var kinds map[string]Registration
+	factories := 0
+	if reg.Storage != nil {
+		kinds = storages
+		factories++
+	}
+	if reg.Messages != nil {
+		kinds = messages
+		factories++
+	}
+	if reg.Payloader != nil {
+		kinds = payloaders
+		factories++
+	}
+	if reg.Cache != nil {
+		kinds = caches
+		factories++
+	}
+	if factories != 1 {
+		return errors.New("config: registration requires exactly one factory")
+	}
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	kinds[reg.Kind] = reg
+	return nil
+}
+
+// StorageKinds returns the registered kinds of storage providers.
+func StorageKinds() []string {
+	return kindsOf(storages)
+}
+
+// MessageKinds returns the registered kinds of message providers.
+func MessageKinds() []string {
+	return kindsOf(messages)
+}
+
+// PayloaderKinds returns the registered kinds of payloaders.
+func PayloaderKinds() []string {
+	return kindsOf(payloaders)
+}
+
+// CacheKinds returns the registered kinds of result caches.
+func CacheKinds() []string {
+	return kindsOf(caches)
+}
+
+// lookup returns the registration of a kind.
+func lookup(kinds map[string]Registration, kind string) (Registration, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	reg, ok := kinds[kind]
+	return reg, ok
+}
+
+func kindsOf(kinds map[string]Registration) []string {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	names := make([]string, 0, len(kinds))
+	for kind := range kinds {
+		names = append(names, kind)
+	}
+	sort.Strings(names)
+	return names
+}
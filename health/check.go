@@ -0,0 +1,127 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/wptide/pkg/storage"
+)
+
+var (
+	// Using exec.LookPath as a variable so that we can mock it in tests.
+	lookPath = exec.LookPath
+
+	// Using ioutil.TempFile as a variable so that we can mock it in tests.
+	tempFile = ioutil.TempFile
+)
+
+// CheckTimeout is the time a check can take before it fails.
+const CheckTimeout = 10 * time.Second
+
+// Check checks a dependency of the pipeline, e.g. that the storage provider can be reached.
+type Check interface {
+	Check(ctx context.Context) error
+}
+
+// CheckFunc is a function that implements Check.
+type CheckFunc func(ctx context.Context) error
+
+// Check calls f(ctx).
+func (f CheckFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Pinger is implemented by storage providers that can tell whether they can be reached,
+// without uploading a file.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Binary checks that a binary is in the PATH, e.g. phpcs or lighthouse.
+func Binary(name string) Check {
+	return CheckFunc(func(ctx context.Context) error {
+		_, err := lookPath(name)
+		return err
+	})
+}
+
+// Storage checks that a storage provider can be reached. Providers that don't implement Pinger can only
+// be checked by uploading a small file, which is opt-in: they are checked if there is a reference to upload to,
+// so that nothing is written to the storage by default.
+func Storage(provider storage.Provider, reference string) Check {
+	return CheckFunc(func(ctx context.Context) error {
+		if provider == nil {
+			return errors.New("no storage provider")
+		}
+		if pinger, ok := provider.(Pinger); ok {
+			return pinger.Ping(ctx)
+		}
+		if reference == "" {
+			return nil
+		}
+
+		f, err := tempFile("", "tide-health")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+
+		_, err = f.WriteString("ok")
+		f.Close()
+		if err != nil {
+			return err
+		}
+
+		return provider.UploadFile(f.Name(), reference)
+	})
+}
+
+// check is a check of the registry with its last result.
+type check struct {
+	Check
+	mutex  sync.Mutex
+	status CheckStatus
+}
+
+// run runs the check, unless its last result is more recent than the interval.
+func (c *check) run(ctx context.Context, interval time.Duration) CheckStatus {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.status.CheckedAt.IsZero() && now().Sub(c.status.CheckedAt) < interval {
+		return c.status
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+	defer cancel()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.Check.Check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	c.status = CheckStatus{
+		Status:    StatusOK,
+		CheckedAt: now(),
+	}
+	if err != nil {
+		c.status.Status = StatusFail
+		c.status.Error = err.Error()
+	}
+	return c.status
+}
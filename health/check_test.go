@@ -0,0 +1,195 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+type mockStorage struct {
+	uploaded  string
+	uploadErr error
+}
+
+func (m *mockStorage) Kind() string {
+	return "mock"
+}
+
+func (m *mockStorage) CollectionRef() string {
+	return ""
+}
+
+func (m *mockStorage) UploadFile(filename, reference string) error {
+	m.uploaded = reference
+	return m.uploadErr
+}
+
+func (m *mockStorage) DownloadFile(reference, filename string) error {
+	return nil
+}
+
+type mockPinger struct {
+	mockStorage
+	err error
+}
+
+func (m *mockPinger) Ping(ctx context.Context) error {
+	return m.err
+}
+
+func TestBinary(t *testing.T) {
+	lookPath = func(file string) (string, error) {
+		if file == "phpcs" {
+			return "/usr/local/bin/phpcs", nil
+		}
+		return "", errors.New("executable file not found in $PATH")
+	}
+	defer func() {
+		lookPath = exec.LookPath
+	}()
+
+	tests := []struct {
+		name    string
+		binary  string
+		wantErr bool
+	}{
+		{
+			"Found",
+			"phpcs",
+			false,
+		},
+		{
+			"Missing",
+			"lh",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Binary(tt.binary).Check(context.Background()); (err != nil) != tt.wantErr {
+				t.Errorf("Binary() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStorage(t *testing.T) {
+	tests := []struct {
+		name         string
+		provider     *mockStorage
+		pinger       *mockPinger
+		reference    string
+		tempFileFail bool
+		wantUploaded string
+		wantErr      bool
+	}{
+		{
+			"Upload",
+			&mockStorage{},
+			nil,
+			".tide-health",
+			false,
+			".tide-health",
+			false,
+		},
+		{
+			"No Upload Without Reference",
+			&mockStorage{},
+			nil,
+			"",
+			false,
+			"",
+			false,
+		},
+		{
+			"Upload Failed",
+			&mockStorage{uploadErr: errors.New("access denied")},
+			nil,
+			".tide-health",
+			false,
+			".tide-health",
+			true,
+		},
+		{
+			"Temp File Failed",
+			&mockStorage{},
+			nil,
+			".tide-health",
+			true,
+			"",
+			true,
+		},
+		{
+			"Ping",
+			nil,
+			&mockPinger{},
+			".tide-health",
+			false,
+			"",
+			false,
+		},
+		{
+			"Ping Failed",
+			nil,
+			&mockPinger{err: errors.New("bucket not found")},
+			".tide-health",
+			false,
+			"",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.tempFileFail {
+				tempFile = func(dir, prefix string) (*os.File, error) {
+					return nil, errors.New("disk full")
+				}
+				defer func() {
+					tempFile = ioutil.TempFile
+				}()
+			}
+
+			var err error
+			var uploaded string
+			if tt.pinger != nil {
+				err = Storage(tt.pinger, tt.reference).Check(context.Background())
+				uploaded = tt.pinger.uploaded
+			} else {
+				err = Storage(tt.provider, tt.reference).Check(context.Background())
+				uploaded = tt.provider.uploaded
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Storage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if uploaded != tt.wantUploaded {
+				t.Errorf("Storage() uploaded = %v, want %v", uploaded, tt.wantUploaded)
+			}
+		})
+	}
+
+	if err := Storage(nil, ".tide-health").Check(context.Background()); err == nil {
+		t.Errorf("Storage(nil) error = nil, want error")
+	}
+}
+
+func TestCheck_Timeout(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	c := &check{Check: CheckFunc(func(ctx context.Context) error {
+		<-block
+		return nil
+	})}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	if got := c.run(ctx, time.Minute); got.Status != StatusFail {
+		t.Errorf("check.run() = %+v, want a failed check", got)
+	}
+}
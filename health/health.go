@@ -0,0 +1,407 @@
+// Package health tells an orchestrator whether the workers of a pipeline are alive and ready for work.
+//
+// Every pipeline has its own Registry, so that pipelines with the same stage names don't share their state.
+// Processes and message providers that implement Reporter report into it: workers of a process beat while
+// they work on a job and record progress once the job is handed on, providers record how their calls ended.
+// Dependencies of the pipeline, e.g. the storage provider or the phpcs binary, are added as checks:
+//
+//	r := health.NewRegistry()
+//	r.AddCheck("phpcs", health.Binary("phpcs"))
+//	http.Handle("/livez", r.LivenessHandler())
+//	http.Handle("/readyz", r.ReadinessHandler())
+//
+// A worker is alive unless it has been busy with a job without a heartbeat for longer than the stall
+// timeout, e.g. because it is stuck on a blocked channel. The pipeline is ready if every worker is alive,
+// no component stopped or is failing, and every check passes.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Status of a report.
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// DefaultStallTimeout is the time a busy worker can go without a heartbeat. Audits can take minutes.
+const DefaultStallTimeout = 15 * time.Minute
+
+// DefaultCheckInterval is the time the result of a check is reused for.
+const DefaultCheckInterval = 30 * time.Second
+
+// Using time.Now as a variable so that we can mock it in tests.
+var now = time.Now
+
+// Reporter is implemented by processes and providers that report into a Registry.
+type Reporter interface {
+	SetHealth(r *Registry)
+}
+
+// Registry keeps the components that report into it and the checks of dependencies.
+// A nil Registry records nothing.
+type Registry struct {
+	StallTimeout  time.Duration // (Optional) Time a busy worker can go without a heartbeat. Defaults to DefaultStallTimeout.
+	CheckInterval time.Duration // (Optional) Time the result of a check is reused for. Defaults to DefaultCheckInterval.
+	mutex         sync.Mutex
+	components    map[string]*Component
+	checks        map[string]*check
+}
+
+// Report is the outcome of a liveness or readiness probe.
+type Report struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components,omitempty"`
+	Checks     map[string]CheckStatus     `json:"checks,omitempty"`
+}
+
+// ComponentStatus is the state of a component in a report.
+type ComponentStatus struct {
+	Status        string    `json:"status"`
+	Workers       int       `json:"workers"` // Workers that are running.
+	Busy          int       `json:"busy"`    // Workers that are working on a job.
+	Stalled       int       `json:"stalled"` // Busy workers without a heartbeat for longer than the stall timeout.
+	LastHeartbeat time.Time `json:"last_heartbeat,omitempty"`
+	LastProgress  time.Time `json:"last_progress,omitempty"`
+	Error         string    `json:"error,omitempty"` // Error of the last call of a provider, if it failed.
+	Stopped       bool      `json:"stopped,omitempty"`
+}
+
+// CheckStatus is the outcome of a check in a report.
+type CheckStatus struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		components: make(map[string]*Component),
+		checks:     make(map[string]*check),
+	}
+}
+
+// Component returns the component with the name, it is created on first use.
+// Components are shared by name, e.g. the workers of a process report into the same component.
+// A nil Registry returns a nil Component.
+func (r *Registry) Component(name string) *Component {
+	if r == nil {
+		return nil
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	c, ok := r.components[name]
+	if !ok {
+		c = &Component{
+			workers: make(map[*Worker]struct{}),
+		}
+		r.components[name] = c
+	}
+	return c
+}
+
+// AddCheck adds a check of a dependency, it replaces a check with the same name.
+func (r *Registry) AddCheck(name string, c Check) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.checks[name] = &check{Check: c}
+}
+
+// RemoveCheck removes a check.
+func (r *Registry) RemoveCheck(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.checks, name)
+}
+
+// Liveness reports whether the workers are alive, it fails if a worker stalled.
+func (r *Registry) Liveness() Report {
+	report := Report{
+		Status:     StatusOK,
+		Components: r.componentStatus(),
+	}
+
+	for _, status := range report.Components {
+		if status.Stalled > 0 {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+// Readiness reports whether the pipeline is ready for work. It fails if a worker stalled, a component
+// stopped or failed, or a check of a dependency failed.
+func (r *Registry) Readiness(ctx context.Context) Report {
+	report := Report{
+		Status:     StatusOK,
+		Components: r.componentStatus(),
+		Checks:     r.runChecks(ctx),
+	}
+
+	for _, status := range report.Components {
+		if status.Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	for _, status := range report.Checks {
+		if status.Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+// LivenessHandler serves the liveness report as JSON, with status 503 if it failed.
+func (r *Registry) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeReport(w, r.Liveness())
+	})
+}
+
+// ReadinessHandler serves the readiness report as JSON, with status 503 if it failed.
+func (r *Registry) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeReport(w, r.Readiness(req.Context()))
+	})
+}
+
+func (r *Registry) stallTimeout() time.Duration {
+	if r.StallTimeout > 0 {
+		return r.StallTimeout
+	}
+	return DefaultStallTimeout
+}
+
+func (r *Registry) checkInterval() time.Duration {
+	if r.CheckInterval > 0 {
+		return r.CheckInterval
+	}
+	return DefaultCheckInterval
+}
+
+func (r *Registry) componentStatus() map[string]ComponentStatus {
+	r.mutex.Lock()
+	components := make(map[string]*Component, len(r.components))
+	for name, c := range r.components {
+		components[name] = c
+	}
+	r.mutex.Unlock()
+
+	status := make(map[string]ComponentStatus, len(components))
+	for name, c := range components {
+		status[name] = c.status(r.stallTimeout())
+	}
+	return status
+}
+
+func (r *Registry) runChecks(ctx context.Context) map[string]CheckStatus {
+	r.mutex.Lock()
+	names := make([]string, 0, len(r.checks))
+	for name := range r.checks {
+		names = append(names, name)
+	}
+	checks := make(map[string]*check, len(r.checks))
+	for name, c := range r.checks {
+		checks[name] = c
+	}
+	r.mutex.Unlock()
+
+	sort.Strings(names)
+
+	status := make(map[string]CheckStatus, len(names))
+	for _, name := range names {
+		status[name] = checks[name].run(ctx, r.checkInterval())
+	}
+	return status
+}
+
+func writeReport(w http.ResponseWriter, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// Component is a part of the pipeline that reports into the registry, e.g. a process or a message provider.
+// A nil Component does nothing, so that providers can report without checking whether they have a registry.
+type Component struct {
+	mutex         sync.Mutex
+	workers       map[*Worker]struct{}
+	started       bool // A worker was started, the component stopped once all of them stopped.
+	lastHeartbeat time.Time
+	lastProgress  time.Time
+	err           error
+}
+
+// Worker starts a worker of the component, call Stop once the worker exits.
+func (c *Component) Worker() *Worker {
+	if c == nil {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	w := &Worker{
+		component: c,
+	}
+	c.workers[w] = struct{}{}
+	c.started = true
+	c.lastHeartbeat = now()
+	return w
+}
+
+// Beat records that the component is alive.
+func (c *Component) Beat() {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.lastHeartbeat = now()
+}
+
+// Done records how a call of the component ended, e.g. a call of a message provider.
+// A failed call makes the component fail until a call succeeds again.
+func (c *Component) Done(err error) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	t := now()
+	c.lastHeartbeat = t
+	c.err = err
+	if err == nil {
+		c.lastProgress = t
+	}
+}
+
+// Call records how a call of the component ended once it returns, e.g.:
+//
+//	defer m.health.Call(&err)
+func (c *Component) Call(err *error) {
+	if err != nil {
+		c.Done(*err)
+		return
+	}
+	c.Done(nil)
+}
+
+func (c *Component) status(stallTimeout time.Duration) ComponentStatus {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	t := now()
+	status := ComponentStatus{
+		Status:        StatusOK,
+		Workers:       len(c.workers),
+		LastHeartbeat: c.lastHeartbeat,
+		LastProgress:  c.lastProgress,
+		Stopped:       c.started && len(c.workers) == 0,
+	}
+
+	for w := range c.workers {
+		if !w.busy {
+			continue
+		}
+		status.Busy++
+		if t.Sub(w.lastHeartbeat) > stallTimeout {
+			status.Stalled++
+		}
+	}
+
+	if c.err != nil {
+		status.Error = c.err.Error()
+	}
+	if status.Stalled > 0 || status.Stopped || c.err != nil {
+		status.Status = StatusFail
+	}
+	return status
+}
+
+// Worker is a goroutine of a component. A nil worker does nothing, so that processes can report
+// without checking whether they were started with one.
+type Worker struct {
+	component     *Component
+	busy          bool
+	lastHeartbeat time.Time
+}
+
+// Beat records that the worker is alive, e.g. when a step of a job started or ended.
+func (w *Worker) Beat() {
+	if w == nil {
+		return
+	}
+	c := w.component
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	w.lastHeartbeat = now()
+	c.lastHeartbeat = w.lastHeartbeat
+}
+
+// Busy records that the worker took a job.
+func (w *Worker) Busy() {
+	if w == nil {
+		return
+	}
+	c := w.component
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	w.busy = true
+	w.lastHeartbeat = now()
+	c.lastHeartbeat = w.lastHeartbeat
+}
+
+// Idle records that the worker is done with its job and waits for the next one.
+// It is progress if the worker was busy.
+func (w *Worker) Idle() {
+	if w == nil {
+		return
+	}
+	c := w.component
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	t := now()
+	if w.busy {
+		c.lastProgress = t
+	}
+	w.busy = false
+	w.lastHeartbeat = t
+	c.lastHeartbeat = t
+}
+
+// Stop records that the worker exited.
+func (w *Worker) Stop() {
+	if w == nil {
+		return
+	}
+	c := w.component
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.workers, w)
+}
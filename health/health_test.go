@@ -0,0 +1,268 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// mockNow replaces now with a clock that can be moved forward.
+func mockNow() (func(d time.Duration), func()) {
+	t := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time {
+		return t
+	}
+	wait := func(d time.Duration) {
+		t = t.Add(d)
+	}
+	reset := func() {
+		now = time.Now
+	}
+	return wait, reset
+}
+
+func TestRegistry_Liveness(t *testing.T) {
+	tests := []struct {
+		name       string
+		report     func(r *Registry, wait func(d time.Duration))
+		wantStatus string
+		want       ComponentStatus
+	}{
+		{
+			"Idle",
+			func(r *Registry, wait func(d time.Duration)) {
+				w := r.Component("PHPCS").Worker()
+				w.Busy()
+				w.Idle()
+				wait(time.Hour)
+			},
+			StatusOK,
+			ComponentStatus{Status: StatusOK, Workers: 1},
+		},
+		{
+			"Busy",
+			func(r *Registry, wait func(d time.Duration)) {
+				w := r.Component("PHPCS").Worker()
+				w.Busy()
+				wait(time.Minute)
+				w.Beat()
+				wait(time.Minute)
+			},
+			StatusOK,
+			ComponentStatus{Status: StatusOK, Workers: 1, Busy: 1},
+		},
+		{
+			"Stalled",
+			func(r *Registry, wait func(d time.Duration)) {
+				r.Component("PHPCS").Worker().Busy()
+				r.Component("PHPCS").Worker()
+				wait(time.Minute * 2)
+			},
+			StatusFail,
+			ComponentStatus{Status: StatusFail, Workers: 2, Busy: 1, Stalled: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wait, reset := mockNow()
+			defer reset()
+
+			r := NewRegistry()
+			r.StallTimeout = time.Minute
+			tt.report(r, wait)
+
+			got := r.Liveness()
+			if got.Status != tt.wantStatus {
+				t.Errorf("Registry.Liveness() Status = %v, want %v", got.Status, tt.wantStatus)
+			}
+
+			status := got.Components["PHPCS"]
+			status.LastHeartbeat, status.LastProgress = time.Time{}, time.Time{}
+			if status != tt.want {
+				t.Errorf("Registry.Liveness() PHPCS = %+v, want %+v", status, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistry_Readiness(t *testing.T) {
+	failing := CheckFunc(func(ctx context.Context) error {
+		return errors.New("phpcs not found")
+	})
+
+	tests := []struct {
+		name       string
+		report     func(r *Registry)
+		wantStatus string
+	}{
+		{
+			"Ready",
+			func(r *Registry) {
+				r.Component("Ingest").Worker()
+				r.Component("sqs").Done(nil)
+				r.AddCheck("storage", CheckFunc(func(ctx context.Context) error {
+					return nil
+				}))
+			},
+			StatusOK,
+		},
+		{
+			"Stopped",
+			func(r *Registry) {
+				r.Component("Ingest").Worker().Stop()
+			},
+			StatusFail,
+		},
+		{
+			"Failing Provider",
+			func(r *Registry) {
+				r.Component("sqs").Done(errors.New("queue not found"))
+			},
+			StatusFail,
+		},
+		{
+			"Recovered Provider",
+			func(r *Registry) {
+				r.Component("sqs").Done(errors.New("queue not found"))
+				r.Component("sqs").Done(nil)
+			},
+			StatusOK,
+		},
+		{
+			"Failing Check",
+			func(r *Registry) {
+				r.AddCheck("phpcs", failing)
+			},
+			StatusFail,
+		},
+		{
+			"Removed Check",
+			func(r *Registry) {
+				r.AddCheck("phpcs", failing)
+				r.RemoveCheck("phpcs")
+			},
+			StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			tt.report(r)
+
+			if got := r.Readiness(context.Background()); got.Status != tt.wantStatus {
+				t.Errorf("Registry.Readiness() = %+v, want status %v", got, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestRegistry_Readiness_Cached(t *testing.T) {
+	wait, reset := mockNow()
+	defer reset()
+
+	calls := 0
+	r := NewRegistry()
+	r.CheckInterval = time.Minute
+	r.AddCheck("storage", CheckFunc(func(ctx context.Context) error {
+		calls++
+		return nil
+	}))
+
+	r.Readiness(context.Background())
+	wait(time.Second * 30)
+	r.Readiness(context.Background())
+	if calls != 1 {
+		t.Errorf("Registry.Readiness() checks = %d, want 1", calls)
+	}
+
+	wait(time.Minute)
+	r.Readiness(context.Background())
+	if calls != 2 {
+		t.Errorf("Registry.Readiness() checks = %d, want 2", calls)
+	}
+}
+
+func TestRegistry_Handlers(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    func(r *Registry) http.Handler
+		report     func(r *Registry)
+		wantStatus int
+	}{
+		{
+			"Live",
+			(*Registry).LivenessHandler,
+			func(r *Registry) {
+				r.Component("Ingest").Worker()
+			},
+			http.StatusOK,
+		},
+		{
+			"Live with failing check",
+			(*Registry).LivenessHandler,
+			func(r *Registry) {
+				r.AddCheck("phpcs", Binary("phpcs-missing-binary"))
+			},
+			http.StatusOK,
+		},
+		{
+			"Not Ready",
+			(*Registry).ReadinessHandler,
+			func(r *Registry) {
+				r.AddCheck("phpcs", Binary("phpcs-missing-binary"))
+			},
+			http.StatusServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			tt.report(r)
+
+			rec := httptest.NewRecorder()
+			tt.handler(r).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("handler status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("handler Content-Type = %v, want application/json", got)
+			}
+
+			var report Report
+			if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+				t.Errorf("handler body is not a report: %v", err)
+			}
+		})
+	}
+}
+
+func TestComponent_Call(t *testing.T) {
+	r := NewRegistry()
+	c := r.Component("test-provider")
+
+	err := errors.New("queue not found")
+	c.Call(&err)
+
+	status := r.Liveness().Components["test-provider"]
+	if status.Status != StatusFail || status.Error != "queue not found" {
+		t.Errorf("Component.Call() status = %+v, want failing with the error", status)
+	}
+
+	err = nil
+	c.Call(&err)
+
+	status = r.Liveness().Components["test-provider"]
+	if status.Status != StatusOK || status.LastProgress.IsZero() {
+		t.Errorf("Component.Call() status = %+v, want ok with progress", status)
+	}
+
+	// Without a registry nothing is recorded.
+	var none *Registry
+	none.Component("test-provider").Call(&err)
+	none.Component("test-provider").Worker().Busy()
+}
@@ -8,7 +8,9 @@ import (
 	"time"
 
 	"cloud.google.com/go/firestore"
+	"github.com/wptide/pkg/health"
 	"github.com/wptide/pkg/message"
+	"github.com/wptide/pkg/metrics"
 	fsClient "github.com/wptide/pkg/wrapper/firestore"
 )
 
@@ -18,17 +20,42 @@ const (
 
 	// LockDuration sets how long an item needs to be locked for.
 	LockDuration  time.Duration = time.Minute * 10
+
+	// PurgeBatch is the number of Documents that a purge removes at most.
+	PurgeBatch = 500
 )
 
 // Provider implements the Provider interface.
 type Provider struct {
-	ctx      context.Context
-	client   fsClient.ClientInterface
-	rootPath string
+	ctx       context.Context
+	client    fsClient.ClientInterface
+	rootPath  string
+	workerID  string
+	retention time.Duration
+	health    *health.Component
+}
+
+// SetWorkerID sets the ID that is recorded for the messages this provider takes.
+// Defaults to message.DefaultWorkerID().
+func (fs *Provider) SetWorkerID(id string) {
+	fs.workerID = id
+}
+
+// SetHealth sets the registry that the calls to Firestore are reported into.
+func (fs *Provider) SetHealth(r *health.Registry) {
+	fs.health = r.Component("firestore")
+}
+
+// SetRetention sets the time Documents are kept for once they completed, failed or died, see Purge.
+// Without it, Documents are kept so that their status can be read.
+func (fs *Provider) SetRetention(retention time.Duration) {
+	fs.retention = retention
 }
 
 // SendMessage sends a message to Firestore.
-func (fs Provider) SendMessage(msg *message.Message) error {
+func (fs Provider) SendMessage(msg *message.Message) (err error) {
+	defer metrics.Start(metrics.QueueOperations, metrics.Labels{"provider": "firestore", "operation": "send"})(&err)
+	defer fs.health.Call(&err)
 	return fs.client.AddDoc(fs.rootPath, generateMessage(msg))
 }
 
@@ -36,7 +63,15 @@ func (fs Provider) SendMessage(msg *message.Message) error {
 //
 // This uses Firestore transactions to update the lock time and
 // available retries for an item.
-func (fs Provider) GetNextMessage() (*message.Message, error) {
+func (fs Provider) GetNextMessage() (msg *message.Message, err error) {
+	defer metrics.Start(metrics.QueueOperations, metrics.Labels{"provider": "firestore", "operation": "get"})(&err)
+	defer fs.health.Call(&err)
+
+	workerID := fs.workerID
+	if workerID == "" {
+		workerID = message.DefaultWorkerID()
+	}
+
 	items, err := fs.client.QueryItems(
 		// Collection to get the message from.
 		fs.rootPath,
@@ -63,18 +98,20 @@ func (fs Provider) GetNextMessage() (*message.Message, error) {
 				retryAvailable = false
 			}
 
-			// Update retry fields and lock.
+			// Update retry fields, lock and status.
+			now := time.Now()
 			out := map[string]interface{}{
 				"retries":         retries,
 				"retry_available": retryAvailable,
-				"lock":            time.Now().Add(LockDuration).UnixNano(),
+				"lock":            now.Add(LockDuration).UnixNano(),
+				"status":          message.StatusInProgress,
+				"worker_id":       workerID,
+				"started":         now.UnixNano(),
 			}
 			return out, nil
 		},
 	)
 
-	var msg *message.Message
-
 	if len(items) > 0 {
 		// Convert the data (interface map) to a QueueMessage object.
 		qmsg := itom(items[0].(map[string]interface{}))
@@ -92,10 +129,145 @@ func (fs Provider) GetNextMessage() (*message.Message, error) {
 }
 
 // DeleteMessage deletes a Document from Firestore.
-func (fs Provider) DeleteMessage(ref *string) error {
+func (fs Provider) DeleteMessage(ref *string) (err error) {
+	defer metrics.Start(metrics.QueueOperations, metrics.Labels{"provider": "firestore", "operation": "delete"})(&err)
+	defer fs.health.Call(&err)
 	return fs.client.DeleteDoc(fmt.Sprintf("%s/%s", fs.rootPath, *ref))
 }
 
+// ReleaseMessage unlocks a Document in Firestore after the delay, so that the message can be retried.
+// Messages without retries left are dead.
+func (fs Provider) ReleaseMessage(ref *string, delay time.Duration) (err error) {
+	defer metrics.Start(metrics.QueueOperations, metrics.Labels{"provider": "firestore", "operation": "release"})(&err)
+	defer fs.health.Call(&err)
+
+	path := fmt.Sprintf("%s/%s", fs.rootPath, *ref)
+
+	if qm := itom(fs.client.GetDoc(path)); qm != nil && !qm.RetryAvailable {
+		now := time.Now()
+		return fs.client.SetDoc(path, map[string]interface{}{
+			"status":       message.StatusDead,
+			"reason":       "no retries left",
+			"finished":     now.UnixNano(),
+			"completed_at": now,
+		})
+	}
+
+	return fs.client.SetDoc(path, map[string]interface{}{
+		"lock":   time.Now().Add(delay).UnixNano(),
+		"status": message.StatusPending,
+	})
+}
+
+// CompleteMessage marks a Document in Firestore as completed, it is kept so that its status can be read
+// until the retention is over, see SetRetention.
+func (fs Provider) CompleteMessage(ref *string) (err error) {
+	defer metrics.Start(metrics.QueueOperations, metrics.Labels{"provider": "firestore", "operation": "complete"})(&err)
+	defer fs.health.Call(&err)
+
+	now := time.Now()
+	return fs.client.SetDoc(fmt.Sprintf("%s/%s", fs.rootPath, *ref), map[string]interface{}{
+		"status":          message.StatusCompleted,
+		"retry_available": false,
+		"finished":        now.UnixNano(),
+		"completed_at":    now,
+	})
+}
+
+// FailMessage marks a Document in Firestore as failed, so that the message is not retried.
+func (fs Provider) FailMessage(ref *string, reason string) (err error) {
+	defer metrics.Start(metrics.QueueOperations, metrics.Labels{"provider": "firestore", "operation": "fail"})(&err)
+	defer fs.health.Call(&err)
+
+	now := time.Now()
+	return fs.client.SetDoc(fmt.Sprintf("%s/%s", fs.rootPath, *ref), map[string]interface{}{
+		"status":          message.StatusFailed,
+		"reason":          reason,
+		"retry_available": false,
+		"finished":        now.UnixNano(),
+		"completed_at":    now,
+	})
+}
+
+// Purge marks Documents as dead whose worker stopped during their last attempt, so that they are
+// purged too, and removes up to PurgeBatch Documents that completed, failed or died longer than
+// the retention ago, Firestore doesn't remove them by itself. Without a retention nothing is removed.
+func (fs Provider) Purge() (purged int, err error) {
+	defer metrics.Start(metrics.QueueOperations, metrics.Labels{"provider": "firestore", "operation": "purge"})(&err)
+	defer fs.health.Call(&err)
+
+	if err := fs.expireLocks(); err != nil {
+		return 0, err
+	}
+
+	if fs.retention <= 0 {
+		return 0, nil
+	}
+
+	items, err := fs.client.QueryItems(
+		fs.rootPath,
+		[]fsClient.Condition{
+			{"completed_at", "<", time.Now().Add(-fs.retention)},
+		},
+		nil,
+		PurgeBatch,
+		nil,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, item := range items {
+		ref, ok := item.(map[string]interface{})["_id"].(string)
+		if !ok {
+			continue
+		}
+		if err = fs.client.DeleteDoc(fmt.Sprintf("%s/%s", fs.rootPath, ref)); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// expireLocks marks up to PurgeBatch Documents as dead whose lock expired during their last attempt.
+func (fs Provider) expireLocks() error {
+	_, err := fs.client.QueryItems(
+		fs.rootPath,
+		[]fsClient.Condition{
+			{"status", "==", message.StatusInProgress},
+			{"retry_available", "==", false},
+			{"lock", "<", time.Now().UnixNano()},
+		},
+		nil,
+		PurgeBatch,
+		func(data map[string]interface{}) (map[string]interface{}, error) {
+			// The message died when its lock expired.
+			lock, _ := data["lock"].(int64)
+			return map[string]interface{}{
+				"status":       message.StatusDead,
+				"reason":       "worker stopped during the last attempt",
+				"finished":     lock,
+				"completed_at": time.Unix(0, lock),
+			}, nil
+		},
+	)
+	return err
+}
+
+// GetStatus reads the status of the job of a Document in Firestore.
+func (fs Provider) GetStatus(ref *string) (status *message.JobStatus, err error) {
+	defer metrics.Start(metrics.QueueOperations, metrics.Labels{"provider": "firestore", "operation": "status"})(&err)
+
+	qm := itom(fs.client.GetDoc(fmt.Sprintf("%s/%s", fs.rootPath, *ref)))
+	if qm == nil {
+		return nil, errors.New("firestore: message not found")
+	}
+
+	return qm.JobStatus(time.Now()), nil
+}
+
 // Close the Firestore client.
 func (fs Provider) Close() error {
 	if fs.client != nil {
@@ -130,7 +302,7 @@ func generateMessage(in *message.Message) map[string]interface{} {
 		"lock":            int64(0),
 		"retries":         int64(RetryAttempts),
 		"message":         msgMap,
-		"status":          "pending",
+		"status":          message.StatusPending,
 		"retry_available": true,
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/wptide/pkg/message"
 	fsClient "github.com/wptide/pkg/wrapper/firestore"
@@ -136,6 +137,358 @@ func TestFirestoreProvider_DeleteMessage(t *testing.T) {
 	}
 }
 
+func TestFirestoreProvider_ReleaseMessage(t *testing.T) {
+	ctx := context.Background()
+	simpleClient, _ := NewWithClient(ctx, "mock-client", "release-message", &mockClient{})
+	failClient, _ := NewWithClient(ctx, "mock-client", "test-fail", &mockClient{})
+
+	tests := []struct {
+		name    string
+		fs      *Provider
+		ref     string
+		wantErr bool
+	}{
+		{
+			"Release Message",
+			simpleClient,
+			"BY7p9iOYjbT7Au4laiJ7",
+			false,
+		},
+		{
+			"Release Message Fail",
+			failClient,
+			"BY7p9iOYjbT7Au4laiJ7",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.fs.ReleaseMessage(&tt.ref, time.Minute); (err != nil) != tt.wantErr {
+				t.Errorf("Provider.ReleaseMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFirestoreProvider_FailMessage(t *testing.T) {
+	ctx := context.Background()
+	simpleClient, _ := NewWithClient(ctx, "mock-client", "fail-message", &mockClient{})
+	failClient, _ := NewWithClient(ctx, "mock-client", "test-fail", &mockClient{})
+
+	tests := []struct {
+		name    string
+		fs      *Provider
+		ref     string
+		wantErr bool
+	}{
+		{
+			"Fail Message",
+			simpleClient,
+			"BY7p9iOYjbT7Au4laiJ7",
+			false,
+		},
+		{
+			"Fail Message Fail",
+			failClient,
+			"BY7p9iOYjbT7Au4laiJ7",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.fs.FailMessage(&tt.ref, "invalid message"); (err != nil) != tt.wantErr {
+				t.Errorf("Provider.FailMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFirestoreProvider_CompleteMessage(t *testing.T) {
+	ctx := context.Background()
+	simpleClient, _ := NewWithClient(ctx, "mock-client", "complete-message", &mockClient{})
+	failClient, _ := NewWithClient(ctx, "mock-client", "test-fail", &mockClient{})
+
+	tests := []struct {
+		name    string
+		fs      *Provider
+		ref     string
+		wantErr bool
+	}{
+		{
+			"Complete Message",
+			simpleClient,
+			"BY7p9iOYjbT7Au4laiJ7",
+			false,
+		},
+		{
+			"Complete Message Fail",
+			failClient,
+			"BY7p9iOYjbT7Au4laiJ7",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.fs.CompleteMessage(&tt.ref); (err != nil) != tt.wantErr {
+				t.Errorf("Provider.CompleteMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFirestoreProvider_GetStatus(t *testing.T) {
+	ctx := context.Background()
+	started := time.Now().Add(-time.Minute)
+
+	client := &mockClient{
+		docs: map[string]map[string]interface{}{
+			"status/in-progress": {
+				"status":          message.StatusInProgress,
+				"worker_id":       "worker-1",
+				"started":         started.UnixNano(),
+				"lock":            started.Add(LockDuration).UnixNano(),
+				"retries":         int64(2),
+				"retry_available": true,
+			},
+			"status/failed": {
+				"status":          message.StatusFailed,
+				"reason":          "invalid message",
+				"finished":        started.UnixNano(),
+				"retry_available": false,
+			},
+			"status/worker-stopped": {
+				"status":          message.StatusInProgress,
+				"worker_id":       "worker-1",
+				"started":         started.Add(-LockDuration).UnixNano(),
+				"lock":            started.UnixNano(),
+				"retries":         int64(0),
+				"retry_available": false,
+			},
+			"status/legacy": {
+				"retries":         int64(3),
+				"retry_available": true,
+			},
+		},
+	}
+	provider, _ := NewWithClient(ctx, "mock-client", "status", client)
+
+	tests := []struct {
+		name    string
+		ref     string
+		want    *message.JobStatus
+		wantErr bool
+	}{
+		{
+			"In Progress",
+			"in-progress",
+			&message.JobStatus{
+				Status:   message.StatusInProgress,
+				WorkerID: "worker-1",
+				Started:  time.Unix(0, started.UnixNano()),
+				Retries:  2,
+			},
+			false,
+		},
+		{
+			"Failed",
+			"failed",
+			&message.JobStatus{
+				Status:   message.StatusFailed,
+				Finished: time.Unix(0, started.UnixNano()),
+				Reason:   "invalid message",
+			},
+			false,
+		},
+		{
+			"Worker Stopped",
+			"worker-stopped",
+			&message.JobStatus{
+				Status:   message.StatusDead,
+				WorkerID: "worker-1",
+				Started:  time.Unix(0, started.Add(-LockDuration).UnixNano()),
+				Finished: time.Unix(0, started.UnixNano()),
+				Reason:   "worker stopped during the last attempt",
+			},
+			false,
+		},
+		{
+			"Legacy Message",
+			"legacy",
+			&message.JobStatus{
+				Status:  message.StatusPending,
+				Retries: 3,
+			},
+			false,
+		},
+		{
+			"Not Found",
+			"missing",
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := provider.GetStatus(&tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Provider.GetStatus() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Provider.GetStatus() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFirestoreProvider_Lifecycle(t *testing.T) {
+	client := &mockClient{
+		docs: make(map[string]map[string]interface{}),
+	}
+	provider, _ := NewWithClient(context.Background(), "mock-client", "with-id", client)
+	provider.SetWorkerID("worker-1")
+
+	ref := "ABC123"
+	status := func() *message.JobStatus {
+		s, err := provider.GetStatus(&ref)
+		if err != nil {
+			t.Fatalf("Provider.GetStatus() error = %v", err)
+		}
+		return s
+	}
+
+	// The mock has a single retry left, the worker takes the last attempt.
+	if _, err := provider.GetNextMessage(); err != nil {
+		t.Fatalf("Provider.GetNextMessage() error = %v", err)
+	}
+	if got := status(); got.Status != message.StatusInProgress || got.WorkerID != "worker-1" || got.Started.IsZero() {
+		t.Errorf("Provider.GetNextMessage() status = %+v, want in progress by worker-1", got)
+	}
+
+	// Without retries left a released message is dead.
+	provider.ReleaseMessage(&ref, time.Minute)
+	if got := status(); got.Status != message.StatusDead || got.Reason != "no retries left" {
+		t.Errorf("Provider.ReleaseMessage() status = %+v, want dead", got)
+	}
+
+	// Messages with retries left are pending again.
+	client.docs["with-id/"+ref]["retry_available"] = true
+	client.docs["with-id/"+ref]["status"] = message.StatusInProgress
+	provider.ReleaseMessage(&ref, time.Minute)
+	if got := status(); got.Status != message.StatusPending {
+		t.Errorf("Provider.ReleaseMessage() status = %+v, want pending", got)
+	}
+
+	provider.FailMessage(&ref, "invalid message")
+	if got := status(); got.Status != message.StatusFailed || got.Reason != "invalid message" || got.Finished.IsZero() {
+		t.Errorf("Provider.FailMessage() status = %+v, want failed with the reason", got)
+	}
+
+	provider.CompleteMessage(&ref)
+	if got := status(); got.Status != message.StatusCompleted {
+		t.Errorf("Provider.CompleteMessage() status = %+v, want completed", got)
+	}
+
+	// The time the job ended is kept for purges.
+	if _, ok := client.docs["with-id/"+ref]["completed_at"].(time.Time); !ok {
+		t.Errorf("Provider.CompleteMessage() completed_at = %v, want a time", client.docs["with-id/"+ref]["completed_at"])
+	}
+}
+
+func TestFirestoreProvider_Purge(t *testing.T) {
+	now := time.Now()
+	client := &mockClient{
+		docs: map[string]map[string]interface{}{
+			"purge/expired": {
+				"status":       message.StatusCompleted,
+				"completed_at": now.Add(-time.Hour * 48),
+			},
+			"purge/failed": {
+				"status":       message.StatusFailed,
+				"completed_at": now.Add(-time.Hour * 25),
+			},
+			"purge/recent": {
+				"status":       message.StatusCompleted,
+				"completed_at": now.Add(-time.Hour),
+			},
+			"purge/pending": {
+				"status": message.StatusPending,
+			},
+			"purge/stopped": {
+				"status":          message.StatusInProgress,
+				"retry_available": false,
+				"lock":            now.Add(-time.Hour * 30).UnixNano(),
+			},
+			"purge/running": {
+				"status":          message.StatusInProgress,
+				"retry_available": false,
+				"lock":            now.Add(time.Minute).UnixNano(),
+			},
+		},
+	}
+	failClient, _ := NewWithClient(context.Background(), "mock-client", "test-fail", &mockClient{})
+
+	tests := []struct {
+		name      string
+		fs        *Provider
+		retention time.Duration
+		want      int
+		wantDocs  []string
+		wantErr   bool
+	}{
+		{
+			"No Retention",
+			&Provider{client: client, rootPath: "purge"},
+			0,
+			0,
+			[]string{"purge/expired", "purge/failed", "purge/recent", "purge/pending", "purge/stopped", "purge/running"},
+			false,
+		},
+		{
+			"Retention",
+			&Provider{client: client, rootPath: "purge"},
+			time.Hour * 24,
+			3,
+			[]string{"purge/recent", "purge/pending", "purge/running"},
+			false,
+		},
+		{
+			"Query Fail",
+			failClient,
+			time.Hour,
+			0,
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fs.SetRetention(tt.retention)
+			got, err := tt.fs.Purge()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Provider.Purge() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			// The message of a worker that stopped during its last attempt died when its lock expired.
+			if stopped := client.docs["purge/stopped"]; stopped != nil && stopped["status"] != message.StatusDead {
+				t.Errorf("Provider.Purge() stopped message = %v, want %v", stopped["status"], message.StatusDead)
+			}
+			if running := client.docs["purge/running"]; running["status"] != message.StatusInProgress {
+				t.Errorf("Provider.Purge() running message = %v, want %v", running["status"], message.StatusInProgress)
+			}
+			if got != tt.want {
+				t.Errorf("Provider.Purge() = %v, want %v", got, tt.want)
+			}
+			for _, path := range tt.wantDocs {
+				if client.docs[path] == nil {
+					t.Errorf("Provider.Purge() removed %v", path)
+				}
+			}
+		})
+	}
+}
+
 func TestNew(t *testing.T) {
 	type args struct {
 		ctx         context.Context
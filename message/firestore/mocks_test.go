@@ -2,19 +2,34 @@ package firestore
 
 import (
 	"errors"
+	"strings"
+	"time"
 
 	"github.com/wptide/pkg/message"
 	fsClient "github.com/wptide/pkg/wrapper/firestore"
 )
 
+// mockClient keeps the documents in docs, if it is set.
 type mockClient struct {
+	docs map[string]map[string]interface{}
 }
 
 func (m mockClient) GetDoc(path string) map[string]interface{} {
-	return nil
+	return m.docs[path]
 }
 
 func (m mockClient) SetDoc(path string, data map[string]interface{}) error {
+	if strings.HasPrefix(path, "test-fail/") {
+		return errors.New("something went wrong")
+	}
+	if m.docs != nil {
+		if m.docs[path] == nil {
+			m.docs[path] = make(map[string]interface{})
+		}
+		for key, val := range data {
+			m.docs[path][key] = val
+		}
+	}
 	return nil
 }
 
@@ -38,6 +53,14 @@ func (m mockClient) Close() error {
 
 func (m mockClient) QueryItems(collection string, conditions []fsClient.Condition, ordering []fsClient.Order, limit int, updateFunc fsClient.UpdateFunc) ([]interface{}, error) {
 
+	// Queries without an update read the kept documents, e.g. to purge them.
+	if updateFunc == nil {
+		if collection == "test-fail" {
+			return nil, errors.New("something went wrong")
+		}
+		return m.query(collection, conditions), nil
+	}
+
 	simpleMessage := func(retries int, id string) []interface{} {
 		docData := map[string]interface{}{
 			"retries": int64(retries),
@@ -52,6 +75,9 @@ func (m mockClient) QueryItems(collection string, conditions []fsClient.Conditio
 
 		if id != "" {
 			docData["_id"] = id
+			if m.docs != nil {
+				m.docs[collection+"/"+id] = docData
+			}
 		}
 
 		return []interface{}{
@@ -74,10 +100,51 @@ func (m mockClient) QueryItems(collection string, conditions []fsClient.Conditio
 	case "with-id":
 		return simpleMessage(1, "ABC123"), nil
 	default:
-		return nil, nil
+		// Update the kept documents that match.
+		items := m.query(collection, conditions)
+		for _, item := range items {
+			doc := m.docs[collection+"/"+item.(map[string]interface{})["_id"].(string)]
+			data, _ := updateFunc(doc)
+			for key, val := range data {
+				doc[key] = val
+			}
+		}
+		return items, nil
 	}
 }
 
+// query returns the documents of the collection that match the conditions, it only knows "==" and "<" on
+// times and integers.
+func (m mockClient) query(collection string, conditions []fsClient.Condition) []interface{} {
+	var items []interface{}
+	for path, doc := range m.docs {
+		if !strings.HasPrefix(path, collection+"/") {
+			continue
+		}
+
+		match := true
+		for _, condition := range conditions {
+			switch value := doc[condition.Path].(type) {
+			case time.Time:
+				match = match && condition.Operator == "<" && value.Before(condition.Value.(time.Time))
+			case int64:
+				match = match && condition.Operator == "<" && value < condition.Value.(int64)
+			default:
+				match = match && condition.Operator == "==" && value == condition.Value
+			}
+		}
+		if match {
+			items = append(items, map[string]interface{}{
+				"_id": strings.TrimPrefix(path, collection+"/"),
+			})
+		}
+	}
+	return items
+}
+
 func (m mockClient) DeleteDoc(path string) error {
+	if m.docs != nil {
+		delete(m.docs, path)
+	}
 	return nil
 }
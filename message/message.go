@@ -1,5 +1,12 @@
 package message
 
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
 // QueueMessage defines how messages are stored in a document store.
 type QueueMessage struct {
 	Created        int64    `json:"created" firestore:"created"`
@@ -8,22 +15,29 @@ type QueueMessage struct {
 	Retries        int64    `json:"retries" firestore:"retries"`
 	Status         string   `json:"status" firestore:"status"`
 	RetryAvailable bool     `json:"retry_available" firestore:"retry_available"`
+	WorkerID       string   `json:"worker_id,omitempty" firestore:"worker_id,omitempty"` // Worker that took the message last.
+	Started        int64    `json:"started,omitempty" firestore:"started,omitempty"`     // When the last attempt started.
+	Finished       int64    `json:"finished,omitempty" firestore:"finished,omitempty"`   // When the message completed, failed or died.
+	Reason         string   `json:"reason,omitempty" firestore:"reason,omitempty"`       // Why the message failed or died.
 }
 
 // Message represents a task to read from or send to a queue.
 type Message struct {
-	ResponseAPIEndpoint string  `json:"response_api_endpoint"`
-	PayloadType         string  `json:"payload_type"`
-	Title               string  `json:"title"`
-	Content             string  `json:"content"`
-	Slug                string  `json:"slug"`
-	ProjectType         string  `json:"project_type,omitempty"`
-	SourceURL           string  `json:"source_url"`
-	SourceType          string  `json:"source_type"`
-	RequestClient       string  `json:"request_client"`
-	Force               bool    `json:"force"`
-	Visibility          string  `json:"visibility"`
-	ExternalRef         *string `json:"external_ref,omitempty"`
+	ResponseAPIEndpoint string   `json:"response_api_endpoint"`
+	PayloadType         string   `json:"payload_type"`
+	Title               string   `json:"title"`
+	Content             string   `json:"content"`
+	Slug                string   `json:"slug"`
+	ProjectType         string   `json:"project_type,omitempty"`
+	SourceURL           string   `json:"source_url"`
+	SourceType          string   `json:"source_type"`               // (Optional) Kind of source, e.g. zip. Detected from the url and content if empty.
+	SourceChecksum      string   `json:"source_checksum,omitempty"` // (Optional) Expected SHA-256 of the downloaded source.
+	RequestClient       string   `json:"request_client"`
+	Force               bool     `json:"force"`
+	Visibility          string   `json:"visibility"`
+	ExternalRef         *string  `json:"external_ref,omitempty"`
+	TraceID             string   `json:"trace_id,omitempty"` // (Optional) Links the trace spans of the message across queue hops.
+	Projects            []string `json:"projects,omitempty"` // (Optional) Folders of the projects of a bundle to audit, e.g. the ones to try again. Defaults to all of them.
 	// @todo: Legacy fields. Need to deprecate over time.
 	Standards []string `json:"standards,omitempty"`
 	Audits    []*Audit `json:"audits,omitempty"`
@@ -35,14 +49,90 @@ type Audit struct {
 	Options *AuditOption `json:"options,omitempty"`
 }
 
+// ReportKey returns the key of the audit results, e.g. "phpcs_wordpress" or "lighthouse".
+func (a Audit) ReportKey() string {
+	key := strings.ToLower(a.Type)
+	if a.Options != nil && a.Options.Standard != "" {
+		key += "_" + strings.ToLower(a.Options.Standard)
+	}
+	return key
+}
+
 // AuditOption describes specific options for an Audit.
+// Options that aren't fields are kept in Extra, so that audit types can take options of their own.
 type AuditOption struct {
-	Standard         string `json:"standard,omitempty"`
-	Report           string `json:"report,omitempty"`
-	Encoding         string `json:"encoding,omitempty"`
-	RuntimeSet       string `json:"runtime-set,omitempty"`
-	Ignore           string `json:"ignore,omitempty"`
-	StandardOverride string `json:"standard-override,omitempty"`
+	Standard         string                 `json:"standard,omitempty"`
+	Report           string                 `json:"report,omitempty"`
+	Encoding         string                 `json:"encoding,omitempty"`
+	RuntimeSet       string                 `json:"runtime-set,omitempty"`
+	Ignore           string                 `json:"ignore,omitempty"`
+	StandardOverride string                 `json:"standard-override,omitempty"`
+	Timeout          int                    `json:"timeout,omitempty"` // Seconds before the audit is stopped, can only lower the timeout of the pipeline.
+	Extra            map[string]interface{} `json:"-"`                 // Options that aren't fields, by name.
+}
+
+// auditOption has the fields of AuditOption without its JSON methods.
+type auditOption AuditOption
+
+// Names of the options that are fields of AuditOption.
+var auditOptionFields = jsonNames(reflect.TypeOf(auditOption{}))
+
+// UnmarshalJSON implements json.Unmarshaler. Options that aren't fields go to Extra.
+func (o *AuditOption) UnmarshalJSON(data []byte) error {
+	var fields auditOption
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	var extra map[string]interface{}
+	if err := json.Unmarshal(data, &extra); err != nil {
+		return err
+	}
+	for _, name := range auditOptionFields {
+		delete(extra, name)
+	}
+	if len(extra) > 0 {
+		fields.Extra = extra
+	}
+
+	*o = AuditOption(fields)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. Extra options are written next to the fields.
+func (o AuditOption) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(auditOption(o))
+	if err != nil || len(o.Extra) == 0 {
+		return data, err
+	}
+
+	return json.Marshal(o.Values())
+}
+
+// Values returns the options that are set by name, together with the Extra options.
+func (o AuditOption) Values() map[string]interface{} {
+	values := make(map[string]interface{}, len(o.Extra))
+	for name, value := range o.Extra {
+		values[name] = value
+	}
+
+	// Fields win over Extra options of the same name.
+	data, _ := json.Marshal(auditOption(o))
+	json.Unmarshal(data, &values)
+
+	return values
+}
+
+// jsonNames returns the JSON names of the fields of a struct type.
+func jsonNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
 }
 
 // Provider is an interface for creating new providers. E.g. firestore, mongo, sqs.
@@ -52,3 +142,14 @@ type Provider interface {
 	DeleteMessage(ref *string) error
 	Close() error
 }
+
+// Releaser is implemented by providers that can hand a message back to the queue before its lock
+// expires, so that another worker can retry it after the delay.
+type Releaser interface {
+	ReleaseMessage(ref *string, delay time.Duration) error
+}
+
+// Failer is implemented by providers that can keep a message that failed for good, without retrying it.
+type Failer interface {
+	FailMessage(ref *string, reason string) error
+}
@@ -4,10 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"time"
 
 	"github.com/mongodb/mongo-go-driver/bson"
 	"github.com/mongodb/mongo-go-driver/bson/objectid"
 	"github.com/mongodb/mongo-go-driver/core/option"
+	"github.com/mongodb/mongo-go-driver/mongo"
 	"github.com/wptide/pkg/message"
 	wrapper "github.com/wptide/pkg/wrapper/mongo"
 )
@@ -48,7 +50,9 @@ func (m MockCollection) FindOne(ctx context.Context, filter interface{}, opts ..
 
 	switch m.collection {
 	case "test-no-records":
-		return &MockDocumentResult{}
+		return &MockDocumentResult{
+			collection: "no-documents",
+		}
 	default:
 		return &MockDocumentResult{
 			collection: m.collection,
@@ -64,6 +68,13 @@ func (m MockCollection) FindOneAndDelete(ctx context.Context, filter interface{}
 	return nil
 }
 
+func (m MockCollection) EnsureTTLIndex(ctx context.Context, field string, ttl time.Duration) error {
+	if m.collection == "test-index-fail" {
+		return errors.New("index options conflict")
+	}
+	return nil
+}
+
 type MockDocumentResult struct {
 	collection string
 }
@@ -101,9 +112,28 @@ func (d MockDocumentResult) Decode() (*bson.Document, error) {
 		doc.Append(bson.EC.ObjectID("_id", id))
 		return doc, err
 
-	case "test-lock-fail-update":
+	case "test-last-attempt-update":
+		fallthrough
+	case "test-last-attempt":
+		msg := generateMessage(&message.Message{
+			Title: "Plugin One",
+		})
+		msg["retries"] = int64(0)
+		msg["retry_available"] = false
+		msg["status"] = message.StatusInProgress
+		msgJSON, _ := json.Marshal(msg)
+
+		doc, err := bson.ParseExtJSONObject(string(msgJSON))
+		id, _ := objectid.FromHex("abcdef123456789009876364")
+		doc.Append(bson.EC.ObjectID("_id", id))
+		return doc, err
+
+	case "test-lock-fail-update", "test-find-fail", "test-find-fail-update":
 		return nil, errors.New("something went wrong")
 
+	case "no-documents", "test-no-records-update":
+		return bson.NewDocument(), mongo.ErrNoDocuments
+
 	case "test-lock-fail":
 		msg := generateMessage(&message.Message{
 			Title: "Plugin One",
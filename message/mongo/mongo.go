@@ -9,7 +9,9 @@ import (
 	"github.com/mongodb/mongo-go-driver/bson"
 	"github.com/mongodb/mongo-go-driver/bson/objectid"
 	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/wptide/pkg/health"
 	"github.com/wptide/pkg/message"
+	"github.com/wptide/pkg/metrics"
 	wrapper "github.com/wptide/pkg/wrapper/mongo"
 )
 
@@ -19,25 +21,79 @@ const (
 
 	// LockDuration sets how long an item needs to be locked for.
 	LockDuration  time.Duration = time.Minute * 10
+
+	// PurgeBatch is the number of Documents that a purge marks as dead at most.
+	PurgeBatch = 500
 )
 
+// ErrNoDocument is returned by ResultToQueueMessage if the query found no Document, e.g. because the queue is empty.
+var ErrNoDocument = errors.New("mongodb: no document found")
+
 // Provider implements the Provider interface.
 type Provider struct {
 	ctx        context.Context
 	client     wrapper.Client
 	database   string
 	collection string
+	workerID   string
+	health     *health.Component
+}
+
+// SetWorkerID sets the ID that is recorded for the messages this provider takes.
+// Defaults to message.DefaultWorkerID().
+func (m *Provider) SetWorkerID(id string) {
+	m.workerID = id
+}
+
+// SetHealth sets the registry that the calls to MongoDB are reported into.
+func (m *Provider) SetHealth(r *health.Registry) {
+	m.health = r.Component("mongo")
+}
+
+// SetRetention makes MongoDB remove Documents once they completed, failed or died longer than ttl ago,
+// with a TTL index on their `completed_at` field. Without it, Documents are kept so that their status can be read.
+func (m *Provider) SetRetention(ttl time.Duration) error {
+	if ttl < time.Second {
+		return errors.New("mongodb: retention must be at least a second")
+	}
+
+	collection := m.client.Database(m.database).Collection(m.collection)
+	indexer, ok := collection.(wrapper.Indexer)
+	if !ok {
+		return errors.New("mongodb: collection can not create indexes")
+	}
+
+	if err := indexer.EnsureTTLIndex(m.ctx, "completed_at", ttl); err != nil {
+		return errors.New("mongodb: could not create retention index: " + err.Error())
+	}
+	return nil
 }
 
 // SendMessage sends a message to MongoDB.
-func (m Provider) SendMessage(msg *message.Message) error {
+func (m Provider) SendMessage(msg *message.Message) (err error) {
+	defer metrics.Start(metrics.QueueOperations, metrics.Labels{"provider": "mongo", "operation": "send"})(&err)
+	defer m.health.Call(&err)
+
 	collection := m.client.Database(m.database).Collection(m.collection)
-	_, err := collection.InsertOne(context.Background(), generateMessage(msg))
+	_, err = collection.InsertOne(context.Background(), generateMessage(msg))
 	return err
 }
 
 // GetNextMessage gets the next message from MongoDB.
-func (m Provider) GetNextMessage() (*message.Message, error) {
+func (m Provider) GetNextMessage() (msg *message.Message, err error) {
+	// An empty queue is not a failed call.
+	empty := false
+	defer func(start time.Time) {
+		outcome := metrics.Success
+		switch {
+		case empty:
+			outcome = metrics.Empty
+		case err != nil:
+			outcome = metrics.Error
+		}
+		metrics.Record(metrics.QueueOperations, metrics.Labels{"provider": "mongo", "operation": "get"}, outcome, time.Since(start))
+	}(time.Now())
+
 	collection := m.client.Database(m.database).Collection(m.collection)
 
 	// Query.
@@ -53,9 +109,15 @@ func (m Provider) GetNextMessage() (*message.Message, error) {
 
 	result := collection.FindOne(m.ctx, filter, sort)
 	qm, err := ResultToQueueMessage(result)
-	if err != nil {
+	switch {
+	case err == ErrNoDocument:
+		// An empty queue is not a failure of the provider.
+		empty = true
+		m.health.Beat()
+		return nil, err
+	case err != nil:
+		m.health.Done(err)
 		return nil, err
-
 	}
 
 	itemID, _ := objectid.FromHex(*qm.Message.ExternalRef)
@@ -72,26 +134,41 @@ func (m Provider) GetNextMessage() (*message.Message, error) {
 		retryAvailable = false
 	}
 
+	workerID := m.workerID
+	if workerID == "" {
+		workerID = message.DefaultWorkerID()
+	}
+
 	// Update data.
+	now := time.Now()
 	updateData := map[string]interface{}{
 		"$set": map[string]interface{}{
 			"retries":         int64(retries),
 			"retry_available": retryAvailable,
-			"lock":            int64(time.Now().Add(LockDuration).UnixNano()),
+			"lock":            int64(now.Add(LockDuration).UnixNano()),
+			"status":          message.StatusInProgress,
+			"worker_id":       workerID,
+			"started":         int64(now.UnixNano()),
 		},
 	}
 
 	// Update item and get new reference.
 	uqm, err := ResultToQueueMessage(collection.FindOneAndUpdate(context.Background(), filter, updateData))
 	if err != nil {
-		return nil, errors.New("mongodb: could not set lock on item")
+		err = errors.New("mongodb: could not set lock on item")
+		m.health.Done(err)
+		return nil, err
 	}
 
+	m.health.Done(nil)
 	return uqm.Message, nil
 }
 
 // DeleteMessage deletes a Document from MongoDB.
-func (m Provider) DeleteMessage(ref *string) error {
+func (m Provider) DeleteMessage(ref *string) (err error) {
+	defer metrics.Start(metrics.QueueOperations, metrics.Labels{"provider": "mongo", "operation": "delete"})(&err)
+	defer m.health.Call(&err)
+
 	collection := m.client.Database(m.database).Collection(m.collection)
 
 	itemID, _ := objectid.FromHex(*ref)
@@ -104,6 +181,147 @@ func (m Provider) DeleteMessage(ref *string) error {
 	return nil
 }
 
+// ReleaseMessage unlocks a Document in MongoDB after the delay, so that the message can be retried.
+// Messages without retries left are dead.
+func (m Provider) ReleaseMessage(ref *string, delay time.Duration) (err error) {
+	defer metrics.Start(metrics.QueueOperations, metrics.Labels{"provider": "mongo", "operation": "release"})(&err)
+	defer m.health.Call(&err)
+
+	if qm, err := m.findMessage(ref); err == nil && !qm.RetryAvailable {
+		now := time.Now()
+		return m.updateMessage(ref, map[string]interface{}{
+			"status":       message.StatusDead,
+			"reason":       "no retries left",
+			"finished":     now.UnixNano(),
+			"completed_at": now,
+		})
+	}
+
+	return m.updateMessage(ref, map[string]interface{}{
+		"lock":   time.Now().Add(delay).UnixNano(),
+		"status": message.StatusPending,
+	})
+}
+
+// CompleteMessage marks a Document in MongoDB as completed, it is kept so that its status can be read
+// until the retention is over, see SetRetention.
+func (m Provider) CompleteMessage(ref *string) (err error) {
+	defer metrics.Start(metrics.QueueOperations, metrics.Labels{"provider": "mongo", "operation": "complete"})(&err)
+	defer m.health.Call(&err)
+
+	now := time.Now()
+	return m.updateMessage(ref, map[string]interface{}{
+		"status":          message.StatusCompleted,
+		"retry_available": false,
+		"finished":        now.UnixNano(),
+		"completed_at":    now,
+	})
+}
+
+// FailMessage marks a Document in MongoDB as failed, so that the message is not retried.
+func (m Provider) FailMessage(ref *string, reason string) (err error) {
+	defer metrics.Start(metrics.QueueOperations, metrics.Labels{"provider": "mongo", "operation": "fail"})(&err)
+	defer m.health.Call(&err)
+
+	now := time.Now()
+	return m.updateMessage(ref, map[string]interface{}{
+		"status":          message.StatusFailed,
+		"reason":          reason,
+		"retry_available": false,
+		"finished":        now.UnixNano(),
+		"completed_at":    now,
+	})
+}
+
+// Purge marks up to PurgeBatch Documents as dead whose worker stopped during their last attempt, so that
+// they get a `completed_at` and the retention index removes them too, see SetRetention. Purge returns
+// the number of Documents it marked, MongoDB removes the Documents by itself.
+func (m Provider) Purge() (purged int, err error) {
+	defer metrics.Start(metrics.QueueOperations, metrics.Labels{"provider": "mongo", "operation": "purge"})(&err)
+	defer m.health.Call(&err)
+
+	collection := m.client.Database(m.database).Collection(m.collection)
+
+	for ; purged < PurgeBatch; purged++ {
+		now := time.Now()
+		filter := map[string]interface{}{
+			"status":          message.StatusInProgress,
+			"retry_available": false,
+			"lock": map[string]interface{}{
+				"$lt": now.UnixNano(),
+			},
+		}
+		updateData := map[string]interface{}{
+			"$set": map[string]interface{}{
+				"status":       message.StatusDead,
+				"reason":       "worker stopped during the last attempt",
+				"finished":     now.UnixNano(),
+				"completed_at": now,
+			},
+		}
+
+		_, err := ResultToQueueMessage(collection.FindOneAndUpdate(m.ctx, filter, updateData))
+		if err == ErrNoDocument {
+			return purged, nil
+		}
+		if err != nil {
+			return purged, err
+		}
+	}
+
+	return purged, nil
+}
+
+// GetStatus reads the status of the job of a Document in MongoDB.
+func (m Provider) GetStatus(ref *string) (status *message.JobStatus, err error) {
+	defer metrics.Start(metrics.QueueOperations, metrics.Labels{"provider": "mongo", "operation": "status"})(&err)
+
+	qm, err := m.findMessage(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return qm.JobStatus(time.Now()), nil
+}
+
+// findMessage reads a Document from MongoDB.
+func (m Provider) findMessage(ref *string) (*message.QueueMessage, error) {
+	collection := m.client.Database(m.database).Collection(m.collection)
+
+	itemID, err := objectid.FromHex(*ref)
+	if err != nil {
+		return nil, errors.New("mongodb: invalid reference")
+	}
+	filter := map[string]interface{}{
+		"_id": itemID,
+	}
+
+	return ResultToQueueMessage(collection.FindOne(m.ctx, filter))
+}
+
+// updateMessage sets the fields of a Document in MongoDB.
+func (m Provider) updateMessage(ref *string, fields map[string]interface{}) error {
+	collection := m.client.Database(m.database).Collection(m.collection)
+
+	itemID, err := objectid.FromHex(*ref)
+	if err != nil {
+		return errors.New("mongodb: invalid reference")
+	}
+	filter := map[string]interface{}{
+		"_id": itemID,
+	}
+
+	updateData := map[string]interface{}{
+		"$set": fields,
+	}
+
+	if _, err := ResultToQueueMessage(collection.FindOneAndUpdate(m.ctx, filter, updateData)); err != nil {
+		return errors.New("mongodb: could not update item")
+	}
+
+	return nil
+}
+
 // Close the MongoDB client.
 func (m Provider) Close() error {
 	return m.client.Close()
@@ -122,20 +340,25 @@ func generateMessage(in *message.Message) map[string]interface{} {
 		"lock":            int64(0),
 		"retries":         int64(RetryAttempts),
 		"message":         msgMap,
-		"status":          "pending",
+		"status":          message.StatusPending,
 		"retry_available": true,
 	}
 }
 
 // ResultToQueueMessage converts a MongoDB result to a QueueMessage.
+// It returns ErrNoDocument if there is no Document, and the error of the query if it failed.
 func ResultToQueueMessage(layer wrapper.DocumentResultLayer) (*message.QueueMessage, error) {
 
-	elem, _ := layer.Decode()
+	elem, err := layer.Decode()
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, errors.New("mongodb: " + err.Error())
+	}
+
 	raw, _ := elem.MarshalBSON()
 	js, err := bson.ToExtJSON(false, raw)
 
 	if err != nil || js == "{}" {
-		return nil, errors.New("mongodb: no document found")
+		return nil, ErrNoDocument
 	}
 
 	extRef := elem.Lookup("_id").ObjectID().Hex()
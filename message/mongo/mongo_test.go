@@ -7,8 +7,10 @@ import (
 	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/wptide/pkg/health"
 	"github.com/wptide/pkg/message"
 	wrapper "github.com/wptide/pkg/wrapper/mongo"
 )
@@ -134,6 +136,19 @@ func TestMongoProvider_GetNextMessage(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"Get Next Message - Find Fail",
+			fields{
+				context.Background(),
+				&MockClient{
+					"test-find-fail",
+				},
+				"test",
+				"test-find-fail",
+			},
+			nil,
+			true,
+		},
 		{
 			"Get Next Message - Lock Fail",
 			fields{
@@ -164,6 +179,38 @@ func TestMongoProvider_GetNextMessage(t *testing.T) {
 	}
 }
 
+func TestMongoProvider_GetNextMessage_Health(t *testing.T) {
+	tests := []struct {
+		name       string
+		collection string
+		wantErr    string
+	}{
+		{
+			"Empty Queue",
+			"test-no-records",
+			"",
+		},
+		{
+			"Find Fail",
+			"test-find-fail",
+			"mongodb: something went wrong",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := health.NewRegistry()
+			m, _ := NewWithClient(context.Background(), "test-db", tt.collection, &MockClient{tt.collection})
+			m.SetHealth(r)
+
+			// Only an empty queue is not a failure of the provider.
+			m.GetNextMessage()
+			if got := r.Liveness().Components["mongo"].Error; got != tt.wantErr {
+				t.Errorf("Provider.GetNextMessage() health error = %v, want %v", got, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestMongoProvider_DeleteMessage(t *testing.T) {
 	type fields struct {
 		ctx        context.Context
@@ -204,6 +251,243 @@ func TestMongoProvider_DeleteMessage(t *testing.T) {
 	}
 }
 
+func TestMongoProvider_ReleaseMessage(t *testing.T) {
+	tests := []struct {
+		name       string
+		collection string
+		ref        string
+		wantErr    bool
+	}{
+		{
+			"Release Message",
+			"test-valid-message",
+			"abcdef123456789009876364",
+			false,
+		},
+		{
+			"Invalid Reference",
+			"test-valid-message",
+			"mock-ref",
+			true,
+		},
+		{
+			"Release Message - No Retries Left",
+			"test-last-attempt",
+			"abcdef123456789009876364",
+			false,
+		},
+		{
+			"Update Fail",
+			"test-lock-fail",
+			"abcdef123456789009876364",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := NewWithClient(context.Background(), "test-db", tt.collection, &MockClient{tt.collection})
+			if err := m.ReleaseMessage(&tt.ref, time.Minute); (err != nil) != tt.wantErr {
+				t.Errorf("Provider.ReleaseMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMongoProvider_FailMessage(t *testing.T) {
+	tests := []struct {
+		name       string
+		collection string
+		ref        string
+		wantErr    bool
+	}{
+		{
+			"Fail Message",
+			"test-valid-message",
+			"abcdef123456789009876364",
+			false,
+		},
+		{
+			"Update Fail",
+			"test-lock-fail",
+			"abcdef123456789009876364",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := NewWithClient(context.Background(), "test-db", tt.collection, &MockClient{tt.collection})
+			if err := m.FailMessage(&tt.ref, "invalid message"); (err != nil) != tt.wantErr {
+				t.Errorf("Provider.FailMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMongoProvider_CompleteMessage(t *testing.T) {
+	tests := []struct {
+		name       string
+		collection string
+		ref        string
+		wantErr    bool
+	}{
+		{
+			"Complete Message",
+			"test-valid-message",
+			"abcdef123456789009876364",
+			false,
+		},
+		{
+			"Invalid Reference",
+			"test-valid-message",
+			"mock-ref",
+			true,
+		},
+		{
+			"Update Fail",
+			"test-lock-fail",
+			"abcdef123456789009876364",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := NewWithClient(context.Background(), "test-db", tt.collection, &MockClient{tt.collection})
+			if err := m.CompleteMessage(&tt.ref); (err != nil) != tt.wantErr {
+				t.Errorf("Provider.CompleteMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMongoProvider_SetRetention(t *testing.T) {
+	tests := []struct {
+		name       string
+		collection string
+		ttl        time.Duration
+		wantErr    bool
+	}{
+		{
+			"Retention",
+			"test-valid-message",
+			time.Hour * 24 * 30,
+			false,
+		},
+		{
+			"Too Short",
+			"test-valid-message",
+			time.Millisecond,
+			true,
+		},
+		{
+			"Index Fail",
+			"test-index-fail",
+			time.Hour,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := NewWithClient(context.Background(), "test-db", tt.collection, &MockClient{tt.collection})
+			if err := m.SetRetention(tt.ttl); (err != nil) != tt.wantErr {
+				t.Errorf("Provider.SetRetention() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMongoProvider_Purge(t *testing.T) {
+	tests := []struct {
+		name       string
+		collection string
+		want       int
+		wantErr    bool
+	}{
+		{
+			"Nothing To Purge",
+			"test-no-records",
+			0,
+			false,
+		},
+		{
+			"Stopped Workers",
+			"test-valid-message",
+			PurgeBatch,
+			false,
+		},
+		{
+			"Update Fail",
+			"test-find-fail",
+			0,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := NewWithClient(context.Background(), "test-db", tt.collection, &MockClient{tt.collection})
+			got, err := m.Purge()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Provider.Purge() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Provider.Purge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMongoProvider_GetStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		collection string
+		ref        string
+		want       string
+		wantErr    bool
+	}{
+		{
+			"Pending",
+			"test-valid-message",
+			"abcdef123456789009876364",
+			message.StatusPending,
+			false,
+		},
+		{
+			"Worker Stopped",
+			"test-last-attempt",
+			"abcdef123456789009876364",
+			message.StatusDead,
+			false,
+		},
+		{
+			"Not Found",
+			"test-no-records",
+			"abcdef123456789009876364",
+			"",
+			true,
+		},
+		{
+			"Invalid Reference",
+			"test-valid-message",
+			"mock-ref",
+			"",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := NewWithClient(context.Background(), "test-db", tt.collection, &MockClient{tt.collection})
+			got, err := m.GetStatus(&tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Provider.GetStatus() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != nil && got.Status != tt.want {
+				t.Errorf("Provider.GetStatus() = %v, want %v", got.Status, tt.want)
+			}
+		})
+	}
+}
+
 func TestNew(t *testing.T) {
 	_, host := testServer(t, nil)
 
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -12,7 +13,9 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/wptide/pkg/health"
 	"github.com/wptide/pkg/message"
+	"github.com/wptide/pkg/metrics"
 )
 
 // Provider represents an SQS queue.
@@ -22,11 +25,19 @@ type Provider struct {
 	sqs       sqsiface.SQSAPI
 	QueueURL  *string
 	QueueName *string
+	health    *health.Component
+}
+
+// SetHealth sets the registry that the calls to SQS are reported into.
+func (mgr *Provider) SetHealth(r *health.Registry) {
+	mgr.health = r.Component("sqs")
 }
 
 // SendMessage implements the required interface method to be a Provider.
 // This method sends a new SQS SendMessageInput message to SQS.
-func (mgr Provider) SendMessage(msg *message.Message) error {
+func (mgr Provider) SendMessage(msg *message.Message) (err error) {
+	defer metrics.Start(metrics.QueueOperations, metrics.Labels{"provider": "sqs", "operation": "send"})(&err)
+	defer mgr.health.Call(&err)
 
 	// Encode the task to send as the message body.
 	taskEncoded, _ := json.Marshal(msg)
@@ -46,7 +57,7 @@ func (mgr Provider) SendMessage(msg *message.Message) error {
 	}
 
 	// Send the message and check for errors.
-	_, err := mgr.sqs.SendMessage(messageInput)
+	_, err = mgr.sqs.SendMessage(messageInput)
 
 	if err != nil {
 		return err
@@ -57,7 +68,9 @@ func (mgr Provider) SendMessage(msg *message.Message) error {
 
 // GetNextMessage implements the required interface method to be a Provider.
 // This method sends a ReceiveMessageInput message to SQS and converts the message into a *task.Task object.
-func (mgr Provider) GetNextMessage() (*message.Message, error) {
+func (mgr Provider) GetNextMessage() (msg *message.Message, err error) {
+	defer metrics.Start(metrics.QueueOperations, metrics.Labels{"provider": "sqs", "operation": "get"})(&err)
+
 	var returnMessage message.Message
 
 	// Prepare the message
@@ -77,6 +90,9 @@ func (mgr Provider) GetNextMessage() (*message.Message, error) {
 	// Retrieve the message from SQS
 	result, err := mgr.sqs.ReceiveMessage(messageInput)
 
+	// The queue was reached unless there is an error, even if it is empty.
+	mgr.health.Done(err)
+
 	if err != nil {
 		// If we get a critical AWS error, issue a new provider error.
 		if awsErr, ok := err.(awserr.Error); ok {
@@ -107,8 +123,11 @@ func (mgr Provider) GetNextMessage() (*message.Message, error) {
 
 // DeleteMessage implements the required interface method to be a Provider.
 // This method deletes a message from the queue.
-func (mgr Provider) DeleteMessage(reference *string) error {
-	_, err := mgr.sqs.DeleteMessage(&sqs.DeleteMessageInput{
+func (mgr Provider) DeleteMessage(reference *string) (err error) {
+	defer metrics.Start(metrics.QueueOperations, metrics.Labels{"provider": "sqs", "operation": "delete"})(&err)
+	defer mgr.health.Call(&err)
+
+	_, err = mgr.sqs.DeleteMessage(&sqs.DeleteMessageInput{
 		QueueUrl:      mgr.QueueURL,
 		ReceiptHandle: reference,
 	})
@@ -120,6 +139,21 @@ func (mgr Provider) DeleteMessage(reference *string) error {
 	return nil
 }
 
+// ReleaseMessage makes a message visible in the queue again after the delay, so that it can be retried.
+// Messages that keep failing are left to the redrive policy of the queue.
+func (mgr Provider) ReleaseMessage(reference *string, delay time.Duration) (err error) {
+	defer metrics.Start(metrics.QueueOperations, metrics.Labels{"provider": "sqs", "operation": "release"})(&err)
+	defer mgr.health.Call(&err)
+
+	_, err = mgr.sqs.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          mgr.QueueURL,
+		ReceiptHandle:     reference,
+		VisibilityTimeout: aws.Int64(int64(delay / time.Second)),
+	})
+
+	return err
+}
+
 // Close implemented to satisfy Provider interface.
 func (mgr Provider) Close() error {
 	return nil
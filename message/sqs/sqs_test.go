@@ -5,6 +5,7 @@ import (
 	"errors"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -89,6 +90,13 @@ func (m mockSqs) DeleteMessage(in *sqs.DeleteMessageInput) (*sqs.DeleteMessageOu
 	return m.deleteMessageOutput, nil
 }
 
+func (m mockSqs) ChangeMessageVisibility(in *sqs.ChangeMessageVisibilityInput) (*sqs.ChangeMessageVisibilityOutput, error) {
+	if *in.ReceiptHandle == "fail-id" {
+		return nil, errors.New("something went wrong")
+	}
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
 func (m mockSqs) ReceiveMessage(in *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
 
 	var messages []*sqs.Message
@@ -287,6 +295,38 @@ func TestSqsProvider_DeleteMessage(t *testing.T) {
 	}
 }
 
+func TestSqsProvider_ReleaseMessage(t *testing.T) {
+	successID := "success-id"
+	failID := "fail-id"
+
+	tests := []struct {
+		name      string
+		mgr       Provider
+		reference *string
+		wantErr   bool
+	}{
+		{
+			"Release Message",
+			testProvider,
+			&successID,
+			false,
+		},
+		{
+			"Release Message Error",
+			testProvider,
+			&failID,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.mgr.ReleaseMessage(tt.reference, time.Minute); (err != nil) != tt.wantErr {
+				t.Errorf("Provider.ReleaseMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func Test_getSession(t *testing.T) {
 	type args struct {
 		region string
@@ -0,0 +1,87 @@
+package message
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Statuses of a message in a document store.
+//
+// A message is pending until a worker takes it, it is then in progress until the job completed or
+// failed. A job that failed with a retryable error is pending again, unless it has no retries left,
+// in which case it is dead. Messages of workers that stopped in the middle of their last attempt are
+// dead once their lock expired.
+const (
+	StatusPending    = "pending"
+	StatusInProgress = "in-progress"
+	StatusCompleted  = "completed"
+	StatusFailed     = "failed"
+	StatusDead       = "dead"
+)
+
+// JobStatus describes where the job of a message stands, e.g. for a dashboard.
+type JobStatus struct {
+	Status   string    `json:"status"`
+	WorkerID string    `json:"worker_id,omitempty"` // Worker that took the message last.
+	Started  time.Time `json:"started"`             // When the last attempt started.
+	Finished time.Time `json:"finished"`            // When the job completed, failed or died.
+	Reason   string    `json:"reason,omitempty"`    // Why the job failed or died.
+	Retries  int64     `json:"retries"`             // Attempts that are left.
+}
+
+// Completer is implemented by providers that keep messages once their job completed, instead of
+// deleting them, so that their status can still be read.
+type Completer interface {
+	CompleteMessage(ref *string) error
+}
+
+// Purger is implemented by providers that keep finished messages and have to clean them up themselves,
+// e.g. remove them once their retention is over, or mark the messages of workers that stopped as dead.
+// Purge returns the number of messages it cleaned up.
+type Purger interface {
+	Purge() (int, error)
+}
+
+// StatusReader is implemented by providers that can tell the status of the job of a message by reference.
+type StatusReader interface {
+	GetStatus(ref *string) (*JobStatus, error)
+}
+
+// JobStatus returns the status of the job of the message at the time.
+func (qm QueueMessage) JobStatus(now time.Time) *JobStatus {
+	status := &JobStatus{
+		Status:   qm.Status,
+		WorkerID: qm.WorkerID,
+		Reason:   qm.Reason,
+		Retries:  qm.Retries,
+	}
+	if status.Status == "" {
+		status.Status = StatusPending
+	}
+	if qm.Started > 0 {
+		status.Started = time.Unix(0, qm.Started)
+	}
+	if qm.Finished > 0 {
+		status.Finished = time.Unix(0, qm.Finished)
+	}
+
+	// The worker stopped during the last attempt, nobody is going to take the message again.
+	if status.Status == StatusInProgress && !qm.RetryAvailable && qm.Lock < now.UnixNano() {
+		status.Status = StatusDead
+		status.Finished = time.Unix(0, qm.Lock)
+		status.Reason = "worker stopped during the last attempt"
+	}
+
+	return status
+}
+
+// DefaultWorkerID returns the ID that providers record for the messages this worker takes,
+// i.e. the hostname and the process ID.
+func DefaultWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
@@ -0,0 +1,126 @@
+// Package metrics records counters and histograms of pipelines, queues and audits.
+//
+// Metrics are recorded to the default Recorder, which does nothing until it is replaced, e.g. by a Registry
+// that exposes them in the Prometheus text format:
+//
+//	registry := metrics.NewRegistry()
+//	metrics.SetRecorder(registry)
+//	http.Handle("/metrics", metrics.Handler())
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Names of the metrics that the packages of this library record.
+const (
+	StageJobs       = "tide_stage_jobs"                     // Jobs of a stage, labelled by stage and outcome. Recorded with Start.
+	Audits          = "tide_audits"                         // Audits, labelled by stage, audit type and outcome. Recorded with Start.
+	QueueOperations = "tide_queue_operations"               // Calls to message providers, labelled by provider, operation and outcome. Recorded with Start.
+	StorageUploads  = "tide_storage_uploads"                // Uploads to storage providers, labelled by provider and outcome. Recorded with Start.
+	PipeMessages    = "tide_pipe_messages_total"            // Messages that went through a pipe, labelled by the stage they failed in and outcome.
+	PipeShutdown    = "tide_pipe_shutdown_duration_seconds" // Time it took a pipe to shut down.
+)
+
+// Outcomes of recorded operations.
+const (
+	Success   = "success"
+	Error     = "error"
+	Empty     = "empty"     // Calls that found nothing to do, e.g. on an empty queue.
+	Retryable = "retryable" // Errors of jobs that are retried.
+	Permanent = "permanent" // Errors of jobs that are not retried.
+)
+
+// Labels are the labels of a metric, e.g. {"stage": "PHPCS", "outcome": "success"}.
+type Labels map[string]string
+
+// Recorder records metrics.
+type Recorder interface {
+	Inc(name string, labels Labels)                    // Increments a counter.
+	Observe(name string, labels Labels, value float64) // Adds a value to a histogram.
+}
+
+// Nop is a Recorder that doesn't record anything. It is the default Recorder.
+type Nop struct{}
+
+// Inc does nothing.
+func (Nop) Inc(name string, labels Labels) {}
+
+// Observe does nothing.
+func (Nop) Observe(name string, labels Labels, value float64) {}
+
+var (
+	recorderMutex sync.RWMutex
+	recorder      Recorder = Nop{}
+)
+
+// SetRecorder replaces the default Recorder. Setting nil stops recording.
+func SetRecorder(r Recorder) {
+	if r == nil {
+		r = Nop{}
+	}
+
+	recorderMutex.Lock()
+	defer recorderMutex.Unlock()
+	recorder = r
+}
+
+// Default returns the default Recorder.
+func Default() Recorder {
+	recorderMutex.RLock()
+	defer recorderMutex.RUnlock()
+	return recorder
+}
+
+// Inc increments a counter of the default Recorder.
+func Inc(name string, labels Labels) {
+	Default().Inc(name, labels)
+}
+
+// Observe adds a value to a histogram of the default Recorder.
+func Observe(name string, labels Labels, value float64) {
+	Default().Observe(name, labels, value)
+}
+
+// Start starts timing an operation. The returned function records the outcome of the operation in the
+// counter `name_total` and its duration in the histogram `name_duration_seconds`, e.g.:
+//
+//	defer metrics.Start(metrics.StorageUploads, metrics.Labels{"provider": "s3"})(&err)
+func Start(name string, labels Labels) func(err *error) {
+	start := time.Now()
+
+	return func(err *error) {
+		outcome := Success
+		if err != nil && *err != nil {
+			outcome = Error
+		}
+		Record(name, labels, outcome, time.Since(start))
+	}
+}
+
+// Record records the outcome and duration of an operation, see Start.
+func Record(name string, labels Labels, outcome string, duration time.Duration) {
+	l := make(Labels, len(labels)+1)
+	for k, v := range labels {
+		l[k] = v
+	}
+	l["outcome"] = outcome
+
+	r := Default()
+	r.Inc(name+"_total", l)
+	r.Observe(name+"_duration_seconds", l, duration.Seconds())
+}
+
+// Handler returns a handler that serves the metrics of the default Recorder, if it can.
+// With the Nop recorder it serves nothing.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if h, ok := Default().(http.Handler); ok {
+			h.ServeHTTP(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+	})
+}
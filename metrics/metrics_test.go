@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	r := NewRegistryWithBuckets([]float64{1, 0.5})
+	r.Inc(PipeMessages, Labels{"stage": "PHPCS", "outcome": Permanent})
+	r.Inc(PipeMessages, Labels{"stage": "PHPCS", "outcome": Permanent})
+	r.Inc(PipeMessages, Labels{"outcome": Success, "stage": ""})
+	r.Inc("custom_total", nil)
+	r.Observe(PipeShutdown, nil, 0.25)
+	r.Observe(PipeShutdown, nil, 0.75)
+	r.Observe(PipeShutdown, nil, 2)
+	r.Inc("escaped_total", Labels{"path": "a\"b\\c\nd"})
+
+	want := `# TYPE custom_total counter
+custom_total 1
+# TYPE escaped_total counter
+escaped_total{path="a\"b\\c\nd"} 1
+# HELP tide_pipe_messages_total Messages that went through a pipe.
+# TYPE tide_pipe_messages_total counter
+tide_pipe_messages_total{outcome="permanent",stage="PHPCS"} 2
+tide_pipe_messages_total{outcome="success",stage=""} 1
+# HELP tide_pipe_shutdown_duration_seconds Time a pipe took to shut down.
+# TYPE tide_pipe_shutdown_duration_seconds histogram
+tide_pipe_shutdown_duration_seconds_bucket{le="0.5"} 1
+tide_pipe_shutdown_duration_seconds_bucket{le="1"} 2
+tide_pipe_shutdown_duration_seconds_bucket{le="+Inf"} 3
+tide_pipe_shutdown_duration_seconds_sum 3
+tide_pipe_shutdown_duration_seconds_count 3
+`
+
+	var b strings.Builder
+	if err := r.Write(&b); err != nil {
+		t.Errorf("Registry.Write() error = %v", err)
+	}
+	if b.String() != want {
+		t.Errorf("Registry.Write() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestStart(t *testing.T) {
+	r := NewRegistryWithBuckets([]float64{60})
+	SetRecorder(r)
+	defer SetRecorder(nil)
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{
+			"Success",
+			nil,
+		},
+		{
+			"Error",
+			errors.New("upload failed"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.err
+			Start(StorageUploads, Labels{"provider": "local"})(&err)
+		})
+	}
+
+	var b strings.Builder
+	r.Write(&b)
+
+	for _, line := range []string{
+		`tide_storage_uploads_total{outcome="error",provider="local"} 1`,
+		`tide_storage_uploads_total{outcome="success",provider="local"} 1`,
+		`tide_storage_uploads_duration_seconds_count{outcome="success",provider="local"} 1`,
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("Start() metrics =\n%s\nwant line %s", b.String(), line)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		recorder Recorder
+		want     string
+	}{
+		{
+			"Nop",
+			nil,
+			"",
+		},
+		{
+			"Registry",
+			NewRegistry(),
+			"# TYPE tide_pipe_messages_total counter\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetRecorder(tt.recorder)
+			defer SetRecorder(nil)
+
+			// Recorded to the default recorder, which is Nop without a registry.
+			Inc(PipeMessages, nil)
+			Observe(PipeShutdown, nil, time.Second.Seconds())
+
+			rec := httptest.NewRecorder()
+			Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+			if got := rec.Header().Get("Content-Type"); got != contentType {
+				t.Errorf("Handler() Content-Type = %v, want %v", got, contentType)
+			}
+			if !strings.Contains(rec.Body.String(), tt.want) || (tt.want == "" && rec.Body.Len() > 0) {
+				t.Errorf("Handler() body = %q, want %q", rec.Body.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// contentType of the Prometheus text format.
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds in seconds of the histogram buckets. Audits can take minutes.
+var DefaultBuckets = []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
+// help describes the metrics of this library.
+var help = map[string]string{
+	StageJobs + "_total":                  "Jobs processed by a stage.",
+	StageJobs + "_duration_seconds":       "Time a stage took to process a job.",
+	Audits + "_total":                     "Audits that ran.",
+	Audits + "_duration_seconds":          "Time an audit took.",
+	QueueOperations + "_total":            "Calls to message providers.",
+	QueueOperations + "_duration_seconds": "Time calls to message providers took.",
+	StorageUploads + "_total":             "Uploads to storage providers.",
+	StorageUploads + "_duration_seconds":  "Time uploads to storage providers took.",
+	PipeMessages:                          "Messages that went through a pipe.",
+	PipeShutdown:                          "Time a pipe took to shut down.",
+}
+
+// Registry is a Recorder that keeps the metrics in memory and serves them in the Prometheus text format.
+type Registry struct {
+	mutex      sync.Mutex
+	buckets    []float64
+	counters   map[string]map[string]float64
+	histograms map[string]map[string]*histogram
+}
+
+// histogram is a single series of a histogram.
+type histogram struct {
+	counts []uint64 // Observations in each bucket, not cumulative.
+	sum    float64
+	count  uint64
+}
+
+// NewRegistry returns a registry with histograms using DefaultBuckets.
+func NewRegistry() *Registry {
+	return NewRegistryWithBuckets(DefaultBuckets)
+}
+
+// NewRegistryWithBuckets returns a registry with histograms using the buckets.
+func NewRegistryWithBuckets(buckets []float64) *Registry {
+	b := make([]float64, len(buckets))
+	copy(b, buckets)
+	sort.Float64s(b)
+
+	return &Registry{
+		buckets:    b,
+		counters:   make(map[string]map[string]float64),
+		histograms: make(map[string]map[string]*histogram),
+	}
+}
+
+// Inc increments a counter.
+func (r *Registry) Inc(name string, labels Labels) {
+	key := formatLabels(labels)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	series, ok := r.counters[name]
+	if !ok {
+		series = make(map[string]float64)
+		r.counters[name] = series
+	}
+	series[key]++
+}
+
+// Observe adds a value to a histogram.
+func (r *Registry) Observe(name string, labels Labels, value float64) {
+	key := formatLabels(labels)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	series, ok := r.histograms[name]
+	if !ok {
+		series = make(map[string]*histogram)
+		r.histograms[name] = series
+	}
+
+	h, ok := series[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(r.buckets))}
+		series[key] = h
+	}
+
+	for i, upper := range r.buckets {
+		if value <= upper {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	r.Write(w)
+}
+
+// Write writes the metrics in the Prometheus text format.
+func (r *Registry) Write(w io.Writer) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	buf := bufio.NewWriter(w)
+
+	names := make([]string, 0, len(r.counters))
+	for name := range r.counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		writeHeader(buf, name, "counter")
+		series := r.counters[name]
+
+		keys := make([]string, 0, len(series))
+		for labels := range series {
+			keys = append(keys, labels)
+		}
+		sort.Strings(keys)
+
+		for _, labels := range keys {
+			fmt.Fprintf(buf, "%s%s %s\n", name, wrap(labels), formatFloat(series[labels]))
+		}
+	}
+
+	names = names[:0]
+	for name := range r.histograms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		writeHeader(buf, name, "histogram")
+		series := r.histograms[name]
+
+		keys := make([]string, 0, len(series))
+		for labels := range series {
+			keys = append(keys, labels)
+		}
+		sort.Strings(keys)
+
+		for _, labels := range keys {
+			h := series[labels]
+
+			var cumulative uint64
+			for i, upper := range r.buckets {
+				cumulative += h.counts[i]
+				fmt.Fprintf(buf, "%s_bucket%s %d\n", name, wrap(join(labels, `le="`+formatFloat(upper)+`"`)), cumulative)
+			}
+			fmt.Fprintf(buf, "%s_bucket%s %d\n", name, wrap(join(labels, `le="+Inf"`)), h.count)
+			fmt.Fprintf(buf, "%s_sum%s %s\n", name, wrap(labels), formatFloat(h.sum))
+			fmt.Fprintf(buf, "%s_count%s %d\n", name, wrap(labels), h.count)
+		}
+	}
+
+	return buf.Flush()
+}
+
+func writeHeader(w io.Writer, name, kind string) {
+	if text, ok := help[name]; ok {
+		fmt.Fprintf(w, "# HELP %s %s\n", name, text)
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+// formatLabels returns the labels as `a="x",b="y"`, sorted by name.
+func formatLabels(labels Labels) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escaper.Replace(labels[name]) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func join(labels, label string) string {
+	if labels == "" {
+		return label
+	}
+	return labels + "," + label
+}
+
+func wrap(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
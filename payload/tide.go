@@ -24,6 +24,7 @@ func (t TidePayload) BuildPayload(msg message.Message, data map[string]interface
 	simpleCodeInfo := tide.SimplifyCodeDetails(codeInfo.Details)
 
 	// Loop through tc.Result to get all `AuditResult`s.
+	// Failed audits are sent with their error, so that the results are sent even if some audits failed.
 	results := make(map[string]tide.AuditResult)
 	for key, result := range data {
 
@@ -39,11 +40,14 @@ func (t TidePayload) BuildPayload(msg message.Message, data map[string]interface
 		return nil, errors.New("no results to send to Tide API")
 	}
 
+	// Jobs that failed before the checksum was known still report their errors.
+	checksum, _ := data["checksum"].(string)
+
 	payloadItem := &tide.Item{
 		Title:         fallbackValue(simpleCodeInfo.Name, msg.Title).(string),
 		Description:   fallbackValue(simpleCodeInfo.Description, msg.Content).(string),
 		Version:       simpleCodeInfo.Version,
-		Checksum:      data["checksum"].(string),
+		Checksum:      checksum,
 		Visibility:    msg.Visibility,
 		ProjectType:   fallbackValue(codeInfo.Type, msg.ProjectType).(string),
 		SourceURL:     msg.SourceURL,
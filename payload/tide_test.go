@@ -97,6 +97,32 @@ func TestTidePayload_BuildPayload(t *testing.T) {
 			[]byte(`{"title":"","content":"","version":"","checksum":"abcdefg","visibility":"","project_type":"plugin","source_url":"","source_type":"","code_info":{"type":"plugin","details":[],"cloc":{}},"reports":{"phpcs_demo":{"raw":{"type":"mock","filename":"mock","path":"mock"},"parsed":{"type":"mock","filename":"mock","path":"mock"},"summary":{}}}}`),
 			false,
 		},
+		{
+			"Failed Results",
+			fields{
+				&MockTideClient{},
+			},
+			args{
+				data: map[string]interface{}{
+					"info": mockInfo,
+					"phpcs_wordpress": tide.AuditResult{
+						Raw: tide.AuditDetails{
+							Type:     "mock",
+							FileName: "mock",
+							Path:     "mock",
+						},
+					},
+					"lighthouse": tide.AuditResult{
+						Error:    "lighthouse timed out after 1s",
+						ExitCode: -1,
+						Stderr:   "killed",
+					},
+					"checksum": "abcdefg",
+				},
+			},
+			[]byte(`{"title":"","content":"","version":"","checksum":"abcdefg","visibility":"","project_type":"plugin","source_url":"","source_type":"","code_info":{"type":"plugin","details":[],"cloc":{}},"reports":{"lighthouse":{"raw":{},"parsed":{},"summary":{},"error":"lighthouse timed out after 1s","exit_code":-1,"stderr":"killed"},"phpcs_wordpress":{"raw":{"type":"mock","filename":"mock","path":"mock"},"parsed":{},"summary":{}}}}`),
+			false,
+		},
 		{
 			"Some Results - With Project Defined",
 			fields{
@@ -4,16 +4,25 @@ package pipe
 import (
 	"context"
 	"errors"
+	"time"
 
+	"github.com/wptide/pkg/health"
+	"github.com/wptide/pkg/message"
+	"github.com/wptide/pkg/metrics"
 	"github.com/wptide/pkg/process"
 )
 
 // Pipe represents a pipe that contains multiple processes.
+// The processes are connected by their channels, so besides a chain a pipe can be a small DAG:
+// a process.Fork sends every job to parallel branches and a process.Join merges them again.
 type Pipe struct {
 	processes  []process.Processor
+	started    []process.Processor
 	errors     []<-chan error
 	context    context.Context
 	cancelFunc context.CancelFunc
+	completer  process.Completer
+	health     *health.Registry
 }
 
 // New creates a new Pipe and then runs the init() method which sets a cancelable context.
@@ -60,16 +69,124 @@ func (p *Pipe) AddProcesses(procs ...process.Processor) error {
 	return nil
 }
 
-// Run iterates over the processes slice and starts each process.
-func (p *Pipe) Run(errc *chan error) error {
-	defer p.cancelFunc()
+// SetCompleter sets the completer that is told how every job ended, e.g. a process.Acknowledger
+// to delete or release the messages in the queue. It has to be set before the pipe starts.
+func (p *Pipe) SetCompleter(c process.Completer) {
+	p.completer = c
+}
+
+// SetHealth sets the registry that the processes report into, e.g. a registry of the pipeline that serves
+// its liveness and readiness. Without it nothing is reported. It has to be set before the pipe starts.
+func (p *Pipe) SetHealth(r *health.Registry) {
+	p.health = r
+}
+
+// completable is implemented by processes that can tell how their jobs ended.
+type completable interface {
+	SetCompleter(c process.Completer)
+}
+
+// stopper is implemented by processes that take new messages from outside of the pipe.
+type stopper interface {
+	Stop()
+}
+
+// waiter is implemented by processes that can tell when they stopped running.
+type waiter interface {
+	Stopped() <-chan struct{}
+}
+
+// Start iterates over the processes slice and starts each process.
+// The processes keep running until Shutdown is called.
+func (p *Pipe) Start(errc *chan error) error {
+	// Count how the messages ended, before the completer is told.
+	completer := process.CompleterFunc(func(msg message.Message, err error) {
+		countMessage(err)
+		if p.completer != nil {
+			p.completer.Complete(msg, err)
+		}
+	})
 
 	for _, proc := range p.processes {
+		if c, ok := proc.(completable); ok {
+			c.SetCompleter(completer)
+		}
+		if r, ok := proc.(health.Reporter); ok {
+			r.SetHealth(p.health)
+		}
+
 		err := proc.Run(errc)
 		if err != nil {
+			// Stop the processes that already started.
+			p.cancelFunc()
 			return err
 		}
+		p.started = append(p.started, proc)
 	}
 
 	return nil
 }
+
+// Run starts each process, it is the same as Start. It is kept for the callers that only ran pipes,
+// pipes that are shut down should use Start and Shutdown.
+func (p *Pipe) Run(errc *chan error) error {
+	return p.Start(errc)
+}
+
+// Shutdown stops the pipe gracefully. The processes stop taking new messages and finish the
+// jobs they already took, then Shutdown returns once every process stopped running.
+// If ctx is done first, the jobs that are still running are cancelled, and the error of ctx is returned
+// once the processes stopped.
+func (p *Pipe) Shutdown(ctx context.Context) error {
+	start := time.Now()
+	defer func() {
+		metrics.Observe(metrics.PipeShutdown, nil, time.Since(start).Seconds())
+	}()
+
+	for _, proc := range p.started {
+		if s, ok := proc.(stopper); ok {
+			s.Stop()
+		}
+	}
+
+	var err error
+	for _, proc := range p.started {
+		w, ok := proc.(waiter)
+		if !ok {
+			continue
+		}
+
+		select {
+		case <-w.Stopped():
+			continue
+		case <-ctx.Done():
+		}
+
+		// Cancel the jobs that are still running, and wait until they ended.
+		err = ctx.Err()
+		p.cancelFunc()
+		<-w.Stopped()
+	}
+
+	p.cancelFunc()
+	return err
+}
+
+// countMessage records how a message ended in the metrics, with the stage it failed in.
+func countMessage(err error) {
+	labels := metrics.Labels{"stage": "", "outcome": metrics.Success}
+
+	if err != nil {
+		labels["outcome"] = metrics.Retryable
+		if process.IsPermanent(err) {
+			labels["outcome"] = metrics.Permanent
+		}
+
+		var pErr *process.PipelineError
+		if errors.As(err, &pErr) {
+			labels["stage"] = pErr.Stage
+		}
+	}
+
+	metrics.Inc(metrics.PipeMessages, labels)
+}
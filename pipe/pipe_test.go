@@ -4,10 +4,13 @@ import (
 	"context"
 	"errors"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/wptide/pkg/message"
+	"github.com/wptide/pkg/metrics"
 	"github.com/wptide/pkg/process"
 )
 
@@ -216,3 +219,305 @@ func TestPipe_Run(t *testing.T) {
 		})
 	}
 }
+
+type mockStage struct {
+	mockProcess
+	ctx      context.Context
+	jobTime  time.Duration
+	stop     chan struct{}
+	stopped  chan struct{}
+	finished bool
+}
+
+func (m *mockStage) SetContext(ctx context.Context) { m.ctx = ctx }
+func (m *mockStage) Stop()                          { close(m.stop) }
+func (m *mockStage) Stopped() <-chan struct{}       { return m.stopped }
+
+func (m *mockStage) Run(errc *chan error) error {
+	m.stop = make(chan struct{})
+	m.stopped = make(chan struct{})
+
+	go func() {
+		defer close(m.stopped)
+
+		// A job that is in-flight when the pipe shuts down.
+		select {
+		case <-time.After(m.jobTime):
+			m.finished = true
+		case <-m.ctx.Done():
+		}
+
+		<-m.stop
+	}()
+
+	return nil
+}
+
+func TestPipe_Shutdown(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		procs        []process.Processor
+		timeout      time.Duration
+		wantErr      error
+		wantFinished bool
+	}{
+		{
+			"Drain In-flight Job",
+			[]process.Processor{
+				&mockProcess{},
+				&mockStage{
+					jobTime: time.Millisecond * 50,
+				},
+			},
+			time.Second,
+			nil,
+			true,
+		},
+		{
+			"Cancel Job After Timeout",
+			[]process.Processor{
+				&mockStage{
+					jobTime: time.Hour,
+				},
+			},
+			time.Millisecond * 50,
+			context.DeadlineExceeded,
+			false,
+		},
+		{
+			"Processes Without Lifecycle",
+			[]process.Processor{
+				&mockProcess{},
+			},
+			time.Millisecond * 50,
+			nil,
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := WithProcesses(tt.procs...)
+
+			errc := make(chan error)
+			if err := p.Start(&errc); err != nil {
+				t.Errorf("Pipe.Start() error = %v", err)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+
+			if err := p.Shutdown(ctx); err != tt.wantErr {
+				t.Errorf("Pipe.Shutdown() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			// The processes can't run after shutting down.
+			if p.context.Err() == nil {
+				t.Errorf("Pipe.Shutdown() did not cancel the context")
+			}
+
+			for _, proc := range tt.procs {
+				if stage, ok := proc.(*mockStage); ok {
+					select {
+					case <-stage.stopped:
+					default:
+						t.Errorf("Pipe.Shutdown() returned before the process stopped")
+						continue
+					}
+					if stage.finished != tt.wantFinished {
+						t.Errorf("Pipe.Shutdown() finished job = %v, want %v", stage.finished, tt.wantFinished)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPipe_Start(t *testing.T) {
+
+	p := WithProcesses(&mockProcess{}, &mockProcess{shouldErr: true})
+
+	errc := make(chan error)
+	if err := p.Start(&errc); err == nil {
+		t.Errorf("Pipe.Start() error = nil, want error")
+	}
+
+	// Processes that already started are stopped.
+	if p.context.Err() == nil {
+		t.Errorf("Pipe.Start() did not cancel the context")
+	}
+}
+
+func TestPipe_DAG(t *testing.T) {
+
+	in := make(chan process.Processor, 2)
+	for _, title := range []string{"Plugin One", "Plugin Two"} {
+		job := &process.Join{}
+		job.SetMessage(message.Message{Title: title})
+		job.SetResults(&process.Result{})
+		in <- job
+	}
+	close(in)
+
+	// Two branches without stages of their own.
+	branches := []chan process.Processor{make(chan process.Processor), make(chan process.Processor)}
+
+	fork := &process.Fork{
+		In:   in,
+		Outs: branches,
+	}
+	join := &process.Join{
+		Ins: []<-chan process.Processor{branches[0], branches[1]},
+		Out: make(chan process.Processor, 2),
+	}
+
+	p := WithProcesses(fork, join)
+
+	errc := make(chan error, 1)
+	if err := p.Start(&errc); err != nil {
+		t.Errorf("Pipe.Start() error = %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// Every job goes through the whole DAG before the pipe stops.
+	if err := p.Shutdown(ctx); err != nil {
+		t.Errorf("Pipe.Shutdown() error = %v", err)
+	}
+
+	var titles []string
+	for proc := range join.Out {
+		titles = append(titles, proc.GetMessage().Title)
+	}
+	if want := []string{"Plugin One", "Plugin Two"}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("Pipe joined %v, want %v", titles, want)
+	}
+}
+
+func TestPipe_SetCompleter(t *testing.T) {
+
+	jobs := make(chan *process.Job, 3)
+	for _, title := range []string{"Valid", "Timeout", "Invalid"} {
+		ref := title
+		jobs <- process.NewJob(message.Message{Title: title, ExternalRef: &ref})
+	}
+	close(jobs)
+
+	stage := &process.Stage{
+		Name: "Audit",
+		In:   jobs,
+		Processor: process.JobProcessorFunc(func(ctx context.Context, job *process.Job) error {
+			switch job.Message.Title {
+			case "Timeout":
+				return errors.New("timed out")
+			case "Invalid":
+				return process.Permanent(errors.New("invalid message"))
+			}
+			return nil
+		}),
+	}
+
+	var mutex sync.Mutex
+	outcomes := make(map[string]string)
+
+	p := WithProcesses(stage)
+	p.SetCompleter(process.CompleterFunc(func(msg message.Message, err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch {
+		case err == nil:
+			outcomes[*msg.ExternalRef] = "delete"
+		case process.IsPermanent(err):
+			outcomes[*msg.ExternalRef] = "fail"
+		default:
+			outcomes[*msg.ExternalRef] = "release"
+		}
+	}))
+
+	errc := make(chan error, 3)
+	if err := p.Start(&errc); err != nil {
+		t.Errorf("Pipe.Start() error = %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := p.Shutdown(ctx); err != nil {
+		t.Errorf("Pipe.Shutdown() error = %v", err)
+	}
+
+	want := map[string]string{
+		"Valid":   "delete",
+		"Timeout": "release",
+		"Invalid": "fail",
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if !reflect.DeepEqual(outcomes, want) {
+		t.Errorf("Pipe completed %v, want %v", outcomes, want)
+	}
+}
+
+func TestPipe_Metrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	metrics.SetRecorder(registry)
+	defer metrics.SetRecorder(nil)
+
+	jobs := make(chan *process.Job, 3)
+	for _, title := range []string{"Valid", "Timeout", "Invalid"} {
+		jobs <- process.NewJob(message.Message{Title: title})
+	}
+	close(jobs)
+
+	stage := &process.Stage{
+		Name: "Audit",
+		In:   jobs,
+		Processor: process.JobProcessorFunc(func(ctx context.Context, job *process.Job) error {
+			switch job.Message.Title {
+			case "Timeout":
+				return errors.New("timed out")
+			case "Invalid":
+				return process.Permanent(errors.New("invalid message"))
+			}
+			return nil
+		}),
+	}
+
+	// Messages are counted without a completer.
+	p := WithProcesses(stage)
+
+	errc := make(chan error, 3)
+	if err := p.Start(&errc); err != nil {
+		t.Errorf("Pipe.Start() error = %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := p.Shutdown(ctx); err != nil {
+		t.Errorf("Pipe.Shutdown() error = %v", err)
+	}
+
+	var b strings.Builder
+	registry.Write(&b)
+
+	for _, line := range []string{
+		`tide_pipe_messages_total{outcome="permanent",stage="Audit"} 1`,
+		`tide_pipe_messages_total{outcome="retryable",stage="Audit"} 1`,
+		`tide_pipe_messages_total{outcome="success",stage=""} 1`,
+		`tide_stage_jobs_total{outcome="permanent",stage="Audit"} 1`,
+		`tide_stage_jobs_total{outcome="retryable",stage="Audit"} 1`,
+		`tide_stage_jobs_total{outcome="success",stage="Audit"} 1`,
+		`tide_pipe_shutdown_duration_seconds_count 1`,
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("Pipe metrics =\n%s\nwant line %s", b.String(), line)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+)
+
+// auditor is implemented by processes that run several audits for a job.
+type auditor interface {
+	doAudits() []error
+}
+
+// projectSplitter is implemented by processes that send a job for every project found in a source.
+type projectSplitter interface {
+	projectProcesses() []Processor
+}
+
+// adapter runs a process as a JobProcessor.
+type adapter struct {
+	proc Processor
+}
+
+// Adapt returns a JobProcessor that runs a process for every job, so that existing processes
+// can be used in stages. Processes keep the current job in their own fields, so every job
+// runs on its own copy of the process. Sources with several projects are split into a job for
+// every project, the same way the process sends them down a pipe, see Split.
+func Adapt(proc Processor) JobProcessor {
+	return &adapter{
+		proc: proc,
+	}
+}
+
+// Do copies the job to a copy of the process, runs it and copies the results back to the job.
+func (a *adapter) Do(ctx context.Context, job *Job) error {
+	proc := copyProcessor(a.proc)
+	result := job.Result()
+
+	proc.SetContext(ctx)
+	proc.SetMessage(job.Message)
+	proc.SetResults(&result)
+	proc.SetFilesPath(job.FilesPath)
+
+	var err error
+	if audits, ok := proc.(auditor); ok {
+		err = combineErrors(audits.doAudits())
+	} else {
+		err = proc.Do()
+	}
+
+	job.Message = proc.GetMessage()
+	job.FilesPath = proc.GetFilesPath()
+	if res := proc.GetResult(); res != nil {
+		job.SetResult(*res)
+	}
+
+	return err
+}
+
+// Split returns a job for every project that the process found in the source of the job.
+// Jobs with a single project, and jobs of processes that don't look for projects, are returned as they are.
+func (a *adapter) Split(job *Job) []*Job {
+	splitter, ok := copyProcessor(a.proc).(projectSplitter)
+	if _, found := job.Results["projects"]; !ok || !found {
+		return []*Job{job}
+	}
+
+	proc := splitter.(Processor)
+	result := job.Result()
+	proc.SetMessage(job.Message)
+	proc.SetResults(&result)
+	proc.SetFilesPath(job.FilesPath)
+
+	procs := splitter.projectProcesses()
+	jobs := make([]*Job, len(procs))
+	for i, project := range procs {
+		split := *job
+		split.ID = newJobID()
+		split.Message = project.GetMessage()
+		split.Timings = append([]Timing(nil), job.Timings...)
+		split.Errors = append([]error(nil), job.Errors...)
+		split.SetResult(*project.GetResult())
+		jobs[i] = &split
+	}
+	return jobs
+}
+
+// copyProcessor returns a copy of a process, the same way the workers of a process copy it.
+// Processes that aren't pointers to structs are returned as they are.
+func copyProcessor(proc Processor) Processor {
+	v := reflect.ValueOf(proc)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return proc
+	}
+
+	c := reflect.New(v.Elem().Type())
+	c.Elem().Set(v.Elem())
+	if copied, ok := c.Interface().(Processor); ok {
+		return copied
+	}
+	return proc
+}
+
+// combineErrors returns a single error for a list of errors, or nil if there are none.
+func combineErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+
+	// Retrying the job is worth it if any of the errors might not happen again.
+	permanent := true
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+		permanent = permanent && IsPermanent(err)
+	}
+
+	err := errors.New(strings.Join(messages, "; "))
+	if permanent {
+		return Permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,204 @@
+package process
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wptide/pkg/log"
+	"github.com/wptide/pkg/message"
+)
+
+type mockAuditor struct {
+	Process
+}
+
+func (m *mockAuditor) Run(errc *chan error) error { return nil }
+func (m *mockAuditor) Do() error                  { return nil }
+
+func (m *mockAuditor) doAudits() []error {
+	(*m.Result)["audited"] = true
+	return []error{errors.New("first failed"), errors.New("second failed")}
+}
+
+type mockBlockingProc struct {
+	Process
+	started chan struct{}
+	release chan struct{}
+}
+
+func (m *mockBlockingProc) Run(errc *chan error) error { return nil }
+
+func (m *mockBlockingProc) Do() error {
+	m.started <- struct{}{}
+	<-m.release
+	(*m.Result)["title"] = m.Message.Title
+	return nil
+}
+
+func TestAdapt(t *testing.T) {
+
+	b := bytes.Buffer{}
+	log.SetOutput(&b)
+	defer log.SetOutput(os.Stdout)
+
+	tests := []struct {
+		name     string
+		proc     Processor
+		job      *Job
+		wantType string
+		wantErr  string
+	}{
+		{
+			"Info Process",
+			&Info{},
+			&Job{
+				Message:   message.Message{Title: "Test Plugin"},
+				FilesPath: "./testdata/info/plugin",
+			},
+			"plugin",
+			"",
+		},
+		{
+			"Info Process Error",
+			&Info{},
+			&Job{
+				Message: message.Message{Title: "Test Plugin"},
+			},
+			"",
+			"could not determine files path",
+		},
+		{
+			"Several Audits",
+			&mockAuditor{},
+			&Job{
+				Message: message.Message{Title: "Test Plugin"},
+			},
+			"",
+			"first failed; second failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Adapt(tt.proc).Do(context.Background(), tt.job)
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("Adapt().Do() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantType != "" && (tt.job.Info == nil || tt.job.Info.Type != tt.wantType) {
+				t.Errorf("Adapt().Do() info = %v, want type %v", tt.job.Info, tt.wantType)
+			}
+
+			// The results of the process are copied to the job, even if it failed.
+			if _, ok := tt.proc.(*mockAuditor); ok && tt.job.Results["audited"] != true {
+				t.Errorf("Adapt().Do() results = %v, want audited", tt.job.Results)
+			}
+		})
+	}
+}
+
+func TestAdapt_Concurrent(t *testing.T) {
+	proc := &mockBlockingProc{
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	adapted := Adapt(proc)
+
+	jobs := []*Job{
+		{Message: message.Message{Title: "First Plugin"}},
+		{Message: message.Message{Title: "Second Plugin"}},
+	}
+
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job *Job) {
+			defer wg.Done()
+			adapted.Do(context.Background(), job)
+		}(job)
+	}
+
+	// Both jobs run at the same time.
+	for range jobs {
+		select {
+		case <-proc.started:
+		case <-time.After(time.Second):
+			t.Error("Adapt().Do() ran the jobs one at a time")
+		}
+	}
+	close(proc.release)
+	wg.Wait()
+
+	for _, job := range jobs {
+		if job.Results["title"] != job.Message.Title {
+			t.Errorf("Adapt().Do() results = %v, want title %v", job.Results, job.Message.Title)
+		}
+	}
+}
+
+func TestAdapt_Split(t *testing.T) {
+
+	b := bytes.Buffer{}
+	log.SetOutput(&b)
+	defer log.SetOutput(os.Stdout)
+
+	// Clean up after.
+	defer func() {
+		os.RemoveAll("./testdata/tmp")
+	}()
+
+	adapted := Adapt(&Ingest{TempFolder: "./testdata/tmp"})
+
+	job := NewJob(message.Message{
+		Title:               "Agency Bundle",
+		Slug:                "agency-bundle",
+		ResponseAPIEndpoint: ts.URL + "/api/audits",
+		SourceURL:           "file://./testdata/bundle",
+		SourceType:          "local",
+	})
+	if err := adapted.Do(context.Background(), job); err != nil {
+		t.Errorf("Adapt().Do() error = %v", err)
+		return
+	}
+
+	splitter, ok := adapted.(JobSplitter)
+	if !ok {
+		t.Fatal("Adapt() is not a JobSplitter")
+	}
+
+	jobs := splitter.Split(job)
+	if len(jobs) != 3 {
+		t.Errorf("Adapt().Split() = %d jobs, want 3", len(jobs))
+		return
+	}
+
+	wantSlugs := []string{"plugin-one", "plugin-two", "theme-one"}
+	ids := make(map[string]bool)
+	for i, got := range jobs {
+		if _, ok := got.Results["projects"]; ok {
+			t.Errorf("Adapt().Split() %d results contain the projects", i)
+		}
+		if got.Message.Slug != wantSlugs[i] {
+			t.Errorf("Adapt().Split() %d slug = %v, want %v", i, got.Message.Slug, wantSlugs[i])
+		}
+		if got.Checksum == job.Checksum || got.CodePath == "" {
+			t.Errorf("Adapt().Split() %d = %+v, want the checksum and code path of the project", i, got)
+		}
+		ids[got.ID] = true
+		got.CloseWorkspace()
+	}
+	if len(ids) != 3 {
+		t.Errorf("Adapt().Split() IDs = %v, want 3 unique IDs", ids)
+	}
+
+	// A job with a single project is not split.
+	single := &Job{Message: message.Message{Title: "Test Plugin"}, Results: Result{}}
+	if got := splitter.Split(single); len(got) != 1 || got[0] != single {
+		t.Errorf("Adapt().Split() = %v, want the job itself", got)
+	}
+}
@@ -0,0 +1,150 @@
+package process
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/wptide/pkg/log"
+	"github.com/wptide/pkg/message"
+)
+
+// Completer is told how every job of a pipe ended. The error is nil if the job made it through the pipe,
+// otherwise it is the error that stopped the job.
+type Completer interface {
+	Complete(msg message.Message, err error)
+}
+
+// CompleterFunc is a function that implements Completer.
+type CompleterFunc func(msg message.Message, err error)
+
+// Complete calls f(msg, err).
+func (f CompleterFunc) Complete(msg message.Message, err error) {
+	f(msg, err)
+}
+
+// Acknowledger is a Completer that tells the message provider how the jobs ended.
+// Messages of jobs that made it through the pipe are marked as completed, or deleted if the provider
+// doesn't keep them. Messages of jobs that failed are released, so that another worker can retry them,
+// or marked as failed if the error is permanent.
+type Acknowledger struct {
+	Provider message.Provider // Provider the messages came from.
+	Backoff  time.Duration    // (Optional) Delay before a failed message is retried. Defaults to no delay.
+}
+
+// Complete acknowledges the message of a job.
+func (a Acknowledger) Complete(msg message.Message, err error) {
+	if a.Provider == nil || msg.ExternalRef == nil {
+		return
+	}
+
+	var ackErr error
+	switch {
+	case err == nil:
+		if completer, ok := a.Provider.(message.Completer); ok {
+			ackErr = completer.CompleteMessage(msg.ExternalRef)
+		} else {
+			ackErr = a.Provider.DeleteMessage(msg.ExternalRef)
+		}
+	case IsPermanent(err):
+		if failer, ok := a.Provider.(message.Failer); ok {
+			ackErr = failer.FailMessage(msg.ExternalRef, err.Error())
+		} else {
+			// Without a way to keep failed messages, don't let them come back.
+			ackErr = a.Provider.DeleteMessage(msg.ExternalRef)
+		}
+	default:
+		// Only the jobs that failed are sent again, so that the others are not posted twice.
+		var retry *RetryError
+		if errors.As(err, &retry) {
+			sendErr := a.Provider.SendMessage(&retry.Message)
+			if sendErr == nil {
+				a.Complete(msg, nil)
+				return
+			}
+			log.Log(msg.Title, "Could not send the jobs to retry: "+sendErr.Error())
+		}
+
+		releaser, ok := a.Provider.(message.Releaser)
+		if !ok {
+			// The message is retried once its lock expires.
+			return
+		}
+		ackErr = releaser.ReleaseMessage(msg.ExternalRef, a.Backoff)
+	}
+
+	if ackErr != nil {
+		log.Log(msg.Title, "Could not acknowledge message: "+ackErr.Error())
+	}
+}
+
+// jobGroup keeps track of the jobs that were started for a single message, e.g. for every project of
+// a bundle, so that the message is completed once all of them ended.
+type jobGroup struct {
+	mutex     sync.Mutex
+	msg       message.Message // Message that started the jobs.
+	jobs      int
+	remaining int
+	retry     []string // Projects of the jobs that failed with a retryable error.
+	err       error
+}
+
+// end records the end of the job of a project. It returns true and the outcome of the group once every job ended.
+func (g *jobGroup) end(project string, err error) (bool, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	// A retryable error wins over a permanent one, so that the message is tried again.
+	if err != nil && (g.err == nil || (IsPermanent(g.err) && !IsPermanent(err))) {
+		g.err = err
+	}
+	if err != nil && !IsPermanent(err) {
+		g.retry = append(g.retry, project)
+	}
+
+	g.remaining--
+	if g.remaining > 0 {
+		return false, nil
+	}
+
+	// Only the projects that failed are tried again, every retry has fewer projects.
+	if g.err != nil && !IsPermanent(g.err) && len(g.retry) < g.jobs {
+		msg := g.msg
+		msg.ExternalRef = nil
+		msg.Projects = g.retry
+		return true, &RetryError{g.err, msg}
+	}
+	return true, g.err
+}
+
+// SetCompleter sets the completer that is told how the jobs of the process ended.
+func (p *Process) SetCompleter(c Completer) {
+	p.completer = c
+}
+
+// complete tells the completer that a job ended, and ends its trace.
+func (p Process) complete(msg message.Message, result *Result, err error) {
+	if result != nil {
+		// A branch of a fork dropped the job, the join completes it.
+		if job, ok := (*result)["fork"].(*fork); ok && !job.drop(err) {
+			return
+		}
+
+		if group, ok := (*result)["jobGroup"].(*jobGroup); ok {
+			project, _ := (*result)["project"].(string)
+			done, groupErr := group.end(project, err)
+			if !done {
+				return
+			}
+			err = groupErr
+		}
+	}
+
+	endTrace(result, err)
+
+	if p.completer == nil {
+		return
+	}
+
+	p.completer.Complete(msg, err)
+}
@@ -0,0 +1,259 @@
+package process
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wptide/pkg/message"
+)
+
+// mockQueue records what happened to the messages.
+type mockQueue struct {
+	calls   []string
+	sendErr error
+}
+
+func (m *mockQueue) GetNextMessage() (*message.Message, error) { return nil, nil }
+func (m *mockQueue) Close() error                              { return nil }
+
+func (m *mockQueue) SendMessage(msg *message.Message) error {
+	m.calls = append(m.calls, "send "+strings.Join(msg.Projects, ","))
+	return m.sendErr
+}
+
+func (m *mockQueue) DeleteMessage(ref *string) error {
+	m.calls = append(m.calls, "delete "+*ref)
+	return nil
+}
+
+// mockReleasingQueue can also release and fail messages.
+type mockReleasingQueue struct {
+	mockQueue
+}
+
+func (m *mockReleasingQueue) ReleaseMessage(ref *string, delay time.Duration) error {
+	m.calls = append(m.calls, "release "+*ref+" "+delay.String())
+	return nil
+}
+
+func (m *mockReleasingQueue) FailMessage(ref *string, reason string) error {
+	m.calls = append(m.calls, "fail "+*ref+" "+reason)
+	return errors.New("something went wrong")
+}
+
+// mockTrackingQueue keeps the messages of completed jobs.
+type mockTrackingQueue struct {
+	mockReleasingQueue
+}
+
+func (m *mockTrackingQueue) CompleteMessage(ref *string) error {
+	m.calls = append(m.calls, "complete "+*ref)
+	return nil
+}
+
+func TestAcknowledger_Complete(t *testing.T) {
+	ref := "ref-1"
+	msg := message.Message{
+		Title:       "Test",
+		ExternalRef: &ref,
+	}
+
+	tests := []struct {
+		name      string
+		releasing bool
+		tracking  bool
+		msg       message.Message
+		err       error
+		sendErr   error
+		want      []string
+	}{
+		{
+			"Success",
+			true,
+			false,
+			msg,
+			nil,
+			nil,
+			[]string{"delete ref-1"},
+		},
+		{
+			"Success - Tracking",
+			true,
+			true,
+			msg,
+			nil,
+			nil,
+			[]string{"complete ref-1"},
+		},
+		{
+			"Permanent - Tracking",
+			true,
+			true,
+			msg,
+			Permanent(errors.New("invalid message")),
+			nil,
+			[]string{"fail ref-1 invalid message"},
+		},
+		{
+			"Retryable",
+			true,
+			false,
+			msg,
+			NewPipelineError("PHPCS", msg, errors.New("timed out")),
+			nil,
+			[]string{"release ref-1 1m0s"},
+		},
+		{
+			"Permanent",
+			true,
+			false,
+			msg,
+			NewPipelineError("Ingest", msg, Permanent(errors.New("invalid message"))),
+			nil,
+			[]string{"fail ref-1 Ingest Error: invalid message"},
+		},
+		{
+			"Retryable - No Release",
+			false,
+			false,
+			msg,
+			errors.New("timed out"),
+			nil,
+			nil,
+		},
+		{
+			"Permanent - No Fail",
+			false,
+			false,
+			msg,
+			Permanent(errors.New("invalid message")),
+			nil,
+			[]string{"delete ref-1"},
+		},
+		{
+			"Retry Projects",
+			true,
+			true,
+			msg,
+			&RetryError{NewPipelineError("PHPCS", msg, errors.New("timed out")), message.Message{Projects: []string{"plugin-two"}}},
+			nil,
+			[]string{"send plugin-two", "complete ref-1"},
+		},
+		{
+			"Retry Projects - Failed Send",
+			true,
+			false,
+			msg,
+			&RetryError{NewPipelineError("PHPCS", msg, errors.New("timed out")), message.Message{Projects: []string{"plugin-two"}}},
+			errors.New("something went wrong"),
+			[]string{"send plugin-two", "release ref-1 1m0s"},
+		},
+		{
+			"No Reference",
+			true,
+			false,
+			message.Message{Title: "Test"},
+			nil,
+			nil,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var queue *mockQueue
+			var provider message.Provider
+			if tt.tracking {
+				tracking := &mockTrackingQueue{}
+				queue, provider = &tracking.mockQueue, tracking
+			} else if tt.releasing {
+				releasing := &mockReleasingQueue{}
+				queue, provider = &releasing.mockQueue, releasing
+			} else {
+				queue = &mockQueue{}
+				provider = queue
+			}
+			queue.sendErr = tt.sendErr
+
+			a := Acknowledger{
+				Provider: provider,
+				Backoff:  time.Minute,
+			}
+			a.Complete(tt.msg, tt.err)
+
+			if !reflect.DeepEqual(queue.calls, tt.want) {
+				t.Errorf("Acknowledger.Complete() calls = %v, want %v", queue.calls, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcess_complete(t *testing.T) {
+	var completed []error
+	p := Process{}
+	p.SetCompleter(CompleterFunc(func(msg message.Message, err error) {
+		completed = append(completed, err)
+	}))
+
+	permanent := Permanent(errors.New("not a theme or plugin"))
+	retryable := errors.New("timed out")
+
+	// A single job completes straight away.
+	p.complete(message.Message{}, &Result{}, nil)
+	if len(completed) != 1 || completed[0] != nil {
+		t.Errorf("Process.complete() completed %v, want one success", completed)
+	}
+
+	// Jobs of a group complete once all of them ended, with the most retryable error.
+	result := &Result{
+		"jobGroup": &jobGroup{remaining: 3},
+	}
+	p.complete(message.Message{}, result, permanent)
+	p.complete(message.Message{}, result, retryable)
+	if len(completed) != 1 {
+		t.Errorf("Process.complete() completed a group too early")
+	}
+	p.complete(message.Message{}, result, nil)
+	if len(completed) != 2 || completed[1] != retryable {
+		t.Errorf("Process.complete() completed %v, want the retryable error", completed)
+	}
+
+	// Only the projects that failed with a retryable error are tried again.
+	ref := "ref-1"
+	group := &jobGroup{
+		msg:       message.Message{Title: "Bundle", ExternalRef: &ref},
+		jobs:      3,
+		remaining: 3,
+	}
+	for project, err := range map[string]error{"plugin-one": nil, "plugin-two": retryable, "theme-one": permanent} {
+		p.complete(message.Message{}, &Result{"jobGroup": group, "project": project}, err)
+	}
+	if len(completed) != 3 {
+		t.Errorf("Process.complete() completed %v, want a retry of the failed projects", completed)
+		return
+	}
+	retry, ok := completed[2].(*RetryError)
+	if !ok {
+		t.Errorf("Process.complete() error = %v, want a retry of the failed projects", completed[2])
+		return
+	}
+	if want := []string{"plugin-two"}; !reflect.DeepEqual(retry.Message.Projects, want) || retry.Message.ExternalRef != nil {
+		t.Errorf("Process.complete() retry = %v, want a new message for %v", retry.Message, want)
+	}
+	if IsPermanent(retry) {
+		t.Errorf("Process.complete() retry is permanent, want retryable")
+	}
+
+	// Every project failed, the message itself is tried again.
+	group = &jobGroup{
+		jobs:      2,
+		remaining: 2,
+	}
+	p.complete(message.Message{}, &Result{"jobGroup": group, "project": "plugin-one"}, retryable)
+	p.complete(message.Message{}, &Result{"jobGroup": group, "project": "plugin-two"}, retryable)
+	if len(completed) != 4 || completed[3] != retryable {
+		t.Errorf("Process.complete() completed %v, want the retryable error", completed)
+	}
+}
@@ -0,0 +1,131 @@
+package process
+
+import (
+	"errors"
+
+	"github.com/wptide/pkg/message"
+)
+
+// PipelineError is the error type for jobs that failed in a pipeline.
+// It tells which message failed, where and if it is worth trying the message again.
+type PipelineError struct {
+	ExternalRef *string // External reference of the message, e.g. to delete it from the queue.
+	Title       string  // Title of the message.
+	Stage       string  // Name of the stage that failed, e.g. "PHPCS".
+	Audit       string  // (Optional) Type of the audit that failed, e.g. "phpcs".
+	Cause       error   // The error of the stage.
+	Type        int     // ErrRetryable or ErrPermanent.
+}
+
+/*
+ * Constants to represent pipeline error types.
+ *
+ * ErrRetryable is an error that might not happen again, e.g. a timeout or a failed upload.
+ * ErrPermanent is an error that happens every time the message is processed, e.g. an invalid message.
+ */
+const (
+	ErrRetryable = iota
+	ErrPermanent
+)
+
+func (e PipelineError) Error() string {
+	return e.Stage + " Error: " + e.Cause.Error()
+}
+
+// Unwrap returns the error of the stage.
+func (e PipelineError) Unwrap() error {
+	return e.Cause
+}
+
+// Retryable returns true if the message could succeed if it is processed again.
+func (e PipelineError) Retryable() bool {
+	return e.Type == ErrRetryable
+}
+
+// NewPipelineError creates a new error for a message that failed in a stage.
+// Errors are retryable, unless they are marked with Permanent.
+func NewPipelineError(stage string, msg message.Message, err error) *PipelineError {
+	pErr := &PipelineError{
+		ExternalRef: msg.ExternalRef,
+		Title:       msg.Title,
+		Stage:       stage,
+		Cause:       err,
+	}
+
+	// Keep the details of errors that already went through a stage, e.g. in an adapter.
+	var prev *PipelineError
+	if errors.As(err, &prev) {
+		pErr.Audit = prev.Audit
+		pErr.Cause = prev.Cause
+		pErr.Type = prev.Type
+		return pErr
+	}
+
+	var audit auditError
+	if errors.As(err, &audit) {
+		pErr.Audit = audit.audit
+	}
+
+	if IsPermanent(err) {
+		pErr.Type = ErrPermanent
+	}
+
+	return pErr
+}
+
+// permanentError is an error that happens every time a message is processed.
+type permanentError struct {
+	error
+}
+
+func (e permanentError) Unwrap() error {
+	return e.error
+}
+
+// Permanent marks an error as permanent, so that the message is not processed again.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// IsPermanent returns true if the error was marked with Permanent.
+func IsPermanent(err error) bool {
+	var pErr *PipelineError
+	if errors.As(err, &pErr) {
+		return !pErr.Retryable()
+	}
+
+	var permanent permanentError
+	return errors.As(err, &permanent)
+}
+
+// RetryError is a retryable error of a message of which only some jobs have to be tried again,
+// e.g. the projects of a bundle that failed. The other jobs already made it through the pipe.
+type RetryError struct {
+	error
+	Message message.Message // New message for the jobs to try again.
+}
+
+func (e RetryError) Unwrap() error {
+	return e.error
+}
+
+// auditError is an error of a single audit of a job.
+type auditError struct {
+	error
+	audit string
+}
+
+func (e auditError) Unwrap() error {
+	return e.error
+}
+
+// withAudit adds the type of the audit to an error.
+func withAudit(audit string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return auditError{err, audit}
+}
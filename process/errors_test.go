@@ -0,0 +1,95 @@
+package process
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/wptide/pkg/message"
+)
+
+func TestNewPipelineError(t *testing.T) {
+	ref := "ref-1"
+	msg := message.Message{
+		Title:       "Test",
+		ExternalRef: &ref,
+	}
+
+	tests := []struct {
+		name          string
+		stage         string
+		err           error
+		wantError     string
+		wantAudit     string
+		wantRetryable bool
+	}{
+		{
+			"Retryable",
+			"Ingest",
+			errors.New("download failed"),
+			"Ingest Error: download failed",
+			"",
+			true,
+		},
+		{
+			"Permanent",
+			"Ingest",
+			Permanent(errors.New("invalid message")),
+			"Ingest Error: invalid message",
+			"",
+			false,
+		},
+		{
+			"Audit",
+			"PHPCS",
+			withAudit("phpcs", Permanent(errors.New("could not determine standard for report"))),
+			"PHPCS Error: could not determine standard for report",
+			"phpcs",
+			false,
+		},
+		{
+			"Previous Stage",
+			"Audit",
+			NewPipelineError("Lighthouse", msg, withAudit("lighthouse", errors.New("timed out"))),
+			"Audit Error: timed out",
+			"lighthouse",
+			true,
+		},
+		{
+			"Combined Permanent",
+			"PHPCS",
+			combineErrors([]error{Permanent(errors.New("one")), Permanent(errors.New("two"))}),
+			"PHPCS Error: one; two",
+			"",
+			false,
+		},
+		{
+			"Combined Retryable",
+			"PHPCS",
+			combineErrors([]error{Permanent(errors.New("one")), errors.New("two")}),
+			"PHPCS Error: one; two",
+			"",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewPipelineError(tt.stage, msg, tt.err)
+
+			if err.Error() != tt.wantError {
+				t.Errorf("NewPipelineError() error = %v, want %v", err.Error(), tt.wantError)
+			}
+			if err.ExternalRef != &ref || err.Title != "Test" || err.Stage != tt.stage {
+				t.Errorf("NewPipelineError() = %+v, want message details", err)
+			}
+			if err.Audit != tt.wantAudit {
+				t.Errorf("NewPipelineError() audit = %v, want %v", err.Audit, tt.wantAudit)
+			}
+			if err.Retryable() != tt.wantRetryable {
+				t.Errorf("NewPipelineError() retryable = %v, want %v", err.Retryable(), tt.wantRetryable)
+			}
+			if IsPermanent(err) == tt.wantRetryable {
+				t.Errorf("IsPermanent() = %v, want %v", IsPermanent(err), !tt.wantRetryable)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package process
+
+import (
+	"errors"
+	"sync"
+)
+
+// Fork defines the structure for a process that sends every job to several branches at the same time.
+// Every branch gets its own copy of the results, a Join merges them again.
+type Fork struct {
+	Process                  // Inherits methods from Process.
+	In      <-chan Processor // Expects a processor channel as input.
+	Outs    []chan Processor // Send a copy of every job to each of these channels.
+}
+
+// fork keeps track of a job that was sent to several branches.
+type fork struct {
+	base     Result // The results before the job was forked.
+	branches int    // Number of branches the job was sent to.
+	mutex    sync.Mutex
+	arrived  int   // Branches that passed the job to the join.
+	dropped  int   // Branches that dropped the job, e.g. because an audit failed.
+	err      error // Error of the first branch that dropped the job.
+	ended    bool  // The job was completed.
+}
+
+// drop records that a branch dropped the job. It returns true if the branch has to complete the job,
+// because every branch dropped it and the join never got it.
+func (f *fork) drop(err error) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.dropped++
+	if f.err == nil {
+		f.err = err
+	}
+
+	if f.ended || f.arrived > 0 || f.dropped < f.branches {
+		return false
+	}
+	f.ended = true
+	return true
+}
+
+// arrive records that a branch passed the job to the join. It returns false if the job already ended.
+func (f *fork) arrive() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.ended {
+		return false
+	}
+	f.arrived++
+	return true
+}
+
+// settle returns true and the error of the dropped branches once every branch passed or dropped the job.
+// The job ends then.
+func (f *fork) settle() (bool, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.arrived+f.dropped < f.branches {
+		return false, nil
+	}
+	f.ended = true
+	return true, f.err
+}
+
+// end ends the job before every branch passed or dropped it. It returns the number of branches that
+// didn't drop the job, they still hold its workspace.
+func (f *fork) end() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.ended = true
+	return f.branches - f.dropped
+}
+
+// Run executes the process in the pipeline.
+func (f *Fork) Run(errc *chan error) error {
+
+	if f.In == nil {
+		return errors.New("requires a previous process")
+	}
+	if len(f.Outs) == 0 {
+		return errors.New("requires at least one branch")
+	}
+
+	f.start()
+	f.health = f.registry.Component("Fork").Worker()
+
+	go func() {
+		defer f.finish()
+		defer f.health.Stop()
+
+		for {
+			// Waiting for the next job is not a stall.
+			f.health.Idle()
+
+			select {
+			case <-f.done():
+				return
+			case in, ok := <-f.In:
+				// The previous process stopped, so do we and the branches.
+				if !ok {
+					for _, out := range f.Outs {
+						close(out)
+					}
+					return
+				}
+				f.health.Busy()
+
+				// Copy Process fields from `in` process.
+				f.CopyFields(in)
+
+				// Send a copy to every branch.
+				procs := f.branches()
+				for i, proc := range procs {
+					if !f.send(f.Outs[i], proc) {
+						// The other branches are dropped too.
+						for _, dropped := range procs[i+1:] {
+							dropped.(*Fork).CloseWorkspace(true)
+						}
+						return
+					}
+				}
+			}
+		}
+
+	}()
+
+	return nil
+}
+
+// Do does nothing, the jobs are copied in Run.
+func (f *Fork) Do() error {
+	return nil
+}
+
+// branches returns a copy of the current job for every branch.
+func (f *Fork) branches() []Processor {
+	result := Result{}
+	if f.Result != nil {
+		result = *f.Result
+	}
+
+	base := Result{}
+	for key, value := range result {
+		base[key] = value
+	}
+	job := &fork{
+		base:     base,
+		branches: len(f.Outs),
+	}
+
+	// Every branch holds the workspace until the join, so a failing branch can't remove it.
+	if ws := f.GetWorkspace(); ws != nil {
+		ws.Share(len(f.Outs) - 1)
+	}
+
+	procs := make([]Processor, len(f.Outs))
+	for i := range f.Outs {
+		branch := Result{}
+		for key, value := range base {
+			branch[key] = value
+		}
+		branch["fork"] = job
+		branch["forkBranch"] = i
+
+		proc := &Fork{}
+		proc.SetContext(f.context)
+		proc.SetMessage(f.Message)
+		proc.SetResults(&branch)
+		proc.SetFilesPath(f.GetFilesPath())
+
+		procs[i] = proc
+	}
+
+	return procs
+}
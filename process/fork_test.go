@@ -0,0 +1,121 @@
+package process
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/wptide/pkg/message"
+	"github.com/wptide/pkg/workspace"
+)
+
+func TestFork_Run(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		in      <-chan Processor
+		outs    []chan Processor
+		wantErr bool
+	}{
+		{
+			"Valid Fork",
+			make(<-chan Processor),
+			[]chan Processor{make(chan Processor)},
+			false,
+		},
+		{
+			"Invalid In channel",
+			nil,
+			[]chan Processor{make(chan Processor)},
+			true,
+		},
+		{
+			"No Branches",
+			make(<-chan Processor),
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &Fork{
+				In:   tt.in,
+				Outs: tt.outs,
+			}
+
+			errc := make(chan error, 1)
+			if err := f.Run(&errc); (err != nil) != tt.wantErr {
+				t.Errorf("Fork.Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFork_branches(t *testing.T) {
+
+	defer os.RemoveAll("./testdata/workspaces")
+
+	ws, _ := workspace.NewManager("./testdata/workspaces", workspace.KeepNone).Create()
+
+	in := make(chan Processor, 1)
+	in <- &Ingest{
+		Process: Process{
+			Message: message.Message{Title: "Test Plugin"},
+			Result: &Result{
+				"checksum":  "abc123",
+				"workspace": ws,
+			},
+		},
+	}
+	close(in)
+
+	f := &Fork{
+		In:   in,
+		Outs: []chan Processor{make(chan Processor, 1), make(chan Processor, 1)},
+	}
+
+	errc := make(chan error, 1)
+	f.Run(&errc)
+
+	var results []*Result
+	for i, out := range f.Outs {
+		select {
+		case proc := <-out:
+			results = append(results, proc.GetResult())
+
+			result := *proc.GetResult()
+			if result["checksum"] != "abc123" || result["forkBranch"] != i {
+				t.Errorf("Fork.Run() branch %d result = %v", i, result)
+			}
+			if proc.GetMessage().Title != "Test Plugin" {
+				t.Errorf("Fork.Run() branch %d message = %v", i, proc.GetMessage())
+			}
+		case <-time.After(time.Second):
+			t.Errorf("Fork.Run() did not send to branch %d", i)
+			return
+		}
+	}
+
+	// Every branch has its own results.
+	(*results[0])["phpcs_wordpress"] = "report"
+	if _, ok := (*results[1])["phpcs_wordpress"]; ok {
+		t.Errorf("Fork.Run() branches share results")
+	}
+	if !reflect.DeepEqual((*results[0])["fork"], (*results[1])["fork"]) {
+		t.Errorf("Fork.Run() branches belong to different jobs")
+	}
+
+	// A failing branch can't remove the workspace of the others.
+	ws.Close(true)
+	if _, err := os.Stat(ws.Path); err != nil {
+		t.Errorf("Fork.Run() did not share the workspace")
+	}
+
+	// The branches stop when the fork stops.
+	for i, out := range f.Outs {
+		if _, ok := <-out; ok {
+			t.Errorf("Fork.Run() did not close branch %d", i)
+		}
+	}
+}
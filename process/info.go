@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/hhatto/gocloc"
+	"github.com/wptide/pkg/health"
 	"github.com/wptide/pkg/log"
 	"github.com/wptide/pkg/message"
 	"github.com/wptide/pkg/tide"
@@ -19,6 +20,7 @@ type Info struct {
 	Process                  // Inherits methods from Process.
 	In      <-chan Processor // Expects a processor channel as input.
 	Out     chan Processor   // Send results to an output channel.
+	Workers int              // (Optional) Number of jobs processed at the same time. Defaults to 1.
 }
 
 // Run executes the process in the pipeline.
@@ -31,32 +33,66 @@ func (info *Info) Run(errc *chan error) error {
 		return errors.New("requires a next process")
 	}
 
-	go func() {
+	info.start()
 
-		for {
-			select {
-			case in := <-info.In:
+	// Every worker works on its own copy of the process.
+	info.spawn("Info", info.Workers, closer(info.Out), func(w *health.Worker) bool {
+		worker := *info
+		worker.health = w
+		return worker.work(errc)
+	})
 
-				// Copy Process fields from `in` process.
-				info.CopyFields(in)
+	return nil
+}
 
-				// Run the process.
-				// If processing produces an error send it up the error channel.
-				if err := info.Do(); err != nil {
-					// Pass the error up the error channel.
-					*errc <- errors.New("Info Error: " + err.Error())
-					// continue so that the message doesn't get passed along.
-					continue
-				}
+// work takes jobs until the previous process stops or the context is cancelled.
+// It returns true if the previous process stopped.
+func (info *Info) work(errc *chan error) bool {
+	for {
+		// Waiting for the next job is not a stall.
+		info.health.Idle()
+
+		select {
+		case <-info.done():
+			return false
+		case in, ok := <-info.In:
+			// The previous process stopped.
+			if !ok {
+				return true
+			}
+			info.health.Busy()
+
+			// Copy Process fields from `in` process.
+			info.CopyFields(in)
+
+			// Run the process.
+			// If processing produces an error send it up the error channel.
+			end := track("Info")
+			_, endSpan := info.startSpan("info")
+			err := info.Do()
+			endSpan(err)
+			end(err)
+
+			if err != nil {
+				// The job ends here, clean up after it.
+				info.CloseWorkspace(true)
+
+				pErr := NewPipelineError("Info", info.Message, err)
+				info.complete(info.Message, info.Result, pErr)
+
+				// Pass the error up the error channel.
+				*errc <- pErr
+				// continue so that the message doesn't get passed along.
+				continue
+			}
 
-				// Send process to the out channel.
-				info.Out <- info
+			// Send a copy of the job to the out channel, so that the worker can take the next job.
+			job := *info
+			if !info.send(info.Out, &job) {
+				return false
 			}
 		}
-
-	}()
-
-	return nil
+	}
 }
 
 // Do runs the actual code for this process.
@@ -75,7 +111,7 @@ func (info *Info) Do() error {
 		return errors.New("could not determine files path")
 	}
 
-	path := info.GetFilesPath() + "/unzipped"
+	path := info.GetCodePath()
 
 	cloc, err := getCloc(path)
 	if err != nil {
@@ -1,23 +1,50 @@
 package process
 
 import (
-	"crypto/sha256"
-	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
 
+	"github.com/wptide/pkg/cache"
+	"github.com/wptide/pkg/health"
 	"github.com/wptide/pkg/log"
 	"github.com/wptide/pkg/message"
 	"github.com/wptide/pkg/source"
-	"github.com/wptide/pkg/source/zip"
+	"github.com/wptide/pkg/source/download"
+	"github.com/wptide/pkg/storage"
+	"github.com/wptide/pkg/tide"
+	"github.com/wptide/pkg/workspace"
+
+	// Register the default sources. Local sources are opt-in, see local.Register.
+	_ "github.com/wptide/pkg/source/git"
+	_ "github.com/wptide/pkg/source/tar"
+	_ "github.com/wptide/pkg/source/zip"
 )
 
+// Using source.DetectWithClient as a variable so that we can mock it in tests.
+var detectSource = source.DetectWithClient
+
 // Ingest defines the structure for our Ingest process.
 type Ingest struct {
-	Process                              // Inherits methods from Process.
-	In            <-chan message.Message // Expects a message channel as input.
-	Out           chan Processor         // Send results to an output channel.
-	TempFolder    string                 // Path to a temp folder where files will be extracted.
-	sourceManager source.Source          // Responsible for getting the code to audit.
+	Process                                // Inherits methods from Process.
+	In              <-chan message.Message // Expects a message channel as input.
+	Out             chan Processor         // Send results to an output channel.
+	TempFolder      string                 // Path to a temp folder where files will be extracted.
+	ExtractPolicy   *source.ExtractPolicy  // (Optional) Limits for extracting archives.
+	Downloader      *download.Client       // (Optional) Client used to download sources.
+	CacheSize       int64                  // (Optional) Size in bytes of the download cache in the temp folder. 0 disables the cache.
+	StorageProvider storage.Provider       // (Optional) Storage provider to upload the file manifest to.
+	ResultCache     cache.Provider         // (Optional) Replays the results of checksums that were already audited.
+	Pipeline        cache.Pipeline         // (Optional) How the pipeline runs the audits, only results of the same configuration are replayed.
+	Workspaces      *workspace.Manager     // (Optional) Creates a workspace for every job. Defaults to removing every workspace in TempFolder.
+	Registry        *Registry              // (Optional) Audit types that messages can ask for. Defaults to DefaultRegistry.
+	cache           *download.Cache        // Download cache shared by all messages.
+	Workers         int                    // (Optional) Number of messages processed at the same time. Defaults to 1.
+	stop            chan struct{}          // Closed to stop taking new messages.
 }
 
 // Run executes the process in the pipeline.
@@ -33,44 +60,122 @@ func (ig *Ingest) Run(errc *chan error) error {
 		return errors.New("requires a next process")
 	}
 
-	go func() {
-		for {
-			select {
-			case msg := <-ig.In:
+	ig.stop = make(chan struct{})
+	ig.start()
 
-				// Init the Result object.
-				ig.Result = &Result{}
+	// The workers share the download cache and the workspaces.
+	if ig.CacheSize > 0 && ig.cache == nil {
+		ig.cache = download.NewCache(ig.TempFolder+"/download-cache", ig.CacheSize)
+	}
+	if ig.Workspaces == nil {
+		ig.Workspaces = workspace.NewManager(ig.TempFolder, workspace.KeepNone)
+	}
 
-				// If message is invalid, skip it, but keep listening on the channel.
-				if err := validateMessage(msg); err != nil {
-					// Pass the error up the error channel.
-					*errc <- errors.New("Ingest Error: " + err.Error())
+	// Every worker works on its own copy of the process.
+	ig.spawn("Ingest", ig.Workers, closer(ig.Out), func(w *health.Worker) bool {
+		worker := *ig
+		worker.health = w
+		return worker.work(errc)
+	})
 
-					// continue so that the message doesn't get passed along.
-					continue
-				}
+	return nil
+}
 
-				// Get the original message.
-				ig.SetMessage(msg)
+// work takes messages until there are no more messages, it is told to stop or the context is cancelled.
+// It returns false if the context was cancelled.
+func (ig *Ingest) work(errc *chan error) bool {
+	for {
+		// Waiting for the next job is not a stall.
+		ig.health.Idle()
 
-				// Run the process.
-				// If processing produces an error send it up the error channel.
-				if err := ig.Do(); err != nil {
-					// Pass the error up the error channel.
-					*errc <- errors.New("Ingest Error: " + err.Error())
+		// Don't take a new message once we are told to stop.
+		select {
+		case <-ig.stop:
+			return true
+		default:
+		}
 
-					// continue so that the message doesn't get passed along.
-					continue
-				}
+		select {
+		case <-ig.stop:
+			return true
+		case <-ig.done():
+			return false
+		case msg, ok := <-ig.In:
+			// No more messages.
+			if !ok {
+				return true
+			}
+			ig.health.Busy()
+
+			// Init the Result object, the trace of the message starts here.
+			ig.Result = &Result{
+				"traceSpan": startTrace(&msg),
+			}
+
+			// If message is invalid, skip it, but keep listening on the channel.
+			if err := ig.validateMessage(msg); err != nil {
+				pErr := NewPipelineError("Ingest", msg, Permanent(err))
+				ig.complete(msg, ig.Result, pErr)
+
+				// Pass the error up the error channel.
+				*errc <- pErr
+
+				// continue so that the message doesn't get passed along.
+				continue
+			}
+
+			// Get the original message.
+			ig.SetMessage(msg)
+
+			// Run the process.
+			// If processing produces an error send it up the error channel.
+			end := track("Ingest")
+			_, endSpan := ig.startSpan("ingest")
+			err := ig.Do()
+			endSpan(err)
+			end(err)
+
+			if err != nil {
+				// The job ends here, clean up after it.
+				ig.CloseWorkspace(true)
 
-				// Send process to the out channel.
-				ig.Out <- ig
+				pErr := NewPipelineError("Ingest", ig.Message, err)
+				ig.complete(ig.Message, ig.Result, pErr)
+
+				// Pass the error up the error channel.
+				*errc <- pErr
+
+				// continue so that the message doesn't get passed along.
+				continue
+			}
+
+			// Send a process for every project to the out channel.
+			procs := ig.projectProcesses()
+			for i, proc := range procs {
+				if !ig.send(ig.Out, proc) {
+					// The other projects are dropped too.
+					for _, dropped := range procs[i+1:] {
+						dropped.(*Ingest).CloseWorkspace(true)
+						ig.complete(dropped.GetMessage(), dropped.GetResult(), errors.New("job cancelled"))
+					}
+					return false
+				}
 			}
 		}
+	}
+}
 
-	}()
+// Stop stops taking new messages. The messages that were already taken are still processed.
+func (ig *Ingest) Stop() {
+	if ig.stop == nil {
+		return
+	}
 
-	return nil
+	select {
+	case <-ig.stop:
+	default:
+		close(ig.stop)
+	}
 }
 
 // Do runs the actual code for this process.
@@ -78,32 +183,59 @@ func (ig *Ingest) Do() error {
 
 	log.Log(ig.Message.Title, "Ingesting...")
 
-	// Set the source manager based on message.
-	switch source.GetKind(ig.Message.SourceURL) {
-	case "zip":
-		ig.sourceManager = zip.NewZip(ig.Message.SourceURL)
+	// Every job gets its own workspace, so that jobs for the same source don't overwrite each other.
+	if ig.Workspaces == nil {
+		ig.Workspaces = workspace.NewManager(ig.TempFolder, workspace.KeepNone)
+	}
+
+	ws, err := ig.Workspaces.Create()
+	if err != nil {
+		return err
 	}
+	(*ig.Result)["workspace"] = ws
+
+	// Set the path to where we will extract the files.
+	ig.SetFilesPath(ws.Path)
 
-	// Return an error if we don't have a source manager.
-	if ig.sourceManager == nil {
-		return ig.Error("could not get appropriate source manager to handle ingest")
+	// Get the source manager for this message. Sources that download files get the configured client,
+	// which also sniffs the content if the source can't be told from the url.
+	sourceManager, err := detectSource(ig.Message.SourceURL, ig.Message.SourceType, ig.downloadClient())
+	if err != nil {
+		// No source handles the url, trying again won't change that.
+		if _, ok := err.(*source.UnknownError); ok {
+			return Permanent(ig.Error("could not get appropriate source manager to handle ingest: " + err.Error()))
+		}
+		if downloadErr, ok := err.(*download.Error); ok && permanentDownload(downloadErr) {
+			return Permanent(ig.Error("rejected source: " + err.Error()))
+		}
+		return ig.Error("could not detect source: " + err.Error())
 	}
 
-	// Calculate hash of the source url.
-	hasher := sha256.New()
-	hasher.Write([]byte(ig.Message.SourceURL))
+	// Use the configured limits for sources that extract archives.
+	if extractor, ok := sourceManager.(source.Extractor); ok && ig.ExtractPolicy != nil {
+		extractor.SetExtractPolicy(*ig.ExtractPolicy)
+	}
 
-	// Set the path to where we will extract the files.
-	ig.SetFilesPath(ig.TempFolder + "/audit-" + base64.URLEncoding.EncodeToString(hasher.Sum(nil)))
+	// Trace the download and extraction of the source.
+	if tracer, ok := sourceManager.(source.Tracer); ok {
+		tracer.SetTraceContext(ig.traceContext())
+	}
 
 	// Download/Prepare the files.
-	err := ig.sourceManager.PrepareFiles(ig.GetFilesPath())
+	err = sourceManager.PrepareFiles(ig.GetFilesPath())
 	if err != nil {
+		// Archives that violate the extract policy are rejected, not retried.
+		if _, ok := err.(*source.ExtractError); ok {
+			return Permanent(ig.Error("rejected source: " + err.Error()))
+		}
+		if downloadErr, ok := err.(*download.Error); ok && permanentDownload(downloadErr) {
+			return Permanent(ig.Error("rejected source: " + err.Error()))
+		}
 		return err
 	}
 
 	// Project checksum.
-	checksum := ig.sourceManager.GetChecksum()
+	checksum := sourceManager.GetChecksum()
 	if checksum == "" {
 		return ig.Error("could not calculate project checksum")
 	}
@@ -111,12 +243,224 @@ func (ig *Ingest) Do() error {
 	// Populate the result.
 	result := *ig.Result
 	result["checksum"] = checksum
-	result["files"] = ig.sourceManager.GetFiles()
+	result["files"] = sourceManager.GetFiles()
 	result["filesPath"] = ig.GetFilesPath()
+	result["manifest"] = sourceManager.GetManifest()
 	ig.Result = &result
 
+	// Upload the manifest next to the reports.
+	if ig.StorageProvider != nil {
+		span, endSpan := ig.startSpan("upload")
+		span.SetAttribute("provider", ig.StorageProvider.Kind())
+		details, err := ig.uploadManifest(checksum, sourceManager.GetManifest())
+		endSpan(err)
+		if err != nil {
+			return err
+		}
+		result["manifestFile"] = details
+	}
+
 	log.Log(ig.Message.Title, "Project checksum: `"+checksum+"`")
 
+	// Archives can contain several plugins and themes, each of them gets audited on its own.
+	codePath := ig.GetFilesPath() + "/unzipped"
+	roots := findProjects(codePath)
+	if len(ig.Message.Projects) > 0 {
+		// Retries of a bundle only audit the projects that failed.
+		if roots = selectProjects(roots, ig.Message.Projects); len(roots) == 0 {
+			return Permanent(ig.Error("none of the projects to audit were found"))
+		}
+	}
+	if len(roots) > 1 || len(ig.Message.Projects) > 0 {
+		projects := make([]Project, len(roots))
+		for i, root := range roots {
+			projects[i] = newProject(root, codePath, sourceManager.GetFiles(), sourceManager.GetManifest())
+		}
+		result["projects"] = projects
+
+		log.Log(ig.Message.Title, "Found "+strconv.Itoa(len(projects))+" projects.")
+		return nil
+	}
+
+	ig.replayCached(result)
+
+	return nil
+}
+
+// downloadClient returns the client that downloads the source of the message, with its checksum and the download cache.
+func (ig *Ingest) downloadClient() *download.Client {
+	client := ig.Downloader
+	if client == nil {
+		client = download.New()
+	}
+	if ig.Message.SourceChecksum != "" {
+		client = client.WithChecksum(ig.Message.SourceChecksum)
+	}
+	if ig.CacheSize > 0 && client.Cache == nil {
+		if ig.cache == nil {
+			ig.cache = download.NewCache(ig.TempFolder+"/download-cache", ig.CacheSize)
+		}
+		client = client.WithCache(ig.cache)
+	}
+	return client
+}
+
+// permanentDownload returns true for downloads that will never succeed: sources that don't match the
+// expected checksum, are too large, or that the server refuses, e.g. with 404 Not Found.
+// Request timeouts and rate limits are worth trying again.
+func permanentDownload(err *download.Error) bool {
+	switch err.Type {
+	case download.ErrChecksum, download.ErrTooLarge:
+		return true
+	case download.ErrStatus:
+		if err.StatusCode == http.StatusRequestTimeout || err.StatusCode == http.StatusTooManyRequests {
+			return false
+		}
+		return err.StatusCode >= 400 && err.StatusCode < 500
+	}
+	return false
+}
+
+// replayCached adds the cached audit results to the result if this code was already audited with the
+// same configuration. The payload is still built for the current message.
+func (ig *Ingest) replayCached(result Result) {
+	if ig.ResultCache == nil || ig.Message.Force {
+		return
+	}
+
+	checksum, _ := result["checksum"].(string)
+
+	data, found, err := ig.ResultCache.GetResults(checksum, cache.ConfigKey(ig.Message, ig.Pipeline))
+	if err != nil {
+		log.Log(ig.Message.Title, "Could not read result cache: "+err.Error())
+		return
+	}
+	if !found {
+		return
+	}
+
+	cached, err := cache.DecodeResults(data)
+	if err != nil {
+		log.Log(ig.Message.Title, "Could not read cached results: "+err.Error())
+		return
+	}
+
+	replayed := Result{}
+	for key, audit := range cached.Audits {
+		replayed[key] = audit
+	}
+
+	// Entries without every requested audit can't replace the audits, e.g. entries of an older format.
+	if !completeResults(ig.Message.Audits, replayed) {
+		return
+	}
+
+	log.Log(ig.Message.Title, "Replaying cached results for `"+checksum+"`, skipping audits.")
+	for key, value := range replayed {
+		result[key] = value
+	}
+	if cached.Info != nil {
+		result["info"] = *cached.Info
+	}
+	result["cachedResults"] = true
+}
+
+// projectProcesses returns a process for every project found in the source,
+// or only the ingest process itself if the source is a single project.
+func (ig *Ingest) projectProcesses() []Processor {
+	projects, ok := (*ig.Result)["projects"].([]Project)
+	if !ok {
+		// A copy of the job, so that the worker can take the next message.
+		job := *ig
+		return []Processor{&job}
+	}
+
+	// The projects share the workspace, it is removed once all of them are done.
+	if ws := ig.GetWorkspace(); ws != nil {
+		ws.Share(len(projects) - 1)
+	}
+
+	// The message is complete once all of its projects are done.
+	group := &jobGroup{
+		msg:       ig.Message,
+		jobs:      len(projects),
+		remaining: len(projects),
+	}
+
+	procs := make([]Processor, len(projects))
+	for i, project := range projects {
+		result := Result{}
+		for key, value := range *ig.Result {
+			if key != "projects" {
+				result[key] = value
+			}
+		}
+
+		result["checksum"] = project.Checksum
+		result["files"] = project.Files
+		result["manifest"] = project.Manifest
+		result["project"] = project.Root
+		result["codePath"] = filepath.Join(ig.GetFilesPath(), "unzipped", project.Root)
+		result["jobGroup"] = group
+
+		ig.replayCached(result)
+
+		// The slug of the bundle does not belong to any of its projects.
+		msg := ig.Message
+		msg.Slug = path.Base(project.Root)
+
+		proc := &Ingest{}
+		proc.SetContext(ig.context)
+		proc.SetMessage(msg)
+		proc.SetResults(&result)
+		proc.SetFilesPath(ig.GetFilesPath())
+
+		procs[i] = proc
+	}
+
+	return procs
+}
+
+// uploadManifest writes the manifest to the temp folder and uploads it to storage.
+func (ig *Ingest) uploadManifest(checksum string, manifest source.Manifest) (tide.AuditDetails, error) {
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return tide.AuditDetails{}, err
+	}
+
+	filename := checksum + "-manifest.json"
+	filepath := ig.GetFilesPath() + "/" + filename
+
+	if err := writeFile(filepath, manifestJSON, os.ModePerm); err != nil {
+		return tide.AuditDetails{}, err
+	}
+
+	if err := ig.StorageProvider.UploadFile(filepath, filename); err != nil {
+		return tide.AuditDetails{}, err
+	}
+
+	return tide.AuditDetails{
+		Type:     ig.StorageProvider.Kind(),
+		FileName: filename,
+		Path:     ig.StorageProvider.CollectionRef(),
+	}, nil
+}
+
+// validateMessage ensures that a message has the minimum requirements and only asks for known audits.
+func (ig Ingest) validateMessage(msg message.Message) error {
+	if err := validateMessage(msg); err != nil {
+		return err
+	}
+
+	registry := ig.Registry
+	if registry == nil {
+		registry = DefaultRegistry
+	}
+
+	if err := registry.Validate(msg.Audits); err != nil {
+		return errors.New(msg.Title + ": " + err.Error())
+	}
+
 	return nil
 }
 
@@ -133,15 +477,11 @@ func validateMessage(msg message.Message) error {
 		return errors.New(msg.Title + ": does not provide an endpoint")
 	}
 
-	// A message must have a source url to process.
+	// A message must have a source url to process. Without a source type, the source is detected
+	// from the url and its content.
 	if msg.SourceURL == "" {
 		return errors.New(msg.Title + ": source url is empty")
 	}
 
-	// A message must provide the type of source to process.
-	if msg.SourceType == "" {
-		return errors.New(msg.Title + ": source type is empty (e.g. zip, git)")
-	}
-
 	return nil
 }
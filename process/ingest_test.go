@@ -11,9 +11,14 @@ import (
 	"context"
 	"time"
 
+	"github.com/wptide/pkg/cache"
 	"github.com/wptide/pkg/log"
 	"github.com/wptide/pkg/message"
 	"github.com/wptide/pkg/source"
+	"github.com/wptide/pkg/source/download"
+	"github.com/wptide/pkg/source/local"
+	"github.com/wptide/pkg/storage"
+	"github.com/wptide/pkg/tide"
 )
 
 type mockSource struct{}
@@ -21,6 +26,7 @@ type mockSource struct{}
 func (m mockSource) PrepareFiles(dest string) error { return nil }
 func (m mockSource) GetChecksum() string            { return "" }
 func (m mockSource) GetFiles() []string             { return nil }
+func (m mockSource) GetManifest() source.Manifest   { return nil }
 
 type mockProcess struct {
 	Process
@@ -31,12 +37,21 @@ type mockProcess struct {
 func (m *mockProcess) Run() (<-chan error, error)     { return nil, nil }
 func (m *mockProcess) SetContext(ctx context.Context) {}
 
+func init() {
+	// Local sources are opt-in, the tests audit folders in testdata.
+	local.Register("./testdata")
+}
+
 var ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 	switch r.URL.String() {
 	case "/test.zip":
 		http.ServeFile(w, r, "./testdata/test.zip")
 		return
+	case "/download/123":
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeFile(w, r, "./testdata/test.zip")
+		return
 	case "/api/audits":
 		http.ServeFile(w, r, `{ "message": "Payload received" }`)
 		return
@@ -107,12 +122,42 @@ func Test_validateMessage(t *testing.T) {
 					SourceURL:           "http://test.local/source.zip",
 				},
 			},
+			false,
+		},
+		{
+			"Unknown Audit",
+			args{
+				message.Message{
+					Title:               "Valid Title",
+					ResponseAPIEndpoint: "http://test.local",
+					SourceURL:           "http://test.local/source.zip",
+					SourceType:          "zip",
+					Audits: []*message.Audit{
+						{Type: "unknown"},
+					},
+				},
+			},
+			true,
+		},
+		{
+			"Missing Audit Standard",
+			args{
+				message.Message{
+					Title:               "Valid Title",
+					ResponseAPIEndpoint: "http://test.local",
+					SourceURL:           "http://test.local/source.zip",
+					SourceType:          "zip",
+					Audits: []*message.Audit{
+						{Type: "phpcs", Options: &message.AuditOption{}},
+					},
+				},
+			},
 			true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := validateMessage(tt.args.msg); (err != nil) != tt.wantErr {
+			if err := (Ingest{}).validateMessage(tt.args.msg); (err != nil) != tt.wantErr {
 				t.Errorf("validateMessage() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -127,15 +172,20 @@ func TestIngest_process(t *testing.T) {
 
 	// Make a /tmp folder
 	os.Mkdir("./testdata/tmp", os.ModePerm)
+	os.MkdirAll("./testdata/upload", os.ModePerm)
 
 	// Clean up after.
 	defer func() {
 		os.RemoveAll("./testdata/tmp")
+		os.RemoveAll("./testdata/upload")
 	}()
 
 	type options struct {
-		tempFolder string
-		sourceMgr  source.Source
+		tempFolder    string
+		sourceMgr     source.Source
+		extractPolicy *source.ExtractPolicy
+		cacheSize     int64
+		storage       storage.Provider
 	}
 
 	tests := []struct {
@@ -155,6 +205,70 @@ func TestIngest_process(t *testing.T) {
 			options{},
 			false,
 		},
+		{
+			"Valid Ingest - Download Endpoint",
+			message.Message{
+				Title:               "Test Ingest",
+				ResponseAPIEndpoint: ts.URL + "/api/audits",
+				SourceURL:           ts.URL + "/download/123",
+				SourceType:          "archive",
+			},
+			options{},
+			false,
+		},
+		{
+			"Valid Ingest - Download Cache",
+			message.Message{
+				Title:               "Test Ingest",
+				ResponseAPIEndpoint: ts.URL + "/api/audits",
+				SourceURL:           ts.URL + "/test.zip",
+				SourceType:          "zip",
+			},
+			options{
+				cacheSize: 1 << 20,
+			},
+			false,
+		},
+		{
+			"Valid Ingest - Upload Manifest",
+			message.Message{
+				Title:               "Test Ingest",
+				ResponseAPIEndpoint: ts.URL + "/api/audits",
+				SourceURL:           ts.URL + "/test.zip",
+				SourceType:          "zip",
+			},
+			options{
+				storage: &mockStorage{},
+			},
+			false,
+		},
+		{
+			"Source Checksum Mismatch",
+			message.Message{
+				Title:               "Test Ingest",
+				ResponseAPIEndpoint: ts.URL + "/api/audits",
+				SourceURL:           ts.URL + "/test.zip",
+				SourceType:          "zip",
+				SourceChecksum:      "0000000000000000000000000000000000000000000000000000000000000000",
+			},
+			options{},
+			true,
+		},
+		{
+			"Rejected By Extract Policy",
+			message.Message{
+				Title:               "Test Ingest",
+				ResponseAPIEndpoint: ts.URL + "/api/audits",
+				SourceURL:           ts.URL + "/test.zip",
+				SourceType:          "zip",
+			},
+			options{
+				extractPolicy: &source.ExtractPolicy{
+					MaxFiles: 1,
+				},
+			},
+			true,
+		},
 		{
 			"No valid source manager",
 			message.Message{
@@ -166,6 +280,39 @@ func TestIngest_process(t *testing.T) {
 			options{},
 			true,
 		},
+		{
+			"Valid Local Ingest",
+			message.Message{
+				Title:               "Test Local Ingest",
+				ResponseAPIEndpoint: ts.URL + "/api/audits",
+				SourceURL:           "file://./testdata/info/theme/unzipped",
+				SourceType:          "local",
+			},
+			options{},
+			false,
+		},
+		{
+			"Tarball source not valid",
+			message.Message{
+				Title:               "Invalid Tarball Source",
+				ResponseAPIEndpoint: ts.URL + "/api/audits",
+				SourceURL:           ts.URL + "/notfound.tar.gz",
+				SourceType:          "tar",
+			},
+			options{},
+			true,
+		},
+		{
+			"Git source not valid",
+			message.Message{
+				Title:               "Invalid Git Source",
+				ResponseAPIEndpoint: ts.URL + "/api/audits",
+				SourceURL:           "./testdata/notfound#master",
+				SourceType:          "git",
+			},
+			options{},
+			true,
+		},
 		{
 			"Source not valid",
 			message.Message{
@@ -203,17 +350,371 @@ func TestIngest_process(t *testing.T) {
 			}
 
 			if tt.options.sourceMgr != nil {
-				ig.sourceManager = tt.options.sourceMgr
+				detectSource = func(sourceURL, sourceType string, client *download.Client) (source.Source, error) {
+					return tt.options.sourceMgr, nil
+				}
+				defer func() {
+					detectSource = source.DetectWithClient
+				}()
 			}
 
+			ig.ExtractPolicy = tt.options.extractPolicy
+			ig.CacheSize = tt.options.cacheSize
+			ig.StorageProvider = tt.options.storage
+
 			ig.Message = tt.message
 			if err := ig.Do(); (err != nil) != tt.wantErr {
 				t.Errorf("Ingest.Do() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr || tt.options.sourceMgr != nil {
+				return
+			}
+
+			result := *ig.Result
+			if manifest, ok := result["manifest"].(source.Manifest); !ok || len(manifest) == 0 {
+				t.Errorf("Ingest.Do() manifest = %v, want files", result["manifest"])
+			}
+			if _, ok := result["manifestFile"]; ok != (tt.options.storage != nil) {
+				t.Errorf("Ingest.Do() manifestFile = %v, want upload %v", result["manifestFile"], tt.options.storage != nil)
 			}
 		})
 	}
 }
 
+func TestIngest_ResultCache(t *testing.T) {
+
+	b := bytes.Buffer{}
+	log.SetOutput(&b)
+	defer log.SetOutput(os.Stdout)
+
+	// Make a /tmp folder
+	os.Mkdir("./testdata/tmp", os.ModePerm)
+
+	// Clean up after.
+	defer func() {
+		os.RemoveAll("./testdata/tmp")
+	}()
+
+	msg := message.Message{
+		Title:               "Test Ingest",
+		ResponseAPIEndpoint: ts.URL + "/api/audits",
+		SourceURL:           ts.URL + "/test.zip",
+		SourceType:          "zip",
+		Audits: []*message.Audit{
+			{
+				Type: "phpcs",
+				Options: &message.AuditOption{
+					Standard: "wordpress",
+				},
+			},
+		},
+	}
+
+	complete, _ := cache.EncodeResults(cache.Results{
+		Audits: map[string]tide.AuditResult{
+			"phpcs_wordpress": {},
+		},
+	})
+
+	pipeline := cache.Pipeline{
+		Tools: map[string]string{"phpcs": "3.3.0"},
+	}
+
+	tests := []struct {
+		name       string
+		force      bool
+		cached     []byte
+		storedWith cache.Pipeline
+		wantCached bool
+	}{
+		{
+			"Not Audited",
+			false,
+			nil,
+			pipeline,
+			false,
+		},
+		{
+			"Already Audited",
+			false,
+			complete,
+			pipeline,
+			true,
+		},
+		{
+			"Already Audited - Force",
+			true,
+			complete,
+			pipeline,
+			false,
+		},
+		{
+			"Already Audited - Other Tool Versions",
+			false,
+			complete,
+			cache.Pipeline{
+				Tools: map[string]string{"phpcs": "3.2.0"},
+			},
+			false,
+		},
+		{
+			"Incomplete Results",
+			false,
+			[]byte(`{ "audits": {} }`),
+			pipeline,
+			false,
+		},
+		{
+			"Invalid Results",
+			false,
+			[]byte(`{ "cached":"payload" `),
+			pipeline,
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resultCache := &mockResultCache{
+				results: make(map[string][]byte),
+			}
+
+			ig := &Ingest{
+				TempFolder:  "./testdata/tmp",
+				ResultCache: resultCache,
+				Pipeline:    pipeline,
+			}
+			ig.Result = &Result{}
+			ig.Message = msg
+			ig.Message.Force = tt.force
+
+			if tt.cached != nil {
+				// The checksum of the test project is always the same.
+				first := &Ingest{TempFolder: "./testdata/tmp"}
+				first.Result = &Result{}
+				first.Message = msg
+				if err := first.Do(); err != nil {
+					t.Errorf("Ingest.Do() error = %v", err)
+					return
+				}
+				resultCache.SetResults((*first.Result)["checksum"].(string), cache.ConfigKey(msg, tt.storedWith), tt.cached)
+			}
+
+			if err := ig.Do(); err != nil {
+				t.Errorf("Ingest.Do() error = %v", err)
+				return
+			}
+
+			if got := ig.Cached(); got != tt.wantCached {
+				t.Errorf("Ingest.Cached() = %v, want %v", got, tt.wantCached)
+			}
+			if _, ok := (*ig.Result)["phpcs_wordpress"].(tide.AuditResult); ok != tt.wantCached {
+				t.Errorf("Ingest.Do() phpcs_wordpress replayed = %v, want %v", ok, tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestIngest_Detect(t *testing.T) {
+
+	b := bytes.Buffer{}
+	log.SetOutput(&b)
+	defer log.SetOutput(os.Stdout)
+
+	// Clean up after.
+	defer func() {
+		os.RemoveAll("./testdata/tmp")
+	}()
+
+	// A server that is gone can't be sniffed.
+	gone := httptest.NewServer(http.NotFoundHandler())
+	gone.Close()
+
+	// A server that doesn't have the source refuses it.
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+
+	tests := []struct {
+		name          string
+		message       message.Message
+		wantPermanent bool
+	}{
+		{
+			"Unknown Source",
+			message.Message{
+				Title:      "Unknown Source",
+				SourceURL:  ts.URL + "/test.rar",
+				SourceType: "rar",
+			},
+			true,
+		},
+		{
+			"Sniff Fail",
+			message.Message{
+				Title:     "Sniff Fail",
+				SourceURL: gone.URL + "/download/123",
+			},
+			false,
+		},
+		{
+			"Sniff Not Found",
+			message.Message{
+				Title:     "Sniff Not Found",
+				SourceURL: missing.URL + "/download/123",
+			},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ig := &Ingest{
+				TempFolder: "./testdata/tmp",
+				Downloader: &download.Client{}, // Don't retry.
+			}
+
+			// The source of a previous message isn't used for the next one.
+			ig.Result = &Result{}
+			ig.Message = message.Message{
+				Title:      "Test Ingest",
+				SourceURL:  ts.URL + "/test.zip",
+				SourceType: "zip",
+			}
+			if err := ig.Do(); err != nil {
+				t.Errorf("Ingest.Do() error = %v", err)
+				return
+			}
+
+			ig.Result = &Result{}
+			ig.Message = tt.message
+			err := ig.Do()
+			if err == nil {
+				t.Errorf("Ingest.Do() error = nil, want error")
+				return
+			}
+			if got := IsPermanent(err); got != tt.wantPermanent {
+				t.Errorf("Ingest.Do() error = %v, permanent = %v, want %v", err, got, tt.wantPermanent)
+			}
+		})
+	}
+}
+
+func Test_permanentDownload(t *testing.T) {
+	status := func(code int) *download.Error {
+		err := download.NewError(download.ErrStatus, ts.URL+"/test.zip", http.StatusText(code))
+		err.StatusCode = code
+		return err
+	}
+
+	tests := []struct {
+		name string
+		err  *download.Error
+		want bool
+	}{
+		{
+			"Request Error",
+			download.NewError(download.ErrRequest, ts.URL+"/test.zip", "connection refused"),
+			false,
+		},
+		{
+			"Checksum Mismatch",
+			download.NewError(download.ErrChecksum, ts.URL+"/test.zip", "checksum does not match"),
+			true,
+		},
+		{
+			"Too Large",
+			download.NewError(download.ErrTooLarge, ts.URL+"/test.zip", "file is too large"),
+			true,
+		},
+		{
+			"Not Found",
+			status(http.StatusNotFound),
+			true,
+		},
+		{
+			"Forbidden",
+			status(http.StatusForbidden),
+			true,
+		},
+		{
+			"Request Timeout",
+			status(http.StatusRequestTimeout),
+			false,
+		},
+		{
+			"Too Many Requests",
+			status(http.StatusTooManyRequests),
+			false,
+		},
+		{
+			"Server Error",
+			status(http.StatusBadGateway),
+			false,
+		},
+		{
+			"Resume Not Supported",
+			status(http.StatusOK),
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := permanentDownload(tt.err); got != tt.want {
+				t.Errorf("permanentDownload() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIngest_Workspace(t *testing.T) {
+
+	b := bytes.Buffer{}
+	log.SetOutput(&b)
+	defer log.SetOutput(os.Stdout)
+
+	// Clean up after.
+	defer func() {
+		os.RemoveAll("./testdata/tmp")
+	}()
+
+	msg := message.Message{
+		Title:               "Test Ingest",
+		ResponseAPIEndpoint: ts.URL + "/api/audits",
+		SourceURL:           ts.URL + "/test.zip",
+		SourceType:          "zip",
+	}
+
+	ig := &Ingest{
+		TempFolder: "./testdata/tmp",
+	}
+
+	// Jobs for the same source get their own workspace.
+	var paths []string
+	for i := 0; i < 2; i++ {
+		ig.Result = &Result{}
+		ig.Message = msg
+		if err := ig.Do(); err != nil {
+			t.Errorf("Ingest.Do() error = %v", err)
+			return
+		}
+		paths = append(paths, ig.GetFilesPath())
+
+		if ws := ig.GetWorkspace(); ws == nil || ws.Path != ig.GetFilesPath() {
+			t.Errorf("Ingest.GetWorkspace() = %v, want workspace in %v", ws, ig.GetFilesPath())
+		}
+	}
+
+	if paths[0] == paths[1] {
+		t.Errorf("Ingest.Do() files path = %v for both jobs, want unique paths", paths[0])
+	}
+
+	// A finished job removes its workspace.
+	ig.CloseWorkspace(false)
+	if _, err := os.Stat(paths[1]); !os.IsNotExist(err) {
+		t.Errorf("Ingest.CloseWorkspace() did not remove %v", paths[1])
+	}
+}
+
 func TestIngest_Run(t *testing.T) {
 
 	b := bytes.Buffer{}
@@ -237,7 +738,6 @@ func TestIngest_Run(t *testing.T) {
 		In         <-chan message.Message
 		Out        chan Processor
 		TempFolder string
-		srcMgr     source.Source
 	}
 
 	tests := []struct {
@@ -347,11 +847,10 @@ func TestIngest_Run(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			ig := &Ingest{
-				Process:       tt.fields.Process,
-				In:            tt.fields.In,
-				Out:           tt.fields.Out,
-				TempFolder:    tt.fields.TempFolder,
-				sourceManager: tt.fields.srcMgr,
+				Process:    tt.fields.Process,
+				In:         tt.fields.In,
+				Out:        tt.fields.Out,
+				TempFolder: tt.fields.TempFolder,
 			}
 
 			ig.SetContext(ctx)
@@ -408,3 +907,48 @@ func generateMessages(messages []message.Message) <-chan message.Message {
 
 	return out
 }
+
+func TestIngest_Stop(t *testing.T) {
+
+	in := make(chan message.Message, 1)
+
+	ig := &Ingest{
+		In:         in,
+		Out:        make(chan Processor),
+		TempFolder: "./testdata/tmp",
+	}
+
+	// Stopping before running does nothing.
+	ig.Stop()
+
+	errc := make(chan error, 1)
+	if err := ig.Run(&errc); err != nil {
+		t.Errorf("Ingest.Run() error = %v", err)
+		return
+	}
+
+	ig.Stop()
+	// Stopping twice is safe.
+	ig.Stop()
+
+	select {
+	case <-ig.Stopped():
+	case <-time.After(time.Second):
+		t.Errorf("Ingest.Stopped() not closed after stop")
+		return
+	}
+
+	// New messages are not taken.
+	in <- message.Message{
+		Title: "Not Taken",
+	}
+	time.Sleep(time.Millisecond * 50)
+	if len(in) != 1 {
+		t.Errorf("Ingest.Run() took a message after stop")
+	}
+
+	// The next process is told to stop.
+	if _, ok := <-ig.Out; ok {
+		t.Errorf("Ingest.Run() did not close the out channel")
+	}
+}
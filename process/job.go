@@ -0,0 +1,178 @@
+package process
+
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/wptide/pkg/log"
+	"github.com/wptide/pkg/message"
+	"github.com/wptide/pkg/source"
+	"github.com/wptide/pkg/tide"
+	"github.com/wptide/pkg/workspace"
+)
+
+// Job carries a single message and everything the stages found out about it through a pipe.
+// A job belongs to one stage at a time, so stages can change it without locks.
+type Job struct {
+	ID        string                      // Unique ID of the job.
+	Message   message.Message             // The message that started the job.
+	Checksum  string                      // Checksum of the code to audit.
+	Files     []string                    // Paths of the files to audit.
+	Manifest  source.Manifest             // Checksum and size of the files to audit.
+	FilesPath string                      // Path where the source was extracted.
+	CodePath  string                      // (Optional) Path of the code to audit, if it is not the extracted source.
+	Workspace *workspace.Workspace        // (Optional) Workspace of the job.
+	Info      *tide.CodeInfo              // (Optional) Details of the project.
+	Audits    map[string]tide.AuditResult // Results of the audits by report key, e.g. "phpcs_wordpress".
+	Results   Result                      // Any other results of the stages.
+	Timings   []Timing                    // Time spent in every stage.
+	Errors    []error                     // Errors of the stages.
+}
+
+// Timing is the time a job spent in a stage.
+type Timing struct {
+	Stage    string
+	Start    time.Time
+	Duration time.Duration
+}
+
+// NewJob returns a new job for a message.
+func NewJob(msg message.Message) *Job {
+	return &Job{
+		ID:      newJobID(),
+		Message: msg,
+		Audits:  make(map[string]tide.AuditResult),
+		Results: make(Result),
+	}
+}
+
+// newJobID returns a random ID.
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return fmt.Sprintf("%x", b)
+}
+
+// Time records the time spent in a stage since start.
+func (j *Job) Time(stage string, start time.Time) {
+	j.Timings = append(j.Timings, Timing{
+		Stage:    stage,
+		Start:    start,
+		Duration: time.Since(start),
+	})
+}
+
+// Fail records an error of a stage.
+func (j *Job) Fail(stage string, err error) {
+	j.Errors = append(j.Errors, NewPipelineError(stage, j.Message, err))
+}
+
+// Failed returns true if any stage failed.
+func (j *Job) Failed() bool {
+	return len(j.Errors) > 0
+}
+
+// Err returns the error the job ended with: the first permanent error, so that the message isn't
+// retried, otherwise the last error. It returns nil if no stage failed.
+func (j *Job) Err() error {
+	for _, err := range j.Errors {
+		if IsPermanent(err) {
+			return err
+		}
+	}
+	if len(j.Errors) == 0 {
+		return nil
+	}
+	return j.Errors[len(j.Errors)-1]
+}
+
+// GetCodePath returns the path of the code to audit.
+func (j *Job) GetCodePath() string {
+	if j.CodePath != "" {
+		return j.CodePath
+	}
+	return j.FilesPath + "/unzipped"
+}
+
+// Result returns the results of the job as a Result map, as used by processes and payloaders.
+func (j *Job) Result() Result {
+	result := make(Result)
+	for key, value := range j.Results {
+		result[key] = value
+	}
+
+	if j.Checksum != "" {
+		result["checksum"] = j.Checksum
+	}
+	if j.Files != nil {
+		result["files"] = j.Files
+	}
+	if j.Manifest != nil {
+		result["manifest"] = j.Manifest
+	}
+	if j.FilesPath != "" {
+		result["filesPath"] = j.FilesPath
+	}
+	if j.CodePath != "" {
+		result["codePath"] = j.CodePath
+	}
+	if j.Workspace != nil {
+		result["workspace"] = j.Workspace
+	}
+	if j.Info != nil {
+		result["info"] = *j.Info
+	}
+	for key, audit := range j.Audits {
+		result[key] = audit
+	}
+
+	return result
+}
+
+// SetResult sets the results of the job from a Result map.
+func (j *Job) SetResult(result Result) {
+	j.Results = make(Result)
+	j.Audits = make(map[string]tide.AuditResult)
+	j.Checksum, j.Files, j.Manifest, j.CodePath, j.Workspace, j.Info = "", nil, nil, "", nil, nil
+
+	for key, value := range result {
+		switch v := value.(type) {
+		case tide.AuditResult:
+			j.Audits[key] = v
+			continue
+		case tide.CodeInfo:
+			if key == "info" {
+				j.Info = &v
+				continue
+			}
+		}
+
+		switch key {
+		case "checksum":
+			j.Checksum, _ = value.(string)
+		case "files":
+			j.Files, _ = value.([]string)
+		case "manifest":
+			j.Manifest, _ = value.(source.Manifest)
+		case "filesPath":
+			j.FilesPath, _ = value.(string)
+		case "codePath":
+			j.CodePath, _ = value.(string)
+		case "workspace":
+			j.Workspace, _ = value.(*workspace.Workspace)
+		default:
+			j.Results[key] = value
+		}
+	}
+}
+
+// CloseWorkspace removes the workspace of the job once it is finished or failed.
+func (j *Job) CloseWorkspace() {
+	if j.Workspace == nil {
+		return
+	}
+	if err := j.Workspace.Close(j.Failed()); err != nil {
+		log.Log(j.Message.Title, "Could not remove workspace: "+err.Error())
+	}
+}
@@ -0,0 +1,176 @@
+package process
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/wptide/pkg/message"
+	"github.com/wptide/pkg/source"
+	"github.com/wptide/pkg/tide"
+	"github.com/wptide/pkg/workspace"
+)
+
+func TestNewJob(t *testing.T) {
+	a := NewJob(message.Message{Title: "Plugin One"})
+	b := NewJob(message.Message{Title: "Plugin One"})
+
+	if a.ID == "" || a.ID == b.ID {
+		t.Errorf("NewJob() IDs = %v and %v, want unique IDs", a.ID, b.ID)
+	}
+	if a.Message.Title != "Plugin One" || a.Audits == nil || a.Results == nil {
+		t.Errorf("NewJob() = %v", a)
+	}
+}
+
+func TestJob_SetResult(t *testing.T) {
+
+	ws := &workspace.Workspace{ID: "job-1"}
+
+	tests := []struct {
+		name   string
+		result Result
+		want   Job
+	}{
+		{
+			"Empty Result",
+			Result{},
+			Job{
+				Audits:  map[string]tide.AuditResult{},
+				Results: Result{},
+			},
+		},
+		{
+			"Typed Results",
+			Result{
+				"checksum":        "abc123",
+				"files":           []string{"plugin.php"},
+				"manifest":        source.Manifest{"plugin.php": {Checksum: "def456", Size: 10}},
+				"filesPath":       "/tmp/job-1",
+				"codePath":        "/tmp/job-1/unzipped/plugin",
+				"workspace":       ws,
+				"info":            tide.CodeInfo{Type: "plugin"},
+				"phpcs_wordpress": tide.AuditResult{Raw: tide.AuditDetails{Type: "local"}},
+				"responseSuccess": true,
+			},
+			Job{
+				Checksum:  "abc123",
+				Files:     []string{"plugin.php"},
+				Manifest:  source.Manifest{"plugin.php": {Checksum: "def456", Size: 10}},
+				FilesPath: "/tmp/job-1",
+				CodePath:  "/tmp/job-1/unzipped/plugin",
+				Workspace: ws,
+				Info:      &tide.CodeInfo{Type: "plugin"},
+				Audits: map[string]tide.AuditResult{
+					"phpcs_wordpress": {Raw: tide.AuditDetails{Type: "local"}},
+				},
+				Results: Result{
+					"responseSuccess": true,
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &Job{}
+			job.SetResult(tt.result)
+
+			if !reflect.DeepEqual(*job, tt.want) {
+				t.Errorf("Job.SetResult() = %v, want %v", *job, tt.want)
+			}
+
+			// The results survive the way back.
+			if got := job.Result(); !reflect.DeepEqual(got, tt.result) {
+				t.Errorf("Job.Result() = %v, want %v", got, tt.result)
+			}
+		})
+	}
+}
+
+func TestJob_Fail(t *testing.T) {
+	job := NewJob(message.Message{})
+
+	if job.Failed() {
+		t.Errorf("Job.Failed() = true for a new job")
+	}
+
+	job.Fail("Info", errors.New("not a theme or plugin"))
+
+	if !job.Failed() || job.Errors[0].Error() != "Info Error: not a theme or plugin" {
+		t.Errorf("Job.Fail() errors = %v", job.Errors)
+	}
+}
+
+func TestJob_Err(t *testing.T) {
+	tests := []struct {
+		name   string
+		errors []error
+		want   string
+	}{
+		{
+			"No Errors",
+			nil,
+			"",
+		},
+		{
+			"Last Error",
+			[]error{
+				errors.New("timeout"),
+				errors.New("upload failed"),
+			},
+			"Audit Error: upload failed",
+		},
+		{
+			"First Permanent Error",
+			[]error{
+				errors.New("timeout"),
+				Permanent(errors.New("invalid message")),
+				Permanent(errors.New("not a theme or plugin")),
+				errors.New("upload failed"),
+			},
+			"Audit Error: invalid message",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := NewJob(message.Message{})
+			for _, err := range tt.errors {
+				job.Fail("Audit", err)
+			}
+
+			err := job.Err()
+			if (err == nil) != (tt.want == "") || (err != nil && err.Error() != tt.want) {
+				t.Errorf("Job.Err() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestJob_Time(t *testing.T) {
+	job := NewJob(message.Message{})
+
+	start := time.Now().Add(-time.Second)
+	job.Time("Info", start)
+
+	if len(job.Timings) != 1 || job.Timings[0].Stage != "Info" || job.Timings[0].Start != start {
+		t.Errorf("Job.Time() timings = %v", job.Timings)
+		return
+	}
+	if job.Timings[0].Duration < time.Second {
+		t.Errorf("Job.Time() duration = %v, want at least 1s", job.Timings[0].Duration)
+	}
+}
+
+func TestJob_GetCodePath(t *testing.T) {
+	job := &Job{FilesPath: "/tmp/job-1"}
+
+	if got := job.GetCodePath(); got != "/tmp/job-1/unzipped" {
+		t.Errorf("Job.GetCodePath() = %v", got)
+	}
+
+	job.CodePath = "/tmp/job-1/unzipped/plugin"
+	if got := job.GetCodePath(); got != "/tmp/job-1/unzipped/plugin" {
+		t.Errorf("Job.GetCodePath() = %v", got)
+	}
+}
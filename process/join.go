@@ -0,0 +1,330 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/wptide/pkg/message"
+)
+
+/*
+ * Constants to represent the policies for merging a result key that was changed by more than one branch.
+ *
+ * MergeFirst keeps the value of the branch that comes first in the Fork.
+ * MergeLast keeps the value of the branch that comes last in the Fork.
+ * MergeError fails the job.
+ */
+const (
+	MergeFirst = iota
+	MergeLast
+	MergeError
+)
+
+// DefaultJoinTimeout is the time a Join waits for the other branches of a job.
+const DefaultJoinTimeout = time.Hour
+
+// How often a Join checks for jobs that were dropped by a branch or waited too long.
+// A variable so that we can mock it in tests.
+var joinSweepInterval = time.Second
+
+// Join defines the structure for a process that waits for every branch of a Fork to finish a job,
+// and merges the results of the branches. A job that a branch dropped is completed with the error
+// of the branch, once the other branches are done with it.
+type Join struct {
+	Process                     // Inherits methods from Process.
+	Ins      []<-chan Processor // Expects a processor channel for every branch.
+	Out      chan Processor     // Send results to an output channel.
+	Policy   int                // How to merge a key that was changed by more than one branch.
+	Policies map[string]int     // (Optional) Policies for single keys, these win over Policy.
+	Timeout  time.Duration      // (Optional) Time to wait for the other branches once a branch passed a job. Defaults to DefaultJoinTimeout.
+}
+
+// branchResult is a job that finished a branch.
+type branchResult struct {
+	message   message.Message
+	result    *Result
+	filesPath string
+}
+
+// pendingJob collects the results of the branches of a job.
+type pendingJob struct {
+	message   message.Message
+	filesPath string
+	results   []Result
+	received  int
+	deadline  time.Time
+}
+
+// Run executes the process in the pipeline.
+func (j *Join) Run(errc *chan error) error {
+
+	if len(j.Ins) == 0 {
+		return errors.New("requires at least one branch")
+	}
+	if j.Out == nil {
+		return errors.New("requires a next process")
+	}
+
+	j.start()
+
+	// Collect the jobs of all branches.
+	done := j.done()
+	var wg sync.WaitGroup
+	joined := make(chan branchResult)
+	for _, in := range j.Ins {
+		wg.Add(1)
+		go func(in <-chan Processor) {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-done:
+					return
+				case proc, ok := <-in:
+					if !ok {
+						return
+					}
+
+					b := branchResult{
+						message:   proc.GetMessage(),
+						result:    proc.GetResult(),
+						filesPath: proc.GetFilesPath(),
+					}
+
+					select {
+					case joined <- b:
+					case <-done:
+						return
+					}
+				}
+			}
+		}(in)
+	}
+
+	// Every branch stopped.
+	go func() {
+		wg.Wait()
+		close(joined)
+	}()
+
+	j.health = j.registry.Component("Join").Worker()
+
+	timeout := j.Timeout
+	if timeout <= 0 {
+		timeout = DefaultJoinTimeout
+	}
+
+	go func() {
+		defer j.finish()
+		defer j.health.Stop()
+
+		pending := make(map[*fork]*pendingJob)
+
+		sweep := time.NewTicker(joinSweepInterval)
+		defer sweep.Stop()
+
+		for {
+			// Waiting for the next branch is not a stall.
+			j.health.Idle()
+
+			select {
+			case <-j.done():
+				return
+			case <-sweep.C:
+				// Jobs that a branch dropped after the other branches passed them, or that waited too long.
+				for job, p := range pending {
+					if settled, err := job.settle(); settled {
+						delete(pending, job)
+						j.fail(job, p, p.received, err, nil)
+						continue
+					}
+					if time.Now().After(p.deadline) {
+						// Branches that pass the job later only release the workspace.
+						holds := job.end()
+						delete(pending, job)
+						j.fail(job, p, holds, errors.New("timed out waiting for the other branches"), errc)
+					}
+				}
+			case b, ok := <-joined:
+				// The branches stopped, so do we and the next process.
+				if !ok {
+					close(j.Out)
+					return
+				}
+				j.health.Busy()
+
+				result := Result{}
+				if b.result != nil {
+					result = *b.result
+				}
+
+				job, ok := result["fork"].(*fork)
+				branch, _ := result["forkBranch"].(int)
+				if !ok || branch < 0 || branch >= job.branches {
+					// Not a branch of a fork, so the job is completed here.
+					delete(result, "fork")
+					delete(result, "forkBranch")
+
+					pErr := NewPipelineError("Join", b.message, Permanent(errors.New(b.message.Title+": job was not forked")))
+					j.complete(b.message, &result, pErr)
+					*errc <- pErr
+					continue
+				}
+
+				// The job already ended, e.g. because it waited too long, this branch is done with it.
+				if !job.arrive() {
+					dropped := Process{Result: &result}
+					dropped.CloseWorkspace(true)
+					continue
+				}
+
+				// Wait for the other branches.
+				p, ok := pending[job]
+				if !ok {
+					p = &pendingJob{
+						message:   b.message,
+						filesPath: b.filesPath,
+						results:   make([]Result, job.branches),
+						deadline:  time.Now().Add(timeout),
+					}
+					pending[job] = p
+				}
+				p.results[branch] = result
+				p.received++
+
+				settled, err := job.settle()
+				if !settled {
+					continue
+				}
+				delete(pending, job)
+
+				// Another branch dropped the job.
+				if err != nil {
+					j.fail(job, p, p.received, err, nil)
+					continue
+				}
+
+				merged, err := j.merge(job.base, p.results)
+
+				j.SetMessage(b.message)
+				j.SetFilesPath(b.filesPath)
+				j.SetResults(&job.base)
+
+				// The branches are done with the workspace, only the joined job keeps it.
+				if ws := j.GetWorkspace(); ws != nil {
+					for i := 1; i < job.branches; i++ {
+						ws.Close(false)
+					}
+				}
+
+				if err != nil {
+					// The job ends here, clean up after it.
+					j.CloseWorkspace(true)
+
+					pErr := NewPipelineError("Join", j.Message, Permanent(j.Error(err.Error())))
+					j.complete(j.Message, &job.base, pErr)
+
+					// Pass the error up the error channel.
+					*errc <- pErr
+					// continue so that the message doesn't get passed along.
+					continue
+				}
+
+				// Send the joined job to the out channel.
+				proc := &Join{}
+				proc.SetContext(j.context)
+				proc.SetMessage(b.message)
+				proc.SetResults(&merged)
+				proc.SetFilesPath(b.filesPath)
+
+				if !j.send(j.Out, proc) {
+					return
+				}
+			}
+		}
+
+	}()
+
+	return nil
+}
+
+// fail completes a job that didn't make it through every branch, and releases the holds of the branches
+// on the workspace. The error is passed up the error channel, unless errc is nil because a branch already did.
+func (j *Join) fail(job *fork, p *pendingJob, holds int, err error, errc *chan error) {
+	j.SetMessage(p.message)
+	j.SetFilesPath(p.filesPath)
+	j.SetResults(&job.base)
+
+	// The job ends here, the branches are done with the workspace.
+	if ws := j.GetWorkspace(); ws != nil {
+		for i := 0; i < holds; i++ {
+			ws.Close(true)
+		}
+	}
+
+	// Errors of a branch keep the stage that failed.
+	pErr, ok := err.(*PipelineError)
+	if !ok {
+		pErr = NewPipelineError("Join", j.Message, err)
+	}
+	j.complete(j.Message, &job.base, pErr)
+
+	if errc != nil {
+		*errc <- pErr
+	}
+}
+
+// Do does nothing, the results are merged in Run.
+func (j *Join) Do() error {
+	return nil
+}
+
+// policy returns the merge policy for a key.
+func (j *Join) policy(key string) int {
+	if policy, ok := j.Policies[key]; ok {
+		return policy
+	}
+	return j.Policy
+}
+
+// merge adds the keys that the branches changed to the results from before the fork.
+func (j *Join) merge(base Result, branches []Result) (Result, error) {
+
+	merged := Result{}
+	for key, value := range base {
+		merged[key] = value
+	}
+
+	changedBy := make(map[string]int)
+
+	for i, branch := range branches {
+		for key, value := range branch {
+			// Keys used to join the branches.
+			if key == "fork" || key == "forkBranch" {
+				continue
+			}
+
+			// Not changed by this branch.
+			if old, ok := base[key]; ok && reflect.DeepEqual(old, value) {
+				continue
+			}
+
+			if first, ok := changedBy[key]; ok && !reflect.DeepEqual(merged[key], value) {
+				switch j.policy(key) {
+				case MergeFirst:
+					continue
+				case MergeError:
+					return nil, fmt.Errorf("branches %d and %d both changed `%s`", first, i, key)
+				}
+			}
+
+			changedBy[key] = i
+			merged[key] = value
+		}
+	}
+
+	return merged, nil
+}
@@ -0,0 +1,364 @@
+package process
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/wptide/pkg/message"
+	"github.com/wptide/pkg/workspace"
+)
+
+func TestJoin_Run(t *testing.T) {
+
+	defer os.RemoveAll("./testdata/workspaces")
+
+	ws, _ := workspace.NewManager("./testdata/workspaces", workspace.KeepNone).Create()
+
+	in := make(chan Processor, 2)
+	for _, title := range []string{"Plugin One", "Plugin Two"} {
+		in <- &Ingest{
+			Process: Process{
+				Message: message.Message{Title: title},
+				Result: &Result{
+					"checksum":  title,
+					"workspace": ws,
+				},
+			},
+		}
+	}
+	close(in)
+
+	branches := []chan Processor{make(chan Processor), make(chan Processor)}
+	f := &Fork{
+		In:   in,
+		Outs: branches,
+	}
+	// Two jobs share the workspace.
+	ws.Share(1)
+
+	// The branches add their own results, the second one is slower.
+	joinIns := []<-chan Processor{}
+	for i, branch := range branches {
+		out := make(chan Processor)
+		joinIns = append(joinIns, out)
+
+		go func(i int, branch chan Processor, out chan Processor) {
+			defer close(out)
+			for proc := range branch {
+				time.Sleep(time.Duration(i*20) * time.Millisecond)
+				result := *proc.GetResult()
+				result["branch"+string('A'+rune(i))] = proc.GetMessage().Title
+				out <- proc
+			}
+		}(i, branch, out)
+	}
+
+	j := &Join{
+		Ins: joinIns,
+		Out: make(chan Processor),
+	}
+
+	errc := make(chan error, 1)
+	if err := f.Run(&errc); err != nil {
+		t.Errorf("Fork.Run() error = %v", err)
+		return
+	}
+	if err := j.Run(&errc); err != nil {
+		t.Errorf("Join.Run() error = %v", err)
+		return
+	}
+
+	for n := 0; n < 2; n++ {
+		select {
+		case proc := <-j.Out:
+			title := proc.GetMessage().Title
+			want := Result{
+				"checksum":  title,
+				"workspace": ws,
+				"branchA":   title,
+				"branchB":   title,
+			}
+			if got := *proc.GetResult(); !reflect.DeepEqual(got, want) {
+				t.Errorf("Join.Run() result = %v, want %v", got, want)
+			}
+			proc.(*Join).CloseWorkspace(false)
+		case err := <-errc:
+			t.Errorf("Join.Run() error = %v", err)
+			return
+		case <-time.After(time.Second):
+			t.Errorf("Join.Run() did not join job %d", n)
+			return
+		}
+	}
+
+	// Only the joined jobs held the workspace.
+	if _, err := os.Stat(ws.Path); !os.IsNotExist(err) {
+		t.Errorf("Join.Run() did not release the workspace")
+	}
+
+	if _, ok := <-j.Out; ok {
+		t.Errorf("Join.Run() did not close the out channel")
+	}
+	select {
+	case <-j.Stopped():
+	case <-time.After(time.Second):
+		t.Errorf("Join.Stopped() not closed")
+	}
+}
+
+func TestJoin_Run_Dropped(t *testing.T) {
+
+	defer os.RemoveAll("./testdata/workspaces")
+
+	oldInterval := joinSweepInterval
+	joinSweepInterval = 10 * time.Millisecond
+	defer func() {
+		joinSweepInterval = oldInterval
+	}()
+
+	const (
+		pass = iota
+		drop
+		lose
+	)
+
+	tests := []struct {
+		name     string
+		branches []int // What every branch does with the job.
+		delays   []time.Duration
+		timeout  time.Duration
+		wantErr  string
+	}{
+		{
+			"Branch Drops Job First",
+			[]int{pass, drop},
+			[]time.Duration{50 * time.Millisecond, 0},
+			0,
+			"Branch Error: something went wrong",
+		},
+		{
+			"Branch Drops Job Last",
+			[]int{pass, drop},
+			[]time.Duration{0, 50 * time.Millisecond},
+			0,
+			"Branch Error: something went wrong",
+		},
+		{
+			"Every Branch Drops Job",
+			[]int{drop, drop},
+			[]time.Duration{0, 20 * time.Millisecond},
+			0,
+			"Branch Error: something went wrong",
+		},
+		{
+			"Branch Loses Job",
+			[]int{pass, lose},
+			[]time.Duration{0, 0},
+			50 * time.Millisecond,
+			"Join Error: timed out waiting for the other branches",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws, _ := workspace.NewManager("./testdata/workspaces", workspace.KeepNone).Create()
+
+			in := make(chan Processor, 1)
+			in <- &Ingest{
+				Process: Process{
+					Message: message.Message{Title: "Plugin"},
+					Result: &Result{
+						"workspace": ws,
+					},
+				},
+			}
+
+			completed := make(chan error, 2)
+			completer := CompleterFunc(func(msg message.Message, err error) {
+				completed <- err
+			})
+
+			branches := make([]chan Processor, len(tt.branches))
+			joinIns := []<-chan Processor{}
+			for i := range tt.branches {
+				branches[i] = make(chan Processor)
+				out := make(chan Processor)
+				joinIns = append(joinIns, out)
+
+				go func(i int, branch chan Processor, out chan Processor) {
+					defer close(out)
+					for proc := range branch {
+						time.Sleep(tt.delays[i])
+						switch tt.branches[i] {
+						case pass:
+							out <- proc
+						case drop:
+							// Branches end failed jobs like any process.
+							dropper := Process{}
+							dropper.SetCompleter(completer)
+							dropper.CopyFields(proc)
+							dropper.CloseWorkspace(true)
+							dropper.complete(dropper.Message, dropper.Result, NewPipelineError("Branch", dropper.Message, errors.New("something went wrong")))
+						}
+					}
+				}(i, branches[i], out)
+			}
+
+			f := &Fork{
+				In:   in,
+				Outs: branches,
+			}
+			j := &Join{
+				Ins:     joinIns,
+				Out:     make(chan Processor),
+				Timeout: tt.timeout,
+			}
+			j.SetCompleter(completer)
+
+			errc := make(chan error, 2)
+			f.Run(&errc)
+			j.Run(&errc)
+			defer close(in)
+
+			select {
+			case err := <-completed:
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Join.Run() completed with %v, want %v", err, tt.wantErr)
+				}
+			case proc := <-j.Out:
+				t.Errorf("Join.Run() passed %v, want the job completed", proc.GetMessage().Title)
+				return
+			case <-time.After(time.Second):
+				t.Errorf("Join.Run() did not complete the job")
+				return
+			}
+
+			// The job is completed once, and every branch released the workspace.
+			time.Sleep(50 * time.Millisecond)
+			select {
+			case err := <-completed:
+				t.Errorf("Join.Run() completed the job again with %v", err)
+			default:
+			}
+			if _, err := os.Stat(ws.Path); !os.IsNotExist(err) {
+				t.Errorf("Join.Run() did not release the workspace")
+			}
+		})
+	}
+}
+
+func TestJoin_merge(t *testing.T) {
+
+	base := Result{
+		"checksum": "abc123",
+		"info":     "plugin",
+	}
+
+	tests := []struct {
+		name     string
+		policy   int
+		policies map[string]int
+		branches []Result
+		want     Result
+		wantErr  bool
+	}{
+		{
+			"No Conflicts",
+			MergeError,
+			nil,
+			[]Result{
+				{"checksum": "abc123", "info": "plugin", "phpcs_wordpress": "a"},
+				{"checksum": "abc123", "info": "plugin", "lighthouse": "b"},
+			},
+			Result{"checksum": "abc123", "info": "plugin", "phpcs_wordpress": "a", "lighthouse": "b"},
+			false,
+		},
+		{
+			"Same Value",
+			MergeError,
+			nil,
+			[]Result{
+				{"info": "theme"},
+				{"info": "theme"},
+			},
+			Result{"checksum": "abc123", "info": "theme"},
+			false,
+		},
+		{
+			"Unchanged Keys Don't Conflict",
+			MergeError,
+			nil,
+			[]Result{
+				{"info": "theme"},
+				{"info": "plugin"},
+			},
+			Result{"checksum": "abc123", "info": "theme"},
+			false,
+		},
+		{
+			"First Branch Wins",
+			MergeFirst,
+			nil,
+			[]Result{
+				{"info": "theme", "fork": &fork{}, "forkBranch": 0},
+				{"info": "other", "fork": &fork{}, "forkBranch": 1},
+			},
+			Result{"checksum": "abc123", "info": "theme"},
+			false,
+		},
+		{
+			"Last Branch Wins",
+			MergeLast,
+			nil,
+			[]Result{
+				{"info": "theme"},
+				{"info": "other"},
+			},
+			Result{"checksum": "abc123", "info": "other"},
+			false,
+		},
+		{
+			"Conflict Error",
+			MergeError,
+			nil,
+			[]Result{
+				{"info": "theme"},
+				{"info": "other"},
+			},
+			nil,
+			true,
+		},
+		{
+			"Key Policy",
+			MergeError,
+			map[string]int{
+				"info": MergeLast,
+			},
+			[]Result{
+				{"info": "theme"},
+				{"info": "other"},
+			},
+			Result{"checksum": "abc123", "info": "other"},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := &Join{
+				Policy:   tt.policy,
+				Policies: tt.policies,
+			}
+
+			got, err := j.merge(base, tt.branches)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Join.merge() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Join.merge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,18 +1,29 @@
 package process
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"strings"
+	"time"
 
+	"github.com/wptide/pkg/health"
 	"github.com/wptide/pkg/log"
+	"github.com/wptide/pkg/message"
 	"github.com/wptide/pkg/shell"
 	"github.com/wptide/pkg/storage"
 	"github.com/wptide/pkg/tide"
 )
 
+// LighthouseAudit is the type of Lighthouse audits in messages.
+const LighthouseAudit = "lighthouse"
+
 var (
+	// Options that Lighthouse audits take.
+	lighthouseOptions = []Option{
+		{Name: "timeout"},
+	}
+
 	lhRunner      shell.Runner
 	defaultRunner shell.Runner = &shell.Command{}
 )
@@ -24,6 +35,10 @@ type Lighthouse struct {
 	Out             chan Processor   // Send results to an output channel.
 	TempFolder      string           // Path to a temp folder where reports will be generated.
 	StorageProvider storage.Provider // Storage provider to upload reports to.
+	Workers         int              // (Optional) Number of jobs processed at the same time. Defaults to 1.
+	Timeout         time.Duration    // (Optional) Time before an audit is stopped. Audits in the message can only lower it.
+	Registry        *Registry        // (Optional) Audit types that the process runs. Defaults to DefaultRegistry.
+	current         *message.Audit   // Audit that is running, its options apply to the run.
 }
 
 // Run runs the process in a pipeline.
@@ -43,60 +58,134 @@ func (lh *Lighthouse) Run(errc *chan error) error {
 		return errors.New("requires a next process")
 	}
 
-	go func() {
-		for {
-			select {
-			case in := <-lh.In:
-
-				// Copy Process fields from `in` process.
-				lh.CopyFields(in)
-
-				// Assume that the rest of the message is also broken.
-				// Don't pass this down the pipe.
-				if lh.Message.Title == "" {
-					*errc <- errors.New("Lighthouse Error: " + lh.Error("invalid message").Error())
-					continue
-				}
-
-				// Run the process.
-				// If processing produces an error send it up the error channel.
-				for _, audit := range lh.Message.Audits {
-					if audit.Type == "lighthouse" {
-						if err := lh.Do(); err != nil {
-							// Pass the error up the error channel.
-							*errc <- errors.New("Lighthouse Error: " + err.Error())
-							// Don't break, the message is still useful to other processes.
-						}
-					}
-				}
-
-				// Send process to the out channel.
-				lh.Out <- lh
-			}
-		}
+	lh.start()
 
-	}()
+	// Every worker works on its own copy of the process.
+	lh.spawn("Lighthouse", lh.Workers, closer(lh.Out), func(w *health.Worker) bool {
+		worker := *lh
+		worker.health = w
+		return worker.work(errc)
+	})
 
 	return nil
 }
 
+// work takes jobs until the previous process stops or the context is cancelled.
+// It returns true if the previous process stopped.
+func (lh *Lighthouse) work(errc *chan error) bool {
+	for {
+		// Waiting for the next job is not a stall.
+		lh.health.Idle()
+
+		select {
+		case <-lh.done():
+			return false
+		case in, ok := <-lh.In:
+			// The previous process stopped.
+			if !ok {
+				return true
+			}
+			lh.health.Busy()
+
+			// Copy Process fields from `in` process.
+			lh.CopyFields(in)
+
+			// Assume that the rest of the message is also broken.
+			// Don't pass this down the pipe.
+			if lh.Message.Title == "" {
+				lh.CloseWorkspace(true)
+				pErr := NewPipelineError("Lighthouse", lh.Message, Permanent(lh.Error("invalid message")))
+				track("Lighthouse")(pErr)
+				lh.complete(lh.Message, lh.Result, pErr)
+				*errc <- pErr
+				continue
+			}
+
+			// Run the process.
+			// If processing produces an error send it up the error channel.
+			end := track("Lighthouse")
+			errs := lh.doAudits()
+			end(combineErrors(errs))
+
+			for _, err := range errs {
+				// Pass the error up the error channel.
+				*errc <- NewPipelineError("Lighthouse", lh.Message, err)
+				// Don't break, the message is still useful to other processes.
+			}
+
+			// Send a copy of the job to the out channel, so that the worker can take the next job.
+			job := *lh
+			if !lh.send(lh.Out, &job) {
+				return false
+			}
+		}
+	}
+}
+
+// doAudits runs every Lighthouse audit of the message, unless the results are replayed from the cache.
+func (lh *Lighthouse) doAudits() []error {
+	var errs []error
+	for _, audit := range lh.registry().Audits(LighthouseAudit, lh.Message.Audits) {
+		if !lh.Cached() {
+			lh.current = audit
+			end := trackAudit("Lighthouse", audit.Type)
+			_, endSpan := lh.startSpan("lighthouse")
+			err := lh.Do()
+			endSpan(err)
+			end(err)
+
+			if err != nil {
+				errs = append(errs, withAudit(audit.Type, err))
+			}
+		}
+	}
+	return errs
+}
+
 // Do executes the process.
-func (lh *Lighthouse) Do() error {
+func (lh *Lighthouse) Do() (err error) {
 	log.Log(lh.Message.Title, "Running Lighthouse Audit...")
 
-	if lhRunner == nil {
-		lhRunner = defaultRunner
+	runner := lhRunner
+	if runner == nil {
+		runner = defaultRunner
 	}
 
 	var results *tide.LighthouseSummary
 
+	var exitCode int
+	var errorBytes []byte
+
+	// Types that Lighthouse runs for other types keep their own results.
+	key := LighthouseAudit
+	if audit := lh.audit(); audit != nil {
+		key = audit.ReportKey()
+	}
+
+	// Record the failed audit, so that the payload tells why there is no report.
+	defer func() {
+		if err != nil {
+			lh.failAudit(key, err, exitCode, errorBytes)
+		}
+	}()
+
 	// Note: This assumes the shell script `lh` is in $PATH and contains the following command:
 	// `lighthouse --quiet --chrome-flags="--headless --disable-gpu --no-sandbox" --output=json --output-path=stdout $@`
 	cmdName := "lh"
 	cmdArgs := []string{fmt.Sprintf("https://wp-themes.com/%s", lh.Message.Slug)}
 
+	ctx, cancel, timeout := lh.auditContext(lh.audit(), lh.Timeout)
+	defer cancel()
+
 	// Prepare the command and set the stdOut pipe.
-	resultBytes, errorBytes, _, err := lhRunner.Run(cmdName, cmdArgs...)
+	resultBytes, errorBytes, exitCode, err := shell.RunContext(ctx, runner, cmdName, cmdArgs...)
+
+	switch err {
+	case context.DeadlineExceeded:
+		return lh.Error(fmt.Sprintf("lighthouse timed out after %s", timeout))
+	case context.Canceled:
+		return lh.Error("lighthouse was cancelled")
+	}
 
 	if len(errorBytes) > 0 {
 		return lh.Error("lighthouse command failed: " + string(errorBytes))
@@ -112,7 +201,10 @@ func (lh *Lighthouse) Do() error {
 
 	// Upload and get full results.
 	log.Log(lh.Message.Title, "Uploading results to remote storage.")
-	rawResults, err := lh.uploadToStorage(resultBytes)
+	span, endSpan := lh.startSpan("upload")
+	span.SetAttribute("provider", lh.StorageProvider.Kind())
+	rawResults, err := lh.uploadToStorage(key, resultBytes)
+	endSpan(err)
 	if err != nil {
 		return err
 	}
@@ -126,7 +218,7 @@ func (lh *Lighthouse) Do() error {
 	}
 
 	result := *lh.Result
-	result["lighthouse"] = auditResult
+	result[key] = auditResult
 	lh.Result = &result
 
 	log.Log(lh.Message.Title, "Lighthouse process complete.")
@@ -134,7 +226,66 @@ func (lh *Lighthouse) Do() error {
 	return nil
 }
 
-func (lh Lighthouse) uploadToStorage(buffer []byte) (*tide.AuditResult, error) {
+// audit returns the audit that is running, or else the first Lighthouse audit of the message.
+func (lh Lighthouse) audit() *message.Audit {
+	if lh.current != nil {
+		return lh.current
+	}
+	if audits := lh.registry().Audits(LighthouseAudit, lh.Message.Audits); len(audits) > 0 {
+		return audits[0]
+	}
+	return nil
+}
+
+// registry returns the registry of the process, or DefaultRegistry.
+func (lh Lighthouse) registry() *Registry {
+	if lh.Registry != nil {
+		return lh.Registry
+	}
+	return DefaultRegistry
+}
+
+// Audit runs the Lighthouse audit of a job, so that Lighthouse can be used as an AuditProcessor.
+func (lh *Lighthouse) Audit(ctx context.Context, job *Job, audit *message.Audit) error {
+	result := job.Result()
+
+	lh.SetContext(ctx)
+	lh.SetMessage(job.Message)
+	lh.SetResults(&result)
+	lh.SetFilesPath(job.FilesPath)
+
+	// The results are replayed from the cache.
+	if lh.Cached() {
+		return nil
+	}
+
+	lh.current = audit
+	end := trackAudit("Lighthouse", audit.Type)
+	_, endSpan := lh.startSpan("lighthouse")
+	err := lh.Do()
+	endSpan(err)
+	end(err)
+
+	if res := lh.GetResult(); res != nil {
+		job.SetResult(*res)
+	}
+	return err
+}
+
+// AuditType returns the Lighthouse audit type, so that a Registry can route the audits of jobs to this process.
+// Every audit runs on its own copy of the process.
+func (lh *Lighthouse) AuditType() AuditType {
+	return AuditType{
+		Name: LighthouseAudit,
+		Factory: func() AuditProcessor {
+			audit := *lh
+			return &audit
+		},
+		Options: lighthouseOptions,
+	}
+}
+
+func (lh Lighthouse) uploadToStorage(key string, buffer []byte) (*tide.AuditResult, error) {
 
 	var results *tide.AuditResult
 
@@ -144,10 +295,16 @@ func (lh Lighthouse) uploadToStorage(buffer []byte) (*tide.AuditResult, error) {
 		return nil, errors.New("there was no checksum to be used for filenames")
 	}
 
-	storageRef := checksum + "-lighthouse-raw.json"
-	filename := strings.TrimRight(lh.TempFolder, "/") + "/" + storageRef
+	storageRef := checksum + "-" + key + "-raw.json"
+
+	// Keep reports with the temp files of the job so that they are removed with its workspace.
+	dir, err := lh.tempDir(lh.TempFolder)
+	if err != nil {
+		return nil, err
+	}
+	filename := dir + "/" + storageRef
 
-	err := writeFile(filename, buffer, 0644)
+	err = writeFile(filename, buffer, 0644)
 	if err != nil {
 		return nil, errors.New("could not write lighthouse audit to tempFolder")
 	}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,6 +14,7 @@ import (
 	"github.com/wptide/pkg/message"
 	"github.com/wptide/pkg/shell"
 	"github.com/wptide/pkg/storage"
+	"github.com/wptide/pkg/tide"
 )
 
 type mockRunner struct{}
@@ -455,3 +457,98 @@ func exampleLighthouseReport() string {
   ]
 }`
 }
+
+func TestLighthouse_Timeout(t *testing.T) {
+
+	b := bytes.Buffer{}
+	log.SetOutput(&b)
+	defer log.SetOutput(os.Stdout)
+
+	lhRunner = &mockHangingRunner{}
+	defer func() {
+		lhRunner = &shell.Command{}
+	}()
+
+	lh := &Lighthouse{
+		Process: Process{
+			Message: message.Message{
+				Title: "Timeout Test",
+				Slug:  "test",
+				Audits: []*message.Audit{
+					{
+						Type: "lighthouse",
+						Options: &message.AuditOption{
+							Timeout: 1,
+						},
+					},
+				},
+			},
+			Result: &Result{
+				"checksum": "timeout",
+			},
+		},
+		TempFolder:      "./testdata/tmp",
+		StorageProvider: &mockStorage{},
+		Timeout:         time.Hour,
+	}
+
+	err := lh.Do()
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Lighthouse.Do() error = %v, want timed out", err)
+	}
+
+	result := *lh.GetResult()
+	audited, ok := result["lighthouse"].(tide.AuditResult)
+	if !ok || !strings.HasSuffix(audited.Error, "lighthouse timed out after 1s") || audited.ExitCode != -1 {
+		t.Errorf("Lighthouse.Do() lighthouse = %v, want timed out error", result["lighthouse"])
+	}
+}
+
+func TestLighthouse_Audit(t *testing.T) {
+
+	b := bytes.Buffer{}
+	log.SetOutput(&b)
+	defer log.SetOutput(os.Stdout)
+
+	lhRunner = &mockHangingRunner{}
+	defer func() {
+		lhRunner = &shell.Command{}
+	}()
+
+	audit := &message.Audit{
+		Type: "lighthouse",
+		Options: &message.AuditOption{
+			Timeout: 1,
+		},
+	}
+	job := &Job{
+		Message: message.Message{
+			Title: "Audit Test",
+			Slug:  "test",
+			Audits: []*message.Audit{
+				{
+					Type: "lighthouse",
+					Options: &message.AuditOption{
+						Timeout: 5,
+					},
+				},
+				audit,
+			},
+		},
+		Results: Result{
+			"checksum": "audit",
+		},
+	}
+
+	lh := &Lighthouse{
+		TempFolder:      "./testdata/tmp",
+		StorageProvider: &mockStorage{},
+		Timeout:         time.Hour,
+	}
+
+	// The timeout of the audit applies, not the one of the first audit of the message.
+	err := lh.Audit(context.Background(), job, audit)
+	if err == nil || !strings.HasSuffix(err.Error(), "lighthouse timed out after 1s") {
+		t.Errorf("Lighthouse.Audit() error = %v, want timed out after 1s", err)
+	}
+}
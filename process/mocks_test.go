@@ -1,9 +1,14 @@
 package process
 
 import (
+	"context"
 	"errors"
 	"io"
 	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/wptide/pkg/message"
 )
 
 type mockStorage struct{}
@@ -48,3 +53,54 @@ func (m mockStorage) UploadFile(filename, reference string) error {
 func (m mockStorage) DownloadFile(reference, filename string) error {
 	return nil
 }
+
+type mockResultCache struct {
+	results map[string][]byte
+}
+
+func (m mockResultCache) GetResults(checksum, config string) ([]byte, bool, error) {
+	results, ok := m.results[checksum+"-"+config]
+	return results, ok, nil
+}
+
+func (m mockResultCache) SetResults(checksum, config string, results []byte) error {
+	m.results[checksum+"-"+config] = results
+	return nil
+}
+
+// mockSlowPayloader takes a while to send payloads and counts how many it sends at the same time.
+type mockSlowPayloader struct {
+	running int32
+	max     int32
+}
+
+func (m *mockSlowPayloader) BuildPayload(msg message.Message, data map[string]interface{}) ([]byte, error) {
+	return []byte(msg.Title), nil
+}
+
+func (m *mockSlowPayloader) SendPayload(destination string, payload []byte) ([]byte, error) {
+	running := atomic.AddInt32(&m.running, 1)
+	defer atomic.AddInt32(&m.running, -1)
+
+	for {
+		max := atomic.LoadInt32(&m.max)
+		if running <= max || atomic.CompareAndSwapInt32(&m.max, max, running) {
+			break
+		}
+	}
+
+	time.Sleep(time.Millisecond * 50)
+	return payload, nil
+}
+
+// mockHangingRunner runs commands that never finish on their own.
+type mockHangingRunner struct{}
+
+func (m mockHangingRunner) Run(name string, arg ...string) ([]byte, []byte, int, error) {
+	return m.RunContext(context.Background(), name, arg...)
+}
+
+func (m mockHangingRunner) RunContext(ctx context.Context, name string, arg ...string) ([]byte, []byte, int, error) {
+	<-ctx.Done()
+	return nil, nil, -1, ctx.Err()
+}
@@ -1,6 +1,7 @@
 package process
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,7 +9,9 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/wptide/pkg/health"
 	"github.com/wptide/pkg/log"
 	"github.com/wptide/pkg/message"
 	"github.com/wptide/pkg/process/phpcs"
@@ -17,8 +20,27 @@ import (
 	"github.com/wptide/pkg/tide"
 )
 
+// PhpcsAudit is the type of PHPCS audits in messages.
+const PhpcsAudit = "phpcs"
+
 var (
 	phpcsRunner shell.Runner
+
+	// Options that PHPCS audits take.
+	phpcsOptions = []Option{
+		{Name: "standard", Required: true},
+		{Name: "report"},
+		{Name: "encoding"},
+		{Name: "runtime-set"},
+		{Name: "ignore"},
+		{Name: "standard-override"},
+		{Name: "timeout"},
+	}
+
+	// Only PHPCompatibility provides parsed results.
+	phpcsPostProcessors = []PostProcessor{
+		{Standard: "phpcompatibility", Process: phpcompatibilityReport},
+	}
 )
 
 // Phpcs defines the structure for our Phpcs process.
@@ -30,6 +52,9 @@ type Phpcs struct {
 	TempFolder      string                       // Path to a temp folder where reports will be generated.
 	StorageProvider storage.Provider             // Storage provider to upload reports to.
 	PhpcsVersions   map[string]map[string]string // PHPCS versions.
+	Workers         int                          // (Optional) Number of jobs processed at the same time. Defaults to 1.
+	Timeout         time.Duration                // (Optional) Time before an audit is stopped. Audits in the message can only lower it.
+	Registry        *Registry                    // (Optional) Audit types that the process runs, with the post-processors of the audits. Defaults to DefaultRegistry.
 }
 
 // Run executes the process in a pipe.
@@ -54,47 +79,99 @@ func (cs *Phpcs) Run(errc *chan error) error {
 		return errors.New("requires a map of PHPCS versions")
 	}
 
-	go func() {
-		for {
-			select {
-			case in := <-cs.In:
-
-				// Copy Process fields from `in` process.
-				cs.CopyFields(in)
-
-				result := *cs.Result
-
-				// Run the process.
-				// If processing produces an error send it up the error channel.
-				for _, audit := range cs.Message.Audits {
-					if audit.Type == "phpcs" {
-						result["phpcsCurrentAudit"] = audit
-						cs.SetResults(&result)
-						if err := cs.Do(); err != nil {
-							// Pass the error up the error channel.
-							*errc <- errors.New("PHPCS Error: " + err.Error())
-							// Don't break, the message is still useful to other processes.
-						}
-					}
-				}
-
-				// Send process to the out channel.
-				cs.Out <- cs
+	cs.start()
+
+	// Every worker works on its own copy of the process.
+	cs.spawn("PHPCS", cs.Workers, closer(cs.Out), func(w *health.Worker) bool {
+		worker := *cs
+		worker.health = w
+		return worker.work(errc)
+	})
+
+	return nil
+}
+
+// work takes jobs until the previous process stops or the context is cancelled.
+// It returns true if the previous process stopped.
+func (cs *Phpcs) work(errc *chan error) bool {
+	for {
+		// Waiting for the next job is not a stall.
+		cs.health.Idle()
+
+		select {
+		case <-cs.done():
+			return false
+		case in, ok := <-cs.In:
+			// The previous process stopped.
+			if !ok {
+				return true
+			}
+			cs.health.Busy()
+
+			// Copy Process fields from `in` process.
+			cs.CopyFields(in)
+
+			// Run the process.
+			// If processing produces an error send it up the error channel.
+			end := track("PHPCS")
+			errs := cs.doAudits()
+			end(combineErrors(errs))
+
+			for _, err := range errs {
+				// Pass the error up the error channel.
+				*errc <- NewPipelineError("PHPCS", cs.Message, err)
+				// Don't break, the message is still useful to other processes.
+			}
+
+			// Send a copy of the job to the out channel, so that the worker can take the next job.
+			job := *cs
+			if !cs.send(cs.Out, &job) {
+				return false
 			}
 		}
+	}
+}
 
-	}()
+// doAudits runs every PHPCS audit of the message, unless the results are replayed from the cache.
+func (cs *Phpcs) doAudits() []error {
+	result := *cs.Result
 
-	return nil
+	var errs []error
+	for _, audit := range cs.registry().Audits(PhpcsAudit, cs.Message.Audits) {
+		if !cs.Cached() {
+			result["phpcsCurrentAudit"] = audit
+			cs.SetResults(&result)
+
+			end := trackAudit("PHPCS", audit.Type)
+			endSpan := cs.startAuditSpan(audit)
+			err := cs.Do()
+			endSpan(err)
+			end(err)
+
+			if err != nil {
+				errs = append(errs, withAudit(audit.Type, err))
+			}
+		}
+	}
+	return errs
+}
+
+// registry returns the registry of the process, or DefaultRegistry.
+func (cs Phpcs) registry() *Registry {
+	if cs.Registry != nil {
+		return cs.Registry
+	}
+	return DefaultRegistry
 }
 
 // Do executes the process.
-func (cs *Phpcs) Do() error {
+func (cs *Phpcs) Do() (err error) {
 
 	log.Log(cs.Message.Title, "Running PHPCS Audit...")
 
-	if phpcsRunner == nil {
-		phpcsRunner = defaultRunner
+	runner := phpcsRunner
+	if runner == nil {
+		runner = defaultRunner
 	}
 
 	result := *cs.Result
@@ -102,6 +179,17 @@ func (cs *Phpcs) Do() error {
 	// Get the current audit from the result.
 	audit := result["phpcsCurrentAudit"].(*message.Audit)
 
+	var exitCode int
+	var errorBytes []byte
+
+	// Record the failed audit, so that the payload tells why there is no report.
+	defer func() {
+		if err != nil {
+			result["phpcsCurrentAudit"] = nil
+			cs.failAudit(audit.ReportKey(), err, exitCode, errorBytes)
+		}
+	}()
+
 	// Try to get filesPath from results first.
 	if path, ok := result["filesPath"].(string); ok {
 		cs.SetFilesPath(path)
@@ -109,12 +197,12 @@ func (cs *Phpcs) Do() error {
 
 	standard := audit.Options.Standard
 	if standard == "" {
-		return errors.New("could not determine standard for report")
+		return Permanent(errors.New("could not determine standard for report"))
 	}
 
 	phpcsVersions, ok := cs.PhpcsVersions[standard]
 	if !ok {
-		return errors.New("could not determine PHPCS versions")
+		return Permanent(errors.New("could not determine PHPCS versions"))
 	}
 
 	checksum, ok := result["checksum"].(string)
@@ -127,11 +215,17 @@ func (cs *Phpcs) Do() error {
 		return errors.New("could not determine files path")
 	}
 
-	path := cs.GetFilesPath() + "/unzipped"
+	path := cs.GetCodePath()
 
 	kind := strings.ToLower(audit.Type) + "_" + strings.ToLower(standard)
 	filename := checksum + "-" + kind + "-raw.json"
-	pathPrefix := strings.TrimRight(cs.TempFolder, "/") + "/"
+
+	// Keep reports with the temp files of the job so that they are removed with its workspace.
+	dir, err := cs.tempDir(cs.TempFolder)
+	if err != nil {
+		return err
+	}
+	pathPrefix := dir + "/"
 	filepath := pathPrefix + filename
 
 	// Provide in implementation, not from message.
@@ -178,8 +272,18 @@ func (cs *Phpcs) Do() error {
 	cmdArgs = append(cmdArgs, path)
 	cmdArgs = append(cmdArgs, "-q")
 
+	ctx, cancel, timeout := cs.auditContext(audit, cs.Timeout)
+	defer cancel()
+
 	// Prepare the command and set the stdOut pipe.
-	resultBytes, errorBytes, exitCode, err := phpcsRunner.Run(cmdName, cmdArgs...)
+	resultBytes, errorBytes, exitCode, err := shell.RunContext(ctx, runner, cmdName, cmdArgs...)
+
+	switch err {
+	case context.DeadlineExceeded:
+		return fmt.Errorf("phpcs (%s) timed out after %s", standard, timeout)
+	case context.Canceled:
+		return fmt.Errorf("phpcs (%s) was cancelled", standard)
+	}
 
 	if len(errorBytes) > 0 {
 		log.Log(cs.Message.Title, fmt.Sprintf("phpcs error:\n %s", strings.TrimSpace(string(errorBytes))))
@@ -189,7 +293,10 @@ func (cs *Phpcs) Do() error {
 	// We already have a reference to the report file, so lets upload and get the storage reference in a result.
 	log.Log(cs.Message.Title, "Uploading "+standard+" results to remote storage.")
 
+	span, endSpan := cs.startSpan("upload")
+	span.SetAttribute("provider", cs.StorageProvider.Kind())
 	fType, fFileName, fPath, err := cs.uploadToStorage(filepath, filename)
+	endSpan(err)
 	if err != nil {
 		return err
 	}
@@ -208,10 +315,10 @@ func (cs *Phpcs) Do() error {
 	fileReader, _ := fileOpen(filepath)
 	defer fileReader.Close()
 
-	report, _ := ioutil.ReadAll(fileReader)
+	raw, _ := ioutil.ReadAll(fileReader)
 
 	var phpcsResults *tide.PhpcsResults
-	err = json.Unmarshal(report, &phpcsResults)
+	err = json.Unmarshal(raw, &phpcsResults)
 	if err != nil {
 		return err
 	}
@@ -220,34 +327,22 @@ func (cs *Phpcs) Do() error {
 	summary := phpcs.GetPhpcsSummary(*phpcsResults)
 	auditResults.Summary = tide.AuditSummary{PhpcsSummary: summary}
 
-	// Only PHPCompatibility provides parsed results.
-	// @todo Abstract this later.
-	if kind == "phpcs_phpcompatibility" {
-		compatibleVersions, incompatibleVersions, compatResults := phpcs.GetPhpcsCompatibility(*phpcsResults)
-
-		resultsJSON, _ := json.Marshal(compatResults)
-
-		fname := checksum + "-" + kind + "-parsed.json"
-		fpath := pathPrefix + fname
-
-		err = writeFile(fpath, resultsJSON, os.ModePerm)
-		if err != nil {
-			return err
-		}
-
-		fType, fFileName, fPath, err := cs.uploadToStorage(fpath, fname)
-		if err != nil {
+	// Let the post-processors of the standard work on the report.
+	registry := cs.registry()
+
+	report := &Report{
+		Audit:    audit,
+		Key:      kind,
+		Checksum: checksum,
+		Dir:      strings.TrimSuffix(pathPrefix, "/"),
+		Raw:      raw,
+		Storage:  cs.StorageProvider,
+		Result:   &auditResults,
+	}
+	for _, post := range registry.PostProcessors(audit) {
+		if err := post.Process(report); err != nil {
 			return err
 		}
-
-		auditResults.Parsed = tide.AuditDetails{
-			Type:     fType,
-			FileName: fFileName,
-			Path:     fPath,
-		}
-
-		auditResults.CompatibleVersions = compatibleVersions
-		auditResults.IncompatibleVersions = incompatibleVersions
 	}
 
 	// Reset current audit.
@@ -261,14 +356,102 @@ func (cs *Phpcs) Do() error {
 	return nil
 }
 
+// Audit runs a single PHPCS audit of a job, so that Phpcs can be used as an AuditProcessor.
+func (cs *Phpcs) Audit(ctx context.Context, job *Job, audit *message.Audit) error {
+	result := job.Result()
+	result["phpcsCurrentAudit"] = audit
+
+	cs.SetContext(ctx)
+	cs.SetMessage(job.Message)
+	cs.SetResults(&result)
+	cs.SetFilesPath(job.FilesPath)
+
+	// The results are replayed from the cache.
+	if cs.Cached() {
+		return nil
+	}
+
+	end := trackAudit("PHPCS", audit.Type)
+	endSpan := cs.startAuditSpan(audit)
+	err := cs.Do()
+	endSpan(err)
+	end(err)
+
+	if res := cs.GetResult(); res != nil {
+		job.SetResult(*res)
+	}
+	return err
+}
+
+// AuditType returns the PHPCS audit type, so that a Registry can route the audits of jobs to this process.
+// Every audit runs on its own copy of the process.
+func (cs *Phpcs) AuditType() AuditType {
+	return AuditType{
+		Name: PhpcsAudit,
+		Factory: func() AuditProcessor {
+			audit := *cs
+			return &audit
+		},
+		Options:        phpcsOptions,
+		PostProcessors: phpcsPostProcessors,
+	}
+}
+
+// startAuditSpan starts the span of a PHPCS audit, so that every standard has its own span.
+func (cs *Phpcs) startAuditSpan(audit *message.Audit) func(err error) {
+	span, end := cs.startSpan("phpcs")
+	if audit.Options != nil {
+		span.SetAttribute("standard", audit.Options.Standard)
+	}
+	return end
+}
+
 func (cs Phpcs) uploadToStorage(filepath, filename string) (fType, fFileName, fPath string, err error) {
-	err = cs.StorageProvider.UploadFile(filepath, filename)
+	details, err := uploadReport(cs.StorageProvider, filepath, filename)
+	return details.Type, details.FileName, details.Path, err
+}
+
+// uploadReport uploads a report file to storage.
+func uploadReport(provider storage.Provider, filepath, filename string) (tide.AuditDetails, error) {
+	if err := provider.UploadFile(filepath, filename); err != nil {
+		return tide.AuditDetails{}, err
+	}
 
-	if err == nil {
-		fType = cs.StorageProvider.Kind()
-		fFileName = filename
-		fPath = cs.StorageProvider.CollectionRef()
+	return tide.AuditDetails{
+		Type:     provider.Kind(),
+		FileName: filename,
+		Path:     provider.CollectionRef(),
+	}, nil
+}
+
+// phpcompatibilityReport adds the PHP versions that the code is compatible with to the results of
+// a PHPCompatibility audit, and uploads the parsed report.
+func phpcompatibilityReport(r *Report) error {
+	var phpcsResults *tide.PhpcsResults
+	if err := json.Unmarshal(r.Raw, &phpcsResults); err != nil {
+		return err
 	}
 
-	return fType, fFileName, fPath, err
+	compatibleVersions, incompatibleVersions, compatResults := phpcs.GetPhpcsCompatibility(*phpcsResults)
+
+	resultsJSON, _ := json.Marshal(compatResults)
+
+	fname := r.Checksum + "-" + r.Key + "-parsed.json"
+	fpath := r.Dir + "/" + fname
+
+	err := writeFile(fpath, resultsJSON, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := uploadReport(r.Storage, fpath, fname)
+	if err != nil {
+		return err
+	}
+
+	r.Result.Parsed = parsed
+	r.Result.CompatibleVersions = compatibleVersions
+	r.Result.IncompatibleVersions = incompatibleVersions
+
+	return nil
 }
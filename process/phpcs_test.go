@@ -6,6 +6,7 @@ import (
 	"errors"
 	"io/ioutil"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -14,6 +15,7 @@ import (
 	"github.com/wptide/pkg/message"
 	"github.com/wptide/pkg/shell"
 	"github.com/wptide/pkg/storage"
+	"github.com/wptide/pkg/tide"
 )
 
 type mockPhpcsRunner struct{}
@@ -802,3 +804,109 @@ func examplePhpcsPhpCompatibilityReport() string {
 	return `{"totals":{"errors":4,"warnings":0,"fixable":0},"files":{"phpcompat\/compatissues.php":{"errors":4,"warnings":0,"messages":[{"message":"\"namespace\" keyword is not present in PHP version 5.2 or earlier","source":"PHPCompatibility.PHP.NewKeywords.t_namespaceFound","severity":5,"type":"ERROR","line":3,"column":1,"fixable":false},{"message":"\"trait\" keyword is not present in PHP version 5.3 or earlier","source":"PHPCompatibility.PHP.NewKeywords.t_traitFound","severity":5,"type":"ERROR","line":8,"column":1,"fixable":false},{"message":"Short array syntax (open) is available since 5.4","source":"PHPCompatibility.PHP.ShortArray.Found","severity":5,"type":"ERROR","line":9,"column":9,"fixable":false},{"message":"Short array syntax (close) is available since 5.4","source":"PHPCompatibility.PHP.ShortArray.Found","severity":5,"type":"ERROR","line":9,"column":10,"fixable":false}]},"dummy-plugin.php":{"errors":0,"warnings":0,"messages":[]}}}
 `
 }
+
+func TestPhpcs_Timeout(t *testing.T) {
+
+	b := bytes.Buffer{}
+	log.SetOutput(&b)
+	defer log.SetOutput(os.Stdout)
+
+	phpcsRunner = &mockHangingRunner{}
+	defer func() {
+		phpcsRunner = &shell.Command{}
+	}()
+
+	audit := &message.Audit{
+		Type: "phpcs",
+		Options: &message.AuditOption{
+			Standard: "wordpress",
+		},
+	}
+
+	cs := &Phpcs{
+		Process: Process{
+			Message: message.Message{
+				Title:  "Timeout Test",
+				Audits: []*message.Audit{audit},
+			},
+			Result: &Result{
+				"checksum":          "timeout",
+				"phpcsCurrentAudit": audit,
+			},
+			FilesPath: "./testdata/info/plugin",
+		},
+		TempFolder:      "./testdata/tmp",
+		StorageProvider: &mockStorage{},
+		PhpcsVersions: map[string]map[string]string{
+			"wordpress": {},
+		},
+		Timeout: time.Millisecond * 50,
+	}
+
+	err := cs.Do()
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Phpcs.Do() error = %v, want timed out", err)
+	}
+
+	result := *cs.GetResult()
+	audited, ok := result["phpcs_wordpress"].(tide.AuditResult)
+	if !ok || !strings.Contains(audited.Error, "timed out after 50ms") {
+		t.Errorf("Phpcs.Do() phpcs_wordpress = %v, want timed out error", result["phpcs_wordpress"])
+	}
+}
+
+func TestPhpcs_Failed(t *testing.T) {
+
+	b := bytes.Buffer{}
+	log.SetOutput(&b)
+	defer log.SetOutput(os.Stdout)
+
+	phpcsRunner = &mockPhpcsRunner{}
+	defer func() {
+		phpcsRunner = &shell.Command{}
+	}()
+
+	audit := &message.Audit{
+		Type: "phpcs",
+		Options: &message.AuditOption{
+			Standard: "phpcompatibility",
+		},
+	}
+
+	cs := &Phpcs{
+		Process: Process{
+			Message: message.Message{
+				Title:  "phpcompat internal error",
+				Audits: []*message.Audit{audit},
+			},
+			Result: &Result{
+				"checksum":          "phpcompatinternalerror",
+				"phpcsCurrentAudit": audit,
+			},
+			FilesPath: "./testdata/info/phpcompatinternalerror",
+		},
+		TempFolder:      "./testdata/tmp",
+		StorageProvider: &mockStorage{},
+		PhpcsVersions: map[string]map[string]string{
+			"phpcompatibility": {},
+		},
+	}
+
+	err := cs.Do()
+	if err == nil {
+		t.Fatalf("Phpcs.Do() error = nil, want error")
+	}
+
+	result := *cs.GetResult()
+	want := tide.AuditResult{
+		Error:    err.Error(),
+		ExitCode: 255,
+		Stderr:   "some sort or trace error",
+	}
+	if audited, ok := result["phpcs_phpcompatibility"].(tide.AuditResult); !ok || !reflect.DeepEqual(audited, want) {
+		t.Errorf("Phpcs.Do() phpcs_phpcompatibility = %v, want %v", result["phpcs_phpcompatibility"], want)
+	}
+	if result["phpcsCurrentAudit"] != nil {
+		t.Errorf("Phpcs.Do() did not reset the current audit")
+	}
+}
@@ -8,8 +8,20 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
+	"github.com/wptide/pkg/health"
+	"github.com/wptide/pkg/log"
 	"github.com/wptide/pkg/message"
+	"github.com/wptide/pkg/metrics"
+	"github.com/wptide/pkg/tide"
+	"github.com/wptide/pkg/trace"
+	"github.com/wptide/pkg/workspace"
 )
 
 var (
@@ -23,15 +35,23 @@ var (
 	fileOpen = os.Open
 )
 
+// maxStderr is the most error output of a failed audit command that is kept in the results.
+const maxStderr = 1024
+
 // Result is an interface map of the processed results.
 type Result map[string]interface{}
 
 // Process is the base for all processes.
 type Process struct {
 	context   context.Context
-	Message   message.Message // Keeps track of the original message.
-	Result    *Result         // Passes along a Result object.
-	FilesPath string          // Path of files to audit.
+	Message   message.Message  // Keeps track of the original message.
+	Result    *Result          // Passes along a Result object.
+	FilesPath string           // Path of files to audit.
+	stopped   chan struct{}    // Closed once the goroutine of the process exited.
+	completer Completer        // Told how the jobs ended.
+	span      *trace.Span      // Current trace span of the job.
+	health    *health.Worker   // Reports the heartbeats of the worker.
+	registry  *health.Registry // Registry the workers report into, nil reports nothing.
 }
 
 // Run is a default implementation with an error nag. Not required, but serves as an example.
@@ -45,6 +65,173 @@ func (p *Process) SetContext(ctx context.Context) {
 	p.context = ctx
 }
 
+// SetHealth sets the registry that the workers of the process report into. It has to be set before
+// the process runs.
+func (p *Process) SetHealth(r *health.Registry) {
+	p.registry = r
+}
+
+// Stopped returns a channel that is closed once the process stopped running.
+func (p *Process) Stopped() <-chan struct{} {
+	return p.stopped
+}
+
+// start marks the process as running, call finish once the goroutine of the process exits.
+func (p *Process) start() {
+	p.stopped = make(chan struct{})
+}
+
+// finish marks the process as stopped.
+func (p *Process) finish() {
+	close(p.stopped)
+}
+
+// spawn starts n workers that each run work until it returns. work returns true if it stopped
+// because the previous process stopped, once all workers did drained is called so that the
+// next process can stop too. The process is marked as stopped when every worker returned.
+// Every worker reports its heartbeats to the health component with the name in the registry of the process.
+func (p *Process) spawn(name string, n int, drained func(), work func(w *health.Worker) bool) {
+	if n < 1 {
+		n = 1
+	}
+
+	var wg sync.WaitGroup
+	var count int32
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		w := p.registry.Component(name).Worker()
+		go func() {
+			defer wg.Done()
+			defer w.Stop()
+			if work(w) {
+				atomic.AddInt32(&count, 1)
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		if int(atomic.LoadInt32(&count)) == n && drained != nil {
+			drained()
+		}
+		p.finish()
+	}()
+}
+
+// track starts timing a job of a stage. The returned function records how the job ended.
+func track(stage string) func(err error) {
+	return trackLabels(metrics.StageJobs, metrics.Labels{"stage": stage})
+}
+
+// trackAudit starts timing an audit of a job. The returned function records how the audit ended.
+func trackAudit(stage, audit string) func(err error) {
+	return trackLabels(metrics.Audits, metrics.Labels{"stage": stage, "audit": audit})
+}
+
+func trackLabels(name string, labels metrics.Labels) func(err error) {
+	start := time.Now()
+	return func(err error) {
+		metrics.Record(name, labels, outcome(err), time.Since(start))
+	}
+}
+
+// outcome returns how a job or audit ended, for metrics.
+func outcome(err error) string {
+	switch {
+	case err == nil:
+		return metrics.Success
+	case IsPermanent(err):
+		return metrics.Permanent
+	}
+	return metrics.Retryable
+}
+
+// closer returns a function that closes the out channel, or nil if there is none.
+func closer(out chan Processor) func() {
+	if out == nil {
+		return nil
+	}
+	return func() {
+		close(out)
+	}
+}
+
+// done returns a channel that is closed when the context of the process is cancelled.
+func (p Process) done() <-chan struct{} {
+	if p.context == nil {
+		return nil
+	}
+	return p.context.Done()
+}
+
+// auditContext returns the context for running an audit and the timeout of the audit.
+// The timeout of the audit in the message can only lower the timeout of the process, so that
+// messages can't keep workers busy for longer than the pipeline allows.
+// Without a timeout the audit only stops once the process is cancelled.
+func (p Process) auditContext(audit *message.Audit, timeout time.Duration) (context.Context, context.CancelFunc, time.Duration) {
+	ctx := p.context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if audit != nil && audit.Options != nil && audit.Options.Timeout > 0 {
+		if t := time.Duration(audit.Options.Timeout) * time.Second; timeout <= 0 || t < timeout {
+			timeout = t
+		}
+	}
+
+	if timeout <= 0 {
+		ctx, cancel := context.WithCancel(ctx)
+		return ctx, cancel, 0
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, cancel, timeout
+}
+
+// failAudit records a failed audit in the results under its report key, so that the payload
+// tells why there is no report for the audit.
+func (p *Process) failAudit(key string, err error, exitCode int, stderr []byte) {
+	result := Result{}
+	if p.Result != nil {
+		result = *p.Result
+	}
+
+	// Keep the end of the error output, that's where commands tell why they failed.
+	excerpt := strings.TrimSpace(string(stderr))
+	if len(excerpt) > maxStderr {
+		start := len(excerpt) - maxStderr
+		for start < len(excerpt) && !utf8.RuneStart(excerpt[start]) {
+			start++
+		}
+		excerpt = "..." + excerpt[start:]
+	}
+
+	result[key] = tide.AuditResult{
+		Error:    err.Error(),
+		ExitCode: exitCode,
+		Stderr:   excerpt,
+	}
+	p.Result = &result
+}
+
+// send passes a job to the next process. It returns false if the context was cancelled first,
+// in which case the job is dropped. The worker stays busy until the next process took the job,
+// so that a worker blocked on a next process that stopped taking jobs stalls.
+func (p Process) send(out chan Processor, proc Processor) bool {
+	select {
+	case out <- proc:
+		return true
+	case <-p.done():
+		job := Process{Message: proc.GetMessage(), Result: proc.GetResult()}
+		job.CloseWorkspace(true)
+		log.Log(job.Message.Title, "Job cancelled.")
+		p.complete(job.Message, job.Result, errors.New("job cancelled"))
+		return false
+	}
+}
+
 // Error returns a new process error.
 func (p Process) Error(msg string) error {
 	return errors.New(p.Message.Title + ": " + msg)
@@ -80,6 +267,63 @@ func (p Process) GetFilesPath() string {
 	return p.FilesPath
 }
 
+// GetCodePath returns the path of the code to audit. This is the extracted source,
+// or a single project in it if the source contains several projects.
+func (p Process) GetCodePath() string {
+	if p.Result != nil {
+		if path, ok := (*p.Result)["codePath"].(string); ok && path != "" {
+			return path
+		}
+	}
+	return p.GetFilesPath() + "/unzipped"
+}
+
+// Cached returns true if the results were replayed from a result cache and the audits can be skipped.
+func (p Process) Cached() bool {
+	if p.Result == nil {
+		return false
+	}
+	cached, _ := (*p.Result)["cachedResults"].(bool)
+	return cached
+}
+
+// GetWorkspace returns the workspace of the job, or nil if it has none.
+func (p Process) GetWorkspace() *workspace.Workspace {
+	if p.Result == nil {
+		return nil
+	}
+	ws, _ := (*p.Result)["workspace"].(*workspace.Workspace)
+	return ws
+}
+
+// CloseWorkspace removes the workspace of the job once it is finished or failed.
+func (p Process) CloseWorkspace(failed bool) {
+	if ws := p.GetWorkspace(); ws != nil {
+		if err := ws.Close(failed); err != nil {
+			log.Log(p.Message.Title, "Could not remove workspace: "+err.Error())
+		}
+	}
+}
+
+// tempDir returns the folder for the temp files of the job in the temp folder of a process.
+// Jobs with a workspace get their own folder, which is removed with the workspace.
+func (p Process) tempDir(tempFolder string) (string, error) {
+	tempFolder = strings.TrimRight(tempFolder, "/")
+
+	ws := p.GetWorkspace()
+	if ws == nil {
+		return tempFolder, nil
+	}
+
+	dir := filepath.Join(tempFolder, ws.ID)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+	ws.Track(dir)
+
+	return dir, nil
+}
+
 // CopyFields copies required fields from one process to another.
 func (p *Process) CopyFields(proc Processor) {
 	p.SetMessage(proc.GetMessage())
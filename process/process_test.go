@@ -1,11 +1,20 @@
 package process
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/wptide/pkg/log"
 	"github.com/wptide/pkg/message"
+	"github.com/wptide/pkg/payload"
+	"github.com/wptide/pkg/tide"
+	"github.com/wptide/pkg/workspace"
 )
 
 func generateProcs(ctx context.Context, procs []Processor) <-chan Processor {
@@ -58,3 +67,414 @@ func TestProcess_Run(t *testing.T) {
 		})
 	}
 }
+
+func TestProcess_CloseWorkspace(t *testing.T) {
+
+	defer os.RemoveAll("./testdata/workspaces")
+
+	ws, _ := workspace.NewManager("./testdata/workspaces", workspace.KeepFailed).Create()
+
+	tests := []struct {
+		name     string
+		result   *Result
+		failed   bool
+		wantKept bool
+	}{
+		{
+			"No Result",
+			nil,
+			false,
+			false,
+		},
+		{
+			"No Workspace",
+			&Result{},
+			false,
+			false,
+		},
+		{
+			"Failed Job",
+			&Result{
+				"workspace": ws,
+			},
+			true,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Process{
+				Result: tt.result,
+			}
+
+			p.CloseWorkspace(tt.failed)
+
+			if got := p.GetWorkspace() != nil; got != tt.wantKept {
+				t.Errorf("Process.GetWorkspace() = %v, want workspace %v", p.GetWorkspace(), tt.wantKept)
+				return
+			}
+
+			if tt.wantKept {
+				if _, err := os.Stat(ws.Path); err != nil {
+					t.Errorf("Process.CloseWorkspace() removed failed workspace %v", ws.Path)
+				}
+			}
+		})
+	}
+}
+
+func TestProcess_tempDir(t *testing.T) {
+
+	defer os.RemoveAll("./testdata/workspaces")
+	defer os.RemoveAll("./testdata/reports")
+
+	manager := workspace.NewManager("./testdata/workspaces", workspace.KeepNone)
+
+	tests := []struct {
+		name        string
+		workspace   bool
+		tempFolder  string
+		wantTracked bool
+	}{
+		{
+			"No Workspace",
+			false,
+			"./testdata/reports/",
+			false,
+		},
+		{
+			"Other Temp Folder",
+			true,
+			"./testdata/reports",
+			true,
+		},
+		{
+			"Workspace Temp Folder",
+			true,
+			"./testdata/workspaces",
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Process{
+				Result: &Result{},
+			}
+
+			var ws *workspace.Workspace
+			if tt.workspace {
+				ws, _ = manager.Create()
+				(*p.Result)["workspace"] = ws
+			}
+
+			dir, err := p.tempDir(tt.tempFolder)
+			if err != nil {
+				t.Errorf("Process.tempDir() error = %v", err)
+				return
+			}
+
+			if ws == nil {
+				if dir != "./testdata/reports" {
+					t.Errorf("Process.tempDir() = %v, want %v", dir, "./testdata/reports")
+				}
+				return
+			}
+
+			if tracked := len(ws.Files()) == 1; tracked != tt.wantTracked {
+				t.Errorf("Process.tempDir() tracked = %v, want %v", ws.Files(), tt.wantTracked)
+			}
+
+			// The folder of the job is removed with its workspace.
+			p.CloseWorkspace(false)
+			if _, err := os.Stat(dir); !os.IsNotExist(err) {
+				t.Errorf("Process.CloseWorkspace() did not remove %v", dir)
+			}
+		})
+	}
+}
+
+func TestProcess_Drain(t *testing.T) {
+
+	in := make(chan Processor, 1)
+	in <- &Ingest{
+		Process: Process{
+			Message:   message.Message{Title: "Test Plugin"},
+			FilesPath: "./testdata/info/plugin",
+			Result:    &Result{},
+		},
+	}
+
+	// The previous process stopped after sending the last job.
+	close(in)
+
+	info := &Info{
+		In:  in,
+		Out: make(chan Processor),
+	}
+
+	errc := make(chan error, 1)
+	if err := info.Run(&errc); err != nil {
+		t.Errorf("Info.Run() error = %v", err)
+		return
+	}
+
+	// The job that was already taken is finished.
+	select {
+	case proc, ok := <-info.Out:
+		if !ok || proc.GetMessage().Title != "Test Plugin" {
+			t.Errorf("Info.Run() sent %v, want job", proc)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Info.Run() did not finish job")
+		return
+	}
+
+	// Then the next process is told to stop.
+	if _, ok := <-info.Out; ok {
+		t.Errorf("Info.Run() did not close the out channel")
+	}
+
+	select {
+	case <-info.Stopped():
+	case <-time.After(time.Second):
+		t.Errorf("Info.Stopped() not closed")
+	}
+}
+
+func TestProcess_Cancel(t *testing.T) {
+
+	defer os.RemoveAll("./testdata/workspaces")
+
+	ws, _ := workspace.NewManager("./testdata/workspaces", workspace.KeepNone).Create()
+
+	in := make(chan Processor, 1)
+	in <- &Ingest{
+		Process: Process{
+			Message:   message.Message{Title: "Test Plugin"},
+			FilesPath: "./testdata/info/plugin",
+			Result: &Result{
+				"workspace": ws,
+			},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Nobody reads the out channel, so the job can't be passed on.
+	info := &Info{
+		In:  in,
+		Out: make(chan Processor),
+	}
+	info.SetContext(ctx)
+
+	errc := make(chan error, 1)
+	if err := info.Run(&errc); err != nil {
+		t.Errorf("Info.Run() error = %v", err)
+		return
+	}
+
+	time.Sleep(time.Millisecond * 100)
+	cancel()
+
+	select {
+	case <-info.Stopped():
+	case <-time.After(time.Second):
+		t.Errorf("Info.Stopped() not closed after cancel")
+		return
+	}
+
+	// The dropped job is cleaned up.
+	if _, err := os.Stat(ws.Path); !os.IsNotExist(err) {
+		t.Errorf("Info.Run() did not remove workspace of cancelled job")
+	}
+}
+
+func TestProcess_Workers(t *testing.T) {
+
+	b := bytes.Buffer{}
+	log.SetOutput(&b)
+	defer log.SetOutput(os.Stdout)
+
+	titles := []string{"One", "Two", "Three", "Four", "Five", "Six", "Seven", "Eight"}
+
+	in := make(chan Processor, len(titles))
+	for _, title := range titles {
+		in <- &Ingest{
+			Process: Process{
+				Message: message.Message{Title: title},
+				Result:  &Result{},
+			},
+		}
+	}
+	close(in)
+
+	payloader := &mockSlowPayloader{}
+	res := &Response{
+		In:  in,
+		Out: make(chan Processor, len(titles)),
+		Payloaders: map[string]payload.Payloader{
+			"tide": payloader,
+		},
+		Workers: 4,
+	}
+
+	errc := make(chan error, len(titles))
+	if err := res.Run(&errc); err != nil {
+		t.Errorf("Response.Run() error = %v", err)
+		return
+	}
+
+	// Every job keeps its own message and results.
+	got := make(map[string]bool)
+	for proc := range res.Out {
+		title := proc.GetMessage().Title
+		if response := (*proc.GetResult())["response"]; response != title {
+			t.Errorf("Response.Run() job %v got response %v", title, response)
+		}
+		got[title] = true
+	}
+	if len(got) != len(titles) {
+		t.Errorf("Response.Run() sent %d jobs, want %d", len(got), len(titles))
+	}
+
+	if payloader.max != 4 {
+		t.Errorf("Response.Run() sent %d payloads at the same time, want 4", payloader.max)
+	}
+
+	select {
+	case <-res.Stopped():
+	case <-time.After(time.Second):
+		t.Errorf("Response.Stopped() not closed")
+	}
+}
+
+func TestProcess_auditContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		audit   *message.Audit
+		timeout time.Duration
+		want    time.Duration
+	}{
+		{
+			"No Timeout",
+			&message.Audit{Type: "lighthouse"},
+			0,
+			0,
+		},
+		{
+			"Process Timeout",
+			&message.Audit{Type: "lighthouse"},
+			time.Minute,
+			time.Minute,
+		},
+		{
+			"Message Timeout",
+			&message.Audit{
+				Type: "phpcs",
+				Options: &message.AuditOption{
+					Standard: "wordpress",
+					Timeout:  30,
+				},
+			},
+			time.Minute,
+			time.Second * 30,
+		},
+		{
+			"Message Timeout Above Process Timeout",
+			&message.Audit{
+				Type: "phpcs",
+				Options: &message.AuditOption{
+					Standard: "wordpress",
+					Timeout:  3600,
+				},
+			},
+			time.Minute,
+			time.Minute,
+		},
+		{
+			"Message Timeout Without Process Timeout",
+			&message.Audit{
+				Type: "phpcs",
+				Options: &message.AuditOption{
+					Standard: "wordpress",
+					Timeout:  30,
+				},
+			},
+			0,
+			time.Second * 30,
+		},
+		{
+			"No Audit",
+			nil,
+			time.Minute,
+			time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Process{}
+			ctx, cancel, timeout := p.auditContext(tt.audit, tt.timeout)
+			defer cancel()
+
+			if timeout != tt.want {
+				t.Errorf("Process.auditContext() timeout = %v, want %v", timeout, tt.want)
+			}
+
+			_, ok := ctx.Deadline()
+			if ok != (tt.want > 0) {
+				t.Errorf("Process.auditContext() deadline = %v, want %v", ok, tt.want > 0)
+			}
+		})
+	}
+}
+
+func TestProcess_failAudit(t *testing.T) {
+	long := strings.Repeat("a", maxStderr) + "the end"
+
+	tests := []struct {
+		name       string
+		stderr     []byte
+		wantStderr string
+	}{
+		{
+			"No Output",
+			nil,
+			"",
+		},
+		{
+			"Short Output",
+			[]byte("  command not found\n"),
+			"command not found",
+		},
+		{
+			"Long Output",
+			[]byte(long),
+			"..." + long[len(long)-maxStderr:],
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Process{
+				Result: &Result{
+					"checksum": "abc",
+				},
+			}
+
+			p.failAudit("phpcs_wordpress", errors.New("something went wrong"), 2, tt.stderr)
+
+			result := *p.GetResult()
+			want := tide.AuditResult{
+				Error:    "something went wrong",
+				ExitCode: 2,
+				Stderr:   tt.wantStderr,
+			}
+			if !reflect.DeepEqual(result["phpcs_wordpress"], want) {
+				t.Errorf("Process.failAudit() = %v, want %v", result["phpcs_wordpress"], want)
+			}
+			if result["checksum"] != "abc" {
+				t.Errorf("Process.failAudit() removed other results")
+			}
+		})
+	}
+}
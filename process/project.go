@@ -0,0 +1,110 @@
+package process
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/wptide/pkg/source"
+)
+
+// Project describes a single plugin or theme found in a source that contains several projects.
+type Project struct {
+	Root     string          // Folder of the project, relative to the extracted files.
+	Checksum string          // Combined checksum of the files in the project.
+	Files    []string        // Paths of the files in the project.
+	Manifest source.Manifest // Checksum and size of the files, relative to the project root.
+}
+
+// findProjects returns the folders of every plugin or theme in the extracted files, relative to path.
+//
+// If the root is a project itself, that is the only project. Otherwise the folders up to
+// two levels below the root are searched, e.g. "my-plugin" or "plugins/my-plugin".
+func findProjects(path string) []string {
+	if hasHeader(path) {
+		return []string{""}
+	}
+
+	var projects []string
+	for _, dir := range subFolders(path) {
+		if hasHeader(filepath.Join(path, dir)) {
+			projects = append(projects, dir)
+			continue
+		}
+
+		for _, subDir := range subFolders(filepath.Join(path, dir)) {
+			if hasHeader(filepath.Join(path, dir, subDir)) {
+				projects = append(projects, dir+"/"+subDir)
+			}
+		}
+	}
+
+	return projects
+}
+
+// selectProjects returns the roots that are in the list of projects, in the order they were found.
+func selectProjects(roots, projects []string) []string {
+	var selected []string
+	for _, root := range roots {
+		for _, project := range projects {
+			if root == project {
+				selected = append(selected, root)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// subFolders returns the names of the folders in a path.
+func subFolders(path string) []string {
+	files, _ := ioutil.ReadDir(path)
+
+	var folders []string
+	for _, f := range files {
+		if f.IsDir() {
+			folders = append(folders, f.Name())
+		}
+	}
+	return folders
+}
+
+// hasHeader returns true if a file in the path has a plugin or theme header.
+func hasHeader(path string) bool {
+	files, _ := ioutil.ReadDir(path)
+
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		if _, _, err := extractHeader(path + "/" + f.Name()); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// newProject collects the files of a project from the files of the whole source.
+func newProject(root, codePath string, files []string, manifest source.Manifest) Project {
+	project := Project{
+		Root:     root,
+		Manifest: make(source.Manifest),
+	}
+
+	prefix := root + "/"
+	for path, file := range manifest {
+		if strings.HasPrefix(path, prefix) {
+			project.Manifest[strings.TrimPrefix(path, prefix)] = file
+		}
+	}
+	project.Checksum = project.Manifest.Checksum()
+
+	projectPath := filepath.Clean(filepath.Join(codePath, root)) + string(filepath.Separator)
+	for _, file := range files {
+		if strings.HasPrefix(filepath.Clean(file), projectPath) {
+			project.Files = append(project.Files, file)
+		}
+	}
+
+	return project
+}
@@ -0,0 +1,283 @@
+package process
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/wptide/pkg/log"
+	"github.com/wptide/pkg/message"
+	"github.com/wptide/pkg/source"
+	"github.com/wptide/pkg/tide"
+)
+
+func Test_findProjects(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want []string
+	}{
+		{
+			"Single Project",
+			"./testdata/info/theme/unzipped",
+			[]string{""},
+		},
+		{
+			"Multiple Projects",
+			"./testdata/bundle",
+			[]string{"plugin-one", "plugin-two", "themes/theme-one"},
+		},
+		{
+			"No Projects",
+			"./testdata/bundle/docs",
+			nil,
+		},
+		{
+			"Invalid Path",
+			"./testdata/not-here",
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findProjects(tt.path); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findProjects() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_selectProjects(t *testing.T) {
+	roots := []string{"plugin-one", "plugin-two", "themes/theme-one"}
+
+	tests := []struct {
+		name     string
+		projects []string
+		want     []string
+	}{
+		{
+			"Some Projects",
+			[]string{"themes/theme-one", "plugin-one"},
+			[]string{"plugin-one", "themes/theme-one"},
+		},
+		{
+			"Missing Project",
+			[]string{"plugin-three"},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := selectProjects(roots, tt.projects); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectProjects() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_newProject(t *testing.T) {
+
+	manifest := source.Manifest{
+		"plugin-one/plugin-one.php":     {Checksum: "aaa", Size: 1},
+		"plugin-two/plugin-two.php":     {Checksum: "bbb", Size: 2},
+		"plugin-two/inc/functions.php":  {Checksum: "ccc", Size: 3},
+		"plugin-two-extra/readme.txt":   {Checksum: "ddd", Size: 4},
+		"themes/theme-one/style.css":    {Checksum: "eee", Size: 5},
+		"themes/theme-one/template.php": {Checksum: "fff", Size: 6},
+	}
+
+	files := []string{
+		"/tmp/job/unzipped/plugin-one/plugin-one.php",
+		"/tmp/job/unzipped/plugin-two/plugin-two.php",
+		"/tmp/job/unzipped/plugin-two/inc/functions.php",
+		"/tmp/job/unzipped/plugin-two-extra/readme.txt",
+	}
+
+	got := newProject("plugin-two", "/tmp/job/unzipped", files, manifest)
+
+	wantManifest := source.Manifest{
+		"plugin-two.php":    {Checksum: "bbb", Size: 2},
+		"inc/functions.php": {Checksum: "ccc", Size: 3},
+	}
+	if !reflect.DeepEqual(got.Manifest, wantManifest) {
+		t.Errorf("newProject() manifest = %v, want %v", got.Manifest, wantManifest)
+	}
+
+	wantFiles := []string{
+		"/tmp/job/unzipped/plugin-two/plugin-two.php",
+		"/tmp/job/unzipped/plugin-two/inc/functions.php",
+	}
+	if !reflect.DeepEqual(got.Files, wantFiles) {
+		t.Errorf("newProject() files = %v, want %v", got.Files, wantFiles)
+	}
+
+	if got.Root != "plugin-two" || got.Checksum != wantManifest.Checksum() {
+		t.Errorf("newProject() = %v, want checksum %v", got, wantManifest.Checksum())
+	}
+
+	// Other projects only get their own files.
+	other := newProject("themes/theme-one", "/tmp/job/unzipped", files, manifest)
+	if other.Checksum == got.Checksum || len(other.Files) != 0 {
+		t.Errorf("newProject() = %v, want a different project", other)
+	}
+}
+
+func TestIngest_Projects(t *testing.T) {
+
+	b := bytes.Buffer{}
+	log.SetOutput(&b)
+	defer log.SetOutput(os.Stdout)
+
+	// Clean up after.
+	defer func() {
+		os.RemoveAll("./testdata/tmp")
+	}()
+
+	ig := &Ingest{
+		Process: Process{
+			Message: message.Message{
+				Title:               "Agency Bundle",
+				Slug:                "agency-bundle",
+				ResponseAPIEndpoint: ts.URL + "/api/audits",
+				SourceURL:           "file://./testdata/bundle",
+				SourceType:          "local",
+			},
+			Result: &Result{},
+		},
+		TempFolder: "./testdata/tmp",
+	}
+
+	if err := ig.Do(); err != nil {
+		t.Errorf("Ingest.Do() error = %v", err)
+		return
+	}
+
+	procs := ig.projectProcesses()
+	if len(procs) != 3 {
+		t.Errorf("Ingest.projectProcesses() = %d processes, want 3", len(procs))
+		return
+	}
+
+	wantTypes := []string{"plugin", "plugin", "theme"}
+	wantSlugs := []string{"plugin-one", "plugin-two", "theme-one"}
+	checksums := make(map[string]bool)
+
+	for i, proc := range procs {
+		result := *proc.GetResult()
+
+		if _, ok := result["projects"]; ok {
+			t.Errorf("Ingest.projectProcesses() %d result contains the projects", i)
+		}
+		if proc.GetMessage().Slug != wantSlugs[i] {
+			t.Errorf("Ingest.projectProcesses() %d slug = %v, want %v", i, proc.GetMessage().Slug, wantSlugs[i])
+		}
+		checksums[result["checksum"].(string)] = true
+
+		// Every project gets its own code info.
+		info := &Info{}
+		info.SetMessage(proc.GetMessage())
+		info.SetResults(proc.GetResult())
+		if err := info.Do(); err != nil {
+			t.Errorf("Info.Do() %d error = %v", i, err)
+			continue
+		}
+
+		codeInfo := (*info.GetResult())["info"].(tide.CodeInfo)
+		if codeInfo.Type != wantTypes[i] {
+			t.Errorf("Info.Do() %d type = %v, want %v", i, codeInfo.Type, wantTypes[i])
+		}
+	}
+
+	if len(checksums) != 3 {
+		t.Errorf("Ingest.projectProcesses() checksums = %v, want 3 unique checksums", checksums)
+	}
+
+	// The workspace is removed once every project is done.
+	ws := ig.GetWorkspace()
+	for i := range procs {
+		if _, err := os.Stat(ws.Path); err != nil {
+			t.Errorf("Workspace removed after %d of %d projects", i, len(procs))
+		}
+		procs[i].(*Ingest).CloseWorkspace(false)
+	}
+	if _, err := os.Stat(ws.Path); !os.IsNotExist(err) {
+		t.Errorf("Workspace %v not removed after all projects", ws.Path)
+	}
+}
+
+func TestIngest_RetryProjects(t *testing.T) {
+
+	b := bytes.Buffer{}
+	log.SetOutput(&b)
+	defer log.SetOutput(os.Stdout)
+
+	// Clean up after.
+	defer func() {
+		os.RemoveAll("./testdata/tmp")
+	}()
+
+	tests := []struct {
+		name          string
+		projects      []string
+		wantSlugs     []string
+		wantPermanent bool
+	}{
+		{
+			"Single Project",
+			[]string{"plugin-two"},
+			[]string{"plugin-two"},
+			false,
+		},
+		{
+			"Several Projects",
+			[]string{"themes/theme-one", "plugin-one"},
+			[]string{"plugin-one", "theme-one"},
+			false,
+		},
+		{
+			"Missing Project",
+			[]string{"plugin-three"},
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ig := &Ingest{
+				Process: Process{
+					Message: message.Message{
+						Title:      "Agency Bundle",
+						Slug:       "agency-bundle",
+						SourceURL:  "file://./testdata/bundle",
+						SourceType: "local",
+						Projects:   tt.projects,
+					},
+					Result: &Result{},
+				},
+				TempFolder: "./testdata/tmp",
+			}
+
+			err := ig.Do()
+			if tt.wantPermanent {
+				if !IsPermanent(err) {
+					t.Errorf("Ingest.Do() error = %v, want a permanent error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Ingest.Do() error = %v", err)
+				return
+			}
+
+			var slugs []string
+			for _, proc := range ig.projectProcesses() {
+				slugs = append(slugs, proc.GetMessage().Slug)
+				proc.(*Ingest).CloseWorkspace(false)
+			}
+			if !reflect.DeepEqual(slugs, tt.wantSlugs) {
+				t.Errorf("Ingest.projectProcesses() slugs = %v, want %v", slugs, tt.wantSlugs)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/wptide/pkg/message"
+	"github.com/wptide/pkg/storage"
+	"github.com/wptide/pkg/tide"
+)
+
+// AuditProcessor runs a single audit of a job.
+type AuditProcessor interface {
+	Audit(ctx context.Context, job *Job, audit *message.Audit) error
+}
+
+// AuditProcessorFunc is a function that implements AuditProcessor.
+type AuditProcessorFunc func(ctx context.Context, job *Job, audit *message.Audit) error
+
+// Audit calls f(ctx, job, audit).
+func (f AuditProcessorFunc) Audit(ctx context.Context, job *Job, audit *message.Audit) error {
+	return f(ctx, job, audit)
+}
+
+// Option describes an option that messages can set for an audit type.
+type Option struct {
+	Name     string   // Name of the option in the message, e.g. "standard".
+	Required bool     // Messages have to set the option.
+	Values   []string // (Optional) The values that are allowed.
+}
+
+// Report is the report of an audit that post-processors work on.
+type Report struct {
+	Audit    *message.Audit    // The audit that ran.
+	Key      string            // Report key of the audit, e.g. "phpcs_wordpress".
+	Checksum string            // Checksum of the audited code.
+	Dir      string            // Folder where report files are written.
+	Raw      []byte            // The raw report.
+	Storage  storage.Provider  // Storage provider to upload report files to.
+	Result   *tide.AuditResult // Result of the audit, post-processors add to it.
+}
+
+// PostProcessor works on the report of an audit once it ran, e.g. to parse the raw report.
+type PostProcessor struct {
+	Standard string              // (Optional) Only work on audits of this standard.
+	Process  func(*Report) error // Does the work.
+}
+
+// AuditType describes an audit type: how to run it, which options it takes and what to do with its reports.
+type AuditType struct {
+	Name           string                                     // Type of the audit in messages, e.g. "phpcs".
+	Factory        func() AuditProcessor                      // (Optional) Returns a processor for every audit. Needed to route audits.
+	Runner         string                                     // (Optional) Type whose process runs the audits in pipes, e.g. PhpcsAudit for a PHPCS type with other options. Defaults to Name.
+	Options        []Option                                   // Options that messages can set.
+	Decode         func(options map[string]interface{}) error // (Optional) Checks the options of an audit once they match Options, e.g. the types of the values.
+	PostProcessors []PostProcessor                            // (Optional) Work on the reports of the audits.
+}
+
+// Registry keeps the audit types that a pipeline knows about.
+// It is also a JobProcessor that runs every audit of a job with the processor of its type.
+type Registry struct {
+	mutex sync.RWMutex
+	types map[string]AuditType
+}
+
+// DefaultRegistry has the audit types of this package. Processes use it unless they are given a registry.
+var DefaultRegistry = newDefaultRegistry()
+
+// newDefaultRegistry returns a registry with the PHPCS and Lighthouse audit types. The audits are run by
+// the Phpcs and Lighthouse processes, so the types don't have factories.
+func newDefaultRegistry() *Registry {
+	r := NewRegistry()
+	r.Register(AuditType{
+		Name:           PhpcsAudit,
+		Options:        phpcsOptions,
+		PostProcessors: phpcsPostProcessors,
+	})
+	r.Register(AuditType{
+		Name:    LighthouseAudit,
+		Options: lighthouseOptions,
+	})
+	return r
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		types: make(map[string]AuditType),
+	}
+}
+
+// Register adds an audit type.
+func (r *Registry) Register(t AuditType) error {
+	if t.Name == "" {
+		return fmt.Errorf("audit type needs a name")
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.types[t.Name]; ok {
+		return fmt.Errorf("audit type `%s` is already registered", t.Name)
+	}
+	r.types[t.Name] = t
+	return nil
+}
+
+// Lookup returns the audit type with the name.
+func (r *Registry) Lookup(name string) (AuditType, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	t, ok := r.types[name]
+	if !ok {
+		return AuditType{}, Permanent(fmt.Errorf("unknown audit type `%s`", name))
+	}
+	return t, nil
+}
+
+// Types returns the names of the registered audit types.
+func (r *Registry) Types() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	names := make([]string, 0, len(r.types))
+	for name := range r.types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate returns an error if an audit has an unknown type or options that its type doesn't take.
+func (r *Registry) Validate(audits []*message.Audit) error {
+	for _, audit := range audits {
+		if audit == nil {
+			return Permanent(fmt.Errorf("empty audit"))
+		}
+
+		t, err := r.Lookup(audit.Type)
+		if err != nil {
+			return err
+		}
+
+		if err := t.validateOptions(audit.Options); err != nil {
+			return Permanent(fmt.Errorf("`%s` audit: %s", audit.Type, err.Error()))
+		}
+	}
+	return nil
+}
+
+// Audits returns the audits that the process of a type runs in pipes, i.e. the audits of the type and of the
+// types that name it as their Runner. Audits of unknown types are left out.
+func (r *Registry) Audits(runner string, audits []*message.Audit) []*message.Audit {
+	var runs []*message.Audit
+	for _, audit := range audits {
+		if audit == nil {
+			continue
+		}
+
+		t, err := r.Lookup(audit.Type)
+		if err != nil {
+			continue
+		}
+		if t.runner() == runner {
+			runs = append(runs, audit)
+		}
+	}
+	return runs
+}
+
+// runner returns the type whose process runs the audits of the type.
+func (t AuditType) runner() string {
+	if t.Runner != "" {
+		return t.Runner
+	}
+	return t.Name
+}
+
+// PostProcessors returns the post-processors for an audit.
+func (r *Registry) PostProcessors(audit *message.Audit) []PostProcessor {
+	t, err := r.Lookup(audit.Type)
+	if err != nil {
+		return nil
+	}
+
+	standard := ""
+	if audit.Options != nil {
+		standard = strings.ToLower(audit.Options.Standard)
+	}
+
+	var posts []PostProcessor
+	for _, post := range t.PostProcessors {
+		if post.Standard == "" || strings.ToLower(post.Standard) == standard {
+			posts = append(posts, post)
+		}
+	}
+	return posts
+}
+
+// Do runs every audit of the job with a new processor of its type.
+func (r *Registry) Do(ctx context.Context, job *Job) error {
+	if err := r.Validate(job.Message.Audits); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, audit := range job.Message.Audits {
+		t, _ := r.Lookup(audit.Type)
+		if t.Factory == nil {
+			errs = append(errs, withAudit(audit.Type, Permanent(fmt.Errorf("no processor for audit type `%s`", audit.Type))))
+			continue
+		}
+
+		if err := t.Factory().Audit(ctx, job, audit); err != nil {
+			errs = append(errs, withAudit(audit.Type, err))
+		}
+	}
+	return combineErrors(errs)
+}
+
+// validateOptions returns an error if the options don't match the options of the audit type.
+func (t AuditType) validateOptions(options *message.AuditOption) error {
+	set := map[string]interface{}{}
+	if options != nil {
+		set = options.Values()
+	}
+
+	known := make(map[string]Option, len(t.Options))
+	for _, option := range t.Options {
+		known[option.Name] = option
+
+		value, ok := set[option.Name]
+		if !ok {
+			if option.Required {
+				return fmt.Errorf("requires option `%s`", option.Name)
+			}
+			continue
+		}
+
+		if len(option.Values) > 0 && !allowed(fmt.Sprint(value), option.Values) {
+			return fmt.Errorf("option `%s` must be one of %s", option.Name, strings.Join(option.Values, ", "))
+		}
+	}
+
+	for name := range set {
+		if _, ok := known[name]; !ok {
+			return fmt.Errorf("unknown option `%s`", name)
+		}
+	}
+
+	if t.Decode != nil {
+		return t.Decode(set)
+	}
+	return nil
+}
+
+// allowed returns true if the value is one of the values, ignoring case.
+func allowed(value string, values []string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
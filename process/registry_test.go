@@ -0,0 +1,349 @@
+package process
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/wptide/pkg/message"
+)
+
+func TestRegistry_Register(t *testing.T) {
+	r := NewRegistry()
+
+	tests := []struct {
+		name    string
+		t       AuditType
+		wantErr bool
+	}{
+		{
+			"Valid Type",
+			AuditType{Name: "test"},
+			false,
+		},
+		{
+			"Duplicate Type",
+			AuditType{Name: "test"},
+			true,
+		},
+		{
+			"Missing Name",
+			AuditType{},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := r.Register(tt.t); (err != nil) != tt.wantErr {
+				t.Errorf("Registry.Register() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if got := r.Types(); !reflect.DeepEqual(got, []string{"test"}) {
+		t.Errorf("Registry.Types() = %v, want %v", got, []string{"test"})
+	}
+}
+
+func TestRegistry_Validate(t *testing.T) {
+	r := NewRegistry()
+	r.Register(AuditType{
+		Name: "test",
+		Options: []Option{
+			{Name: "standard", Required: true, Values: []string{"wordpress", "phpcompatibility"}},
+			{Name: "timeout"},
+		},
+	})
+	r.Register(AuditType{
+		Name: "custom",
+		Options: []Option{
+			{Name: "url", Required: true},
+			{Name: "runs"},
+		},
+		Decode: func(options map[string]interface{}) error {
+			if _, ok := options["runs"].(float64); !ok && options["runs"] != nil {
+				return errors.New("option `runs` must be a number")
+			}
+			return nil
+		},
+	})
+
+	// Messages decode options that aren't fields of message.AuditOption too.
+	decode := func(data string) []*message.Audit {
+		var audits []*message.Audit
+		if err := json.Unmarshal([]byte(data), &audits); err != nil {
+			t.Fatal(err)
+		}
+		return audits
+	}
+
+	tests := []struct {
+		name      string
+		audits    []*message.Audit
+		wantErr   bool
+		permanent bool
+	}{
+		{
+			"Valid Audits",
+			[]*message.Audit{
+				{Type: "test", Options: &message.AuditOption{Standard: "WordPress"}},
+				{Type: "test", Options: &message.AuditOption{Standard: "phpcompatibility", Timeout: 10}},
+			},
+			false,
+			false,
+		},
+		{
+			"No Audits",
+			nil,
+			false,
+			false,
+		},
+		{
+			"Unknown Type",
+			[]*message.Audit{
+				{Type: "unknown"},
+			},
+			true,
+			true,
+		},
+		{
+			"Empty Audit",
+			[]*message.Audit{nil},
+			true,
+			true,
+		},
+		{
+			"Missing Option",
+			[]*message.Audit{
+				{Type: "test"},
+			},
+			true,
+			true,
+		},
+		{
+			"Invalid Value",
+			[]*message.Audit{
+				{Type: "test", Options: &message.AuditOption{Standard: "psr2"}},
+			},
+			true,
+			true,
+		},
+		{
+			"Unknown Option",
+			[]*message.Audit{
+				{Type: "test", Options: &message.AuditOption{Standard: "wordpress", Report: "json"}},
+			},
+			true,
+			true,
+		},
+		{
+			"Options Of The Type",
+			decode(`[{"type": "custom", "options": {"url": "http://test.local", "runs": 3}}]`),
+			false,
+			false,
+		},
+		{
+			"Missing Option Of The Type",
+			decode(`[{"type": "custom", "options": {"runs": 3}}]`),
+			true,
+			true,
+		},
+		{
+			"Unknown Option Of Another Type",
+			decode(`[{"type": "test", "options": {"standard": "wordpress", "url": "http://test.local"}}]`),
+			true,
+			true,
+		},
+		{
+			"Invalid Option Of The Type",
+			decode(`[{"type": "custom", "options": {"url": "http://test.local", "runs": "three"}}]`),
+			true,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.Validate(tt.audits)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Registry.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if IsPermanent(err) != tt.permanent {
+				t.Errorf("IsPermanent() = %v, want %v", IsPermanent(err), tt.permanent)
+			}
+		})
+	}
+}
+
+func TestRegistry_Audits(t *testing.T) {
+	r := NewRegistry()
+	r.Register(AuditType{Name: PhpcsAudit})
+	r.Register(AuditType{Name: "phpcs-vip", Runner: PhpcsAudit})
+	r.Register(AuditType{Name: LighthouseAudit})
+
+	phpcs := &message.Audit{Type: PhpcsAudit}
+	vip := &message.Audit{Type: "phpcs-vip"}
+	lighthouse := &message.Audit{Type: LighthouseAudit}
+	audits := []*message.Audit{phpcs, lighthouse, nil, {Type: "unknown"}, vip}
+
+	tests := []struct {
+		name   string
+		runner string
+		want   []*message.Audit
+	}{
+		{
+			"PHPCS And Types It Runs",
+			PhpcsAudit,
+			[]*message.Audit{phpcs, vip},
+		},
+		{
+			"Lighthouse",
+			LighthouseAudit,
+			[]*message.Audit{lighthouse},
+		},
+		{
+			"Nothing To Run",
+			"phpcs-vip",
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.Audits(tt.runner, audits); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Registry.Audits() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistry_PostProcessors(t *testing.T) {
+	tests := []struct {
+		name  string
+		audit *message.Audit
+		want  int
+	}{
+		{
+			"PHPCompatibility",
+			&message.Audit{Type: PhpcsAudit, Options: &message.AuditOption{Standard: "PHPCompatibility"}},
+			1,
+		},
+		{
+			"WordPress",
+			&message.Audit{Type: PhpcsAudit, Options: &message.AuditOption{Standard: "wordpress"}},
+			0,
+		},
+		{
+			"Lighthouse",
+			&message.Audit{Type: LighthouseAudit},
+			0,
+		},
+		{
+			"Unknown Type",
+			&message.Audit{Type: "unknown"},
+			0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultRegistry.PostProcessors(tt.audit); len(got) != tt.want {
+				t.Errorf("Registry.PostProcessors() = %d post-processors, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistry_Do(t *testing.T) {
+	var ran []string
+	record := func(ctx context.Context, job *Job, audit *message.Audit) error {
+		ran = append(ran, audit.Options.Standard)
+		return nil
+	}
+
+	r := NewRegistry()
+	r.Register(AuditType{
+		Name: "test",
+		Factory: func() AuditProcessor {
+			return AuditProcessorFunc(record)
+		},
+		Options: []Option{{Name: "standard"}},
+	})
+	r.Register(AuditType{
+		Name: "failing",
+		Factory: func() AuditProcessor {
+			return AuditProcessorFunc(func(ctx context.Context, job *Job, audit *message.Audit) error {
+				return errors.New("audit failed")
+			})
+		},
+	})
+	r.Register(AuditType{
+		Name: "no-factory",
+	})
+
+	tests := []struct {
+		name      string
+		audits    []*message.Audit
+		wantRan   []string
+		wantErr   bool
+		wantAudit string
+	}{
+		{
+			"Routed Audits",
+			[]*message.Audit{
+				{Type: "test", Options: &message.AuditOption{Standard: "a"}},
+				{Type: "test", Options: &message.AuditOption{Standard: "b"}},
+			},
+			[]string{"a", "b"},
+			false,
+			"",
+		},
+		{
+			"Unknown Type",
+			[]*message.Audit{
+				{Type: "test", Options: &message.AuditOption{Standard: "a"}},
+				{Type: "unknown"},
+			},
+			nil,
+			true,
+			"",
+		},
+		{
+			"Failed Audit",
+			[]*message.Audit{
+				{Type: "failing"},
+				{Type: "test", Options: &message.AuditOption{Standard: "a"}},
+			},
+			[]string{"a"},
+			true,
+			"failing",
+		},
+		{
+			"No Factory",
+			[]*message.Audit{
+				{Type: "no-factory"},
+			},
+			nil,
+			true,
+			"no-factory",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ran = nil
+
+			job := NewJob(message.Message{Title: "Test", Audits: tt.audits})
+			err := r.Do(context.Background(), job)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Registry.Do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(ran, tt.wantRan) {
+				t.Errorf("Registry.Do() ran = %v, want %v", ran, tt.wantRan)
+			}
+			if err != nil {
+				if got := NewPipelineError("Audit", job.Message, err).Audit; got != tt.wantAudit {
+					t.Errorf("PipelineError.Audit = %v, want %v", got, tt.wantAudit)
+				}
+			}
+		})
+	}
+}
@@ -4,16 +4,24 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/wptide/pkg/cache"
+	"github.com/wptide/pkg/health"
+	"github.com/wptide/pkg/log"
+	"github.com/wptide/pkg/message"
 	"github.com/wptide/pkg/payload"
+	"github.com/wptide/pkg/tide"
 )
 
 // Response defines the structure for a Response process.
 // This determines where the processed results will be sent.
 type Response struct {
-	Process                                 // Inherits methods from Process.
-	In         <-chan Processor             // Expects a processor channel as input.
-	Out        chan Processor               // (Optional) Send results to an output channel.
-	Payloaders map[string]payload.Payloader // A map of "Payloader"s for different services.
+	Process                                  // Inherits methods from Process.
+	In          <-chan Processor             // Expects a processor channel as input.
+	Out         chan Processor               // (Optional) Send results to an output channel.
+	Payloaders  map[string]payload.Payloader // A map of "Payloader"s for different services.
+	ResultCache cache.Provider               // (Optional) Stores the results of complete audits.
+	Pipeline    cache.Pipeline               // (Optional) How the pipeline runs the audits, results are stored for this configuration. Use the same as Ingest.
+	Workers     int                          // (Optional) Number of jobs processed at the same time. Defaults to 1.
 }
 
 // Run executes the process in a pipe.
@@ -27,34 +35,74 @@ func (res *Response) Run(errc *chan error) error {
 		return errors.New("need to provide at least one payload manager")
 	}
 
-	go func() {
-		for {
-			select {
-			case in := <-res.In:
-
-				// Copy Process fields from `in` process.
-				res.CopyFields(in)
-
-				// Run the process.
-				// If processing produces an error send it up the error channel.
-				if err := res.Do(); err != nil {
-					// Pass the error up the error channel.
-					*errc <- errors.New("Response Error: " + err.Error())
-					// Don't break, the message is still useful to other processes.
-				}
-
-				// Send process to the out channel.
-				if res.Out != nil {
-					res.Out <- res
-				}
-			}
-		}
+	res.start()
 
-	}()
+	// Every worker works on its own copy of the process.
+	res.spawn("Response", res.Workers, closer(res.Out), func(w *health.Worker) bool {
+		worker := *res
+		worker.health = w
+		return worker.work(errc)
+	})
 
 	return nil
 }
 
+// work takes jobs until the previous process stops or the context is cancelled.
+// It returns true if the previous process stopped.
+func (res *Response) work(errc *chan error) bool {
+	for {
+		// Waiting for the next job is not a stall.
+		res.health.Idle()
+
+		select {
+		case <-res.done():
+			return false
+		case in, ok := <-res.In:
+			// The previous process stopped.
+			if !ok {
+				return true
+			}
+			res.health.Busy()
+
+			// Copy Process fields from `in` process.
+			res.CopyFields(in)
+
+			// Run the process.
+			// If processing produces an error send it up the error channel.
+			end := track("Response")
+			_, endSpan := res.startSpan("response")
+			err := res.Do()
+			endSpan(err)
+			end(err)
+
+			// The job is finished, clean up after it.
+			res.CloseWorkspace(err != nil)
+
+			var pErr error
+			if err != nil {
+				pErr = NewPipelineError("Response", res.Message, err)
+			}
+
+			// This is the last process, the job ends here.
+			if res.Out == nil {
+				res.complete(res.Message, res.Result, pErr)
+			}
+
+			if pErr != nil {
+				// Pass the error up the error channel.
+				*errc <- pErr
+				// Don't break, the message is still useful to other processes.
+			}
+
+			// Send a copy of the job to the out channel, so that the worker can take the next job.
+			job := *res
+			if res.Out != nil && !res.send(res.Out, &job) {
+				return false
+			}
+		}
+	}
+}
+
 // Do executes the process.
 func (res *Response) Do() error {
 
@@ -70,19 +118,29 @@ func (res *Response) Do() error {
 
 	payloader, ok := res.Payloaders[payloadType]
 	if !ok {
-		return errors.New("Could not find a valid payload generator for task")
+		return Permanent(errors.New("Could not find a valid payload generator for task"))
 	}
 
+	// The payload is built for this message, even if the results were replayed from the result cache.
 	p, err := payloader.BuildPayload(res.Message, result)
 	if err != nil {
 		return err
 	}
 
+	span, endSpan := res.startSpan("send")
+	span.SetAttribute("payload_type", payloadType)
+	span.SetAttribute("endpoint", res.Message.ResponseAPIEndpoint)
 	reply, err := payloader.SendPayload(res.Message.ResponseAPIEndpoint, p)
+	endSpan(err)
 	if err != nil {
 		return err
 	}
 
+	// Only complete results are worth replaying.
+	if res.ResultCache != nil && !res.Cached() && completeResults(res.Message.Audits, result) {
+		res.cacheResults(result)
+	}
+
 	result["response"] = string(reply)
 	result["responseMessage"] = fmt.Sprintf("'%s' payload submitted successfully.", payloadType)
 	result["responseSuccess"] = true
@@ -91,3 +149,44 @@ func (res *Response) Do() error {
 
 	return nil
 }
+
+// cacheResults stores the audit results in the result cache, without anything of the message.
+func (res *Response) cacheResults(result Result) {
+	checksum, ok := result["checksum"].(string)
+	if !ok {
+		return
+	}
+
+	cached := cache.Results{
+		Audits: make(map[string]tide.AuditResult),
+	}
+	for key, value := range result {
+		if audit, ok := value.(tide.AuditResult); ok {
+			cached.Audits[key] = audit
+		}
+	}
+	if info, ok := result["info"].(tide.CodeInfo); ok {
+		cached.Info = &info
+	}
+
+	data, err := cache.EncodeResults(cached)
+	if err == nil {
+		err = res.ResultCache.SetResults(checksum, cache.ConfigKey(res.Message, res.Pipeline), data)
+	}
+	if err != nil {
+		log.Log(res.Message.Title, "Could not store results in cache: "+err.Error())
+	}
+}
+
+// completeResults returns true if every requested audit has a successful result.
+func completeResults(audits []*message.Audit, result Result) bool {
+	for _, audit := range audits {
+		key := audit.ReportKey()
+
+		// Audits that failed, e.g. timed out, might succeed next time.
+		if audit, ok := result[key].(tide.AuditResult); !ok || audit.Error != "" {
+			return false
+		}
+	}
+	return true
+}
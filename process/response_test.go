@@ -3,14 +3,17 @@ package process
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/wptide/pkg/cache"
 	"github.com/wptide/pkg/log"
 	"github.com/wptide/pkg/message"
 	"github.com/wptide/pkg/payload"
+	"github.com/wptide/pkg/tide"
 )
 
 type MockPayloader struct{}
@@ -231,3 +234,242 @@ func TestResponse_Run(t *testing.T) {
 		})
 	}
 }
+
+func TestResponse_Do_ResultCache(t *testing.T) {
+
+	b := bytes.Buffer{}
+	log.SetOutput(&b)
+	defer log.SetOutput(os.Stdout)
+
+	audits := []*message.Audit{
+		{
+			Type: "phpcs",
+			Options: &message.AuditOption{
+				Standard: "wordpress",
+			},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		message    message.Message
+		result     Result
+		wantErr    bool
+		wantStored bool
+	}{
+		{
+			"Store Complete Results",
+			message.Message{
+				Title:       "Test",
+				PayloadType: "mock",
+				Audits:      audits,
+			},
+			Result{
+				"checksum":        "abc123",
+				"phpcs_wordpress": tide.AuditResult{},
+			},
+			false,
+			true,
+		},
+		{
+			"Skip Incomplete Results",
+			message.Message{
+				Title:       "Test",
+				PayloadType: "mock",
+				Audits:      audits,
+			},
+			Result{
+				"checksum": "abc123",
+			},
+			false,
+			false,
+		},
+		{
+			"Skip Replayed Results",
+			message.Message{
+				Title:       "Test",
+				PayloadType: "mock",
+				Audits:      audits,
+			},
+			Result{
+				"checksum":        "abc123",
+				"phpcs_wordpress": tide.AuditResult{},
+				"cachedResults":   true,
+			},
+			false,
+			false,
+		},
+		{
+			"Build Replayed Results",
+			message.Message{
+				Title:       "Test",
+				PayloadType: "mock",
+				Slug:        "buildFail",
+				Audits:      audits,
+			},
+			Result{
+				"checksum":        "abc123",
+				"phpcs_wordpress": tide.AuditResult{},
+				"cachedResults":   true,
+			},
+			true,
+			false,
+		},
+		{
+			"Send Fail",
+			message.Message{
+				Title:               "Test",
+				PayloadType:         "mock",
+				ResponseAPIEndpoint: "http://test.local/sendfail",
+				Audits:              audits,
+			},
+			Result{
+				"checksum":        "abc123",
+				"phpcs_wordpress": tide.AuditResult{},
+			},
+			true,
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resultCache := &mockResultCache{
+				results: make(map[string][]byte),
+			}
+
+			res := &Response{
+				Process: Process{
+					Message: tt.message,
+					Result:  &tt.result,
+				},
+				Payloaders: map[string]payload.Payloader{
+					"mock": MockPayloader{},
+				},
+				ResultCache: resultCache,
+			}
+
+			if err := res.Do(); (err != nil) != tt.wantErr {
+				t.Errorf("Response.Do() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			_, stored, _ := resultCache.GetResults("abc123", cache.ConfigKey(tt.message, cache.Pipeline{}))
+			if stored != tt.wantStored {
+				t.Errorf("Response.Do() stored = %v, want %v", stored, tt.wantStored)
+			}
+		})
+	}
+}
+
+// mockRecordPayloader builds payloads with the TidePayload and records the payloads it sends.
+type mockRecordPayloader struct {
+	payload.TidePayload
+	sent *[]byte
+}
+
+func (m mockRecordPayloader) SendPayload(destination string, payload []byte) ([]byte, error) {
+	*m.sent = payload
+	return []byte(`{ "status": "ok" }`), nil
+}
+
+func TestResponse_ResultCache_Messages(t *testing.T) {
+
+	b := bytes.Buffer{}
+	log.SetOutput(&b)
+	defer log.SetOutput(os.Stdout)
+
+	audits := []*message.Audit{
+		{
+			Type: "phpcs",
+			Options: &message.AuditOption{
+				Standard: "wordpress",
+			},
+		},
+	}
+
+	first := message.Message{
+		Title:         "First",
+		PayloadType:   "tide",
+		Visibility:    "public",
+		RequestClient: "client-a",
+		Audits:        audits,
+	}
+	second := message.Message{
+		Title:         "Second",
+		PayloadType:   "tide",
+		Visibility:    "private",
+		RequestClient: "client-b",
+		Audits:        audits,
+	}
+
+	resultCache := &mockResultCache{
+		results: make(map[string][]byte),
+	}
+	var sent []byte
+	payloaders := map[string]payload.Payloader{
+		"tide": mockRecordPayloader{sent: &sent},
+	}
+
+	// The first message is audited and its results are stored.
+	res := &Response{
+		Process: Process{
+			Message: first,
+			Result: &Result{
+				"checksum": "abc123",
+				"info": tide.CodeInfo{
+					Type: "plugin",
+				},
+				"phpcs_wordpress": tide.AuditResult{
+					Raw: tide.AuditDetails{
+						Type: "local",
+					},
+				},
+			},
+		},
+		Payloaders:  payloaders,
+		ResultCache: resultCache,
+	}
+	if err := res.Do(); err != nil {
+		t.Errorf("Response.Do() error = %v", err)
+		return
+	}
+
+	// The second message replays them.
+	ig := &Ingest{
+		ResultCache: resultCache,
+	}
+	ig.Message = second
+	ig.Result = &Result{
+		"checksum": "abc123",
+	}
+	ig.replayCached(*ig.Result)
+	if !ig.Cached() {
+		t.Errorf("Ingest.Cached() = false, want true")
+		return
+	}
+
+	res = &Response{
+		Process: Process{
+			Message: second,
+			Result:  ig.Result,
+		},
+		Payloaders:  payloaders,
+		ResultCache: resultCache,
+	}
+	if err := res.Do(); err != nil {
+		t.Errorf("Response.Do() error = %v", err)
+		return
+	}
+
+	var item tide.Item
+	if err := json.Unmarshal(sent, &item); err != nil {
+		t.Errorf("Response.Do() payload = %s, error = %v", sent, err)
+		return
+	}
+	if item.Title != second.Title || item.Visibility != second.Visibility || item.RequestClient != second.RequestClient {
+		t.Errorf("Response.Do() payload = %s, want the metadata of %v", sent, second)
+	}
+	if item.CodeInfo.Type != "plugin" || item.Reports["phpcs_wordpress"].Raw.Type != "local" {
+		t.Errorf("Response.Do() payload = %s, want the cached results", sent)
+	}
+}
@@ -0,0 +1,224 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/wptide/pkg/health"
+	"github.com/wptide/pkg/message"
+	"github.com/wptide/pkg/trace"
+)
+
+// JobProcessor does the work of a stage for a single job.
+type JobProcessor interface {
+	Do(ctx context.Context, job *Job) error
+}
+
+// JobProcessorFunc is a function that implements JobProcessor.
+type JobProcessorFunc func(ctx context.Context, job *Job) error
+
+// Do calls f(ctx, job).
+func (f JobProcessorFunc) Do(ctx context.Context, job *Job) error {
+	return f(ctx, job)
+}
+
+// JobSplitter is implemented by job processors that split a job once it is done, e.g. into a job
+// for every project found in its source. Stages send every job of the split to the next stage.
+type JobSplitter interface {
+	Split(job *Job) []*Job
+}
+
+// Stage runs a JobProcessor in a pipe. It takes jobs from In, or starts a job for every message
+// from Messages, and sends them to Out once the processor is done with them.
+type Stage struct {
+	Process                            // Inherits methods from Process.
+	Name        string                 // Name of the stage, used for timings and errors.
+	Processor   JobProcessor           // Does the work for every job.
+	Messages    <-chan message.Message // (Optional) Start a job for every message, instead of taking jobs from In.
+	In          <-chan *Job            // Expects a job channel as input, unless Messages is set.
+	Out         chan *Job              // (Optional) Send jobs to an output channel. Without it the jobs end here.
+	Workers     int                    // (Optional) Number of jobs processed at the same time. Defaults to 1.
+	DropOnError bool                   // Don't send jobs to the next stage if the processor failed.
+	stop        chan struct{}          // Closed to stop taking new messages.
+}
+
+// Run executes the stage in the pipeline.
+func (s *Stage) Run(errc *chan error) error {
+
+	if s.Processor == nil {
+		return errors.New("requires a job processor")
+	}
+	if s.In == nil && s.Messages == nil {
+		return errors.New("requires a previous stage or a message channel")
+	}
+
+	s.stop = make(chan struct{})
+	s.start()
+
+	var drained func()
+	if s.Out != nil {
+		drained = func() {
+			close(s.Out)
+		}
+	}
+
+	// The workers only share the configuration of the stage, every job has its own state.
+	s.spawn(s.Name, s.Workers, drained, func(w *health.Worker) bool {
+		return s.work(errc, w)
+	})
+
+	return nil
+}
+
+// Do is not used by stages, the jobs are processed in Run.
+func (s *Stage) Do() error {
+	return errors.New("stage needs a job, use Run")
+}
+
+// Stop stops taking new messages. The jobs that were already started are still processed.
+// Stages that take jobs from In stop once the previous stage stopped.
+func (s *Stage) Stop() {
+	if s.stop == nil || s.Messages == nil {
+		return
+	}
+
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+}
+
+// drained returns true if the stage stopped because there are no more jobs, not because it was cancelled.
+func (s *Stage) drained() bool {
+	select {
+	case <-s.done():
+		return false
+	default:
+		return true
+	}
+}
+
+// next returns the next job, or false if there are no more jobs or the stage is cancelled.
+func (s *Stage) next() (*Job, bool) {
+	if s.Messages == nil {
+		select {
+		case <-s.done():
+			return nil, false
+		case job, ok := <-s.In:
+			return job, ok
+		}
+	}
+
+	// Don't take a new message once we are told to stop.
+	select {
+	case <-s.stop:
+		return nil, false
+	default:
+	}
+
+	select {
+	case <-s.stop:
+		return nil, false
+	case <-s.done():
+		return nil, false
+	case msg, ok := <-s.Messages:
+		if !ok {
+			return nil, false
+		}
+		// The trace of the message starts here.
+		span := startTrace(&msg)
+		job := NewJob(msg)
+		job.Results["traceSpan"] = span
+		return job, true
+	}
+}
+
+// work processes jobs until there are no more jobs or the context is cancelled, w reports the heartbeats
+// of the worker. It returns true if there are no more jobs.
+func (s *Stage) work(errc *chan error, w *health.Worker) bool {
+	for {
+		// Waiting for the next job is not a stall.
+		w.Idle()
+
+		job, ok := s.next()
+		if !ok {
+			return s.drained()
+		}
+		if job == nil {
+			continue
+		}
+		w.Busy()
+
+		ctx := s.context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		start := time.Now()
+		end := track(s.Name)
+		ctx, span := trace.Start(jobTraceContext(ctx, job), s.Name)
+		err := s.Processor.Do(ctx, job)
+		job.Time(s.Name, start)
+		span.Finish(err)
+		end(err)
+
+		if err != nil {
+			job.Fail(s.Name, err)
+
+			// Pass the error up the error channel.
+			*errc <- job.Errors[len(job.Errors)-1]
+
+			// The job ends here, clean up after it.
+			if s.DropOnError {
+				job.CloseWorkspace()
+				s.complete(job.Message, &job.Results, job.Err())
+				continue
+			}
+		}
+
+		jobs := []*Job{job}
+		if splitter, ok := s.Processor.(JobSplitter); ok && err == nil {
+			jobs = splitter.Split(job)
+		}
+
+		for i, next := range jobs {
+			if !s.pass(next) {
+				// The other jobs of the split are dropped too.
+				for _, dropped := range jobs[i+1:] {
+					s.cancel(dropped)
+				}
+				return false
+			}
+		}
+	}
+}
+
+// pass sends a job to the next stage, or completes it if this is the last stage.
+// It returns false if the stage was cancelled before the next stage took the job.
+func (s *Stage) pass(job *Job) bool {
+	// This is the last stage, the job is finished with the errors of every stage.
+	if s.Out == nil {
+		job.CloseWorkspace()
+		s.complete(job.Message, &job.Results, job.Err())
+		return true
+	}
+
+	// The worker stays busy until the next stage took the job, so that it stalls if the next stage
+	// stopped taking jobs.
+	select {
+	case s.Out <- job:
+		return true
+	case <-s.done():
+		s.cancel(job)
+		return false
+	}
+}
+
+// cancel completes a job that won't reach the next stage.
+func (s *Stage) cancel(job *Job) {
+	job.Fail(s.Name, errors.New("job cancelled"))
+	job.CloseWorkspace()
+	s.complete(job.Message, &job.Results, job.Err())
+}
@@ -0,0 +1,455 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wptide/pkg/health"
+	"github.com/wptide/pkg/message"
+	"github.com/wptide/pkg/workspace"
+)
+
+func TestStage_Run(t *testing.T) {
+
+	nothing := JobProcessorFunc(func(ctx context.Context, job *Job) error {
+		return nil
+	})
+
+	tests := []struct {
+		name    string
+		stage   *Stage
+		wantErr bool
+	}{
+		{
+			"Valid Stage",
+			&Stage{
+				Processor: nothing,
+				In:        make(chan *Job),
+			},
+			false,
+		},
+		{
+			"Valid Message Stage",
+			&Stage{
+				Processor: nothing,
+				Messages:  make(chan message.Message),
+			},
+			false,
+		},
+		{
+			"No Processor",
+			&Stage{
+				In: make(chan *Job),
+			},
+			true,
+		},
+		{
+			"No Input",
+			&Stage{
+				Processor: nothing,
+			},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errc := make(chan error, 1)
+			if err := tt.stage.Run(&errc); (err != nil) != tt.wantErr {
+				t.Errorf("Stage.Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := (&Stage{}).Do(); err == nil {
+		t.Errorf("Stage.Do() error = nil, want error")
+	}
+}
+
+func TestStage_Jobs(t *testing.T) {
+
+	defer os.RemoveAll("./testdata/workspaces")
+	workspaces := workspace.NewManager("./testdata/workspaces", workspace.KeepNone)
+
+	titles := []string{"One", "Two", "Fail", "Three", "Four"}
+
+	messages := make(chan message.Message, len(titles))
+	for _, title := range titles {
+		messages <- message.Message{Title: title}
+	}
+	close(messages)
+
+	jobs := make(chan *Job)
+	ingest := &Stage{
+		Name:     "Ingest",
+		Messages: messages,
+		Out:      jobs,
+		Processor: JobProcessorFunc(func(ctx context.Context, job *Job) error {
+			job.Workspace, _ = workspaces.Create()
+			job.Checksum = job.Message.Title
+			return nil
+		}),
+	}
+
+	// Audits run at the same time, and only change their own job.
+	var running, max int32
+	audited := make(chan *Job, len(titles))
+	audit := &Stage{
+		Name:        "Audit",
+		In:          jobs,
+		Out:         audited,
+		Workers:     3,
+		DropOnError: true,
+		Processor: JobProcessorFunc(func(ctx context.Context, job *Job) error {
+			if n := atomic.AddInt32(&running, 1); n > atomic.LoadInt32(&max) {
+				atomic.StoreInt32(&max, n)
+			}
+			defer atomic.AddInt32(&running, -1)
+
+			time.Sleep(time.Millisecond * 50)
+
+			if job.Message.Title == "Fail" {
+				return errors.New("something went wrong")
+			}
+			job.Results["audited"] = job.Checksum
+			return nil
+		}),
+	}
+
+	errc := make(chan error, len(titles))
+	ingest.Run(&errc)
+	audit.Run(&errc)
+
+	var workspacesKept []*workspace.Workspace
+	got := 0
+	for job := range audited {
+		got++
+		if job.Results["audited"] != job.Message.Title {
+			t.Errorf("Stage.Run() job %v audited %v", job.Message.Title, job.Results["audited"])
+		}
+		if len(job.Timings) != 2 || job.Timings[0].Stage != "Ingest" || job.Timings[1].Stage != "Audit" {
+			t.Errorf("Stage.Run() timings = %v", job.Timings)
+		}
+		workspacesKept = append(workspacesKept, job.Workspace)
+	}
+
+	if got != len(titles)-1 {
+		t.Errorf("Stage.Run() passed %d jobs, want %d", got, len(titles)-1)
+	}
+	if max < 2 || max > 3 {
+		t.Errorf("Stage.Run() ran %d jobs at the same time, want 2 to 3", max)
+	}
+
+	select {
+	case err := <-errc:
+		if err.Error() != "Audit Error: something went wrong" {
+			t.Errorf("Stage.Run() error = %v", err)
+		}
+		if pErr, ok := err.(*PipelineError); !ok || pErr.Stage != "Audit" || pErr.Title == "" {
+			t.Errorf("Stage.Run() error = %#v, want a pipeline error", err)
+		}
+	default:
+		t.Errorf("Stage.Run() did not report the failed job")
+	}
+
+	// Only the workspace of the dropped job is removed.
+	dirs, _ := ioutil.ReadDir("./testdata/workspaces")
+	if len(dirs) != len(workspacesKept) {
+		t.Errorf("Stage.Run() kept %d workspaces, want %d", len(dirs), len(workspacesKept))
+	}
+
+	select {
+	case <-audit.Stopped():
+	case <-time.After(time.Second):
+		t.Errorf("Stage.Stopped() not closed")
+	}
+}
+
+func TestStage_Complete(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		fail          error
+		wantErr       bool
+		wantPermanent bool
+	}{
+		{
+			"Succeed In Every Stage",
+			nil,
+			false,
+			false,
+		},
+		{
+			"Fail In Stage 1, Succeed In Last Stage",
+			errors.New("something went wrong"),
+			true,
+			false,
+		},
+		{
+			"Fail Permanently In Stage 1, Succeed In Last Stage",
+			Permanent(errors.New("invalid message")),
+			true,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := make(chan message.Message, 1)
+			messages <- message.Message{Title: "Test"}
+			close(messages)
+
+			jobs := make(chan *Job)
+			first := &Stage{
+				Name:     "First",
+				Messages: messages,
+				Out:      jobs,
+				Processor: JobProcessorFunc(func(ctx context.Context, job *Job) error {
+					return tt.fail
+				}),
+			}
+			last := &Stage{
+				Name: "Last",
+				In:   jobs,
+				Processor: JobProcessorFunc(func(ctx context.Context, job *Job) error {
+					return nil
+				}),
+			}
+
+			completed := make(chan error, 1)
+			last.SetCompleter(CompleterFunc(func(msg message.Message, err error) {
+				completed <- err
+			}))
+
+			errc := make(chan error, 2)
+			first.Run(&errc)
+			last.Run(&errc)
+
+			select {
+			case err := <-completed:
+				if (err != nil) != tt.wantErr {
+					t.Errorf("Stage.Run() completed with %v, wantErr %v", err, tt.wantErr)
+				}
+				if got := IsPermanent(err); got != tt.wantPermanent {
+					t.Errorf("Stage.Run() completed with %v, permanent = %v, want %v", err, got, tt.wantPermanent)
+				}
+			case <-time.After(time.Second):
+				t.Errorf("Stage.Run() did not complete the job")
+			}
+		})
+	}
+}
+
+type mockSplitter struct {
+	JobProcessorFunc
+}
+
+func (m mockSplitter) Split(job *Job) []*Job {
+	first, second := *job, *job
+	first.Message.Slug, second.Message.Slug = "first", "second"
+	return []*Job{&first, &second}
+}
+
+func TestStage_Split(t *testing.T) {
+	messages := make(chan message.Message, 1)
+	messages <- message.Message{Title: "Bundle"}
+	close(messages)
+
+	jobs := make(chan *Job)
+	first := &Stage{
+		Name:     "First",
+		Messages: messages,
+		Out:      jobs,
+		Processor: mockSplitter{JobProcessorFunc(func(ctx context.Context, job *Job) error {
+			return nil
+		})},
+	}
+	last := &Stage{
+		Name: "Last",
+		In:   jobs,
+		Processor: JobProcessorFunc(func(ctx context.Context, job *Job) error {
+			return nil
+		}),
+	}
+
+	completed := make(chan string, 2)
+	last.SetCompleter(CompleterFunc(func(msg message.Message, err error) {
+		completed <- msg.Slug
+	}))
+
+	errc := make(chan error, 2)
+	first.Run(&errc)
+	last.Run(&errc)
+	<-last.Stopped()
+	close(completed)
+
+	var got []string
+	for slug := range completed {
+		got = append(got, slug)
+	}
+	if !reflect.DeepEqual(got, []string{"first", "second"}) {
+		t.Errorf("Stage.Run() completed %v, want every job of the split", got)
+	}
+}
+
+func TestStage_Stop(t *testing.T) {
+
+	messages := make(chan message.Message, 1)
+	done := make(chan *Job, 1)
+
+	s := &Stage{
+		Name:     "Ingest",
+		Messages: messages,
+		Processor: JobProcessorFunc(func(ctx context.Context, job *Job) error {
+			done <- job
+			return nil
+		}),
+	}
+
+	errc := make(chan error, 1)
+	s.Run(&errc)
+
+	messages <- message.Message{Title: "Taken"}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("Stage.Run() did not take message")
+		return
+	}
+
+	s.Stop()
+	s.Stop()
+
+	select {
+	case <-s.Stopped():
+	case <-time.After(time.Second):
+		t.Errorf("Stage.Stopped() not closed after stop")
+		return
+	}
+
+	messages <- message.Message{Title: "Not Taken"}
+	time.Sleep(time.Millisecond * 50)
+	if len(messages) != 1 {
+		t.Errorf("Stage.Run() took a message after stop")
+	}
+}
+
+func TestStage_Cancel(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	in := make(chan *Job, 1)
+	in <- NewJob(message.Message{Title: "Slow"})
+
+	s := &Stage{
+		Name: "Audit",
+		In:   in,
+		Out:  make(chan *Job),
+		Processor: JobProcessorFunc(func(ctx context.Context, job *Job) error {
+			// Long running processors stop when the job is cancelled.
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+	}
+	s.SetContext(ctx)
+
+	errc := make(chan error, 1)
+	s.Run(&errc)
+
+	time.Sleep(time.Millisecond * 50)
+	cancel()
+
+	select {
+	case <-s.Stopped():
+	case <-time.After(time.Second):
+		t.Errorf("Stage.Stopped() not closed after cancel")
+	}
+}
+
+func TestStage_Health(t *testing.T) {
+	messages := make(chan message.Message)
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	s := &Stage{
+		Name:     "Health Check",
+		Messages: messages,
+		Processor: JobProcessorFunc(func(ctx context.Context, job *Job) error {
+			close(started)
+			<-release
+			return nil
+		}),
+	}
+
+	r := health.NewRegistry()
+	s.SetHealth(r)
+
+	errc := make(chan error, 1)
+	if err := s.Run(&errc); err != nil {
+		t.Fatalf("Stage.Run() error = %v", err)
+	}
+
+	status := func() health.ComponentStatus {
+		return r.Liveness().Components["Health Check"]
+	}
+
+	messages <- message.Message{Title: "Test"}
+	<-started
+	if got := status(); got.Workers != 1 || got.Busy != 1 {
+		t.Errorf("Stage health = %+v, want a busy worker", got)
+	}
+
+	close(release)
+	close(messages)
+	<-s.Stopped()
+
+	if got := status(); !got.Stopped || got.Busy != 0 || got.LastProgress.IsZero() {
+		t.Errorf("Stage health = %+v, want a stopped component with progress", got)
+	}
+}
+
+func TestStage_Health_BlockedSend(t *testing.T) {
+	messages := make(chan message.Message, 1)
+	out := make(chan *Job)
+
+	s := &Stage{
+		Name:     "Blocked Send",
+		Messages: messages,
+		Out:      out,
+		Processor: JobProcessorFunc(func(ctx context.Context, job *Job) error {
+			return nil
+		}),
+	}
+
+	r := health.NewRegistry()
+	s.SetHealth(r)
+
+	errc := make(chan error, 1)
+	if err := s.Run(&errc); err != nil {
+		t.Fatalf("Stage.Run() error = %v", err)
+	}
+
+	status := func() health.ComponentStatus {
+		return r.Liveness().Components["Blocked Send"]
+	}
+
+	// Nobody takes the job yet, the worker waits for the next stage.
+	messages <- message.Message{Title: "Test"}
+	time.Sleep(time.Millisecond * 50)
+	if got := status(); got.Busy != 1 || !got.LastProgress.IsZero() {
+		t.Errorf("Stage health = %+v, want a busy worker without progress", got)
+	}
+
+	<-out
+	close(messages)
+	<-s.Stopped()
+
+	if got := status(); got.Busy != 0 || got.LastProgress.IsZero() {
+		t.Errorf("Stage health = %+v, want progress once the job was taken", got)
+	}
+}
@@ -0,0 +1,7 @@
+<?php
+/**
+ * Plugin Name: Plugin One
+ * Description: The first plugin in the bundle.
+ * Version: 1.0.0
+ * Text Domain: plugin-one
+ */
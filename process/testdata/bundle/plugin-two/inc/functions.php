@@ -0,0 +1,5 @@
+<?php
+
+function plugin_two_hello() {
+	return 'Hello';
+}
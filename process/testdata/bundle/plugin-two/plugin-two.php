@@ -0,0 +1,9 @@
+<?php
+/**
+ * Plugin Name: Plugin Two
+ * Description: The second plugin in the bundle.
+ * Version: 2.0.0
+ * Text Domain: plugin-two
+ */
+
+require_once __DIR__ . '/inc/functions.php';
@@ -0,0 +1,2 @@
+<?php
+get_header();
@@ -0,0 +1,79 @@
+package process
+
+import (
+	"context"
+
+	"github.com/wptide/pkg/message"
+	"github.com/wptide/pkg/trace"
+)
+
+// startTrace starts the trace of a message that was received. The span of the message is kept in the
+// results under "traceSpan" and ends once the job is complete.
+func startTrace(msg *message.Message) *trace.Span {
+	// Messages that were queued by another traced service keep its trace.
+	if msg.TraceID == "" {
+		msg.TraceID = trace.NewTraceID()
+	}
+
+	_, span := trace.Start(trace.WithTraceID(context.Background(), msg.TraceID), "message")
+	span.SetAttribute("title", msg.Title)
+	if msg.ExternalRef != nil {
+		span.SetAttribute("external_ref", *msg.ExternalRef)
+	}
+	return span
+}
+
+// endTrace ends the span of the message of a job.
+func endTrace(result *Result, err error) {
+	if result == nil {
+		return
+	}
+	if span, ok := (*result)["traceSpan"].(*trace.Span); ok {
+		span.Finish(err)
+	}
+}
+
+// jobTraceContext returns ctx with the span of the message of a job, to start spans that are children of it.
+func jobTraceContext(ctx context.Context, job *Job) context.Context {
+	ctx = trace.WithTraceID(ctx, job.Message.TraceID)
+	if span, ok := job.Results["traceSpan"].(*trace.Span); ok {
+		ctx = trace.ContextWithSpan(ctx, span)
+	}
+	return ctx
+}
+
+// traceContext returns a context with the current span of the job, to start spans that are children of it.
+// It is done once the context of the process is done.
+func (p *Process) traceContext() context.Context {
+	ctx := p.context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = trace.WithTraceID(ctx, p.Message.TraceID)
+
+	span := p.span
+	if span == nil && p.Result != nil {
+		span, _ = (*p.Result)["traceSpan"].(*trace.Span)
+	}
+	if span != nil {
+		ctx = trace.ContextWithSpan(ctx, span)
+	}
+	return ctx
+}
+
+// startSpan starts a span for a step of the job, as a child of the current span. The returned function
+// ends the span, after which the span before it is the current span again.
+// Every step is a heartbeat of the worker.
+func (p *Process) startSpan(name string) (*trace.Span, func(err error)) {
+	prev := p.span
+
+	_, span := trace.Start(p.traceContext(), name)
+	p.span = span
+	p.health.Beat()
+
+	return span, func(err error) {
+		span.Finish(err)
+		p.span = prev
+		p.health.Beat()
+	}
+}
@@ -0,0 +1,93 @@
+package process
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wptide/pkg/message"
+	"github.com/wptide/pkg/trace"
+)
+
+func TestStage_Trace(t *testing.T) {
+	var mutex sync.Mutex
+	spans := make(map[string]*trace.Span)
+	exported := make(chan struct{}, 3)
+	trace.SetExporter(trace.ExporterFunc(func(span *trace.Span) error {
+		mutex.Lock()
+		spans[span.Name] = span
+		mutex.Unlock()
+		exported <- struct{}{}
+		return nil
+	}))
+	defer trace.SetExporter(nil)
+
+	// The message was queued by another traced service.
+	messages := make(chan message.Message, 1)
+	messages <- message.Message{Title: "Test", TraceID: "queued"}
+	close(messages)
+
+	s := &Stage{
+		Name:     "Audit",
+		Messages: messages,
+		Processor: JobProcessorFunc(func(ctx context.Context, job *Job) error {
+			_, span := trace.Start(ctx, "phpcs")
+			span.Finish(nil)
+			return nil
+		}),
+	}
+
+	errc := make(chan error, 1)
+	if err := s.Run(&errc); err != nil {
+		t.Fatalf("Stage.Run() error = %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-exported:
+		case <-time.After(time.Second):
+			t.Fatalf("Stage.Run() exported %d spans, want 3", i)
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	tests := []struct {
+		name       string
+		wantParent string
+	}{
+		{
+			"message",
+			"",
+		},
+		{
+			"Audit",
+			"message",
+		},
+		{
+			"phpcs",
+			"Audit",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			span := spans[tt.name]
+			if span == nil {
+				t.Fatalf("span %s was not exported", tt.name)
+			}
+			if span.TraceID != "queued" {
+				t.Errorf("span %s TraceID = %v, want %v", tt.name, span.TraceID, "queued")
+			}
+
+			wantParent := ""
+			if tt.wantParent != "" && spans[tt.wantParent] != nil {
+				wantParent = spans[tt.wantParent].SpanID
+			}
+			if span.ParentID != wantParent {
+				t.Errorf("span %s ParentID = %v, want %v", tt.name, span.ParentID, wantParent)
+			}
+		})
+	}
+}
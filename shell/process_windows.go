@@ -0,0 +1,15 @@
+package shell
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup does nothing, process groups are not supported.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the command.
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process != nil {
+		cmd.Process.Kill()
+	}
+}
@@ -2,16 +2,37 @@ package shell
 
 import (
 	"bytes"
+	"context"
 	"os/exec"
 	"sync"
 	"syscall"
+	"time"
 )
 
+// Time to wait for a killed command to finish. Processes that left its process group can keep
+// its output open, so the command is given up on after this delay.
+var waitDelay = 5 * time.Second
+
 // Runner implements an interface for running a shell command.
 type Runner interface {
 	Run(name string, arg ...string) ([]byte, []byte, int, error)
 }
 
+// ContextRunner implements a Runner that stops the command once the context is done.
+type ContextRunner interface {
+	Runner
+	RunContext(ctx context.Context, name string, arg ...string) ([]byte, []byte, int, error)
+}
+
+// RunContext runs the command with the runner, stopping it once the context is done if the runner
+// is a ContextRunner.
+func RunContext(ctx context.Context, r Runner, name string, arg ...string) ([]byte, []byte, int, error) {
+	if cr, ok := r.(ContextRunner); ok && ctx != nil {
+		return cr.RunContext(ctx, name, arg...)
+	}
+	return r.Run(name, arg...)
+}
+
 // Command implements Runner.
 type Command struct {
 	execFunc func(name string, arg ...string) *exec.Cmd
@@ -20,6 +41,12 @@ type Command struct {
 
 // Run executes the shell command.
 func (c *Command) Run(name string, arg ...string) ([]byte, []byte, int, error) {
+	return c.RunContext(context.Background(), name, arg...)
+}
+
+// RunContext executes the shell command and kills it, and any process it started, once the
+// context is done. The error is then the error of the context.
+func (c *Command) RunContext(ctx context.Context, name string, arg ...string) ([]byte, []byte, int, error) {
 
 	c.once.Do(func() {
 		if c.execFunc == nil {
@@ -27,17 +54,46 @@ func (c *Command) Run(name string, arg ...string) ([]byte, []byte, int, error) {
 		}
 	})
 
+	// Don't start a command that would be killed straight away.
+	if err := ctx.Err(); err != nil {
+		return nil, nil, 0, err
+	}
+
 	resultsBuffer := bytes.Buffer{}
 	errorsBuffer := bytes.Buffer{}
 	cmd := c.execFunc(name, arg...)
 	cmd.Stdout = &resultsBuffer
 	cmd.Stderr = &errorsBuffer
 
-	exitCode := 0
-	exitErr := cmd.Run()
+	// Run the command in its own process group, so that we can kill its children too.
+	setProcessGroup(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return resultsBuffer.Bytes(), errorsBuffer.Bytes(), 0, err
+	}
+
+	waitc := make(chan error, 1)
+	go func() {
+		waitc <- cmd.Wait()
+	}()
 
-	if exitErr, ok := exitErr.(*exec.ExitError); ok {
-		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+	var exitErr error
+	select {
+	case exitErr = <-waitc:
+	case <-ctx.Done():
+		killProcessGroup(cmd)
+		select {
+		case <-waitc:
+		case <-time.After(waitDelay):
+			// The output is still being written, so it can't be returned.
+			return nil, nil, 0, ctx.Err()
+		}
+		exitErr = ctx.Err()
+	}
+
+	exitCode := 0
+	if cmd.ProcessState != nil {
+		if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok {
 			exitCode = status.ExitStatus()
 		}
 	}
@@ -1,11 +1,13 @@
 package shell
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"testing"
+	"time"
 )
 
 func mockExecCommand(command string, args ...string) *exec.Cmd {
@@ -105,6 +107,111 @@ func TestCommand_Run(t *testing.T) {
 	}
 }
 
+func TestCommand_RunContext(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeout  time.Duration
+		command  string
+		wantOutB []byte
+		wantErr  error
+	}{
+		{
+			"Run Success",
+			time.Second * 10,
+			"test-success",
+			[]byte("Success!"),
+			nil,
+		},
+		{
+			"Run Timeout",
+			time.Millisecond * 200,
+			"test-hang",
+			[]byte("Hanging..."),
+			context.DeadlineExceeded,
+		},
+		{
+			"Run Timeout - Output Kept Open",
+			time.Millisecond * 200,
+			"test-orphan",
+			nil,
+			context.DeadlineExceeded,
+		},
+	}
+
+	oldWaitDelay := waitDelay
+	waitDelay = time.Millisecond * 200
+	defer func() {
+		waitDelay = oldWaitDelay
+	}()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Command{
+				execFunc: mockExecCommand,
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+
+			start := time.Now()
+			outBuff, _, _, err := c.RunContext(ctx, tt.command)
+			if err != tt.wantErr {
+				t.Errorf("Command.RunContext() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(outBuff) != string(tt.wantOutB) {
+				t.Errorf("Command.RunContext() outBuff = %v, want %v", string(outBuff), string(tt.wantOutB))
+			}
+			if elapsed := time.Since(start); elapsed > tt.timeout+time.Second*5 {
+				t.Errorf("Command.RunContext() took %v, want less than %v", elapsed, tt.timeout)
+			}
+		})
+	}
+}
+
+type mockRunner struct{}
+
+func (m mockRunner) Run(name string, arg ...string) ([]byte, []byte, int, error) {
+	return []byte(name), nil, 0, nil
+}
+
+func TestRunContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name     string
+		r        Runner
+		wantOutB []byte
+		wantErr  bool
+	}{
+		{
+			"Runner",
+			mockRunner{},
+			[]byte("test-success"),
+			false,
+		},
+		{
+			"Context Runner",
+			&Command{
+				execFunc: mockExecCommand,
+			},
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outBuff, _, _, err := RunContext(ctx, tt.r, "test-success")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RunContext() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(outBuff) != string(tt.wantOutB) {
+				t.Errorf("RunContext() outBuff = %v, want %v", string(outBuff), string(tt.wantOutB))
+			}
+		})
+	}
+}
+
 // TestHelperProcess is the fake command.
 func TestHelperProcess(t *testing.T) {
 	// If the helper process var is not set this code should not run.
@@ -140,6 +247,22 @@ func TestHelperProcess(t *testing.T) {
 	case "test-fail":
 		fmt.Fprintf(os.Stderr, "Failed!")
 		os.Exit(0)
+	case "test-hang":
+		fmt.Fprintf(os.Stdout, "Hanging...")
+		time.Sleep(time.Minute)
+		os.Exit(0)
+	case "test-orphan":
+		// Start a process that leaves the process group and keeps the output open.
+		child := mockExecCommand("test-sleep")
+		child.Stdout = os.Stdout
+		setProcessGroup(child)
+		child.Start()
+		fmt.Fprintf(os.Stdout, "Orphan...")
+		time.Sleep(time.Minute)
+		os.Exit(0)
+	case "test-sleep":
+		time.Sleep(time.Second * 10)
+		os.Exit(0)
 	case "test-exit":
 		fmt.Fprintf(os.Stdout, "Exit!")
 		os.Exit(22)
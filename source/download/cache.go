@@ -0,0 +1,179 @@
+package download
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache stores downloaded files on disk by url.
+//
+// Cached files are revalidated with conditional requests (ETag and Last-Modified) and are
+// only served when the server reports them as unchanged. Files are evicted least recently
+// used first when the cache grows larger than MaxSize, or when they have not been used for MaxAge.
+type Cache struct {
+	Dir     string        // Folder where the cached files are stored.
+	MaxSize int64         // Maximum size of all cached files in bytes. 0 means no limit.
+	MaxAge  time.Duration // Evict files that have not been used for this long. 0 means no limit.
+	mutex   sync.Mutex
+}
+
+// cacheEntry describes a cached file.
+type cacheEntry struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	ContentType  string `json:"content_type,omitempty"`
+	Size         int64  `json:"size"`
+}
+
+const (
+	cacheDataExt = ".data"
+	cacheMetaExt = ".json"
+)
+
+var (
+	// Using time.Now as a variable so that we can mock it in tests.
+	now = time.Now
+)
+
+// NewCache returns a new Cache in the given folder.
+func NewCache(dir string, maxSize int64) *Cache {
+	return &Cache{
+		Dir:     dir,
+		MaxSize: maxSize,
+	}
+}
+
+// key returns the file name (without extension) for a url.
+func (c *Cache) key(url string) string {
+	return filepath.Join(c.Dir, fmt.Sprintf("%x", sha256.Sum256([]byte(url))))
+}
+
+// lookup returns the cache entry for a url, or nil if the url is not cached.
+func (c *Cache) lookup(url string) *cacheEntry {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := c.key(url)
+
+	meta, err := ioutil.ReadFile(key + cacheMetaExt)
+	if err != nil {
+		return nil
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(meta, &entry); err != nil || entry.URL != url {
+		return nil
+	}
+
+	if _, err := os.Stat(key + cacheDataExt); err != nil {
+		return nil
+	}
+
+	return &entry
+}
+
+// open opens a cached file and marks it as recently used.
+func (c *Cache) open(url string) (*os.File, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	name := c.key(url) + cacheDataExt
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	t := now()
+	os.Chtimes(name, t, t)
+
+	return f, nil
+}
+
+// create returns a temporary file to write a new download to.
+func (c *Cache) create() (*os.File, error) {
+	if err := os.MkdirAll(c.Dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return ioutil.TempFile(c.Dir, "download-")
+}
+
+// store moves a completed download into the cache and evicts old files.
+func (c *Cache) store(entry cacheEntry, tmp string) error {
+	meta, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := c.key(entry.URL)
+
+	if err := os.Rename(tmp, key+cacheDataExt); err != nil {
+		return err
+	}
+
+	t := now()
+	os.Chtimes(key+cacheDataExt, t, t)
+
+	if err := ioutil.WriteFile(key+cacheMetaExt, meta, 0644); err != nil {
+		os.Remove(key + cacheDataExt)
+		return err
+	}
+
+	return c.evict()
+}
+
+// Evict removes files that are too old or don't fit in the cache.
+func (c *Cache) Evict() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.evict()
+}
+
+// evict expects the mutex to be held.
+func (c *Cache) evict() error {
+	files, err := ioutil.ReadDir(c.Dir)
+	if err != nil {
+		return err
+	}
+
+	// Most recently used first.
+	var data []os.FileInfo
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), cacheDataExt) {
+			data = append(data, file)
+		}
+	}
+	sort.Slice(data, func(i, j int) bool {
+		return data[i].ModTime().After(data[j].ModTime())
+	})
+
+	var total int64
+	for _, file := range data {
+		total += file.Size()
+
+		expired := c.MaxAge > 0 && now().Sub(file.ModTime()) > c.MaxAge
+		full := c.MaxSize > 0 && total > c.MaxSize
+
+		if expired || full {
+			key := filepath.Join(c.Dir, strings.TrimSuffix(file.Name(), cacheDataExt))
+			os.Remove(key + cacheDataExt)
+			os.Remove(key + cacheMetaExt)
+			total -= file.Size()
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,307 @@
+package download
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// cacheServer serves a file with validators and counts full and conditional responses.
+type cacheServer struct {
+	body         []byte
+	etag         string
+	lastModified time.Time
+	full         int
+	notModified  int
+	onRequest    func() // (Optional) Called before every response.
+}
+
+func (m *cacheServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if m.onRequest != nil {
+		m.onRequest()
+	}
+
+	rec := httptest.NewRecorder()
+	if m.etag != "" {
+		rec.Header().Set("ETag", m.etag)
+	}
+
+	http.ServeContent(rec, r, "", m.lastModified, bytes.NewReader(m.body))
+
+	switch rec.Code {
+	case http.StatusNotModified:
+		m.notModified++
+	case http.StatusOK:
+		m.full++
+	}
+
+	for k, v := range rec.Header() {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rec.Code)
+	w.Write(rec.Body.Bytes())
+}
+
+func readAll(client *Client, url string) ([]byte, error) {
+	body, err := client.Open(url)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return ioutil.ReadAll(body)
+}
+
+func TestCache(t *testing.T) {
+
+	modified := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		server          *cacheServer
+		client          *Client
+		change          []byte // Content served for the second request, if changed.
+		wantFull        int
+		wantNotModified int
+		wantCached      bool
+	}{
+		{
+			"ETag - Unchanged",
+			&cacheServer{
+				body: content,
+				etag: `"v1"`,
+			},
+			New(),
+			nil,
+			1,
+			1,
+			true,
+		},
+		{
+			"ETag - Changed",
+			&cacheServer{
+				body: content,
+				etag: `"v1"`,
+			},
+			New(),
+			[]byte("new content"),
+			2,
+			0,
+			true,
+		},
+		{
+			"Last-Modified - Unchanged",
+			&cacheServer{
+				body:         content,
+				lastModified: modified,
+			},
+			New(),
+			nil,
+			1,
+			1,
+			true,
+		},
+		{
+			"Last-Modified - Changed",
+			&cacheServer{
+				body:         content,
+				lastModified: modified,
+			},
+			New(),
+			[]byte("new content"),
+			2,
+			0,
+			true,
+		},
+		{
+			"No Validators",
+			&cacheServer{
+				body: content,
+			},
+			New(),
+			nil,
+			2,
+			0,
+			false,
+		},
+		{
+			"Invalid Checksum",
+			&cacheServer{
+				body: content,
+				etag: `"v1"`,
+			},
+			New().WithChecksum("abcdef"),
+			nil,
+			2,
+			0,
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, _ := ioutil.TempDir("", "download-cache")
+			defer os.RemoveAll(dir)
+
+			server := httptest.NewServer(tt.server)
+			defer server.Close()
+
+			cache := NewCache(dir, 0)
+			client := tt.client.WithCache(cache)
+
+			first, firstErr := readAll(client, server.URL+"/source.zip")
+
+			if tt.change != nil {
+				tt.server.body = tt.change
+				tt.server.etag = `"v2"`
+				tt.server.lastModified = modified.Add(time.Hour)
+			}
+
+			second, secondErr := readAll(client, server.URL+"/source.zip")
+
+			if firstErr == nil && tt.change == nil && !bytes.Equal(first, second) {
+				t.Errorf("Cache served %d bytes, want %d bytes", len(second), len(first))
+			}
+			if secondErr == nil && !bytes.Equal(second, tt.server.body) {
+				t.Errorf("Cache served %d bytes, want %d bytes", len(second), len(tt.server.body))
+			}
+
+			if tt.server.full != tt.wantFull {
+				t.Errorf("Cache full responses = %v, want %v", tt.server.full, tt.wantFull)
+			}
+			if tt.server.notModified != tt.wantNotModified {
+				t.Errorf("Cache not modified responses = %v, want %v", tt.server.notModified, tt.wantNotModified)
+			}
+
+			entry := cache.lookup(server.URL + "/source.zip")
+			if (entry != nil) != tt.wantCached {
+				t.Errorf("Cache entry = %v, wantCached %v", entry, tt.wantCached)
+			}
+			if entry != nil && entry.Size != int64(len(tt.server.body)) {
+				t.Errorf("Cache entry size = %v, want %v", entry.Size, len(tt.server.body))
+			}
+
+			// No temporary files should be left behind.
+			if tmp, _ := filepath.Glob(filepath.Join(dir, "download-*")); len(tmp) != 0 {
+				t.Errorf("Cache left temporary files %v", tmp)
+			}
+		})
+	}
+}
+
+func TestCache_EvictedWhileRevalidating(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "download-cache")
+	defer os.RemoveAll(dir)
+
+	server := &cacheServer{
+		body: content,
+		etag: `"v1"`,
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	url := ts.URL + "/source.zip"
+	cache := NewCache(dir, 0)
+	client := New().WithCache(cache)
+
+	if _, err := readAll(client, url); err != nil {
+		t.Fatalf("Client.Open() error = %v", err)
+	}
+
+	// The file is evicted after it was looked up, while the server confirms that it is unchanged.
+	server.onRequest = func() {
+		os.Remove(cache.key(url) + cacheDataExt)
+	}
+
+	got, err := readAll(client, url)
+	if err != nil || !bytes.Equal(got, content) {
+		t.Errorf("Client.Open() = %d bytes, error = %v, want %d bytes", len(got), err, len(content))
+	}
+	if server.notModified != 1 || server.full != 2 {
+		t.Errorf("Cache responses = %v full, %v not modified, want the file again after it was evicted", server.full, server.notModified)
+	}
+}
+
+func TestCache_Evict(t *testing.T) {
+
+	oldNow := now
+	current := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time {
+		return current
+	}
+	defer func() {
+		now = oldNow
+	}()
+
+	tests := []struct {
+		name       string
+		maxSize    int64
+		maxAge     time.Duration
+		wantCached []string
+	}{
+		{
+			"No Limits",
+			0,
+			0,
+			[]string{"a", "b", "c"},
+		},
+		{
+			"Max Size",
+			25,
+			0,
+			[]string{"b", "c"},
+		},
+		{
+			"Max Age",
+			0,
+			time.Minute * 90,
+			[]string{"b", "c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, _ := ioutil.TempDir("", "download-cache")
+			defer os.RemoveAll(dir)
+
+			cache := NewCache(dir, tt.maxSize)
+			cache.MaxAge = tt.maxAge
+
+			// Store a file every hour, each 10 bytes.
+			start := current
+			for _, url := range []string{"a", "b", "c"} {
+				tmp, _ := cache.create()
+				tmp.Write([]byte("0123456789"))
+				tmp.Close()
+				if err := cache.store(cacheEntry{URL: url, ETag: url, Size: 10}, tmp.Name()); err != nil {
+					t.Errorf("Cache.store() error = %v", err)
+				}
+				current = current.Add(time.Hour)
+			}
+			current = start.Add(time.Hour * 2)
+
+			if err := cache.Evict(); err != nil {
+				t.Errorf("Cache.Evict() error = %v", err)
+			}
+
+			var got []string
+			for _, url := range []string{"a", "b", "c"} {
+				if cache.lookup(url) != nil {
+					got = append(got, url)
+				}
+			}
+
+			if len(got) != len(tt.wantCached) {
+				t.Errorf("Cache entries = %v, want %v", got, tt.wantCached)
+				return
+			}
+			for i := range got {
+				if got[i] != tt.wantCached[i] {
+					t.Errorf("Cache entries = %v, want %v", got, tt.wantCached)
+				}
+			}
+		})
+	}
+}
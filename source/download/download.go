@@ -0,0 +1,481 @@
+package download
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Error is a new error type for failed downloads.
+type Error struct {
+	error      string
+	Type       int
+	URL        string
+	StatusCode int // (Optional) Status code of the response, for ErrStatus errors.
+}
+
+/*
+ * Constants to represent download error types.
+ *
+ * ErrRequest is a request that could not be completed (e.g. network error).
+ * ErrStatus is a response with an unexpected status code.
+ * ErrTooLarge is a response body larger than the maximum size.
+ * ErrChecksum is a downloaded file that does not match the expected checksum.
+ */
+const (
+	ErrRequest = iota
+	ErrStatus
+	ErrTooLarge
+	ErrChecksum
+)
+
+func (e Error) Error() string {
+	return e.error
+}
+
+// NewError creates a new error object for the given type and url.
+func NewError(errType int, url string, s string) *Error {
+	return &Error{
+		error: "download: " + s + ": " + url,
+		Type:  errType,
+		URL:   url,
+	}
+}
+
+// newStatusError creates a new ErrStatus error for a response.
+func newStatusError(url string, resp *http.Response, s string) *Error {
+	err := NewError(ErrStatus, url, s)
+	err.StatusCode = resp.StatusCode
+	return err
+}
+
+// Default settings for new clients.
+const (
+	DefaultTimeout = time.Minute * 10
+	DefaultRetries = 3
+	DefaultBackoff = time.Second
+	DefaultMaxSize = 512 << 20 // 512MB
+)
+
+var (
+	// Using time.Sleep as a variable so that we can mock it in tests.
+	sleep = time.Sleep
+)
+
+// Client downloads files over HTTP.
+type Client struct {
+	HTTPClient *http.Client  // Client used for the requests.
+	Retries    int           // Number of retries after a failed request.
+	Backoff    time.Duration // Delay before the first retry, doubles with every retry.
+	MaxSize    int64         // Maximum size of the response body in bytes. 0 means no limit.
+	Checksum   string        // (Optional) Expected SHA-256 (hex) of the response body.
+	Cache      *Cache        // (Optional) Cache for downloaded files.
+	peek       *Peek         // Download that the next Open of its url continues.
+}
+
+// New returns a new Client with the default settings.
+func New() *Client {
+	return &Client{
+		HTTPClient: &http.Client{Timeout: DefaultTimeout},
+		Retries:    DefaultRetries,
+		Backoff:    DefaultBackoff,
+		MaxSize:    DefaultMaxSize,
+	}
+}
+
+// WithChecksum returns a copy of the client that verifies the given checksum.
+func (c Client) WithChecksum(checksum string) *Client {
+	c.Checksum = strings.ToLower(checksum)
+	return &c
+}
+
+// WithCache returns a copy of the client that uses the given cache.
+func (c Client) WithCache(cache *Cache) *Client {
+	c.Cache = cache
+	return &c
+}
+
+// WithPeek returns a copy of the client whose next Open of the url of the peek continues the peeked
+// download, instead of requesting the url again.
+func (c Client) WithPeek(peek *Peek) *Client {
+	c.peek = peek
+	return &c
+}
+
+// Open requests a url and returns a reader for the response body.
+//
+// Failed requests and server errors are retried with backoff. If the connection drops
+// while reading, the reader resumes the download with an HTTP Range request, which only
+// continues the same version of the file, see If-Range. If the server sends the whole file
+// instead, the download restarts and the bytes that were already read must not have changed.
+// The reader returns an *Error if the body is too large or does not match the checksum.
+//
+// If the client has a Cache, a cached file is revalidated and served when unchanged,
+// and completed downloads are added to the cache.
+func (c *Client) Open(url string) (io.ReadCloser, error) {
+	if c.peek != nil && c.peek.URL == url {
+		if body := c.peek.take(); body != nil {
+			return body, nil
+		}
+	}
+
+	return c.open(url)
+}
+
+// Peek opens a url and reads up to the first n bytes of the content, e.g. to sniff what it is.
+// The download can be continued with a client from WithPeek, otherwise close the peek.
+func (c *Client) Peek(url string, n int) (*Peek, error) {
+	r, err := c.open(url)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, n)
+	read, err := io.ReadFull(r, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		r.Close()
+		return nil, err
+	}
+
+	return &Peek{
+		URL:         url,
+		ContentType: r.contentType,
+		Header:      header[:read],
+		body:        r,
+	}, nil
+}
+
+// open requests a url and returns a reader for the response body.
+func (c *Client) open(url string) (*reader, error) {
+	r := &reader{
+		client: c,
+		url:    url,
+		hash:   sha256.New(),
+	}
+
+	if c.Cache != nil {
+		r.cached = c.Cache.lookup(url)
+	}
+
+	if err := r.request(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Peek is a download whose first bytes were read ahead, see Client.Peek.
+type Peek struct {
+	URL         string // Url of the download.
+	ContentType string // Media type of the content in lower case, if the server sent one.
+	Header      []byte // First bytes of the content.
+	mutex       sync.Mutex
+	body        io.ReadCloser // Rest of the download, nil once a client took it.
+}
+
+// take returns a reader for the whole content and hands the download over to the caller, once.
+func (p *Peek) take() io.ReadCloser {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.body == nil {
+		return nil
+	}
+
+	body := p.body
+	p.body = nil
+	return &peekReader{
+		Reader: io.MultiReader(bytes.NewReader(p.Header), body),
+		body:   body,
+	}
+}
+
+// Close closes the download, unless a client continued it.
+func (p *Peek) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.body == nil {
+		return nil
+	}
+
+	err := p.body.Close()
+	p.body = nil
+	return err
+}
+
+// peekReader reads the peeked bytes and then the rest of the download.
+type peekReader struct {
+	io.Reader
+	body io.ReadCloser
+}
+
+// Close implements io.Closer.
+func (r *peekReader) Close() error {
+	return r.body.Close()
+}
+
+// reader reads a response body and resumes the download if reading fails.
+type reader struct {
+	client  *Client
+	url     string
+	body    io.ReadCloser
+	hash    hash.Hash
+	offset  int64
+	retries int
+	cached  *cacheEntry // Cache entry to revalidate.
+	entry   cacheEntry  // Cache entry for the new download.
+	tmp     *os.File    // Temporary file the new download is written to.
+
+	contentType string // Media type of the content in lower case.
+	validator   string // ETag or Last-Modified of the download, so that it is only resumed if unchanged.
+	restart     bool   // Request the whole file, the server didn't send the requested range.
+}
+
+// request performs a (ranged) request, retrying on failures.
+func (r *reader) request() error {
+	httpClient := r.client.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	lastErr := NewError(ErrRequest, r.url, "no attempts left")
+	for ; r.retries <= r.client.Retries; r.retries++ {
+		if r.retries > 0 {
+			sleep(r.client.Backoff * time.Duration(1<<uint(r.retries-1)))
+		}
+
+		req, err := http.NewRequest(http.MethodGet, r.url, nil)
+		if err != nil {
+			return NewError(ErrRequest, r.url, err.Error())
+		}
+
+		if r.offset > 0 && !r.restart {
+			req.Header.Set("Range", "bytes="+strconv.FormatInt(r.offset, 10)+"-")
+			if r.validator != "" {
+				req.Header.Set("If-Range", r.validator)
+			}
+		} else if r.offset == 0 && r.cached != nil {
+			if r.cached.ETag != "" {
+				req.Header.Set("If-None-Match", r.cached.ETag)
+			}
+			if r.cached.LastModified != "" {
+				req.Header.Set("If-Modified-Since", r.cached.LastModified)
+			}
+		}
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			lastErr = NewError(ErrRequest, r.url, err.Error())
+			continue
+		}
+
+		// Server errors and rate limits are worth retrying, anything else is permanent.
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			resp.Body.Close()
+			lastErr = newStatusError(r.url, resp, "unexpected status "+resp.Status)
+			continue
+		}
+
+		// The cached file is still valid.
+		if resp.StatusCode == http.StatusNotModified && r.cached != nil {
+			resp.Body.Close()
+			f, err := r.client.Cache.open(r.url)
+			if err != nil {
+				// The file was evicted since it was looked up, download it again.
+				r.cached = nil
+				return r.request()
+			}
+			r.body = f
+			r.contentType = r.cached.ContentType
+			return nil
+		}
+
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+			resp.Body.Close()
+			return newStatusError(r.url, resp, "unexpected status "+resp.Status)
+		}
+
+		// A resumed download must continue where it stopped, otherwise the whole file is requested.
+		if resp.StatusCode == http.StatusPartialContent && (r.offset == 0 || r.restart || rangeStart(resp) != r.offset) {
+			resp.Body.Close()
+			r.restart = true
+			lastErr = NewError(ErrRequest, r.url, "server sent the wrong range of the file")
+			continue
+		}
+
+		size := resp.ContentLength
+		if resp.StatusCode == http.StatusPartialContent {
+			size += r.offset
+		}
+		if r.client.MaxSize > 0 && resp.ContentLength > 0 && size > r.client.MaxSize {
+			resp.Body.Close()
+			return NewError(ErrTooLarge, r.url, fmt.Sprintf("file is larger than %d bytes", r.client.MaxSize))
+		}
+
+		if resp.StatusCode == http.StatusOK && r.offset > 0 {
+			// The server sent the whole file, e.g. because it changed or doesn't support ranges.
+			if err := r.skip(resp.Body); err != nil {
+				resp.Body.Close()
+				return err
+			}
+		} else if resp.StatusCode == http.StatusOK {
+			r.contentType = mediaType(resp)
+			r.validator = validator(resp)
+			r.startCache(resp)
+		}
+
+		r.restart = false
+		r.body = resp.Body
+		return nil
+	}
+
+	return lastErr
+}
+
+// skip reads the part of a restarted download that was already read, which must not have changed.
+func (r *reader) skip(body io.Reader) error {
+	h := sha256.New()
+	if _, err := io.CopyN(h, body, r.offset); err != nil {
+		return NewError(ErrRequest, r.url, "could not restart the download: "+err.Error())
+	}
+	if !bytes.Equal(h.Sum(nil), r.hash.Sum(nil)) {
+		return NewError(ErrRequest, r.url, "file changed while downloading")
+	}
+	return nil
+}
+
+// rangeStart returns the first byte of a partial response, or -1 if its Content-Range is invalid.
+func rangeStart(resp *http.Response) int64 {
+	// e.g. "bytes 100-199/200"
+	contentRange := strings.TrimPrefix(resp.Header.Get("Content-Range"), "bytes ")
+	i := strings.Index(contentRange, "-")
+	if i == -1 {
+		return -1
+	}
+	start, err := strconv.ParseInt(contentRange[:i], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return start
+}
+
+// validator returns the strong ETag of a response, or else its Last-Modified header, for If-Range.
+// Weak ETags can't be used for ranges.
+func validator(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// startCache starts writing a new download to the cache.
+// Responses without an ETag or Last-Modified header can't be revalidated, so they are not cached.
+func (r *reader) startCache(resp *http.Response) {
+	r.discardCache()
+
+	if r.client.Cache == nil {
+		return
+	}
+
+	r.entry = cacheEntry{
+		URL:          r.url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		ContentType:  r.contentType,
+	}
+	if r.entry.ETag == "" && r.entry.LastModified == "" {
+		return
+	}
+
+	if tmp, err := r.client.Cache.create(); err == nil {
+		r.tmp = tmp
+	}
+}
+
+// mediaType returns the Content-Type of a response in lower case, without parameters.
+func mediaType(resp *http.Response) string {
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return strings.ToLower(contentType)
+}
+
+// discardCache removes a download that could not be completed from the cache.
+func (r *reader) discardCache() {
+	if r.tmp != nil {
+		r.tmp.Close()
+		os.Remove(r.tmp.Name())
+		r.tmp = nil
+	}
+}
+
+// commitCache adds a completed download to the cache.
+func (r *reader) commitCache() {
+	if r.tmp == nil {
+		return
+	}
+
+	name := r.tmp.Name()
+	r.tmp.Close()
+	r.tmp = nil
+
+	r.entry.Size = r.offset
+	if err := r.client.Cache.store(r.entry, name); err != nil {
+		os.Remove(name)
+	}
+}
+
+// Read implements io.Reader.
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+
+	r.hash.Write(p[:n])
+	r.offset += int64(n)
+
+	if r.tmp != nil {
+		if _, writeErr := r.tmp.Write(p[:n]); writeErr != nil {
+			r.discardCache()
+		}
+	}
+
+	if r.client.MaxSize > 0 && r.offset > r.client.MaxSize {
+		r.discardCache()
+		return n, NewError(ErrTooLarge, r.url, fmt.Sprintf("file is larger than %d bytes", r.client.MaxSize))
+	}
+
+	switch {
+	case err == io.EOF:
+		if r.client.Checksum != "" {
+			if sum := fmt.Sprintf("%x", r.hash.Sum(nil)); sum != r.client.Checksum {
+				r.discardCache()
+				return n, NewError(ErrChecksum, r.url, "checksum "+sum+" does not match expected "+r.client.Checksum)
+			}
+		}
+		r.commitCache()
+	case err != nil && r.retries < r.client.Retries:
+		// The connection dropped, resume from where we are.
+		r.body.Close()
+		r.retries++
+		if reqErr := r.request(); reqErr != nil {
+			r.discardCache()
+			return n, reqErr
+		}
+		return n, nil
+	}
+
+	return n, err
+}
+
+// Close implements io.Closer.
+func (r *reader) Close() error {
+	r.discardCache()
+	return r.body.Close()
+}
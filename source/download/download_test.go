@@ -0,0 +1,471 @@
+package download
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	content         = []byte(strings.Repeat("Tide audits WordPress plugins and themes. ", 100))
+	contentChecksum = fmt.Sprintf("%x", sha256.Sum256(content))
+)
+
+// mockServer serves `content` and can misbehave for the first requests.
+type mockServer struct {
+	sync.Mutex
+	requests int
+	failures int  // Number of requests that fail with a 503.
+	drops    int  // Number of requests that drop the connection half way.
+	noRange  bool // Ignore Range headers.
+	badRange bool // Respond to Range headers with the whole file as partial content.
+	status   int  // Always respond with this status.
+	etag     string
+	changed  []byte // (Optional) Content served after the dropped connections, with another ETag.
+	ranges   []string
+	ifRanges []string
+}
+
+func (m *mockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.Lock()
+	m.requests++
+	request := m.requests
+	m.ranges = append(m.ranges, r.Header.Get("Range"))
+	m.ifRanges = append(m.ifRanges, r.Header.Get("If-Range"))
+	m.Unlock()
+
+	body, etag := content, m.etag
+	if m.changed != nil && request > m.failures+m.drops {
+		body, etag = m.changed, m.etag+"-changed"
+	}
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+
+	if m.status != 0 {
+		w.WriteHeader(m.status)
+		return
+	}
+
+	if request <= m.failures {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	if request <= m.failures+m.drops {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(content[:len(content)/2])
+		// Abort the connection so the client gets an unexpected EOF.
+		panic(http.ErrAbortHandler)
+	}
+
+	if m.noRange {
+		r.Header.Del("Range")
+	}
+
+	if m.badRange && r.Header.Get("Range") != "" {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(body)-1, len(body)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(body)
+		return
+	}
+
+	http.ServeContent(w, r, "source.zip", time.Time{}, bytes.NewReader(body))
+}
+
+func TestClient_Open(t *testing.T) {
+
+	// Don't wait for retries.
+	oldSleep := sleep
+	var slept []time.Duration
+	sleep = func(d time.Duration) {
+		slept = append(slept, d)
+	}
+	defer func() {
+		sleep = oldSleep
+	}()
+
+	tests := []struct {
+		name        string
+		server      *mockServer
+		client      *Client
+		want        []byte
+		wantRanges  []string
+		wantSlept   []time.Duration
+		wantErr     bool
+		wantErrType int
+	}{
+		{
+			"Success",
+			&mockServer{},
+			New(),
+			content,
+			[]string{""},
+			nil,
+			false,
+			0,
+		},
+		{
+			"Success - Valid Checksum",
+			&mockServer{},
+			New().WithChecksum(strings.ToUpper(contentChecksum)),
+			content,
+			[]string{""},
+			nil,
+			false,
+			0,
+		},
+		{
+			"Invalid Checksum",
+			&mockServer{},
+			New().WithChecksum("abcdef"),
+			nil,
+			nil,
+			nil,
+			true,
+			ErrChecksum,
+		},
+		{
+			"Not Found",
+			&mockServer{
+				status: http.StatusNotFound,
+			},
+			New(),
+			nil,
+			[]string{""},
+			nil,
+			true,
+			ErrStatus,
+		},
+		{
+			"Retry Server Errors",
+			&mockServer{
+				failures: 2,
+			},
+			New(),
+			content,
+			[]string{"", "", ""},
+			[]time.Duration{time.Second, time.Second * 2},
+			false,
+			0,
+		},
+		{
+			"Too Many Server Errors",
+			&mockServer{
+				failures: 5,
+			},
+			New(),
+			nil,
+			[]string{"", "", "", ""},
+			[]time.Duration{time.Second, time.Second * 2, time.Second * 4},
+			true,
+			ErrStatus,
+		},
+		{
+			"Resume Dropped Connection",
+			&mockServer{
+				drops: 1,
+			},
+			New().WithChecksum(contentChecksum),
+			content,
+			[]string{"", "bytes=" + strconv.Itoa(len(content)/2) + "-"},
+			[]time.Duration{time.Second},
+			false,
+			0,
+		},
+		{
+			"Resume Not Supported",
+			&mockServer{
+				drops:   1,
+				noRange: true,
+			},
+			New().WithChecksum(contentChecksum),
+			content,
+			[]string{"", "bytes=" + strconv.Itoa(len(content)/2) + "-"},
+			[]time.Duration{time.Second},
+			false,
+			0,
+		},
+		{
+			"Resume Wrong Range",
+			&mockServer{
+				drops:    1,
+				badRange: true,
+			},
+			New().WithChecksum(contentChecksum),
+			content,
+			[]string{"", "bytes=" + strconv.Itoa(len(content)/2) + "-", ""},
+			[]time.Duration{time.Second, time.Second * 2},
+			false,
+			0,
+		},
+		{
+			"Resume Changed File",
+			&mockServer{
+				drops:   1,
+				etag:    `"v1"`,
+				changed: bytes.Repeat([]byte("Changed. "), 500),
+			},
+			New(),
+			nil,
+			nil,
+			nil,
+			true,
+			ErrRequest,
+		},
+		{
+			"Too Large - Content Length",
+			&mockServer{},
+			&Client{
+				MaxSize: 100,
+			},
+			nil,
+			[]string{""},
+			nil,
+			true,
+			ErrTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slept = nil
+
+			server := httptest.NewServer(tt.server)
+			defer server.Close()
+
+			body, err := tt.client.Open(server.URL + "/source.zip")
+
+			var got []byte
+			if err == nil {
+				got, err = ioutil.ReadAll(body)
+				body.Close()
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.Open() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if err != nil {
+				e, ok := err.(*Error)
+				if !ok || e.Type != tt.wantErrType {
+					t.Errorf("Client.Open() error = %#v, want type %v", err, tt.wantErrType)
+					return
+				}
+				if e.Type == ErrStatus && e.StatusCode == 0 {
+					t.Errorf("Client.Open() error = %#v, want the status code", err)
+				}
+				return
+			}
+
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Client.Open() body = %d bytes, want %d bytes", len(got), len(tt.want))
+			}
+
+			if tt.wantRanges != nil && strings.Join(tt.server.ranges, ",") != strings.Join(tt.wantRanges, ",") {
+				t.Errorf("Client.Open() ranges = %v, want %v", tt.server.ranges, tt.wantRanges)
+			}
+
+			if fmt.Sprint(slept) != fmt.Sprint(tt.wantSlept) {
+				t.Errorf("Client.Open() backoff = %v, want %v", slept, tt.wantSlept)
+			}
+		})
+	}
+}
+
+func TestClient_Open_IfRange(t *testing.T) {
+
+	// Don't wait for retries.
+	oldSleep := sleep
+	sleep = func(d time.Duration) {}
+	defer func() {
+		sleep = oldSleep
+	}()
+
+	server := &mockServer{
+		drops: 1,
+		etag:  `"v1"`,
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	got, err := readAll(New(), ts.URL+"/source.zip")
+	if err != nil || !bytes.Equal(got, content) {
+		t.Errorf("Client.Open() = %d bytes, error = %v, want %d bytes", len(got), err, len(content))
+	}
+
+	// The download is only resumed if it is still the same file.
+	if want := []string{"", `"v1"`}; fmt.Sprint(server.ifRanges) != fmt.Sprint(want) {
+		t.Errorf("Client.Open() If-Range = %v, want %v", server.ifRanges, want)
+	}
+}
+
+func TestClient_Open_TooLargeBody(t *testing.T) {
+
+	// Chunked responses have no Content-Length, the size is only known while reading.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(content)
+		w.(http.Flusher).Flush()
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	client := &Client{
+		MaxSize: int64(len(content)),
+	}
+
+	body, err := client.Open(server.URL)
+	if err != nil {
+		t.Errorf("Client.Open() error = %v", err)
+		return
+	}
+	defer body.Close()
+
+	_, err = ioutil.ReadAll(body)
+	if e, ok := err.(*Error); !ok || e.Type != ErrTooLarge {
+		t.Errorf("Client.Open() error = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestClient_Open_RequestError(t *testing.T) {
+
+	oldSleep := sleep
+	sleep = func(d time.Duration) {}
+	defer func() {
+		sleep = oldSleep
+	}()
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{
+			"Invalid Url",
+			"http://[::1",
+		},
+		{
+			"Unreachable Url",
+			"http://error.err/source.zip",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New().Open(tt.url)
+			if e, ok := err.(*Error); !ok || e.Type != ErrRequest {
+				t.Errorf("Client.Open() error = %v, want ErrRequest", err)
+			}
+		})
+	}
+}
+
+func TestClient_Peek(t *testing.T) {
+	tests := []struct {
+		name         string
+		length       int
+		checksum     string
+		continued    bool
+		wantRequests int
+		wantErr      bool
+	}{
+		{
+			"Continue Download",
+			512,
+			contentChecksum,
+			true,
+			1,
+			false,
+		},
+		{
+			"Peek Everything",
+			len(content) * 2,
+			"",
+			true,
+			1,
+			false,
+		},
+		{
+			"Closed Peek",
+			512,
+			"",
+			false,
+			2,
+			false,
+		},
+		{
+			"Checksum Mismatch",
+			512,
+			"abc123",
+			true,
+			1,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &mockServer{}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			client := New().WithChecksum(tt.checksum)
+
+			peek, err := client.Peek(ts.URL, tt.length)
+			if err != nil {
+				t.Errorf("Client.Peek() error = %v", err)
+				return
+			}
+			if peek.ContentType != "application/zip" {
+				t.Errorf("Client.Peek() content type = %v, want application/zip", peek.ContentType)
+			}
+			want := tt.length
+			if want > len(content) {
+				want = len(content)
+			}
+			if !bytes.Equal(peek.Header, content[:want]) {
+				t.Errorf("Client.Peek() header = %d bytes, want %d", len(peek.Header), want)
+			}
+
+			if tt.continued {
+				client = client.WithPeek(peek)
+			} else {
+				peek.Close()
+			}
+
+			body, err := client.Open(ts.URL)
+			if err != nil {
+				t.Errorf("Client.Open() error = %v", err)
+				return
+			}
+			got, err := ioutil.ReadAll(body)
+			body.Close()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.Open() read error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !bytes.Equal(got, content) {
+				t.Errorf("Client.Open() body = %d bytes, want %d", len(got), len(content))
+			}
+			if server.requests != tt.wantRequests {
+				t.Errorf("Client.Peek() requests = %v, want %v", server.requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestError_Error(t *testing.T) {
+	err := NewError(ErrStatus, "http://example.local/source.zip", "unexpected status 404 Not Found")
+	want := "download: unexpected status 404 Not Found: http://example.local/source.zip"
+
+	if got := err.Error(); got != want {
+		t.Errorf("Error.Error() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,157 @@
+package source
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExtractError is a new error type for archives that violate an ExtractPolicy.
+type ExtractError struct {
+	error string
+	Type  int
+	Path  string
+}
+
+/*
+ * Constants to represent extract error types.
+ *
+ * ErrPathTraversal is an entry that would be written outside the destination.
+ * ErrTotalSize is an archive that exceeds the maximum uncompressed size.
+ * ErrFileCount is an archive that contains too many files.
+ * ErrCompressionRatio is an entry that is compressed suspiciously well (zip bomb).
+ * ErrSymlink is a symlink entry when symlinks are rejected.
+ */
+const (
+	ErrPathTraversal = iota
+	ErrTotalSize
+	ErrFileCount
+	ErrCompressionRatio
+	ErrSymlink
+)
+
+func (e ExtractError) Error() string {
+	return e.error
+}
+
+// NewExtractError creates a new error object for the given type and archive entry.
+func NewExtractError(errType int, path string, s string) *ExtractError {
+	return &ExtractError{
+		error: "extract: " + s + ": " + path,
+		Type:  errType,
+		Path:  path,
+	}
+}
+
+/*
+ * Constants to represent how symlink entries are handled.
+ *
+ * SymlinkSkip ignores symlink entries.
+ * SymlinkReject fails the extraction with an ErrSymlink error.
+ */
+const (
+	SymlinkSkip = iota
+	SymlinkReject
+)
+
+// ExtractPolicy describes the limits for extracting an archive. A zero limit means no limit.
+type ExtractPolicy struct {
+	MaxTotalSize        int64   // Maximum uncompressed size of all files, in bytes.
+	MaxFiles            int     // Maximum number of files.
+	MaxCompressionRatio float64 // Maximum uncompressed to compressed size ratio of a single file.
+	Symlinks            int     // How to handle symlink entries.
+}
+
+// DefaultExtractPolicy is used by archive sources when no policy is set.
+var DefaultExtractPolicy = ExtractPolicy{
+	MaxTotalSize:        1 << 30, // 1GB
+	MaxFiles:            50000,
+	MaxCompressionRatio: 200,
+	Symlinks:            SymlinkSkip,
+}
+
+// Version control folders, they are not part of the audited code.
+var vcsFolders = map[string]bool{
+	".git": true,
+	".svn": true,
+	".hg":  true,
+}
+
+// InVCSFolder returns true if an entry is, or is in, a version control folder, e.g. ".git".
+// Sources skip these entries, so that the same project results in the same files and checksum.
+func InVCSFolder(name string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(name), "/") {
+		if vcsFolders[part] {
+			return true
+		}
+	}
+	return false
+}
+
+// Extractor is implemented by sources that extract archives and accept an ExtractPolicy.
+type Extractor interface {
+	SetExtractPolicy(policy ExtractPolicy)
+}
+
+// Extraction enforces an ExtractPolicy for a single archive being extracted to a destination.
+type Extraction struct {
+	policy      ExtractPolicy
+	destination string
+	files       int
+	size        int64
+}
+
+// NewExtraction returns a new Extraction for the given destination.
+func NewExtraction(destination string, policy ExtractPolicy) *Extraction {
+	return &Extraction{
+		policy:      policy,
+		destination: filepath.Clean(destination),
+	}
+}
+
+// Path returns the path an entry is extracted to, or an error if it would escape the destination.
+func (e *Extraction) Path(name string) (string, error) {
+	path := filepath.Join(e.destination, name)
+
+	if path != e.destination && !strings.HasPrefix(path, e.destination+string(os.PathSeparator)) {
+		return "", NewExtractError(ErrPathTraversal, name, "path escapes destination")
+	}
+
+	return path, nil
+}
+
+// AddFile accounts for a file entry and returns an error if it violates the policy.
+// Use a compressed size of 0 if the size is not known.
+func (e *Extraction) AddFile(name string, size, compressed int64) error {
+	e.files++
+	e.size += size
+
+	if e.policy.MaxFiles > 0 && e.files > e.policy.MaxFiles {
+		return NewExtractError(ErrFileCount, name, fmt.Sprintf("archive has more than %d files", e.policy.MaxFiles))
+	}
+
+	if e.policy.MaxTotalSize > 0 && e.size > e.policy.MaxTotalSize {
+		return NewExtractError(ErrTotalSize, name, fmt.Sprintf("archive is larger than %d bytes", e.policy.MaxTotalSize))
+	}
+
+	return e.CheckRatio(name, size, compressed)
+}
+
+// CheckRatio returns an error if the compression ratio of an entry (or a whole archive) is too high.
+// Use a compressed size of 0 if the size is not known.
+func (e *Extraction) CheckRatio(name string, size, compressed int64) error {
+	if e.policy.MaxCompressionRatio > 0 && compressed > 0 && float64(size)/float64(compressed) > e.policy.MaxCompressionRatio {
+		return NewExtractError(ErrCompressionRatio, name, fmt.Sprintf("compression ratio is higher than %g", e.policy.MaxCompressionRatio))
+	}
+
+	return nil
+}
+
+// Symlink returns an error if symlink entries are rejected. Otherwise the entry should be skipped.
+func (e *Extraction) Symlink(name string) error {
+	if e.policy.Symlinks == SymlinkReject {
+		return NewExtractError(ErrSymlink, name, "symlinks are not allowed")
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package source
+
+import (
+	"testing"
+)
+
+func TestExtraction_Path(t *testing.T) {
+	tests := []struct {
+		name     string
+		entry    string
+		want     string
+		wantType int
+		wantErr  bool
+	}{
+		{
+			"Valid Entry",
+			"plugin/plugin.php",
+			"dest/plugin/plugin.php",
+			0,
+			false,
+		},
+		{
+			"Root Entry",
+			"",
+			"dest",
+			0,
+			false,
+		},
+		{
+			"Absolute Entry",
+			"/etc/passwd",
+			"dest/etc/passwd",
+			0,
+			false,
+		},
+		{
+			"Parent Entry",
+			"../evil.php",
+			"",
+			ErrPathTraversal,
+			true,
+		},
+		{
+			"Nested Parent Entry",
+			"plugin/../../evil.php",
+			"",
+			ErrPathTraversal,
+			true,
+		},
+		{
+			"Sibling Prefix Entry",
+			"../destination/evil.php",
+			"",
+			ErrPathTraversal,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewExtraction("./dest", DefaultExtractPolicy)
+			got, err := e.Path(tt.entry)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Extraction.Path() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Extraction.Path() = %v, want %v", got, tt.want)
+			}
+			if err != nil && err.(*ExtractError).Type != tt.wantType {
+				t.Errorf("Extraction.Path() error type = %v, want %v", err.(*ExtractError).Type, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestExtraction_AddFile(t *testing.T) {
+	type file struct {
+		size       int64
+		compressed int64
+	}
+	tests := []struct {
+		name     string
+		policy   ExtractPolicy
+		files    []file
+		wantType int
+		wantErr  bool
+	}{
+		{
+			"Within Limits",
+			DefaultExtractPolicy,
+			[]file{
+				{1024, 512},
+				{2048, 1024},
+			},
+			0,
+			false,
+		},
+		{
+			"No Limits",
+			ExtractPolicy{},
+			[]file{
+				{1 << 40, 1},
+			},
+			0,
+			false,
+		},
+		{
+			"Too Many Files",
+			ExtractPolicy{
+				MaxFiles: 1,
+			},
+			[]file{
+				{1024, 512},
+				{1024, 512},
+			},
+			ErrFileCount,
+			true,
+		},
+		{
+			"Too Large",
+			ExtractPolicy{
+				MaxTotalSize: 2048,
+			},
+			[]file{
+				{1024, 512},
+				{1025, 512},
+			},
+			ErrTotalSize,
+			true,
+		},
+		{
+			"Compression Ratio",
+			ExtractPolicy{
+				MaxCompressionRatio: 10,
+			},
+			[]file{
+				{1 << 20, 1024},
+			},
+			ErrCompressionRatio,
+			true,
+		},
+		{
+			"Compression Ratio - Unknown Compressed Size",
+			ExtractPolicy{
+				MaxCompressionRatio: 10,
+			},
+			[]file{
+				{1 << 20, 0},
+			},
+			0,
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewExtraction("./dest", tt.policy)
+
+			var err error
+			for _, f := range tt.files {
+				if err = e.AddFile("file.php", f.size, f.compressed); err != nil {
+					break
+				}
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Extraction.AddFile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil && err.(*ExtractError).Type != tt.wantType {
+				t.Errorf("Extraction.AddFile() error type = %v, want %v", err.(*ExtractError).Type, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestExtraction_Symlink(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  ExtractPolicy
+		wantErr bool
+	}{
+		{
+			"Skip Symlinks",
+			ExtractPolicy{
+				Symlinks: SymlinkSkip,
+			},
+			false,
+		},
+		{
+			"Reject Symlinks",
+			ExtractPolicy{
+				Symlinks: SymlinkReject,
+			},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewExtraction("./dest", tt.policy)
+			if err := e.Symlink("plugin/link"); (err != nil) != tt.wantErr {
+				t.Errorf("Extraction.Symlink() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInVCSFolder(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want bool
+	}{
+		{"Folder", ".git", true},
+		{"Folder With Slash", ".svn/", true},
+		{"Nested File", "plugin/.hg/store/data", true},
+		{"Plugin File", "plugin/plugin.php", false},
+		{"Similar Name", "plugin/.github/workflows/ci.yml", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := InVCSFolder(tt.path); got != tt.want {
+				t.Errorf("InVCSFolder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractError_Error(t *testing.T) {
+	err := NewExtractError(ErrPathTraversal, "../evil.php", "path escapes destination")
+	want := "extract: path escapes destination: ../evil.php"
+
+	if got := err.Error(); got != want {
+		t.Errorf("ExtractError.Error() = %v, want %v", got, want)
+	}
+}
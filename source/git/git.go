@@ -0,0 +1,299 @@
+package git
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wptide/pkg/shell"
+	"github.com/wptide/pkg/source"
+	"github.com/wptide/pkg/trace"
+)
+
+// Git describes a git repository checked out at a given ref.
+type Git struct {
+	url      string
+	ref      string
+	dest     string
+	files    []string
+	checksum string
+	manifest source.Manifest
+	traceCtx context.Context
+}
+
+var (
+	// Runner used for git commands. A variable so that we can mock it in tests.
+	gitRunner shell.Runner = &shell.Command{}
+
+	// File system operation variables.
+	makeDirectoryAll = os.MkdirAll
+	removeAll        = os.RemoveAll
+	fileOpen         = os.Open
+	ioCopy           = io.Copy
+
+	// Default paths.
+	checkoutFolder = "unzipped"
+
+	// Scheme prefixes that only tell Detect that a url is a git repository, git doesn't know them.
+	schemePrefixes = []string{"git+https://", "git+ssh://"}
+
+	// Schemes that repositories can be cloned from. Local paths and other transports, e.g. "file" or "ext",
+	// would give messages access to the host.
+	allowedSchemes = map[string]bool{
+		"http":  true,
+		"https": true,
+		"ssh":   true,
+		"git":   true,
+	}
+
+	// Time a git command may take before it is stopped.
+	gitTimeout = 10 * time.Minute
+)
+
+func init() {
+	source.Register(source.Registration{
+		Kind: "git",
+		Factory: func(url string) source.Source {
+			return NewGit(url)
+		},
+		Schemes:    []string{"git", "ssh", "git+ssh", "git+https"},
+		Extensions: []string{"git"},
+	})
+}
+
+// PrepareFiles clones the repository to a given destination, checks out the requested ref
+// and extracts info about the files in the working tree.
+func (g *Git) PrepareFiles(dest string) error {
+
+	// Urls and refs are passed to git as arguments, they must not be taken for options.
+	if strings.HasPrefix(g.url, "-") {
+		return errors.New("git: invalid repository url: " + g.url)
+	}
+	if strings.HasPrefix(g.ref, "-") {
+		return errors.New("git: invalid ref: " + g.ref)
+	}
+	if !remoteURL(g.url) {
+		return errors.New("git: repository url has to be a http(s), ssh or git url: " + g.url)
+	}
+
+	// Prepare destination.
+	g.dest = dest
+	if err := makeDirectoryAll(g.dest, os.ModePerm); err != nil {
+		return err
+	}
+
+	path := g.dest + "/" + checkoutFolder
+
+	// Always start with a fresh clone.
+	if err := removeAll(path); err != nil {
+		return err
+	}
+
+	if err := g.checkout(path); err != nil {
+		return err
+	}
+
+	// Only the working tree gets audited, not the repository metadata.
+	if err := removeAll(path + "/.git"); err != nil {
+		return err
+	}
+
+	// Symlinks in the repository could point anywhere on the host.
+	if err := removeSymlinks(path); err != nil {
+		return err
+	}
+
+	files, checksums, err := hashFiles(path)
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		return errors.New("git: no files to audit in repository")
+	}
+
+	g.files = files
+
+	// Calculate checksum - uses same technique as Tide Audit Server.
+	g.checksum = source.CombinedChecksum(checksums)
+
+	g.manifest, err = source.NewManifest(path, g.files, checksums)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// checkout clones the repository and checks out the ref.
+func (g *Git) checkout(path string) (err error) {
+	ctx, span := trace.Start(g.traceCtx, "download")
+	span.SetAttribute("url", g.url)
+	defer func() {
+		span.Finish(err)
+	}()
+
+	if err := runGit(ctx, "clone", "--quiet", "--", g.url, path); err != nil {
+		return err
+	}
+
+	// A ref can be a branch, a tag or a commit. Arguments after "--" are paths for checkout,
+	// so the ref goes before it.
+	if g.ref != "" {
+		if err := runGit(ctx, "-C", path, "checkout", "--quiet", g.ref, "--"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetTraceContext sets the context that the span of the clone is a child of. The git commands are
+// stopped once the context is done.
+func (g *Git) SetTraceContext(ctx context.Context) {
+	g.traceCtx = ctx
+}
+
+// GetChecksum returns the combined checksum for the checked out files.
+func (g Git) GetChecksum() string {
+	return g.checksum
+}
+
+// GetFiles returns the files contained in the checked out working tree.
+func (g Git) GetFiles() []string {
+	return g.files
+}
+
+// GetManifest returns the checksum and size of every file in the checked out working tree.
+func (g Git) GetManifest() source.Manifest {
+	return g.manifest
+}
+
+// NewGit returns a new Git source.
+//
+// The ref to check out can be appended to the repository url as a fragment,
+// e.g. "https://github.com/wptide/example.git#develop". If no ref is given the
+// default branch of the repository is used. Urls starting with "git+https://" or
+// "git+ssh://" are cloned with the scheme after the "git+".
+func NewGit(url string) *Git {
+	for _, prefix := range schemePrefixes {
+		if strings.HasPrefix(url, prefix) {
+			url = strings.TrimPrefix(url, "git+")
+			break
+		}
+	}
+
+	g := &Git{
+		url: url,
+	}
+
+	if i := strings.LastIndex(url, "#"); i != -1 {
+		g.url = url[:i]
+		g.ref = url[i+1:]
+	}
+
+	return g
+}
+
+// remoteURL returns true if a repository url has one of the allowed schemes, or is a scp-like ssh url,
+// e.g. "git@github.com:wptide/example.git".
+func remoteURL(repository string) bool {
+	if u, err := url.Parse(repository); err == nil && u.Scheme != "" && u.Opaque == "" {
+		return allowedSchemes[strings.ToLower(u.Scheme)]
+	}
+
+	// Git only takes urls without a scheme for ssh if there is a host before a colon,
+	// and no slash before that colon. Anything else is a local path.
+	at, colon := strings.Index(repository, "@"), strings.Index(repository, ":")
+	slash := strings.Index(repository, "/")
+	return allowedSchemes["ssh"] && at > 0 && colon > at+1 && (slash == -1 || slash > colon)
+}
+
+// runGit runs a git command, stopped once the context is done or after gitTimeout,
+// and uses stderr for the error message if the command fails.
+func runGit(ctx context.Context, args ...string) error {
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+
+	_, errorBytes, _, err := shell.RunContext(ctx, gitRunner, "git", args...)
+	switch err {
+	case context.DeadlineExceeded:
+		return fmt.Errorf("git %s: timed out after %s", args[0], gitTimeout)
+	case context.Canceled:
+		return fmt.Errorf("git %s: cancelled", args[0])
+	}
+	if err != nil {
+		msg := strings.TrimSpace(string(errorBytes))
+		if msg == "" {
+			msg = err.Error()
+		}
+		return fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return nil
+}
+
+// removeSymlinks removes every symlink in a directory, so that nothing follows them out of it.
+func removeSymlinks(root string) error {
+	var links []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			links = append(links, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, link := range links {
+		if err := removeAll(link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hashFiles walks a directory and returns every regular file with its SHA-256 checksum.
+func hashFiles(root string) (filenames, checksums []string, err error) {
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := fileOpen(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		h := sha256.New()
+		if _, err := ioCopy(h, file); err != nil {
+			return err
+		}
+
+		filenames = append(filenames, path)
+		checksums = append(checksums, fmt.Sprintf("%x", h.Sum(nil)))
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return filenames, checksums, nil
+}
@@ -0,0 +1,496 @@
+package git
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wptide/pkg/source"
+)
+
+type mockRunner struct {
+	failOn  string
+	calls   *[][]string // (Optional) Records the arguments of every call.
+	symlink string      // (Optional) Target of a symlink that the clone creates.
+	block   bool        // (Optional) Runs until the context is done.
+}
+
+func (m mockRunner) Run(name string, arg ...string) ([]byte, []byte, int, error) {
+	if m.calls != nil {
+		*m.calls = append(*m.calls, arg)
+	}
+	for _, a := range arg {
+		if a == m.failOn {
+			return nil, []byte("fatal: something went wrong"), 128, errors.New("exit status 128")
+		}
+	}
+	if m.symlink != "" && arg[0] == "clone" {
+		path := arg[len(arg)-1]
+		os.MkdirAll(path, os.ModePerm)
+		os.Symlink(m.symlink, path+"/link")
+	}
+	return nil, nil, 0, nil
+}
+
+func (m mockRunner) RunContext(ctx context.Context, name string, arg ...string) ([]byte, []byte, int, error) {
+	if m.block {
+		<-ctx.Done()
+		return nil, nil, 0, ctx.Err()
+	}
+	return m.Run(name, arg...)
+}
+
+// Files committed to the test repository for each ref.
+var (
+	masterFiles = map[string]string{
+		"plugin.php":     "<?php\n/**\n * Plugin Name: Git Plugin\n */\n",
+		"assets/app.js":  "console.log('master');\n",
+		"assets/app.css": "body { color: red; }\n",
+	}
+	featureFiles = map[string]string{
+		"plugin.php":     "<?php\n/**\n * Plugin Name: Git Plugin\n */\n",
+		"assets/app.js":  "console.log('feature');\n",
+		"assets/app.css": "body { color: red; }\n",
+	}
+)
+
+// setupRepository creates a local bare repository with a tag and a feature branch.
+// It returns the path of the bare repository and the commit hash of the tagged commit.
+func setupRepository(t *testing.T) (string, string) {
+	work := "./testdata/work"
+	bare := "./testdata/repo.git"
+
+	git := func(dir string, args ...string) string {
+		args = append([]string{"-C", dir, "-c", "user.name=Tide", "-c", "user.email=tide@example.local"}, args...)
+		out, err := exec.Command("git", args...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %s", args, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	write := func(files map[string]string) {
+		for name, content := range files {
+			os.MkdirAll(work+"/assets", os.ModePerm)
+			ioutil.WriteFile(work+"/"+name, []byte(content), 0644)
+		}
+	}
+
+	os.MkdirAll(work, os.ModePerm)
+	git(work, "init", "--quiet")
+	git(work, "checkout", "--quiet", "-b", "master")
+
+	write(masterFiles)
+	git(work, "add", ".")
+	git(work, "commit", "--quiet", "-m", "Initial commit")
+	git(work, "tag", "v1.0.0")
+	commit := git(work, "rev-parse", "HEAD")
+
+	git(work, "checkout", "--quiet", "-b", "feature")
+	write(featureFiles)
+	git(work, "commit", "--quiet", "-am", "Feature commit")
+	git(work, "checkout", "--quiet", "master")
+
+	git(".", "clone", "--quiet", "--bare", work, bare)
+
+	return bare, commit
+}
+
+func checksumFor(files map[string]string) string {
+	var sums []string
+	for _, content := range files {
+		sums = append(sums, fmt.Sprintf("%x", sha256.Sum256([]byte(content))))
+	}
+	return source.CombinedChecksum(sums)
+}
+
+func TestGit_PrepareFiles(t *testing.T) {
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not available")
+	}
+
+	dest := "./testdata/checkout"
+
+	// Clean up after.
+	defer func() {
+		os.RemoveAll("./testdata/work")
+		os.RemoveAll("./testdata/repo.git")
+		os.RemoveAll(dest)
+	}()
+
+	bare, commit := setupRepository(t)
+
+	// The test repository is local, which messages can't clone from.
+	allowedSchemes["file"] = true
+	defer delete(allowedSchemes, "file")
+
+	abs, _ := filepath.Abs(bare)
+	bare = "file://" + abs
+
+	errorDirectoryCreate := func(path string, perm os.FileMode) error {
+		return errors.New("something went wrong")
+	}
+
+	errorCopy := func(dst io.Writer, src io.Reader) (written int64, err error) {
+		return 0, errors.New("something went wrong")
+	}
+
+	type args struct {
+		url              string
+		runner           *mockRunner
+		makeDirectoryAll func(path string, perm os.FileMode) error
+		ioCopy           func(dst io.Writer, src io.Reader) (written int64, err error)
+	}
+	tests := []struct {
+		name         string
+		args         args
+		wantChecksum string
+		wantFiles    []string
+		wantErr      bool
+	}{
+		{
+			"Default Branch",
+			args{
+				url: bare,
+			},
+			checksumFor(masterFiles),
+			[]string{
+				"testdata/checkout/unzipped/assets/app.css",
+				"testdata/checkout/unzipped/assets/app.js",
+				"testdata/checkout/unzipped/plugin.php",
+			},
+			false,
+		},
+		{
+			"Branch",
+			args{
+				url: bare + "#feature",
+			},
+			checksumFor(featureFiles),
+			[]string{
+				"testdata/checkout/unzipped/assets/app.css",
+				"testdata/checkout/unzipped/assets/app.js",
+				"testdata/checkout/unzipped/plugin.php",
+			},
+			false,
+		},
+		{
+			"Tag",
+			args{
+				url: bare + "#v1.0.0",
+			},
+			checksumFor(masterFiles),
+			nil,
+			false,
+		},
+		{
+			"Commit",
+			args{
+				url: bare + "#" + commit,
+			},
+			checksumFor(masterFiles),
+			nil,
+			false,
+		},
+		{
+			"Invalid Ref",
+			args{
+				url: bare + "#does-not-exist",
+			},
+			"",
+			nil,
+			true,
+		},
+		{
+			"Invalid Repository",
+			args{
+				url: "file://" + filepath.Dir(abs) + "/not-a-repo.git",
+			},
+			"",
+			nil,
+			true,
+		},
+		{
+			"Local Path",
+			args{
+				url: abs,
+			},
+			"",
+			nil,
+			true,
+		},
+		{
+			"Clone Error",
+			args{
+				url:    bare,
+				runner: &mockRunner{failOn: "clone"},
+			},
+			"",
+			nil,
+			true,
+		},
+		{
+			"Checkout Error",
+			args{
+				url:    bare + "#feature",
+				runner: &mockRunner{failOn: "checkout"},
+			},
+			"",
+			nil,
+			true,
+		},
+		{
+			"No Files",
+			args{
+				url:    bare,
+				runner: &mockRunner{},
+			},
+			"",
+			nil,
+			true,
+		},
+		{
+			"Failed Directory Create",
+			args{
+				url:              bare,
+				makeDirectoryAll: errorDirectoryCreate,
+			},
+			"",
+			nil,
+			true,
+		},
+		{
+			"Symlinks",
+			args{
+				url:    bare,
+				runner: &mockRunner{symlink: "../../../repo.git/config"},
+			},
+			"",
+			nil,
+			true,
+		},
+		{
+			"Failed Copy to Hasher",
+			args{
+				url:    bare,
+				ioCopy: errorCopy,
+			},
+			"",
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			if tt.args.runner != nil {
+				oldRunner := gitRunner
+				gitRunner = tt.args.runner
+				defer func() {
+					gitRunner = oldRunner
+				}()
+			}
+
+			if tt.args.makeDirectoryAll != nil {
+				oldMakeDirectoryAll := makeDirectoryAll
+				makeDirectoryAll = tt.args.makeDirectoryAll
+				defer func() {
+					makeDirectoryAll = oldMakeDirectoryAll
+				}()
+			}
+
+			if tt.args.ioCopy != nil {
+				oldCopy := ioCopy
+				ioCopy = tt.args.ioCopy
+				defer func() {
+					ioCopy = oldCopy
+				}()
+			}
+
+			g := NewGit(tt.args.url)
+			err := g.PrepareFiles(dest)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Git.PrepareFiles() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if got := g.GetChecksum(); got != tt.wantChecksum {
+				t.Errorf("Git.GetChecksum() = %v, want %v", got, tt.wantChecksum)
+			}
+
+			if tt.wantFiles != nil && !reflect.DeepEqual(g.GetFiles(), tt.wantFiles) {
+				t.Errorf("Git.GetFiles() = %v, want %v", g.GetFiles(), tt.wantFiles)
+			}
+
+			if _, err := os.Stat(dest + "/unzipped/.git"); !tt.wantErr && !os.IsNotExist(err) {
+				t.Errorf("Git.PrepareFiles() did not remove repository metadata")
+			}
+
+			if _, err := os.Lstat(dest + "/unzipped/link"); tt.args.runner != nil && tt.args.runner.symlink != "" && !os.IsNotExist(err) {
+				t.Errorf("Git.PrepareFiles() did not remove symlinks")
+			}
+		})
+	}
+}
+
+func TestGit_checkout(t *testing.T) {
+	var calls [][]string
+	oldRunner := gitRunner
+	gitRunner = &mockRunner{calls: &calls}
+	defer func() {
+		gitRunner = oldRunner
+	}()
+
+	tests := []struct {
+		name      string
+		url       string
+		wantCalls [][]string
+		wantErr   bool
+	}{
+		{
+			"Url And Ref",
+			"https://github.com/wptide/example.git#develop",
+			[][]string{
+				{"clone", "--quiet", "--", "https://github.com/wptide/example.git", "./testdata/checkout/unzipped"},
+				{"-C", "./testdata/checkout/unzipped", "checkout", "--quiet", "develop", "--"},
+			},
+			false,
+		},
+		{
+			"Option As Url",
+			"--upload-pack=touch ./testdata/pwned",
+			nil,
+			true,
+		},
+		{
+			"Option As Ref",
+			"https://github.com/wptide/example.git#--orphan=pwned",
+			nil,
+			true,
+		},
+		{
+			"SCP-like Url",
+			"git@github.com:wptide/example.git",
+			[][]string{
+				{"clone", "--quiet", "--", "git@github.com:wptide/example.git", "./testdata/checkout/unzipped"},
+			},
+			true,
+		},
+		{
+			"File Url",
+			"file:///etc",
+			nil,
+			true,
+		},
+		{
+			"Local Path",
+			"/etc",
+			nil,
+			true,
+		},
+		{
+			"Ext Transport",
+			"ext::sh -c touch% ./testdata/pwned",
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = nil
+
+			// The checkout has no files, only the git commands matter.
+			err := NewGit(tt.url).PrepareFiles("./testdata/checkout")
+			defer os.RemoveAll("./testdata/checkout")
+			if tt.wantErr && err == nil {
+				t.Errorf("Git.PrepareFiles() error = nil, want error")
+			}
+
+			if !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("Git.PrepareFiles() git calls = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestNewGit(t *testing.T) {
+	type args struct {
+		url string
+	}
+	tests := []struct {
+		name string
+		args args
+		want *Git
+	}{
+		{
+			"Without Ref",
+			args{
+				"https://github.com/wptide/example.git",
+			},
+			&Git{
+				url: "https://github.com/wptide/example.git",
+			},
+		},
+		{
+			"With Ref",
+			args{
+				"https://github.com/wptide/example.git#develop",
+			},
+			&Git{
+				url: "https://github.com/wptide/example.git",
+				ref: "develop",
+			},
+		},
+		{
+			"Git+HTTPS",
+			args{
+				"git+https://github.com/wptide/example.git#develop",
+			},
+			&Git{
+				url: "https://github.com/wptide/example.git",
+				ref: "develop",
+			},
+		},
+		{
+			"Git+SSH",
+			args{
+				"git+ssh://git@github.com/wptide/example.git",
+			},
+			&Git{
+				url: "ssh://git@github.com/wptide/example.git",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewGit(tt.args.url); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewGit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGit_PrepareFiles_Timeout(t *testing.T) {
+	oldRunner, oldTimeout := gitRunner, gitTimeout
+	gitRunner, gitTimeout = &mockRunner{block: true}, time.Millisecond*10
+	defer func() {
+		gitRunner, gitTimeout = oldRunner, oldTimeout
+	}()
+	defer os.RemoveAll("./testdata/checkout")
+
+	err := NewGit("https://github.com/wptide/example.git").PrepareFiles("./testdata/checkout")
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Git.PrepareFiles() error = %v, want a timeout", err)
+	}
+}
@@ -0,0 +1,281 @@
+package local
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wptide/pkg/source"
+)
+
+// Local describes a directory on the local filesystem.
+type Local struct {
+	path     string
+	baseDir  string // (Optional) Directory that the path has to be in.
+	dest     string
+	files    []string
+	checksum string
+	manifest source.Manifest
+	policy   *source.ExtractPolicy
+}
+
+var (
+	// File system operation variables.
+	makeDirectoryAll = os.MkdirAll
+	removeAll        = os.RemoveAll
+	ioCopy           = io.Copy
+	openFile         = os.OpenFile
+	fileOpen         = os.Open
+)
+
+// Register makes "file" urls available for source.Detect. Messages could otherwise read any
+// directory of the host, so only directories in the base directory can be audited.
+func Register(baseDir string) error {
+	if baseDir == "" {
+		return errors.New("local: a base directory is required")
+	}
+
+	base, err := filepath.Abs(baseDir)
+	if err != nil {
+		return err
+	}
+
+	return source.Register(source.Registration{
+		Kind: "local",
+		Factory: func(url string) source.Source {
+			l := NewLocal(url)
+			l.baseDir = base
+			return l
+		},
+		Schemes: []string{"file"},
+	})
+}
+
+// PrepareFiles copies the files from the local directory to a given destination
+// and extracts info about the files.
+func (l *Local) PrepareFiles(dest string) error {
+
+	// Resolve the directory first, so that the checked directory is the one that is copied.
+	root, err := resolvePath(l.path)
+	if err != nil {
+		return err
+	}
+
+	if l.baseDir != "" {
+		if err := inDirectory(root, l.baseDir); err != nil {
+			return err
+		}
+	}
+
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return errors.New("local: " + l.path + " is not a directory")
+	}
+
+	// Prepare destination.
+	l.dest = dest
+	path := l.dest + "/unzipped"
+
+	// Always start from a clean copy.
+	if err := removeAll(path); err != nil {
+		return err
+	}
+
+	policy := source.DefaultExtractPolicy
+	if l.policy != nil {
+		policy = *l.policy
+	}
+
+	var checksums []string
+	l.files, checksums, err = copyFiles(root, path, policy)
+	if err != nil {
+		return err
+	}
+
+	if len(l.files) == 0 {
+		return errors.New("local: no files to audit in " + l.path)
+	}
+
+	// Calculate checksum - uses same technique as Tide Audit Server.
+	l.checksum = source.CombinedChecksum(checksums)
+
+	l.manifest, err = source.NewManifest(path, l.files, checksums)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetChecksum returns the combined checksum for the local files.
+func (l Local) GetChecksum() string {
+	return l.checksum
+}
+
+// GetFiles returns the copied files.
+func (l Local) GetFiles() []string {
+	return l.files
+}
+
+// GetManifest returns the checksum and size of every copied file.
+func (l Local) GetManifest() source.Manifest {
+	return l.manifest
+}
+
+// SetExtractPolicy sets the limits and symlink handling used to copy the directory.
+func (l *Local) SetExtractPolicy(policy source.ExtractPolicy) {
+	l.policy = &policy
+}
+
+// NewLocal returns a new Local source for a "file://" url or a directory path.
+func NewLocal(path string) *Local {
+	if u, err := url.Parse(path); err == nil && u.Scheme == "file" {
+		path = u.Host + u.Path
+	}
+
+	return &Local{
+		path: path,
+	}
+}
+
+// resolvePath returns the absolute path without symlinks.
+func resolvePath(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(resolved)
+}
+
+// inDirectory returns an error if the path resolves to a location outside the directory,
+// e.g. with ".." or a symlink.
+func inDirectory(path, dir string) error {
+	resolvedPath, err := resolvePath(path)
+	if err != nil {
+		return err
+	}
+
+	resolvedDir, err := resolvePath(dir)
+	if err != nil {
+		return err
+	}
+
+	relative, err := filepath.Rel(resolvedDir, resolvedPath)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return errors.New("local: " + path + " is outside of " + dir)
+	}
+	return nil
+}
+
+// copyFiles copies every regular file from the resolved root to destination, keeping the
+// folder structure, and returns the copied files with their checksums.
+// The policy is enforced the same way as for archives.
+func copyFiles(root, destination string, policy source.ExtractPolicy) (filenames, checksums []string, err error) {
+
+	if err := makeDirectoryAll(destination, 0755); err != nil {
+		return nil, nil, err
+	}
+
+	// The destination could be inside the root folder, don't copy it into itself.
+	absDestination, err := resolvePath(destination)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	extraction := source.NewExtraction(destination, policy)
+
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		// Version control folders are not part of the audited code, the same as archive sources.
+		if source.InVCSFolder(relative) || path == absDestination {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Never follow links, they could point anywhere on the system.
+		if info.Mode()&os.ModeSymlink != 0 {
+			return extraction.Symlink(relative)
+		}
+
+		// Special files are not part of the audited code.
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+
+		// A folder of the entry could have been replaced with a link since the root was resolved.
+		if err := inDirectory(path, root); err != nil {
+			return source.NewExtractError(source.ErrPathTraversal, relative, "path escapes directory")
+		}
+
+		target, err := extraction.Path(relative)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return makeDirectoryAll(target, info.Mode())
+		}
+
+		if err := extraction.AddFile(relative, info.Size(), 0); err != nil {
+			return err
+		}
+
+		sum, err := copyFile(path, target, info.Mode())
+		if err != nil {
+			return err
+		}
+
+		filenames = append(filenames, target)
+		checksums = append(checksums, sum)
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return filenames, checksums, nil
+}
+
+// copyFile copies a single file and returns its checksum.
+func copyFile(src, dst string, mode os.FileMode) (string, error) {
+	sourceFile, err := fileOpen(src)
+	if err != nil {
+		return "", err
+	}
+	defer sourceFile.Close()
+
+	targetFile, err := openFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return "", err
+	}
+	defer targetFile.Close()
+
+	// Hash the file while writing it to the destination.
+	h := sha256.New()
+	if _, err := ioCopy(io.MultiWriter(targetFile, h), sourceFile); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -0,0 +1,377 @@
+package local
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/wptide/pkg/source"
+)
+
+func TestLocal_PrepareFiles(t *testing.T) {
+
+	dest := "./testdata/workspace"
+
+	// Version control folders should never be copied.
+	os.MkdirAll("./testdata/project/.git", os.ModePerm)
+	ioutil.WriteFile("./testdata/project/.git/HEAD", []byte("ref: refs/heads/master\n"), 0644)
+
+	// Clean up after.
+	defer func() {
+		os.RemoveAll("./testdata/project/.git")
+		os.RemoveAll(dest)
+	}()
+
+	errorDirectoryCreate := func(path string, perm os.FileMode) error {
+		return errors.New("something went wrong")
+	}
+
+	errorCopy := func(dst io.Writer, src io.Reader) (written int64, err error) {
+		return 0, errors.New("something went wrong")
+	}
+
+	errorOpenFile := func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		return nil, errors.New("something went wrong")
+	}
+
+	type args struct {
+		path             string
+		makeDirectoryAll func(path string, perm os.FileMode) error
+		ioCopy           func(dst io.Writer, src io.Reader) (written int64, err error)
+		openFile         func(name string, flag int, perm os.FileMode) (*os.File, error)
+	}
+	tests := []struct {
+		name         string
+		args         args
+		wantFiles    []string
+		wantChecksum string
+		wantErr      bool
+	}{
+		{
+			"Directory Path",
+			args{
+				path: "./testdata/project",
+			},
+			[]string{
+				"testdata/workspace/unzipped/function.php",
+				"testdata/workspace/unzipped/script.js",
+				"testdata/workspace/unzipped/style.css",
+			},
+			// Same checksum as the zip source for the same files.
+			"a28f162ea0ea0050602d9da97a56cb9e154048047bbcc74aa2033807a47479f5",
+			false,
+		},
+		{
+			"File URL",
+			args{
+				path: "file://./testdata/project",
+			},
+			[]string{
+				"testdata/workspace/unzipped/function.php",
+				"testdata/workspace/unzipped/script.js",
+				"testdata/workspace/unzipped/style.css",
+			},
+			"a28f162ea0ea0050602d9da97a56cb9e154048047bbcc74aa2033807a47479f5",
+			false,
+		},
+		{
+			"Missing Directory",
+			args{
+				path: "./testdata/missing",
+			},
+			nil,
+			"",
+			true,
+		},
+		{
+			"Not a Directory",
+			args{
+				path: "./testdata/project/style.css",
+			},
+			nil,
+			"",
+			true,
+		},
+		{
+			"Failed Directory Create",
+			args{
+				path:             "./testdata/project",
+				makeDirectoryAll: errorDirectoryCreate,
+			},
+			nil,
+			"",
+			true,
+		},
+		{
+			"Failed Open Target File",
+			args{
+				path:     "./testdata/project",
+				openFile: errorOpenFile,
+			},
+			nil,
+			"",
+			true,
+		},
+		{
+			"Failed Copy",
+			args{
+				path:   "./testdata/project",
+				ioCopy: errorCopy,
+			},
+			nil,
+			"",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			if tt.args.makeDirectoryAll != nil {
+				oldMakeDirectoryAll := makeDirectoryAll
+				makeDirectoryAll = tt.args.makeDirectoryAll
+				defer func() {
+					makeDirectoryAll = oldMakeDirectoryAll
+				}()
+			}
+
+			if tt.args.ioCopy != nil {
+				oldCopy := ioCopy
+				ioCopy = tt.args.ioCopy
+				defer func() {
+					ioCopy = oldCopy
+				}()
+			}
+
+			if tt.args.openFile != nil {
+				oldOpenFile := openFile
+				openFile = tt.args.openFile
+				defer func() {
+					openFile = oldOpenFile
+				}()
+			}
+
+			l := NewLocal(tt.args.path)
+			err := l.PrepareFiles(dest)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Local.PrepareFiles() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got := l.GetFiles(); !reflect.DeepEqual(got, tt.wantFiles) {
+				t.Errorf("Local.GetFiles() = %v, want %v", got, tt.wantFiles)
+			}
+			if got := l.GetChecksum(); got != tt.wantChecksum {
+				t.Errorf("Local.GetChecksum() = %v, want %v", got, tt.wantChecksum)
+			}
+		})
+	}
+}
+
+func TestLocal_PrepareFiles_DestinationInSource(t *testing.T) {
+
+	dest := "./testdata/project/workspace"
+
+	// Clean up after.
+	defer func() {
+		os.RemoveAll(dest)
+	}()
+
+	l := NewLocal("./testdata/project")
+
+	// Run twice, the second run must not pick up the first copy.
+	for i := 0; i < 2; i++ {
+		if err := l.PrepareFiles(dest); err != nil {
+			t.Errorf("Local.PrepareFiles() error = %v", err)
+			return
+		}
+	}
+
+	if got := len(l.GetFiles()); got != 3 {
+		t.Errorf("Local.GetFiles() = %v files, want 3", got)
+	}
+}
+
+func TestLocal_PrepareFiles_Policy(t *testing.T) {
+
+	dest := "./testdata/workspace"
+
+	// A folder that is a symlink to the project, and a symlink in the project.
+	os.Symlink("project", "./testdata/linked")
+	os.Symlink("style.css", "./testdata/project/link.css")
+
+	// Clean up after.
+	defer func() {
+		os.Remove("./testdata/linked")
+		os.Remove("./testdata/project/link.css")
+		os.RemoveAll(dest)
+	}()
+
+	tests := []struct {
+		name      string
+		path      string
+		policy    *source.ExtractPolicy
+		wantFiles int
+		wantErr   bool
+	}{
+		{
+			"Skip Symlinks",
+			"./testdata/project",
+			nil,
+			3,
+			false,
+		},
+		{
+			"Symlink Root",
+			"./testdata/linked",
+			nil,
+			3,
+			false,
+		},
+		{
+			"Reject Symlinks",
+			"./testdata/project",
+			&source.ExtractPolicy{
+				Symlinks: source.SymlinkReject,
+			},
+			0,
+			true,
+		},
+		{
+			"Too Many Files",
+			"./testdata/project",
+			&source.ExtractPolicy{
+				MaxFiles: 2,
+			},
+			0,
+			true,
+		},
+		{
+			"Too Large",
+			"./testdata/project",
+			&source.ExtractPolicy{
+				MaxTotalSize: 1000,
+			},
+			0,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLocal(tt.path)
+			if tt.policy != nil {
+				l.SetExtractPolicy(*tt.policy)
+			}
+
+			err := l.PrepareFiles(dest)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Local.PrepareFiles() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got := len(l.GetFiles()); got != tt.wantFiles {
+				t.Errorf("Local.GetFiles() = %v files, want %v", got, tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestNewLocal(t *testing.T) {
+	type args struct {
+		path string
+	}
+	tests := []struct {
+		name string
+		args args
+		want *Local
+	}{
+		{
+			"Directory Path",
+			args{
+				"/srv/plugin",
+			},
+			&Local{
+				path: "/srv/plugin",
+			},
+		},
+		{
+			"File URL",
+			args{
+				"file:///srv/plugin",
+			},
+			&Local{
+				path: "/srv/plugin",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewLocal(tt.args.path); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewLocal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+
+	dest := "./testdata/workspace"
+
+	// A symlink in the base directory that points out of it.
+	os.Symlink("../..", "./testdata/escape")
+
+	// Clean up after.
+	defer func() {
+		os.Remove("./testdata/escape")
+		os.RemoveAll(dest)
+	}()
+
+	if err := Register(""); err == nil {
+		t.Errorf("Register() error = nil, want error without a base directory")
+	}
+
+	if err := Register("./testdata"); err != nil {
+		t.Errorf("Register() error = %v", err)
+		return
+	}
+
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{
+			"In Base Directory",
+			"file://./testdata/project",
+			false,
+		},
+		{
+			"Outside Base Directory",
+			"file:///etc",
+			true,
+		},
+		{
+			"Parent Directory",
+			"file://./testdata/../../",
+			true,
+		},
+		{
+			"Symlink Out Of Base Directory",
+			"file://./testdata/escape",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := source.Detect(tt.url, "")
+			if err != nil {
+				t.Errorf("source.Detect() error = %v", err)
+				return
+			}
+
+			if err := src.PrepareFiles(dest); (err != nil) != tt.wantErr {
+				t.Errorf("Local.PrepareFiles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+// Get object.
+var obj = obj | {};
+
+// Add greeter.
+obj.greeter = function(msg) {
+    // Log to console.
+    console.log("Hello " + msg);
+}
+
+// Greet.
+obj.greeter("World");
\ No newline at end of file
@@ -0,0 +1,80 @@
+package source
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ManifestFile describes a single file in a Manifest.
+type ManifestFile struct {
+	Checksum string `json:"checksum"` // SHA-256 (hex) of the file contents.
+	Size     int64  `json:"size"`     // Size in bytes.
+}
+
+// Manifest maps the path of every file in a project, relative to the project root, to its checksum and size.
+type Manifest map[string]ManifestFile
+
+// NewManifest creates a Manifest from the extracted files of a source and their checksums.
+// Paths are made relative to root and sizes are read from disk.
+func NewManifest(root string, files, checksums []string) (Manifest, error) {
+	if len(files) != len(checksums) {
+		return nil, errors.New("source: every file in a manifest requires a checksum")
+	}
+
+	manifest := make(Manifest, len(files))
+	for i, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+
+		path, err := filepath.Rel(root, file)
+		if err != nil {
+			return nil, err
+		}
+
+		manifest[filepath.ToSlash(path)] = ManifestFile{
+			Checksum: checksums[i],
+			Size:     info.Size(),
+		}
+	}
+
+	return manifest, nil
+}
+
+// Checksum returns the combined checksum of all files in the manifest, see CombinedChecksum.
+func (m Manifest) Checksum() string {
+	sums := make([]string, 0, len(m))
+	for _, file := range m {
+		sums = append(sums, file.Checksum)
+	}
+	return CombinedChecksum(sums)
+}
+
+// Diff compares the manifest to an older manifest and returns the sorted paths
+// of files that were added, removed or changed.
+func (m Manifest) Diff(old Manifest) (added, removed, changed []string) {
+	for path, file := range m {
+		oldFile, ok := old[path]
+		switch {
+		case !ok:
+			added = append(added, path)
+		case oldFile != file:
+			changed = append(changed, path)
+		}
+	}
+
+	for path := range old {
+		if _, ok := m[path]; !ok {
+			removed = append(removed, path)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+
+	return added, removed, changed
+}
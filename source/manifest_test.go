@@ -0,0 +1,138 @@
+package source
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestNewManifest(t *testing.T) {
+
+	root, _ := ioutil.TempDir("", "manifest")
+	defer os.RemoveAll(root)
+
+	os.MkdirAll(root+"/inc", os.ModePerm)
+	ioutil.WriteFile(root+"/plugin.php", []byte("<?php // plugin"), 0644)
+	ioutil.WriteFile(root+"/inc/functions.php", []byte("<?php"), 0644)
+
+	type args struct {
+		files     []string
+		checksums []string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    Manifest
+		wantErr bool
+	}{
+		{
+			"Valid Files",
+			args{
+				[]string{root + "/plugin.php", root + "/inc/functions.php"},
+				[]string{"aaa", "bbb"},
+			},
+			Manifest{
+				"plugin.php":        {Checksum: "aaa", Size: 15},
+				"inc/functions.php": {Checksum: "bbb", Size: 5},
+			},
+			false,
+		},
+		{
+			"No Files",
+			args{},
+			Manifest{},
+			false,
+		},
+		{
+			"Missing Checksum",
+			args{
+				[]string{root + "/plugin.php", root + "/inc/functions.php"},
+				[]string{"aaa"},
+			},
+			nil,
+			true,
+		},
+		{
+			"Missing File",
+			args{
+				[]string{root + "/missing.php"},
+				[]string{"aaa"},
+			},
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewManifest(root, tt.args.files, tt.args.checksums)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewManifest() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewManifest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManifest_Checksum(t *testing.T) {
+	manifest := Manifest{
+		"plugin.php":        {Checksum: "aaa", Size: 15},
+		"inc/functions.php": {Checksum: "bbb", Size: 5},
+	}
+
+	if got, want := manifest.Checksum(), CombinedChecksum([]string{"bbb", "aaa"}); got != want {
+		t.Errorf("Manifest.Checksum() = %v, want %v", got, want)
+	}
+}
+
+func TestManifest_Diff(t *testing.T) {
+	old := Manifest{
+		"plugin.php":        {Checksum: "aaa", Size: 15},
+		"inc/functions.php": {Checksum: "bbb", Size: 5},
+		"readme.txt":        {Checksum: "ccc", Size: 10},
+	}
+
+	tests := []struct {
+		name        string
+		manifest    Manifest
+		wantAdded   []string
+		wantRemoved []string
+		wantChanged []string
+	}{
+		{
+			"Unchanged",
+			old,
+			nil,
+			nil,
+			nil,
+		},
+		{
+			"Added, Removed and Changed",
+			Manifest{
+				"plugin.php":        {Checksum: "ddd", Size: 15},
+				"inc/functions.php": {Checksum: "bbb", Size: 5},
+				"inc/admin.php":     {Checksum: "eee", Size: 20},
+			},
+			[]string{"inc/admin.php"},
+			[]string{"readme.txt"},
+			[]string{"plugin.php"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed, changed := tt.manifest.Diff(old)
+			if !reflect.DeepEqual(added, tt.wantAdded) {
+				t.Errorf("Manifest.Diff() added = %v, want %v", added, tt.wantAdded)
+			}
+			if !reflect.DeepEqual(removed, tt.wantRemoved) {
+				t.Errorf("Manifest.Diff() removed = %v, want %v", removed, tt.wantRemoved)
+			}
+			if !reflect.DeepEqual(changed, tt.wantChanged) {
+				t.Errorf("Manifest.Diff() changed = %v, want %v", changed, tt.wantChanged)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package source
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/wptide/pkg/source/download"
+)
+
+// Factory creates a new Source for a url.
+type Factory func(url string) Source
+
+// Magic describes bytes found at an offset at the start of a file.
+type Magic struct {
+	Offset int
+	Bytes  []byte
+}
+
+// Registration describes a kind of source and how to recognise it.
+type Registration struct {
+	Kind         string   // Name of the source kind, matched against `message.Message.SourceType`.
+	Factory      Factory  // Creates the source.
+	Schemes      []string // URL schemes handled by the source, e.g. "file".
+	Extensions   []string // File extensions without the leading dot, e.g. "zip" or "tar.gz".
+	ContentTypes []string // HTTP Content-Types, e.g. "application/zip".
+	Magic        []Magic  // Magic bytes found at the start of the content.
+}
+
+var (
+	registryMutex sync.RWMutex
+	registry      = make(map[string]Registration)
+	registryOrder []string
+
+	// Client used to sniff remote content if Detect isn't given one. A variable so that we can mock it in tests.
+	sniffClient = download.New()
+
+	// Number of bytes read when sniffing content.
+	sniffLength = 512
+)
+
+// UnknownError is returned by Detect for urls that no registered source handles, e.g. invalid urls.
+// Other errors of Detect, e.g. failing to sniff the remote content, are a *download.Error.
+type UnknownError struct {
+	URL string
+}
+
+func (e UnknownError) Error() string {
+	return "source: could not determine source for " + e.URL
+}
+
+// Register makes a source kind available for Detect. Sources register themselves in `init()`,
+// so importing a source package is enough to make it available.
+// Registering a kind again replaces the previous registration.
+func Register(reg Registration) error {
+	if reg.Kind == "" {
+		return errors.New("source: registration requires a kind")
+	}
+	if reg.Factory == nil {
+		return errors.New("source: registration requires a factory")
+	}
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if _, ok := registry[reg.Kind]; !ok {
+		registryOrder = append(registryOrder, reg.Kind)
+	}
+	registry[reg.Kind] = reg
+
+	return nil
+}
+
+// Kinds returns the registered source kinds in the order they were registered.
+func Kinds() []string {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	kinds := make([]string, len(registryOrder))
+	copy(kinds, registryOrder)
+	return kinds
+}
+
+// Detect returns a new Source for a url.
+//
+// The source is picked from the registered sources by url scheme, then source type,
+// then file extension and finally by sniffing the HTTP Content-Type and magic bytes
+// of the remote content. A source type is trusted as it is, leave it empty to detect
+// the source from the url and its content.
+func Detect(sourceURL, sourceType string) (Source, error) {
+	return DetectWithClient(sourceURL, sourceType, nil)
+}
+
+// DetectWithClient returns a new Source for a url like Detect, but sniffs the remote content with the client,
+// so that its retries, size limit and cache apply. Sources that download files get the client, and continue
+// the download that was sniffed instead of requesting the url again.
+func DetectWithClient(sourceURL, sourceType string, client *download.Client) (Source, error) {
+	registryMutex.RLock()
+	regs := make([]Registration, 0, len(registryOrder))
+	for _, kind := range registryOrder {
+		regs = append(regs, registry[kind])
+	}
+	registryMutex.RUnlock()
+
+	u, err := url.Parse(sourceURL)
+	if err != nil {
+		return nil, &UnknownError{URL: sourceURL}
+	}
+	scheme := strings.ToLower(u.Scheme)
+	path := strings.ToLower(u.Path)
+
+	// URL scheme.
+	for _, reg := range regs {
+		if contains(reg.Schemes, scheme) {
+			return withClient(reg.Factory(sourceURL), client), nil
+		}
+	}
+
+	// Source type.
+	for _, reg := range regs {
+		if reg.Kind == sourceType {
+			return withClient(reg.Factory(sourceURL), client), nil
+		}
+	}
+
+	// File extension, ignoring the query string.
+	for _, reg := range regs {
+		for _, ext := range reg.Extensions {
+			if strings.HasSuffix(path, "."+ext) {
+				return withClient(reg.Factory(sourceURL), client), nil
+			}
+		}
+	}
+
+	// Only remote content can be sniffed.
+	if scheme != "http" && scheme != "https" {
+		return nil, &UnknownError{URL: sourceURL}
+	}
+
+	if client == nil {
+		client = sniffClient
+	}
+
+	// The sniffed download is continued by the source, or closed if no source takes it.
+	peek, err := client.Peek(sourceURL, sniffLength)
+	if err != nil {
+		return nil, err
+	}
+
+	reg, ok := sniff(regs, peek)
+	if !ok {
+		peek.Close()
+		return nil, &UnknownError{URL: sourceURL}
+	}
+
+	src := reg.Factory(sourceURL)
+	if downloader, ok := src.(Downloader); ok {
+		downloader.SetDownloadClient(client.WithPeek(peek))
+	} else {
+		peek.Close()
+	}
+	return src, nil
+}
+
+// sniff returns the registration that handles the peeked content, by HTTP Content-Type and then by magic bytes.
+func sniff(regs []Registration, peek *download.Peek) (Registration, bool) {
+	// HTTP Content-Type.
+	for _, reg := range regs {
+		if contains(reg.ContentTypes, peek.ContentType) {
+			return reg, true
+		}
+	}
+
+	// Magic bytes.
+	for _, reg := range regs {
+		for _, magic := range reg.Magic {
+			end := magic.Offset + len(magic.Bytes)
+			if len(peek.Header) >= end && bytes.Equal(peek.Header[magic.Offset:end], magic.Bytes) {
+				return reg, true
+			}
+		}
+	}
+
+	return Registration{}, false
+}
+
+// withClient sets the download client of sources that download files, if there is one.
+func withClient(src Source, client *download.Client) Source {
+	if downloader, ok := src.(Downloader); ok && client != nil {
+		downloader.SetDownloadClient(client)
+	}
+	return src
+}
+
+func contains(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,317 @@
+package source
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/wptide/pkg/source/download"
+)
+
+type mockSource struct {
+	kind string
+	url  string
+}
+
+func (m mockSource) PrepareFiles(dest string) error { return nil }
+func (m mockSource) GetChecksum() string            { return "" }
+func (m mockSource) GetFiles() []string             { return nil }
+func (m mockSource) GetManifest() Manifest          { return nil }
+
+// mockDownloader is a source that downloads files.
+type mockDownloader struct {
+	mockSource
+	client *download.Client
+}
+
+func (m *mockDownloader) SetDownloadClient(client *download.Client) {
+	m.client = client
+}
+
+func mockFactory(kind string) Factory {
+	return func(url string) Source {
+		return &mockSource{kind, url}
+	}
+}
+
+var (
+	sniffMutex    sync.Mutex
+	sniffRequests = make(map[string]int)
+)
+
+var sniffServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	sniffMutex.Lock()
+	sniffRequests[r.URL.Path]++
+	sniffMutex.Unlock()
+
+	switch r.URL.Path {
+	case "/download/downloader":
+		w.Header().Set("Content-Type", "application/x-mock-download")
+		w.Write([]byte("the content of the download"))
+	case "/download/content-type":
+		w.Header().Set("Content-Type", "application/x-mock; charset=binary")
+		w.Write([]byte("no magic here"))
+	case "/download/magic":
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte("MOCK\x01\x02 the rest of the content"))
+	case "/download/offset":
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte("0123MOCKOFFSET"))
+	case "/download/unknown":
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte("unknown content"))
+	default:
+		http.NotFound(w, r)
+	}
+}))
+
+func init() {
+	// Don't retry unreachable urls.
+	sniffClient = &download.Client{}
+
+	Register(Registration{
+		Kind:         "mock-archive",
+		Factory:      mockFactory("mock-archive"),
+		Extensions:   []string{"mock", "mock.gz"},
+		ContentTypes: []string{"application/x-mock"},
+		Magic: []Magic{
+			{Offset: 0, Bytes: []byte("MOCK\x01\x02")},
+			{Offset: 4, Bytes: []byte("MOCKOFFSET")},
+		},
+	})
+	Register(Registration{
+		Kind: "mock-download",
+		Factory: func(url string) Source {
+			return &mockDownloader{mockSource: mockSource{"mock-download", url}}
+		},
+		ContentTypes: []string{"application/x-mock-download"},
+	})
+	Register(Registration{
+		Kind:    "mock-repo",
+		Factory: mockFactory("mock-repo"),
+		Schemes: []string{"mockrepo"},
+	})
+}
+
+func TestRegister(t *testing.T) {
+	tests := []struct {
+		name    string
+		reg     Registration
+		wantErr bool
+	}{
+		{
+			"Valid Registration",
+			Registration{
+				Kind:    "mock-register",
+				Factory: mockFactory("mock-register"),
+			},
+			false,
+		},
+		{
+			"Replace Registration",
+			Registration{
+				Kind:    "mock-register",
+				Factory: mockFactory("mock-register"),
+			},
+			false,
+		},
+		{
+			"No Kind",
+			Registration{
+				Factory: mockFactory(""),
+			},
+			true,
+		},
+		{
+			"No Factory",
+			Registration{
+				Kind: "mock-no-factory",
+			},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Register(tt.reg); (err != nil) != tt.wantErr {
+				t.Errorf("Register() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	count := 0
+	for _, kind := range Kinds() {
+		if kind == "mock-register" {
+			count++
+		}
+		if kind == "mock-no-factory" {
+			t.Errorf("Kinds() contains invalid registration %v", kind)
+		}
+	}
+	if count != 1 {
+		t.Errorf("Kinds() contains %d mock-register kinds, want 1", count)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	type args struct {
+		url        string
+		sourceType string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    Source
+		wantErr bool
+	}{
+		{
+			"Scheme",
+			args{
+				url: "mockrepo://example.local/project",
+			},
+			&mockSource{"mock-repo", "mockrepo://example.local/project"},
+			false,
+		},
+		{
+			"Source Type",
+			args{
+				url:        sniffServer.URL + "/download/unknown",
+				sourceType: "mock-archive",
+			},
+			&mockSource{"mock-archive", sniffServer.URL + "/download/unknown"},
+			false,
+		},
+		{
+			"Extension",
+			args{
+				url: "http://example.local/project.mock",
+			},
+			&mockSource{"mock-archive", "http://example.local/project.mock"},
+			false,
+		},
+		{
+			"Extension - Query String",
+			args{
+				url: "http://example.local/project.mock.gz?ver=2",
+			},
+			&mockSource{"mock-archive", "http://example.local/project.mock.gz?ver=2"},
+			false,
+		},
+		{
+			"Content-Type",
+			args{
+				url: sniffServer.URL + "/download/content-type",
+			},
+			&mockSource{"mock-archive", sniffServer.URL + "/download/content-type"},
+			false,
+		},
+		{
+			"Magic Bytes",
+			args{
+				url: sniffServer.URL + "/download/magic",
+			},
+			&mockSource{"mock-archive", sniffServer.URL + "/download/magic"},
+			false,
+		},
+		{
+			"Magic Bytes - Offset",
+			args{
+				url: sniffServer.URL + "/download/offset",
+			},
+			&mockSource{"mock-archive", sniffServer.URL + "/download/offset"},
+			false,
+		},
+		{
+			"Unknown Content",
+			args{
+				url: sniffServer.URL + "/download/unknown",
+			},
+			nil,
+			true,
+		},
+		{
+			"Not Found",
+			args{
+				url: sniffServer.URL + "/download/missing",
+			},
+			nil,
+			true,
+		},
+		{
+			"Unknown Local Path",
+			args{
+				url: "/srv/project",
+			},
+			nil,
+			true,
+		},
+		{
+			"Invalid Url",
+			args{
+				url: "http://[::1",
+			},
+			nil,
+			true,
+		},
+		{
+			"Unreachable Url",
+			args{
+				url: "http://error.err/download",
+			},
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Detect(tt.args.url, tt.args.sourceType)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Detect() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Detect() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectWithClient(t *testing.T) {
+	url := sniffServer.URL + "/download/downloader"
+	client := &download.Client{}
+
+	src, err := DetectWithClient(url, "", client)
+	if err != nil {
+		t.Fatalf("DetectWithClient() error = %v", err)
+	}
+	downloader, ok := src.(*mockDownloader)
+	if !ok || downloader.client == nil {
+		t.Fatalf("DetectWithClient() = %v, want a mock-download source with a client", src)
+	}
+
+	// The source continues the sniffed download.
+	body, err := downloader.client.Open(url)
+	if err != nil {
+		t.Fatalf("Client.Open() error = %v", err)
+	}
+	got, _ := ioutil.ReadAll(body)
+	body.Close()
+
+	if string(got) != "the content of the download" {
+		t.Errorf("Client.Open() body = %q, want the whole content", got)
+	}
+
+	sniffMutex.Lock()
+	defer sniffMutex.Unlock()
+	if sniffRequests["/download/downloader"] != 1 {
+		t.Errorf("DetectWithClient() requests = %v, want 1", sniffRequests["/download/downloader"])
+	}
+
+	// Sources that are not sniffed get the client too.
+	src, _ = DetectWithClient("http://example.local/project", "mock-download", client)
+	if downloader, ok := src.(*mockDownloader); !ok || downloader.client != client {
+		t.Errorf("DetectWithClient() = %v, want the client", src)
+	}
+}
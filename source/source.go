@@ -1,7 +1,15 @@
 package source
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
 	"strings"
+
+	"github.com/wptide/pkg/source/download"
 )
 
 // Source interface describes the source for code to be audited.
@@ -9,14 +17,45 @@ type Source interface {
 	PrepareFiles(dest string) error
 	GetChecksum() string
 	GetFiles() []string
+	GetManifest() Manifest
+}
+
+// Downloader is implemented by sources that download files over HTTP and accept a download client.
+type Downloader interface {
+	SetDownloadClient(client *download.Client)
+}
+
+// Tracer is implemented by sources that record trace spans for their steps, e.g. download and extraction.
+// The spans are children of the span in ctx.
+type Tracer interface {
+	SetTraceContext(ctx context.Context)
 }
 
 // GetKind uses basic string manipulation to get the type of source file.
-func GetKind(url string) string {
+// The query string and fragment of the url are ignored.
+//
+// Deprecated: Use Detect, which also looks at the source type and the content.
+func GetKind(sourceURL string) string {
+	if u, err := url.Parse(sourceURL); err == nil {
+		sourceURL = u.Path
+	}
+
 	var kind string
-	ts := strings.Split(url, ".")
+	ts := strings.Split(sourceURL, ".")
 	if len(ts) > 1 {
 		kind = ts[len(ts)-1]
 	}
 	return kind
 }
+
+// CombinedChecksum calculates a single checksum from the checksums of every file in a project.
+//
+// Uses the same technique as Tide Audit Server so that the same files always produce the same
+// checksum regardless of the source they came from.
+func CombinedChecksum(sums []string) string {
+	sorted := make([]string, len(sums))
+	copy(sorted, sums)
+	sort.Strings(sorted)
+	jsonChecksums, _ := json.Marshal(sorted)
+	return fmt.Sprintf("%x", sha256.Sum256(jsonChecksums))
+}
@@ -21,6 +21,20 @@ func TestGetKind(t *testing.T) {
 			},
 			want: "zip",
 		},
+		{
+			name: "Compressed Tarball",
+			args: args{
+				url: "http://example.local/example.tar.gz",
+			},
+			want: "gz",
+		},
+		{
+			name: "Query String",
+			args: args{
+				url: "http://example.local/example.zip?ver=2",
+			},
+			want: "zip",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -30,3 +44,44 @@ func TestGetKind(t *testing.T) {
 		})
 	}
 }
+
+func TestCombinedChecksum(t *testing.T) {
+	type args struct {
+		sums []string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			"Sorted",
+			args{
+				[]string{
+					"27dd8ed44a83ff94d557f9fd0412ed5a8cbca69ea04922d88c01184a07300a5a",
+					"2c8b08da5ce60398e1f19af0e5dccc744df274b826abe585eaba68c525434806",
+					"f6936912184481f5edd4c304ce27c5a1a827804fc7f329f43d273b8621870776",
+				},
+			},
+			"5a0c0a95d189c266ca1ed43767dd98f3fb513ce3434e2b08f34828ac11e79a94",
+		},
+		{
+			"Unsorted",
+			args{
+				[]string{
+					"f6936912184481f5edd4c304ce27c5a1a827804fc7f329f43d273b8621870776",
+					"27dd8ed44a83ff94d557f9fd0412ed5a8cbca69ea04922d88c01184a07300a5a",
+					"2c8b08da5ce60398e1f19af0e5dccc744df274b826abe585eaba68c525434806",
+				},
+			},
+			"5a0c0a95d189c266ca1ed43767dd98f3fb513ce3434e2b08f34828ac11e79a94",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CombinedChecksum(tt.args.sums); got != tt.want {
+				t.Errorf("CombinedChecksum() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
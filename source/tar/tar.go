@@ -0,0 +1,385 @@
+package tar
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ulikunitz/xz"
+	"github.com/wptide/pkg/source"
+	"github.com/wptide/pkg/source/download"
+	"github.com/wptide/pkg/trace"
+)
+
+// Tar describes a (optionally compressed) tarball.
+type Tar struct {
+	url      string
+	dest     string
+	files    []string
+	checksum string
+	manifest source.Manifest
+	policy   *source.ExtractPolicy
+	client   *download.Client
+	traceCtx context.Context
+}
+
+var (
+	// File system operation variables.
+	createFile       = os.Create
+	makeDirectoryAll = os.MkdirAll
+	ioCopy           = io.Copy
+	openFile         = os.OpenFile
+	fileOpen         = os.Open
+	tempDir          = ioutil.TempDir
+	rename           = os.Rename
+
+	// Default paths.
+	sourceFilename = "source.tar"
+
+	// Magic bytes used to detect the compression of a tarball.
+	magicGzip  = []byte{0x1f, 0x8b}
+	magicBzip2 = []byte("BZh")
+	magicXz    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+func init() {
+	source.Register(source.Registration{
+		Kind: "tar",
+		Factory: func(url string) source.Source {
+			return NewTar(url)
+		},
+		Extensions: []string{"tar", "tar.gz", "tgz", "tar.bz2", "tbz2", "tar.xz", "txz"},
+		ContentTypes: []string{
+			"application/x-tar",
+			"application/x-gtar",
+			"application/gzip",
+			"application/x-gzip",
+			"application/x-bzip2",
+			"application/x-xz",
+		},
+		Magic: []source.Magic{
+			{Offset: 0, Bytes: magicGzip},
+			{Offset: 0, Bytes: magicBzip2},
+			{Offset: 0, Bytes: magicXz},
+			{Offset: 257, Bytes: []byte("ustar")},
+		},
+	})
+}
+
+// PrepareFiles downloads a tarball to a given destination and extracts info about the files in the tarball.
+func (m *Tar) PrepareFiles(dest string) error {
+
+	// Prepare destination.
+	m.dest = dest
+	if _, err := os.Stat(m.dest); os.IsNotExist(err) {
+		os.Mkdir(m.dest, os.ModePerm)
+	}
+
+	client := m.client
+	if client == nil {
+		client = download.New()
+	}
+
+	_, span := trace.Start(m.traceCtx, "download")
+	span.SetAttribute("url", m.url)
+	err := downloadFile(client, m.url, m.dest+"/"+sourceFilename)
+	span.Finish(err)
+	if err != nil {
+		return err
+	}
+
+	policy := source.DefaultExtractPolicy
+	if m.policy != nil {
+		policy = *m.policy
+	}
+
+	_, span = trace.Start(m.traceCtx, "extract")
+	var checksums []string
+	m.files, checksums, err = untar(m.dest+"/"+sourceFilename, m.dest+"/unzipped", policy)
+	span.Finish(err)
+	if err != nil {
+		return err
+	}
+
+	// Calculate checksum - uses same technique as Tide Audit Server.
+	m.checksum = source.CombinedChecksum(checksums)
+
+	m.manifest, err = source.NewManifest(m.dest+"/unzipped", m.files, checksums)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetChecksum returns the combined checksum for the tarball.
+func (m Tar) GetChecksum() string {
+	return m.checksum
+}
+
+// GetFiles returns the files contained in the tarball.
+func (m Tar) GetFiles() []string {
+	return m.files
+}
+
+// GetManifest returns the checksum and size of every file in the tarball.
+func (m Tar) GetManifest() source.Manifest {
+	return m.manifest
+}
+
+// SetExtractPolicy sets the policy used to extract the tarball.
+func (m *Tar) SetExtractPolicy(policy source.ExtractPolicy) {
+	m.policy = &policy
+}
+
+// SetDownloadClient sets the client used to download the tarball.
+func (m *Tar) SetDownloadClient(client *download.Client) {
+	m.client = client
+}
+
+// SetTraceContext sets the context that the spans of the download and extraction are children of.
+func (m *Tar) SetTraceContext(ctx context.Context) {
+	m.traceCtx = ctx
+}
+
+// NewTar returns a new Tar source.
+func NewTar(url string) *Tar {
+	return &Tar{
+		url: url,
+	}
+}
+
+// downloadFile uses an HTTP request to get a file and save it to a given destination folder.
+func downloadFile(client *download.Client, source string, destination string) error {
+
+	// Create destination
+	out, err := createFile(destination)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	// Get file
+	body, err := client.Open(source)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	// Write to file
+	_, err = ioCopy(out, body)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// openTar opens a tarball and wraps it in the decompressor matching its magic bytes.
+// Uncompressed tarballs are read as is.
+func openTar(archive string) (*tar.Reader, io.Closer, error) {
+	file, err := fileOpen(archive)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	buffered := bufio.NewReader(file)
+	header, _ := buffered.Peek(len(magicXz))
+
+	var reader io.Reader
+	switch {
+	case bytes.HasPrefix(header, magicGzip):
+		reader, err = gzip.NewReader(buffered)
+	case bytes.HasPrefix(header, magicBzip2):
+		reader = bzip2.NewReader(buffered)
+	case bytes.HasPrefix(header, magicXz):
+		reader, err = xz.NewReader(buffered)
+	default:
+		reader = buffered
+	}
+
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	return tar.NewReader(reader), file, nil
+}
+
+// untar will un-compress a tarball,
+// moving all files and folders to a destination directory.
+//
+// Uses the same rules as the zip source to determine the root folder
+// so that the same project results in the same files and checksum.
+func untar(archive, destination string, policy source.ExtractPolicy) (filenames, checksums []string, err error) {
+	reader, closer, err := openTar(archive)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer closer.Close()
+
+	if err := makeDirectoryAll(destination, 0755); err != nil {
+		return nil, nil, err
+	}
+
+	// Tarballs can only be read once, and the root folder is only known after the last entry.
+	// So the files are extracted to a staging folder, and moved without the root folder afterwards.
+	staging, err := tempDir(filepath.Dir(filepath.Clean(destination)), ".untar-")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	extraction := source.NewExtraction(destination, policy)
+	staged := source.NewExtraction(staging, policy)
+
+	// Entries in a tarball are not compressed individually, so check the ratio for the whole archive.
+	var compressed int64
+	if info, err := os.Stat(archive); err == nil {
+		compressed = info.Size()
+	}
+
+	var entries []tarEntry
+	index := make(map[string]int)
+	rootPath := ""
+	var totalSize int64
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Version control folders are not part of the audited code, the same as local sources.
+		name := entryName(header.Name)
+		if name == "" || source.InVCSFolder(name) {
+			continue
+		}
+		entry := tarEntry{
+			name: name,
+			mode: header.FileInfo().Mode(),
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if len(name) < len(rootPath) || rootPath == "" {
+				rootPath = name
+			}
+			entry.dir = true
+
+		// Never write links, they could point anywhere on the system.
+		case tar.TypeSymlink, tar.TypeLink:
+			if err := extraction.Symlink(header.Name); err != nil {
+				return nil, nil, err
+			}
+			continue
+
+		case tar.TypeReg:
+			if err := extraction.AddFile(header.Name, header.Size, 0); err != nil {
+				return nil, nil, err
+			}
+			totalSize += header.Size
+			if err := extraction.CheckRatio(archive, totalSize, compressed); err != nil {
+				return nil, nil, err
+			}
+
+			if entry.checksum, err = stageFile(staged, name, entry.mode, reader); err != nil {
+				return nil, nil, err
+			}
+
+		// Special files are not part of the audited code.
+		default:
+			continue
+		}
+
+		// A later entry of the same name replaces the earlier one.
+		if i, ok := index[name]; ok {
+			entries[i] = entry
+			continue
+		}
+		index[name] = len(entries)
+		entries = append(entries, entry)
+	}
+
+	for _, entry := range entries {
+		path, err := extraction.Path(strings.TrimPrefix(entry.name, rootPath))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if entry.dir {
+			makeDirectoryAll(path, entry.mode)
+			continue
+		}
+
+		if err := makeDirectoryAll(filepath.Dir(path), 0755); err != nil {
+			return nil, nil, err
+		}
+		stagedPath, _ := staged.Path(entry.name)
+		if err := rename(stagedPath, path); err != nil {
+			return nil, nil, err
+		}
+
+		filenames = append(filenames, path)
+		checksums = append(checksums, entry.checksum)
+	}
+
+	return filenames, checksums, nil
+}
+
+// tarEntry is a folder or file of a tarball that was extracted to the staging folder.
+type tarEntry struct {
+	name     string
+	mode     os.FileMode
+	dir      bool
+	checksum string
+}
+
+// entryName returns the name of an entry without the "./" prefix, that zip archives don't have.
+// The name of the "./" entry itself is empty.
+func entryName(name string) string {
+	for strings.HasPrefix(name, "./") {
+		name = name[2:]
+	}
+	if name == "." {
+		return ""
+	}
+	return name
+}
+
+// stageFile writes a file to the staging folder and returns its checksum.
+func stageFile(staged *source.Extraction, name string, mode os.FileMode, reader io.Reader) (string, error) {
+	path, err := staged.Path(name)
+	if err != nil {
+		return "", err
+	}
+	if err := makeDirectoryAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+
+	targetFile, err := openFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return "", err
+	}
+	defer targetFile.Close()
+
+	// Hash the file while writing it to the staging folder.
+	h := sha256.New()
+	if _, err := ioCopy(io.MultiWriter(targetFile, h), reader); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
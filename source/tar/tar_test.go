@@ -0,0 +1,518 @@
+package tar
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/wptide/pkg/source"
+	"github.com/wptide/pkg/source/download"
+)
+
+var fileServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.String() {
+	case "/test.tar.gz":
+		w.Header().Set("Content-Type", "application/gzip")
+		http.ServeFile(w, r, "./testdata/test.tar.gz")
+	case "/test.tar.bz2":
+		w.Header().Set("Content-Type", "application/x-bzip2")
+		http.ServeFile(w, r, "./testdata/test.tar.bz2")
+	case "/test.tar.xz":
+		w.Header().Set("Content-Type", "application/x-xz")
+		http.ServeFile(w, r, "./testdata/test.tar.xz")
+	case "/test.tar":
+		w.Header().Set("Content-Type", "application/x-tar")
+		http.ServeFile(w, r, "./testdata/test.tar")
+	}
+}))
+
+// Same files and checksums as the zip source testdata.
+var (
+	testFilenames = []string{
+		"testdata/unzipped/function.php",
+		"testdata/unzipped/script.js",
+		"testdata/unzipped/style.css",
+	}
+	testChecksums = []string{
+		"64a43b6ce686b50bbd7eb91b2b1346ed66e7053d42f7f7b9d5562d55a25d1321",
+		"9a8549c5d1f384593788dc25b1c236f8450534e8cb95833003786fef8201b92b",
+		"09679b8abb88b21dd1cf166e1d2745df7882a879d2b8672548f6dc0dc9572fe6",
+	}
+	testChecksum = "a28f162ea0ea0050602d9da97a56cb9e154048047bbcc74aa2033807a47479f5"
+)
+
+func TestTar_GetChecksum(t *testing.T) {
+
+	checksum := "5a0c0a95d189c266ca1ed43767dd98f3fb513ce3434e2b08f34828ac11e79a94"
+
+	// Should be impossible to fail.
+	t.Run("Get Checksum", func(t *testing.T) {
+		m := Tar{
+			checksum: checksum,
+		}
+		if got := m.GetChecksum(); got != checksum {
+			t.Errorf("Tar.GetChecksum() = %v, want %v", got, checksum)
+		}
+	})
+}
+
+func TestTar_GetFiles(t *testing.T) {
+
+	files := []string{
+		"file1.txt",
+		"file2.txt",
+		"file3.txt",
+	}
+
+	// Should be impossible to fail.
+	t.Run("Get Files", func(t *testing.T) {
+		m := Tar{
+			files: files,
+		}
+		if got := m.GetFiles(); !reflect.DeepEqual(got, files) {
+			t.Errorf("Tar.GetFiles() = %v, want %v", got, files)
+		}
+	})
+}
+
+func Test_untar(t *testing.T) {
+
+	// Clean up after.
+	defer func() {
+		os.RemoveAll("./testdata/unzipped")
+	}()
+
+	errorDirectoryCreate := func(path string, perm os.FileMode) error {
+		return errors.New("something went wrong")
+	}
+
+	errorCopy := func(dst io.Writer, src io.Reader) (written int64, err error) {
+		return 0, errors.New("something went wrong")
+	}
+
+	errorOpenFile := func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		return nil, errors.New("something went wrong")
+	}
+
+	type args struct {
+		source           string
+		destination      string
+		makeDirectoryAll func(path string, perm os.FileMode) error
+		ioCopy           func(dst io.Writer, src io.Reader) (written int64, err error)
+		openFile         func(name string, flag int, perm os.FileMode) (*os.File, error)
+		policy           source.ExtractPolicy
+	}
+	tests := []struct {
+		name          string
+		args          args
+		wantFilenames []string
+		wantChecksums []string
+		wantErr       bool
+	}{
+		{
+			"Untar - Gzip",
+			args{
+				source:      "./testdata/test.tar.gz",
+				destination: "./testdata/unzipped",
+			},
+			testFilenames,
+			testChecksums,
+			false,
+		},
+		{
+			"Untar - Bzip2",
+			args{
+				source:      "./testdata/test.tar.bz2",
+				destination: "./testdata/unzipped",
+			},
+			testFilenames,
+			testChecksums,
+			false,
+		},
+		{
+			"Untar - Xz",
+			args{
+				source:      "./testdata/test.tar.xz",
+				destination: "./testdata/unzipped",
+			},
+			testFilenames,
+			testChecksums,
+			false,
+		},
+		{
+			"Untar - Uncompressed",
+			args{
+				source:      "./testdata/test.tar",
+				destination: "./testdata/unzipped",
+			},
+			testFilenames,
+			testChecksums,
+			false,
+		},
+		{
+			"Untar - Dot Slash Prefix",
+			args{
+				source:      "./testdata/dotslash.tar.gz",
+				destination: "./testdata/unzipped",
+			},
+			testFilenames,
+			testChecksums,
+			false,
+		},
+		{
+			"Untar - Skip VCS Folders",
+			args{
+				source:      "./testdata/vcs.tar.gz",
+				destination: "./testdata/unzipped",
+			},
+			testFilenames,
+			testChecksums,
+			false,
+		},
+		{
+			"Untar - Path Traversal",
+			args{
+				source:      "./testdata/slip.tar.gz",
+				destination: "./testdata/unzipped",
+				policy:      source.DefaultExtractPolicy,
+			},
+			nil,
+			nil,
+			true,
+		},
+		{
+			"Untar - Skip Symlink",
+			args{
+				source:      "./testdata/symlink.tar.gz",
+				destination: "./testdata/unzipped",
+				policy:      source.DefaultExtractPolicy,
+			},
+			[]string{
+				"testdata/unzipped/plugin.php",
+			},
+			[]string{
+				"d70f7cedd6e5dd683d9a6dddf98a3c9780e24ab4b0af90932887858fbc06aa49",
+			},
+			false,
+		},
+		{
+			"Untar - Reject Symlink",
+			args{
+				source:      "./testdata/symlink.tar.gz",
+				destination: "./testdata/unzipped",
+				policy: source.ExtractPolicy{
+					Symlinks: source.SymlinkReject,
+				},
+			},
+			nil,
+			nil,
+			true,
+		},
+		{
+			"Untar - Compression Ratio",
+			args{
+				source:      "./testdata/bomb.tar.gz",
+				destination: "./testdata/unzipped",
+				policy:      source.DefaultExtractPolicy,
+			},
+			nil,
+			nil,
+			true,
+		},
+		{
+			"Untar - No Limits",
+			args{
+				source:      "./testdata/bomb.tar.gz",
+				destination: "./testdata/unzipped",
+			},
+			[]string{
+				"testdata/unzipped/zeros.txt",
+			},
+			[]string{
+				"30e14955ebf1352266dc2ff8067e68104607e750abb9d3b36582b8af909fcb58",
+			},
+			false,
+		},
+		{
+			"Untar - Too Many Files",
+			args{
+				source:      "./testdata/test.tar.gz",
+				destination: "./testdata/unzipped",
+				policy: source.ExtractPolicy{
+					MaxFiles: 2,
+				},
+			},
+			nil,
+			nil,
+			true,
+		},
+		{
+			"Untar - Too Large",
+			args{
+				source:      "./testdata/test.tar.gz",
+				destination: "./testdata/unzipped",
+				policy: source.ExtractPolicy{
+					MaxTotalSize: 1024,
+				},
+			},
+			nil,
+			nil,
+			true,
+		},
+		{
+			"Untar - Missing File",
+			args{
+				source:      "./testdata/missing.tar.gz",
+				destination: "./testdata/unzipped",
+			},
+			nil,
+			nil,
+			true,
+		},
+		{
+			"Untar - Corrupt File",
+			args{
+				source:      "./testdata/error.tar.gz",
+				destination: "./testdata/unzipped",
+			},
+			nil,
+			nil,
+			true,
+		},
+		{
+			"Untar - Failed Directory Create",
+			args{
+				source:           "./testdata/test.tar.gz",
+				destination:      "./testdata/unzipped",
+				makeDirectoryAll: errorDirectoryCreate,
+			},
+			nil,
+			nil,
+			true,
+		},
+		{
+			"Untar - Fail Open Target File",
+			args{
+				source:      "./testdata/test.tar.gz",
+				destination: "./testdata/unzipped",
+				openFile:    errorOpenFile,
+			},
+			nil,
+			nil,
+			true,
+		},
+		{
+			"Untar - Fail Copy to Target File",
+			args{
+				source:      "./testdata/test.tar.gz",
+				destination: "./testdata/unzipped",
+				ioCopy:      errorCopy,
+			},
+			nil,
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			if tt.args.makeDirectoryAll != nil {
+				oldMakeDirectoryAll := makeDirectoryAll
+				makeDirectoryAll = tt.args.makeDirectoryAll
+				defer func() {
+					makeDirectoryAll = oldMakeDirectoryAll
+				}()
+			}
+
+			if tt.args.ioCopy != nil {
+				oldCopy := ioCopy
+				ioCopy = tt.args.ioCopy
+				defer func() {
+					ioCopy = oldCopy
+				}()
+			}
+
+			if tt.args.openFile != nil {
+				oldOpenFile := openFile
+				openFile = tt.args.openFile
+				defer func() {
+					openFile = oldOpenFile
+				}()
+			}
+
+			gotFilenames, gotChecksums, err := untar(tt.args.source, tt.args.destination, tt.args.policy)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("untar() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(gotFilenames, tt.wantFilenames) {
+				t.Errorf("untar() gotFilenames = %v, want %v", gotFilenames, tt.wantFilenames)
+			}
+			if !reflect.DeepEqual(gotChecksums, tt.wantChecksums) {
+				t.Errorf("untar() gotChecksums = %v, want %v", gotChecksums, tt.wantChecksums)
+			}
+		})
+	}
+}
+
+func TestTar_PrepareFiles(t *testing.T) {
+
+	dest := "./testdata/download/"
+
+	// Clean up after.
+	defer func() {
+		os.RemoveAll(dest)
+	}()
+
+	errorCreate := func(path string) (*os.File, error) {
+		return nil, errors.New("something went wrong")
+	}
+
+	type args struct {
+		url        string
+		createFile func(string) (*os.File, error)
+		client     *download.Client
+	}
+	tests := []struct {
+		name         string
+		args         args
+		wantChecksum string
+		wantErr      bool
+	}{
+		{
+			"Gzip Tarball",
+			args{
+				url: fileServer.URL + "/test.tar.gz",
+			},
+			testChecksum,
+			false,
+		},
+		{
+			"Bzip2 Tarball",
+			args{
+				url: fileServer.URL + "/test.tar.bz2",
+			},
+			testChecksum,
+			false,
+		},
+		{
+			"Xz Tarball",
+			args{
+				url: fileServer.URL + "/test.tar.xz",
+			},
+			testChecksum,
+			false,
+		},
+		{
+			"Error Destination",
+			args{
+				url:        fileServer.URL + "/test.tar.gz",
+				createFile: errorCreate,
+			},
+			"",
+			true,
+		},
+		{
+			"Error Url",
+			args{
+				url: "https://error.err/error.tar.gz",
+				// Don't retry unreachable hosts.
+				client: &download.Client{},
+			},
+			"",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			if tt.args.createFile != nil {
+				oldCreateFile := createFile
+				createFile = tt.args.createFile
+				defer func() {
+					createFile = oldCreateFile
+				}()
+			}
+
+			m := NewTar(tt.args.url)
+			if tt.args.client != nil {
+				m.SetDownloadClient(tt.args.client)
+			}
+			if err := m.PrepareFiles(dest); (err != nil) != tt.wantErr {
+				t.Errorf("Tar.PrepareFiles() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got := m.GetChecksum(); got != tt.wantChecksum {
+				t.Errorf("Tar.GetChecksum() = %v, want %v", got, tt.wantChecksum)
+			}
+		})
+	}
+}
+
+func TestNewTar(t *testing.T) {
+	type args struct {
+		url string
+	}
+	tests := []struct {
+		name string
+		args args
+		want *Tar
+	}{
+		{
+			"Get new *Tar",
+			args{
+				fileServer.URL + "/test.tar.gz",
+			},
+			&Tar{
+				url: fileServer.URL + "/test.tar.gz",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewTar(tt.args.url); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewTar() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistration(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        string
+		sourceType string
+	}{
+		{
+			"Extension",
+			"http://example.local/plugin.tar.gz?ver=2",
+			"",
+		},
+		{
+			"Source Type",
+			"http://example.local/download/123",
+			"tar",
+		},
+		{
+			"Remote Tarball",
+			fileServer.URL + "/test.tar.xz",
+			"archive",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := source.Detect(tt.url, tt.sourceType)
+			if err != nil {
+				t.Errorf("source.Detect() error = %v", err)
+				return
+			}
+			if _, ok := got.(*Tar); !ok {
+				t.Errorf("source.Detect() = %T, want *Tar", got)
+			}
+		})
+	}
+}
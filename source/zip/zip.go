@@ -2,15 +2,16 @@ package zip
 
 import (
 	"archive/zip"
+	"context"
 	"crypto/sha256"
-	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
-	"path/filepath"
-	"sort"
 	"strings"
+
+	"github.com/wptide/pkg/source"
+	"github.com/wptide/pkg/source/download"
+	"github.com/wptide/pkg/trace"
 )
 
 // Zip describes a zip file.
@@ -19,6 +20,10 @@ type Zip struct {
 	dest     string
 	files    []string
 	checksum string
+	manifest source.Manifest
+	policy   *source.ExtractPolicy
+	client   *download.Client
+	traceCtx context.Context
 }
 
 var (
@@ -32,6 +37,20 @@ var (
 	sourceFilename = "source.zip"
 )
 
+func init() {
+	source.Register(source.Registration{
+		Kind: "zip",
+		Factory: func(url string) source.Source {
+			return NewZip(url)
+		},
+		Extensions:   []string{"zip"},
+		ContentTypes: []string{"application/zip", "application/x-zip-compressed"},
+		Magic: []source.Magic{
+			{Offset: 0, Bytes: []byte("PK\x03\x04")},
+		},
+	})
+}
+
 // PrepareFiles downloads a zip file to a given destination and extracts info about the files in the zip.
 func (m *Zip) PrepareFiles(dest string) error {
 
@@ -41,13 +60,28 @@ func (m *Zip) PrepareFiles(dest string) error {
 		os.Mkdir(m.dest, os.ModePerm)
 	}
 
-	err := downloadFile(m.url, m.dest+"/"+sourceFilename)
+	client := m.client
+	if client == nil {
+		client = download.New()
+	}
+
+	_, span := trace.Start(m.traceCtx, "download")
+	span.SetAttribute("url", m.url)
+	err := downloadFile(client, m.url, m.dest+"/"+sourceFilename)
+	span.Finish(err)
 	if err != nil {
 		return err
 	}
 
+	policy := source.DefaultExtractPolicy
+	if m.policy != nil {
+		policy = *m.policy
+	}
+
+	_, span = trace.Start(m.traceCtx, "extract")
 	var checksums []string
-	m.files, checksums, err = unzip(m.dest+"/"+sourceFilename, m.dest+"/unzipped")
+	m.files, checksums, err = unzip(m.dest+"/"+sourceFilename, m.dest+"/unzipped", policy)
+	span.Finish(err)
 	if err != nil {
 		return err
 	}
@@ -55,6 +89,11 @@ func (m *Zip) PrepareFiles(dest string) error {
 	// Calculate checksum - uses same technique as Tide Audit Server.
 	m.checksum = combinedChecksum(checksums)
 
+	m.manifest, err = source.NewManifest(m.dest+"/unzipped", m.files, checksums)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -68,6 +107,26 @@ func (m Zip) GetFiles() []string {
 	return m.files
 }
 
+// GetManifest returns the checksum and size of every file in the zip file.
+func (m Zip) GetManifest() source.Manifest {
+	return m.manifest
+}
+
+// SetExtractPolicy sets the policy used to extract the zip file.
+func (m *Zip) SetExtractPolicy(policy source.ExtractPolicy) {
+	m.policy = &policy
+}
+
+// SetDownloadClient sets the client used to download the zip file.
+func (m *Zip) SetDownloadClient(client *download.Client) {
+	m.client = client
+}
+
+// SetTraceContext sets the context that the spans of the download and extraction are children of.
+func (m *Zip) SetTraceContext(ctx context.Context) {
+	m.traceCtx = ctx
+}
+
 // NewZip returns a new Zip source.
 func NewZip(url string) *Zip {
 	return &Zip{
@@ -76,7 +135,7 @@ func NewZip(url string) *Zip {
 }
 
 // downloadFile uses an HTTP request to get a file and save it to a given destination folder.
-func downloadFile(source string, destination string) error {
+func downloadFile(client *download.Client, source string, destination string) error {
 
 	// Create destination
 	out, err := createFile(destination)
@@ -86,14 +145,14 @@ func downloadFile(source string, destination string) error {
 	defer out.Close()
 
 	// Get file
-	resp, err := http.Get(source)
+	body, err := client.Open(source)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
+	defer body.Close()
 
 	// Write to file
-	_, err = ioCopy(out, resp.Body)
+	_, err = ioCopy(out, body)
 
 	if err != nil {
 		return err
@@ -107,20 +166,23 @@ func downloadFile(source string, destination string) error {
 //
 // Props to https://golangcode.com/unzip-files-in-go/ and
 // http://blog.ralch.com/tutorial/golang-working-with-zip/
-func unzip(source, destination string) (filenames, checksums []string, err error) {
-	reader, err := zip.OpenReader(source)
+func unzip(archive, destination string, policy source.ExtractPolicy) (filenames, checksums []string, err error) {
+	reader, err := zip.OpenReader(archive)
 	if err != nil {
 		return filenames, checksums, err
 	}
+	defer reader.Close()
 
 	if err := makeDirectoryAll(destination, 0755); err != nil {
 		return filenames, checksums, err
 	}
 
+	extraction := source.NewExtraction(destination, policy)
+
 	rootPath := ""
 	for _, file := range reader.File {
 		path := file.Name
-		if !file.FileInfo().IsDir() {
+		if !file.FileInfo().IsDir() || source.InVCSFolder(path) {
 			continue
 		}
 		if len(path) < len(rootPath) || rootPath == "" {
@@ -129,32 +191,60 @@ func unzip(source, destination string) (filenames, checksums []string, err error
 	}
 
 	for _, file := range reader.File {
-		path := filepath.Join(destination, strings.TrimPrefix(file.Name, rootPath))
+		// Version control folders are not part of the audited code, the same as local sources.
+		if source.InVCSFolder(file.Name) {
+			continue
+		}
+
+		path, err := extraction.Path(strings.TrimPrefix(file.Name, rootPath))
+		if err != nil {
+			return nil, nil, err
+		}
+
 		if file.FileInfo().IsDir() {
 			makeDirectoryAll(path, file.Mode())
 			continue
 		}
 
+		// Never write symlinks, they could point anywhere on the system.
+		if file.Mode()&os.ModeSymlink != 0 {
+			if err := extraction.Symlink(file.Name); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		if err := extraction.AddFile(file.Name, int64(file.UncompressedSize64), int64(file.CompressedSize64)); err != nil {
+			return nil, nil, err
+		}
+
 		filenames = append(filenames, path)
 
 		// This reads the file from the ZIP. It does not yet exist on the system.
-		fileReader, _ := file.Open()
+		fileReader, err := file.Open()
+		if err != nil {
+			return nil, nil, err
+		}
 
 		h := sha256.New()
 		if _, err := ioCopy(h, fileReader); err != nil {
 			fileReader.Close()
 			return nil, nil, err
 		}
+		fileReader.Close()
 		checksums = append(checksums, fmt.Sprintf("%x", h.Sum(nil)))
 
 		targetFile, err := openFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode())
 		if err != nil {
-			fileReader.Close()
 			return nil, nil, err
 		}
 
 		// Because the zip package does not implement Seek(), we need to read it again..
-		fileReader, _ = file.Open()
+		fileReader, err = file.Open()
+		if err != nil {
+			targetFile.Close()
+			return nil, nil, err
+		}
 
 		if _, err := ioCopy(targetFile, fileReader); err != nil {
 			fileReader.Close()
@@ -170,7 +260,5 @@ func unzip(source, destination string) (filenames, checksums []string, err error
 }
 
 func combinedChecksum(sums []string) string {
-	sort.Strings(sums)
-	jsonChecksums, _ := json.Marshal(sums)
-	return fmt.Sprintf("%x", sha256.Sum256(jsonChecksums))
+	return source.CombinedChecksum(sums)
 }
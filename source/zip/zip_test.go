@@ -8,6 +8,9 @@ import (
 	"os"
 	"reflect"
 	"testing"
+
+	"github.com/wptide/pkg/source"
+	"github.com/wptide/pkg/source/download"
 )
 
 var fileServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -16,6 +19,8 @@ var fileServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
 		w.Header().Set("Content-Type", "applicaiton/zip")
 		w.Header().Set("Content-Disposition", "attachment; filename='test.zip'")
 		http.ServeFile(w, r, "./testdata/test.zip")
+	case "/notfound.zip":
+		http.NotFound(w, r)
 	}
 }))
 
@@ -129,6 +134,7 @@ func Test_unzip(t *testing.T) {
 		makeDirectoryAll func(path string, perm os.FileMode) error
 		ioCopy           func(dst io.Writer, src io.Reader) (written int64, err error)
 		openFile         func(name string, flag int, perm os.FileMode) (*os.File, error)
+		policy           source.ExtractPolicy
 	}
 	tests := []struct {
 		name          string
@@ -155,6 +161,114 @@ func Test_unzip(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"Unzip - Skip VCS Folders",
+			args{
+				source:      "./testdata/vcs.zip",
+				destination: "./testdata/unzipped",
+			},
+			[]string{
+				"testdata/unzipped/function.php",
+				"testdata/unzipped/script.js",
+				"testdata/unzipped/style.css",
+			},
+			[]string{
+				"64a43b6ce686b50bbd7eb91b2b1346ed66e7053d42f7f7b9d5562d55a25d1321",
+				"9a8549c5d1f384593788dc25b1c236f8450534e8cb95833003786fef8201b92b",
+				"09679b8abb88b21dd1cf166e1d2745df7882a879d2b8672548f6dc0dc9572fe6",
+			},
+			false,
+		},
+		{
+			"Unzip - Path Traversal",
+			args{
+				source:      "./testdata/slip.zip",
+				destination: "./testdata/unzipped",
+				policy:      source.DefaultExtractPolicy,
+			},
+			nil,
+			nil,
+			true,
+		},
+		{
+			"Unzip - Skip Symlink",
+			args{
+				source:      "./testdata/symlink.zip",
+				destination: "./testdata/unzipped",
+				policy:      source.DefaultExtractPolicy,
+			},
+			[]string{
+				"testdata/unzipped/plugin.php",
+			},
+			[]string{
+				"d70f7cedd6e5dd683d9a6dddf98a3c9780e24ab4b0af90932887858fbc06aa49",
+			},
+			false,
+		},
+		{
+			"Unzip - Reject Symlink",
+			args{
+				source:      "./testdata/symlink.zip",
+				destination: "./testdata/unzipped",
+				policy: source.ExtractPolicy{
+					Symlinks: source.SymlinkReject,
+				},
+			},
+			nil,
+			nil,
+			true,
+		},
+		{
+			"Unzip - Compression Ratio",
+			args{
+				source:      "./testdata/bomb.zip",
+				destination: "./testdata/unzipped",
+				policy:      source.DefaultExtractPolicy,
+			},
+			nil,
+			nil,
+			true,
+		},
+		{
+			"Unzip - No Limits",
+			args{
+				source:      "./testdata/bomb.zip",
+				destination: "./testdata/unzipped",
+			},
+			[]string{
+				"testdata/unzipped/zeros.txt",
+			},
+			[]string{
+				"30e14955ebf1352266dc2ff8067e68104607e750abb9d3b36582b8af909fcb58",
+			},
+			false,
+		},
+		{
+			"Unzip - Too Many Files",
+			args{
+				source:      "./testdata/test.zip",
+				destination: "./testdata/unzipped",
+				policy: source.ExtractPolicy{
+					MaxFiles: 2,
+				},
+			},
+			nil,
+			nil,
+			true,
+		},
+		{
+			"Unzip - Too Large",
+			args{
+				source:      "./testdata/test.zip",
+				destination: "./testdata/unzipped",
+				policy: source.ExtractPolicy{
+					MaxTotalSize: 1024,
+				},
+			},
+			nil,
+			nil,
+			true,
+		},
 		{
 			"Unzip File - File",
 			args{
@@ -240,7 +354,7 @@ func Test_unzip(t *testing.T) {
 				}()
 			}
 
-			gotFilenames, gotChecksums, err := unzip(tt.args.source, tt.args.destination)
+			gotFilenames, gotChecksums, err := unzip(tt.args.source, tt.args.destination, tt.args.policy)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("unzip() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -275,6 +389,7 @@ func TestZip_PrepareFiles(t *testing.T) {
 		dest     string
 		files    []string
 		checksum string
+		client   *download.Client
 	}
 	type args struct {
 		dest           string
@@ -327,6 +442,8 @@ func TestZip_PrepareFiles(t *testing.T) {
 			fields{
 				url:  "https://error.err/error.zip",
 				dest: dest,
+				// Don't retry unreachable hosts.
+				client: &download.Client{},
 			},
 			args{
 				dest: dest,
@@ -360,6 +477,7 @@ func TestZip_PrepareFiles(t *testing.T) {
 				dest:     tt.fields.dest,
 				files:    tt.fields.files,
 				checksum: tt.fields.checksum,
+				client:   tt.fields.client,
 			}
 			if err := m.PrepareFiles(tt.args.dest); (err != nil) != tt.wantErr {
 				t.Errorf("Zip.PrepareFiles() error = %v, wantErr %v", err, tt.wantErr)
@@ -399,6 +517,14 @@ func Test_downloadFile(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"Download - Not Found",
+			args{
+				source:      fileServer.URL + "/notfound.zip",
+				destination: dest,
+			},
+			true,
+		},
 		{
 			"Download - Fail Copy to Target",
 			args{
@@ -421,7 +547,7 @@ func Test_downloadFile(t *testing.T) {
 				}()
 			}
 
-			if err := downloadFile(tt.args.source, tt.args.destination); (err != nil) != tt.wantErr {
+			if err := downloadFile(download.New(), tt.args.source, tt.args.destination); (err != nil) != tt.wantErr {
 				t.Errorf("downloadFile() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -455,3 +581,39 @@ func TestNewZip(t *testing.T) {
 		})
 	}
 }
+
+func TestRegistration(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        string
+		sourceType string
+	}{
+		{
+			"Extension",
+			"http://example.local/plugin.zip?ver=2",
+			"",
+		},
+		{
+			"Source Type",
+			"http://example.local/download/123",
+			"zip",
+		},
+		{
+			"Magic Bytes",
+			fileServer.URL + "/test.zip",
+			"archive",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := source.Detect(tt.url, tt.sourceType)
+			if err != nil {
+				t.Errorf("source.Detect() error = %v", err)
+				return
+			}
+			if _, ok := got.(*Zip); !ok {
+				t.Errorf("source.Detect() = %T, want *Zip", got)
+			}
+		})
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"io"
 	"os"
+
+	"github.com/wptide/pkg/metrics"
 )
 
 var (
@@ -32,7 +34,8 @@ func (p Provider) CollectionRef() string {
 }
 
 // UploadFile puts the given file to the storage provider.
-func (p Provider) UploadFile(filename, reference string) error {
+func (p Provider) UploadFile(filename, reference string) (err error) {
+	defer metrics.Start(metrics.StorageUploads, metrics.Labels{"provider": "gcs"})(&err)
 
 	// Open file for writing to Cloud Storage.
 	file, err := fileOpen(filename)
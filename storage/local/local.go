@@ -1,13 +1,18 @@
 package local
 
 import (
+	"context"
+	"errors"
 	"io"
 	"os"
+
+	"github.com/wptide/pkg/metrics"
 )
 
 var (
 	fileCreate = os.Create
 	fileOpen   = os.Open
+	fileStat   = os.Stat
 )
 
 // Provider is a local storage provider.
@@ -27,12 +32,26 @@ func (p Provider) CollectionRef() string {
 }
 
 // UploadFile copies the file to a destination.
-func (p Provider) UploadFile(filename, reference string) error {
+func (p Provider) UploadFile(filename, reference string) (err error) {
+	defer metrics.Start(metrics.StorageUploads, metrics.Labels{"provider": "local"})(&err)
+
 	// Copy to "uploads" folder.
 	dest := p.serverPath + "/" + reference
 	return copyFile(filename, dest)
 }
 
+// Ping checks that the storage folder exists.
+func (p Provider) Ping(ctx context.Context) error {
+	info, err := fileStat(p.serverPath)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return errors.New(p.serverPath + " is not a folder")
+	}
+	return nil
+}
+
 // DownloadFile copies the file from the storage provider.
 func (p Provider) DownloadFile(reference, filename string) error {
 	// Copy from "uploads" folder.
@@ -1,6 +1,7 @@
 package local
 
 import (
+	"context"
 	"reflect"
 	"testing"
 )
@@ -95,6 +96,46 @@ func TestProvider_UploadFile(t *testing.T) {
 	}
 }
 
+func TestProvider_Ping(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       Provider
+		wantErr bool
+	}{
+		{
+			"Folder",
+			Provider{
+				"./testdata/dest_bucket",
+				"subdir",
+			},
+			false,
+		},
+		{
+			"File",
+			Provider{
+				"./testdata/source_bucket/upload.txt",
+				"subdir",
+			},
+			true,
+		},
+		{
+			"Missing",
+			Provider{
+				"./testdata/missing_bucket",
+				"subdir",
+			},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.p.Ping(context.Background()); (err != nil) != tt.wantErr {
+				t.Errorf("Provider.Ping() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestProvider_DownloadFile(t *testing.T) {
 	type args struct {
 		reference string
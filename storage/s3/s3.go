@@ -9,6 +9,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
+	"github.com/wptide/pkg/metrics"
 )
 
 var (
@@ -35,7 +36,8 @@ func (s3p Provider) CollectionRef() string {
 }
 
 // UploadFile puts a file in the relevant bucket.
-func (s3p Provider) UploadFile(filename, reference string) error {
+func (s3p Provider) UploadFile(filename, reference string) (err error) {
+	defer metrics.Start(metrics.StorageUploads, metrics.Labels{"provider": "s3"})(&err)
 
 	// Open file for writing to S3.
 	file, err := fileOpen(filename)
@@ -66,6 +66,8 @@ type AuditResult struct {
 	IncompatibleVersions []string               `json:"incompatible_versions,omitempty"`
 	PhpcsVersions        map[string]string      `json:"phpcs_versions,omitempty"`
 	Error                string                 `json:"error,omitempty"`
+	ExitCode             int                    `json:"exit_code,omitempty"` // Exit code of a failed audit command.
+	Stderr               string                 `json:"stderr,omitempty"`    // End of the error output of a failed audit command.
 	Extra                map[string]interface{} `json:"extra,omitempty"`
 }
 
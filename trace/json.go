@@ -0,0 +1,40 @@
+package trace
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// JSONExporter writes every span as a line of JSON, e.g. to a file or stderr.
+type JSONExporter struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+// jsonSpan is a span as it is written by the JSONExporter.
+type jsonSpan struct {
+	*Span
+	Duration int64 `json:"duration_ms"`
+}
+
+// NewJSONExporter returns an exporter that writes to w.
+func NewJSONExporter(w io.Writer) *JSONExporter {
+	return &JSONExporter{
+		w: w,
+	}
+}
+
+// Export writes the span.
+func (e *JSONExporter) Export(span *Span) error {
+	line, err := json.Marshal(jsonSpan{span, span.Duration().Nanoseconds() / 1e6})
+	if err != nil {
+		return err
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	_, err = e.w.Write(append(line, '\n'))
+	return err
+}
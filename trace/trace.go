@@ -0,0 +1,171 @@
+// Package trace records spans of the steps of a job, e.g. the download of the source or an audit,
+// so that it is possible to see where the time went.
+//
+// Spans of a job are linked by the trace ID of its message, which is carried in message.Message across
+// queue hops. Spans are exported to the default Exporter, which drops them until it is replaced, e.g.:
+//
+//	trace.SetExporter(trace.NewJSONExporter(os.Stderr))
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Span is a timed step of a job.
+type Span struct {
+	TraceID    string            `json:"trace_id"`
+	SpanID     string            `json:"span_id"`
+	ParentID   string            `json:"parent_id,omitempty"`
+	Name       string            `json:"name"`
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	mutex      sync.Mutex
+	ended      bool
+}
+
+// Exporter exports spans once they ended.
+type Exporter interface {
+	Export(span *Span) error
+}
+
+// ExporterFunc is a function that implements Exporter.
+type ExporterFunc func(span *Span) error
+
+// Export calls f(span).
+func (f ExporterFunc) Export(span *Span) error {
+	return f(span)
+}
+
+// Nop is an Exporter that drops spans. It is the default Exporter.
+type Nop struct{}
+
+// Export does nothing.
+func (Nop) Export(span *Span) error {
+	return nil
+}
+
+var (
+	exporterMutex sync.RWMutex
+	exporter      Exporter = Nop{}
+)
+
+// SetExporter replaces the default Exporter. Setting nil drops spans again.
+func SetExporter(e Exporter) {
+	if e == nil {
+		e = Nop{}
+	}
+
+	exporterMutex.Lock()
+	defer exporterMutex.Unlock()
+	exporter = e
+}
+
+// Default returns the default Exporter.
+func Default() Exporter {
+	exporterMutex.RLock()
+	defer exporterMutex.RUnlock()
+	return exporter
+}
+
+type contextKey int
+
+const (
+	spanKey contextKey = iota
+	traceIDKey
+)
+
+// ContextWithSpan returns a context with the span, spans started from it are children of the span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey, span)
+}
+
+// FromContext returns the span of the context, or nil.
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey).(*Span)
+	return span
+}
+
+// WithTraceID returns a context with a trace ID, spans started from it without a parent span use it.
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceIDKey, traceID)
+}
+
+// Start starts a span. The span is a child of the span of ctx, if there is one. Otherwise it starts
+// the trace with the trace ID of ctx, or a new trace ID.
+// The returned context carries the span, to start children of it.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	span := &Span{
+		SpanID: newID(8),
+		Name:   name,
+		Start:  time.Now(),
+	}
+
+	if parent := FromContext(ctx); parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentID = parent.SpanID
+	} else if traceID, _ := ctx.Value(traceIDKey).(string); traceID != "" {
+		span.TraceID = traceID
+	} else {
+		span.TraceID = NewTraceID()
+	}
+
+	return ContextWithSpan(ctx, span), span
+}
+
+// SetAttribute adds an attribute to the span, e.g. the standard of an audit.
+func (s *Span) SetAttribute(key, value string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]string)
+	}
+	s.Attributes[key] = value
+}
+
+// Finish ends the span with the error of the step, if any, and exports it.
+// Only the first call ends the span.
+func (s *Span) Finish(err error) {
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	if err != nil {
+		s.Error = err.Error()
+	}
+	s.mutex.Unlock()
+
+	Default().Export(s)
+}
+
+// Duration returns how long the span took.
+func (s *Span) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// NewTraceID returns a random trace ID.
+func NewTraceID() string {
+	return newID(16)
+}
+
+func newID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
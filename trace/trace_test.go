@@ -0,0 +1,136 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// collect replaces the default exporter with one that keeps the spans.
+func collect() (*[]*Span, func()) {
+	var mutex sync.Mutex
+	spans := &[]*Span{}
+	SetExporter(ExporterFunc(func(span *Span) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		*spans = append(*spans, span)
+		return nil
+	}))
+	return spans, func() {
+		SetExporter(nil)
+	}
+}
+
+func TestStart(t *testing.T) {
+	parentCtx, parent := Start(WithTraceID(context.Background(), "trace"), "parent")
+
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		wantTraceID string
+		wantParent  string
+	}{
+		{
+			"Child",
+			parentCtx,
+			"trace",
+			parent.SpanID,
+		},
+		{
+			"Trace ID",
+			WithTraceID(context.Background(), "other"),
+			"other",
+			"",
+		},
+		{
+			"New Trace",
+			nil,
+			"",
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, span := Start(tt.ctx, "child")
+
+			if FromContext(ctx) != span {
+				t.Errorf("Start() context span = %v, want %v", FromContext(ctx), span)
+			}
+			if tt.wantTraceID != "" && span.TraceID != tt.wantTraceID {
+				t.Errorf("Start() TraceID = %v, want %v", span.TraceID, tt.wantTraceID)
+			}
+			if span.TraceID == "" {
+				t.Errorf("Start() TraceID is empty")
+			}
+			if span.ParentID != tt.wantParent {
+				t.Errorf("Start() ParentID = %v, want %v", span.ParentID, tt.wantParent)
+			}
+		})
+	}
+}
+
+func TestSpan_Finish(t *testing.T) {
+	spans, reset := collect()
+	defer reset()
+
+	_, span := Start(nil, "upload")
+	span.SetAttribute("provider", "local")
+	span.Finish(errors.New("upload failed"))
+	span.Finish(nil)
+
+	if len(*spans) != 1 {
+		t.Fatalf("Span.Finish() exported %d spans, want 1", len(*spans))
+	}
+	if span.Error != "upload failed" {
+		t.Errorf("Span.Finish() Error = %v, want %v", span.Error, "upload failed")
+	}
+	if span.End.Before(span.Start) {
+		t.Errorf("Span.Finish() End = %v, before Start %v", span.End, span.Start)
+	}
+	if span.Attributes["provider"] != "local" {
+		t.Errorf("Span.SetAttribute() Attributes = %v", span.Attributes)
+	}
+}
+
+func TestJSONExporter_Export(t *testing.T) {
+	var b strings.Builder
+	SetExporter(NewJSONExporter(&b))
+	defer SetExporter(nil)
+
+	ctx, parent := Start(WithTraceID(context.Background(), "trace"), "message")
+	_, child := Start(ctx, "download")
+	child.Finish(nil)
+	parent.Finish(nil)
+
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("JSONExporter.Export() lines = %q, want 2 lines", lines)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatalf("JSONExporter.Export() invalid JSON: %v", err)
+	}
+	for key, want := range map[string]interface{}{
+		"trace_id":  "trace",
+		"name":      "download",
+		"parent_id": parent.SpanID,
+	} {
+		if got[key] != want {
+			t.Errorf("JSONExporter.Export() %s = %v, want %v", key, got[key], want)
+		}
+	}
+	if _, ok := got["duration_ms"]; !ok {
+		t.Errorf("JSONExporter.Export() duration_ms is missing")
+	}
+}
+
+func TestSetExporter(t *testing.T) {
+	SetExporter(nil)
+	if _, ok := Default().(Nop); !ok {
+		t.Errorf("SetExporter(nil) Default() = %T, want Nop", Default())
+	}
+}
@@ -0,0 +1,185 @@
+// Package workspace gives every job its own folder and cleans up after it.
+package workspace
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+/*
+ * Constants to represent the policies for keeping workspaces when a job finishes.
+ *
+ * KeepNone removes every workspace.
+ * KeepFailed keeps the workspaces of failed jobs so that they can be debugged.
+ * KeepAll keeps every workspace.
+ */
+const (
+	KeepNone = iota
+	KeepFailed
+	KeepAll
+)
+
+// failedMarker is created in kept workspaces of failed jobs.
+const failedMarker = ".failed"
+
+var (
+	// Using os.RemoveAll as a variable so that we can mock it in tests.
+	removeAll = os.RemoveAll
+)
+
+// Manager creates workspaces in a root folder.
+type Manager struct {
+	Root    string // Folder where workspaces are created.
+	Policy  int    // Which workspaces to keep when a job finishes.
+	MaxKept int    // Maximum number of kept failed workspaces, oldest are removed first. 0 means no limit.
+	mutex   sync.Mutex
+}
+
+// NewManager returns a new Manager.
+func NewManager(root string, policy int) *Manager {
+	return &Manager{
+		Root:   root,
+		Policy: policy,
+	}
+}
+
+// Create creates a new workspace with a unique folder.
+func (m *Manager) Create() (*Workspace, error) {
+	if err := os.MkdirAll(m.Root, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	path, err := ioutil.TempDir(m.Root, "job-")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Workspace{
+		ID:      filepath.Base(path),
+		Path:    path,
+		manager: m,
+		refs:    1,
+	}, nil
+}
+
+// prune removes the oldest kept failed workspaces if there are more than MaxKept.
+func (m *Manager) prune() {
+	if m.MaxKept <= 0 {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	markers, _ := filepath.Glob(filepath.Join(m.Root, "job-*", failedMarker))
+	if len(markers) <= m.MaxKept {
+		return
+	}
+
+	// Oldest first.
+	sort.Slice(markers, func(i, j int) bool {
+		a, _ := os.Stat(markers[i])
+		b, _ := os.Stat(markers[j])
+		if a == nil || b == nil {
+			return a == nil
+		}
+		return a.ModTime().Before(b.ModTime())
+	})
+
+	for _, marker := range markers[:len(markers)-m.MaxKept] {
+		removeAll(filepath.Dir(marker))
+	}
+}
+
+// Workspace is the folder of a single job, together with the temp files the job created elsewhere.
+type Workspace struct {
+	ID      string // Unique ID of the workspace.
+	Path    string // Folder of the workspace.
+	manager *Manager
+	mutex   sync.Mutex
+	files   []string
+	refs    int
+	failed  bool
+}
+
+// File returns the path for a file in the workspace.
+func (w *Workspace) File(name string) string {
+	return filepath.Join(w.Path, name)
+}
+
+// Track adds a temp file or folder outside of the workspace folder that needs to be removed with the workspace.
+// Paths that are already tracked, and the workspace folder itself, are ignored.
+func (w *Workspace) Track(path string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if filepath.Clean(path) == filepath.Clean(w.Path) {
+		return
+	}
+	for _, file := range w.files {
+		if file == path {
+			return
+		}
+	}
+	w.files = append(w.files, path)
+}
+
+// Files returns the tracked temp files.
+func (w *Workspace) Files() []string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	files := make([]string, len(w.files))
+	copy(files, w.files)
+	return files
+}
+
+// Share adds n users of the workspace, each of them needs to Close it before it is removed.
+func (w *Workspace) Share(n int) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.refs += n
+}
+
+// Close removes the workspace and the tracked files once every user closed it, unless the
+// policy keeps them. The workspace counts as failed if any of its users failed.
+// Closing a workspace more often than it has users does nothing.
+func (w *Workspace) Close(failed bool) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.refs <= 0 {
+		return nil
+	}
+	w.refs--
+	w.failed = w.failed || failed
+
+	if w.refs > 0 {
+		return nil
+	}
+
+	switch {
+	case w.manager.Policy == KeepAll:
+		return nil
+	case w.manager.Policy == KeepFailed && w.failed:
+		err := ioutil.WriteFile(w.File(failedMarker), nil, 0644)
+		w.manager.prune()
+		return err
+	}
+
+	var lastErr error
+	for _, file := range w.files {
+		if err := removeAll(file); err != nil {
+			lastErr = err
+		}
+	}
+	if err := removeAll(w.Path); err != nil {
+		lastErr = err
+	}
+
+	return lastErr
+}
@@ -0,0 +1,205 @@
+package workspace
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestManager_Create(t *testing.T) {
+
+	root := "./testdata/workspaces"
+	defer os.RemoveAll("./testdata")
+
+	m := NewManager(root, KeepNone)
+
+	a, err := m.Create()
+	if err != nil {
+		t.Errorf("Manager.Create() error = %v", err)
+		return
+	}
+	b, _ := m.Create()
+
+	if a.Path == b.Path || a.ID == b.ID {
+		t.Errorf("Manager.Create() = %v and %v, want unique workspaces", a.Path, b.Path)
+	}
+	if !exists(a.Path) || !exists(b.Path) {
+		t.Errorf("Manager.Create() did not create workspace folders")
+	}
+	if got, want := a.File("report.json"), filepath.Join(a.Path, "report.json"); got != want {
+		t.Errorf("Workspace.File() = %v, want %v", got, want)
+	}
+
+	// The root can't be created inside a file.
+	ioutil.WriteFile("./testdata/file", nil, 0644)
+	if _, err := NewManager("./testdata/file/workspaces", KeepNone).Create(); err == nil {
+		t.Errorf("Manager.Create() error = nil, want error")
+	}
+}
+
+func TestWorkspace_Close(t *testing.T) {
+
+	root := "./testdata/workspaces"
+	defer os.RemoveAll("./testdata")
+
+	tests := []struct {
+		name       string
+		policy     int
+		failed     bool
+		wantKept   bool
+		wantMarker bool
+	}{
+		{
+			"Keep None - Success",
+			KeepNone,
+			false,
+			false,
+			false,
+		},
+		{
+			"Keep None - Failed",
+			KeepNone,
+			true,
+			false,
+			false,
+		},
+		{
+			"Keep Failed - Success",
+			KeepFailed,
+			false,
+			false,
+			false,
+		},
+		{
+			"Keep Failed - Failed",
+			KeepFailed,
+			true,
+			true,
+			true,
+		},
+		{
+			"Keep All - Success",
+			KeepAll,
+			false,
+			true,
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws, _ := NewManager(root, tt.policy).Create()
+
+			ioutil.WriteFile(ws.File("report.json"), []byte("{}"), 0644)
+
+			tracked := filepath.Join(root, ws.ID+"-tracked.json")
+			ioutil.WriteFile(tracked, []byte("{}"), 0644)
+			ws.Track(tracked)
+
+			// Tracking a file again, or the workspace itself, does nothing.
+			ws.Track(tracked)
+			ws.Track(ws.Path)
+
+			if err := ws.Close(tt.failed); err != nil {
+				t.Errorf("Workspace.Close() error = %v", err)
+			}
+
+			// Closing again does nothing.
+			if err := ws.Close(false); err != nil {
+				t.Errorf("Workspace.Close() error = %v", err)
+			}
+
+			if got := exists(ws.File("report.json")); got != tt.wantKept {
+				t.Errorf("Workspace.Close() kept workspace = %v, want %v", got, tt.wantKept)
+			}
+			if got := exists(tracked); got != tt.wantKept {
+				t.Errorf("Workspace.Close() kept tracked file = %v, want %v", got, tt.wantKept)
+			}
+			if got := exists(ws.File(failedMarker)); got != tt.wantMarker {
+				t.Errorf("Workspace.Close() failed marker = %v, want %v", got, tt.wantMarker)
+			}
+			if len(ws.Files()) != 1 {
+				t.Errorf("Workspace.Files() = %v, want 1 file", ws.Files())
+			}
+		})
+	}
+}
+
+func TestManager_MaxKept(t *testing.T) {
+
+	root := "./testdata/workspaces"
+	defer os.RemoveAll("./testdata")
+
+	m := NewManager(root, KeepFailed)
+	m.MaxKept = 2
+
+	var workspaces []*Workspace
+	for i := 0; i < 3; i++ {
+		ws, _ := m.Create()
+		workspaces = append(workspaces, ws)
+		ws.Close(true)
+
+		// Make sure every marker has a different time.
+		past := time.Now().Add(time.Duration(i-10) * time.Minute)
+		os.Chtimes(ws.File(failedMarker), past, past)
+	}
+
+	// Every close beyond MaxKept removes the oldest failed workspace.
+	ws, _ := m.Create()
+	ws.Close(true)
+
+	want := []bool{false, false, true, true}
+	for i, ws := range append(workspaces, ws) {
+		if got := exists(ws.Path); got != want[i] {
+			t.Errorf("Manager.prune() kept workspace %d = %v, want %v", i, got, want[i])
+		}
+	}
+}
+
+func TestWorkspace_Share(t *testing.T) {
+
+	root := "./testdata/workspaces"
+	defer os.RemoveAll("./testdata")
+
+	tests := []struct {
+		name     string
+		policy   int
+		failed   []bool
+		wantKept bool
+	}{
+		{
+			"All Succeeded",
+			KeepFailed,
+			[]bool{false, false, false},
+			false,
+		},
+		{
+			"One Failed",
+			KeepFailed,
+			[]bool{false, true, false},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws, _ := NewManager(root, tt.policy).Create()
+			ws.Share(len(tt.failed) - 1)
+
+			for i, failed := range tt.failed {
+				ws.Close(failed)
+
+				// Only the last user removes the workspace.
+				last := i == len(tt.failed)-1
+				if got := exists(ws.Path); got != (!last || tt.wantKept) {
+					t.Errorf("Workspace.Close() %d kept workspace = %v", i, got)
+				}
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package mongo
 import (
 	"context"
 	"errors"
+	"time"
+
 	"github.com/mongodb/mongo-go-driver/bson"
 	"github.com/mongodb/mongo-go-driver/core/option"
 	"github.com/mongodb/mongo-go-driver/mongo"
@@ -133,6 +135,21 @@ func (c WrapperCollection) FindOneAndDelete(ctx context.Context, filter interfac
 	return docResult
 }
 
+// Indexer is implemented by collections that can create indexes.
+type Indexer interface {
+	EnsureTTLIndex(ctx context.Context, field string, ttl time.Duration) error
+}
+
+// EnsureTTLIndex creates an index that makes MongoDB remove documents once the time in the field is
+// older than ttl. It fails if the field already has an index with other options.
+func (c WrapperCollection) EnsureTTLIndex(ctx context.Context, field string, ttl time.Duration) error {
+	_, err := c.Collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.NewDocument(bson.EC.Int32(field, 1)),
+		Options: bson.NewDocument(bson.EC.Int32("expireAfterSeconds", int32(ttl/time.Second))),
+	})
+	return err
+}
+
 // InsertOneResultLayer is an empty interface. No methods are required for this.
 // Everything implements this.
 type InsertOneResultLayer interface{}